@@ -527,14 +527,9 @@ func dump(ctx *cli.Context) error {
 	return nil
 }
 
+// inspect is kept for compatibility, it is the same as "geth db inspect" over the local database
 func inspect(ctx *cli.Context) error {
-	node, _ := makeConfigNode(ctx)
-	defer node.Close()
-
-	_, chainDb := utils.MakeChain(ctx, node)
-	defer chainDb.Close()
-
-	return ethdb.InspectDatabase(chainDb)
+	return dbInspect(ctx)
 }
 
 // hashish returns true for strings that look like hashes.
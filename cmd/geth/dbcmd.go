@@ -0,0 +1,265 @@
+// Copyright 2020 The turbo-geth Authors
+// This file is part of turbo-geth.
+//
+// turbo-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// turbo-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with turbo-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/migrations"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+var (
+	dryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Apply the migrations in memory and discard the changes",
+	}
+	remoteDbAddrFlag = cli.StringFlag{
+		Name:  "remote-db-addr",
+		Usage: "Network address of the remote database server of a running node (for example, localhost:9999), the local database is inspected if empty",
+	}
+	remoteDbServerCACertFlag = cli.StringFlag{
+		Name:  "remote-db-server-cacert",
+		Usage: "CA certificate file to verify the remote database server against, enables TLS",
+	}
+	remoteDbClientCertFlag = cli.StringFlag{
+		Name:  "remote-db-client-cert",
+		Usage: "Client certificate file for the remote database server (mutual TLS)",
+	}
+	remoteDbClientKeyFlag = cli.StringFlag{
+		Name:  "remote-db-client-key",
+		Usage: "Client private key file for the remote database server (mutual TLS)",
+	}
+	jsonFlag = cli.BoolFlag{
+		Name:  "json",
+		Usage: "Print the statistics as JSON",
+	}
+
+	dbCommand = cli.Command{
+		Name:     "db",
+		Usage:    "Manage the chain database",
+		Category: "BLOCKCHAIN COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "inspect",
+				Usage:  "Print the number and the sizes of the keys and values of every bucket",
+				Action: utils.MigrateFlags(dbInspect),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.SyncModeFlag,
+					remoteDbAddrFlag,
+					utils.RemoteDbTokenFlag,
+					remoteDbServerCACertFlag,
+					remoteDbClientCertFlag,
+					remoteDbClientKeyFlag,
+					jsonFlag,
+				},
+				Description: `
+    geth db inspect [--remote-db-addr <address>] [--json]
+
+Walks all of the buckets and prints the number of the keys, the sizes of the keys
+and values and their histograms. The keys of the state, the history, the contract
+code and the intermediate hashes buckets are also broken down by their kind.
+Only the keys and the sizes of the values are read, so that with --remote-db-addr
+it can run against the remote database of a running node.`,
+			},
+			{
+				Name:  "migrations",
+				Usage: "Manage the database migrations",
+				Description: `
+The migrations are applied on the start of the node, these commands show
+and apply them without starting it.`,
+				Subcommands: []cli.Command{
+					{
+						Name:   "list",
+						Usage:  "Print the migrations and whether they are applied",
+						Action: utils.MigrateFlags(migrationsList),
+						Flags: []cli.Flag{
+							utils.DataDirFlag,
+							utils.SyncModeFlag,
+						},
+					},
+					{
+						Name:   "apply",
+						Usage:  "Apply the pending migrations",
+						Action: utils.MigrateFlags(migrationsApply),
+						Flags: []cli.Flag{
+							utils.DataDirFlag,
+							utils.SyncModeFlag,
+							dryRunFlag,
+						},
+						Description: `
+    geth db migrations apply [--dry-run]
+
+Applies the migrations with the storage mode the database was created with.
+With --dry-run the migrations are applied in memory and the changes are discarded.`,
+					},
+				},
+			},
+		},
+	}
+)
+
+func migrationsList(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	statuses, err := migrations.NewMigrator().Status(chainDb)
+	if err != nil {
+		utils.Fatalf("Could not read the migrations: %v", err)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Migration", "Status"})
+	for _, s := range statuses {
+		status := "pending"
+		switch {
+		case s.Applied:
+			status = "applied"
+		case s.Progress != nil:
+			status = fmt.Sprintf("in progress (%x)", s.Progress)
+		}
+		table.Append([]string{s.Name, status})
+	}
+	table.Render()
+	return nil
+}
+
+func migrationsApply(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	sm, err := ethdb.GetStorageModeFromDB(chainDb)
+	if err != nil {
+		utils.Fatalf("Could not read the storage mode: %v", err)
+	}
+	migrator := migrations.NewMigrator()
+	if ctx.Bool(dryRunFlag.Name) {
+		names, err := migrator.DryRun(chainDb, sm)
+		if err != nil {
+			utils.Fatalf("Dry run failed: %v", err)
+		}
+		log.Info("Dry run succeeded", "mode", sm.ToString(), "migrations", names)
+		return nil
+	}
+	if err := migrator.Apply(chainDb, sm); err != nil {
+		utils.Fatalf("Could not apply the migrations: %v", err)
+	}
+	log.Info("Migrations applied", "mode", sm.ToString())
+	return nil
+}
+
+func dbInspect(ctx *cli.Context) error {
+	var kv ethdb.KV
+	if addr := ctx.String(remoteDbAddrFlag.Name); addr != "" {
+		opts := ethdb.NewRemote().Path(addr).Token(ctx.GlobalString(utils.RemoteDbTokenFlag.Name))
+		if caCert := ctx.String(remoteDbServerCACertFlag.Name); caCert != "" {
+			tlsConfig, err := remote.NewClientTLSConfig(ctx.String(remoteDbClientCertFlag.Name), ctx.String(remoteDbClientKeyFlag.Name), caCert)
+			if err != nil {
+				utils.Fatalf("Could not load TLS configuration for the remote database: %v", err)
+			}
+			opts = opts.TLS(tlsConfig)
+		}
+		var err error
+		if kv, err = opts.Open(context.Background()); err != nil {
+			utils.Fatalf("Could not connect to the remote database: %v", err)
+		}
+		defer kv.Close()
+	} else {
+		stack, _ := makeConfigNode(ctx)
+		defer stack.Close()
+		chainDb := utils.MakeChainDatabase(ctx, stack)
+		defer chainDb.Close()
+		hasKV, ok := chainDb.(ethdb.HasAbstractKV)
+		if !ok {
+			utils.Fatalf("The database does not support the inspection")
+		}
+		kv = hasKV.AbstractKV()
+	}
+
+	stats, err := ethdb.InspectDatabase(context.Background(), kv, dbutils.Buckets)
+	if err != nil {
+		utils.Fatalf("Could not inspect the database: %v", err)
+	}
+	if ctx.Bool(jsonFlag.Name) {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+	printInspectStats(stats)
+	return nil
+}
+
+// printInspectStats prints the sizes of the buckets, broken down by the kinds of the keys, and the size histograms
+func printInspectStats(stats []*ethdb.BucketStats) {
+	row := func(bucket, kind string, s ethdb.KeyStats) []string {
+		return []string{bucket, kind, strconv.FormatUint(s.Keys, 10), common.StorageSize(s.KeySize).String(), common.StorageSize(s.ValueSize).String()}
+	}
+	var total ethdb.KeyStats
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Bucket", "Key type", "Keys", "Key size", "Value size"})
+	for _, s := range stats {
+		total.Keys += s.Keys
+		total.KeySize += s.KeySize
+		total.ValueSize += s.ValueSize
+		table.Append(row(s.Bucket, "", s.KeyStats))
+		kinds := make([]string, 0, len(s.KeyTypes))
+		for kind := range s.KeyTypes {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			table.Append(row("", kind, *s.KeyTypes[kind]))
+		}
+	}
+	table.SetFooter(row("Total", "", total))
+	table.Render()
+
+	table = tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Bucket", "Size (bytes)", "Keys", "Values"})
+	for _, s := range stats {
+		bucket := s.Bucket
+		for i := range s.KeySizes {
+			if s.KeySizes[i] == 0 && s.ValueSizes[i] == 0 {
+				continue
+			}
+			size := "0"
+			if min, max := ethdb.SizeHistogramRange(i); max > 0 {
+				size = fmt.Sprintf("%d-%d", min, max)
+			}
+			table.Append([]string{bucket, size, strconv.FormatUint(s.KeySizes[i], 10), strconv.FormatUint(s.ValueSizes[i], 10)})
+			// The bucket name is printed in the first row of its histogram only
+			bucket = ""
+		}
+	}
+	table.Render()
+}
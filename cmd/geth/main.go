@@ -96,6 +96,7 @@ var (
 		utils.GCModeLimitFlag,
 		utils.GCModeBlockToPruneFlag,
 		utils.GCModeTickTimeout,
+		utils.GCModeBodiesLimitFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
 		utils.LightKDFFlag,
@@ -109,10 +110,16 @@ var (
 		utils.CacheGCFlag,
 		utils.TrieCacheGenFlag,
 		utils.DownloadOnlyFlag,
+		utils.MGRLeecherFlag,
+		utils.MGRSeederFlag,
 		utils.StorageModeFlag,
 		utils.ArchiveSyncInterval,
 		utils.DatabaseFlag,
 		utils.RemoteDbListenAddress,
+		utils.RemoteDbTLSCertFlag,
+		utils.RemoteDbTLSKeyFlag,
+		utils.RemoteDbTLSCACertFlag,
+		utils.RemoteDbTokenFlag,
 		utils.CacheNoPrefetchFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
@@ -178,6 +185,7 @@ var (
 		utils.IPCPathFlag,
 		utils.InsecureUnlockAllowedFlag,
 		utils.RPCGlobalGasCap,
+		utils.RPCTraceMaxBlocksFlag,
 	}
 
 	metricsFlags = []cli.Flag{
@@ -209,6 +217,8 @@ func init() {
 		dumpCommand,
 		dumpGenesisCommand,
 		inspectCommand,
+		// See dbcmd.go:
+		dbCommand,
 		// See accountcmd.go:
 		accountCommand,
 		walletCommand,
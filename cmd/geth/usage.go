@@ -81,11 +81,14 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.GCModeLimitFlag,
 			utils.GCModeBlockToPruneFlag,
 			utils.GCModeTickTimeout,
+			utils.GCModeBodiesLimitFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
 			utils.WhitelistFlag,
 			utils.DownloadOnlyFlag,
+			utils.MGRLeecherFlag,
+			utils.MGRSeederFlag,
 			utils.StorageModeFlag,
 			utils.ArchiveSyncInterval,
 		},
@@ -169,6 +172,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.RPCPortFlag,
 			utils.RPCApiFlag,
 			utils.RPCGlobalGasCap,
+			utils.RPCTraceMaxBlocksFlag,
 			utils.RPCCORSDomainFlag,
 			utils.RPCVirtualHostsFlag,
 			utils.WSEnabledFlag,
@@ -185,6 +189,10 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.ExecFlag,
 			utils.PreloadJSFlag,
 			utils.RemoteDbListenAddress,
+			utils.RemoteDbTLSCertFlag,
+			utils.RemoteDbTLSKeyFlag,
+			utils.RemoteDbTLSCACertFlag,
+			utils.RemoteDbTokenFlag,
 		},
 	},
 	{
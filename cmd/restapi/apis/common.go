@@ -1,6 +1,7 @@
 package apis
 
 import (
+	"crypto/tls"
 	"errors"
 
 	"github.com/ledgerwatch/turbo-geth/ethdb"
@@ -11,4 +12,6 @@ var ErrEntityNotFound = errors.New("entity not found")
 type Env struct {
 	DB              ethdb.KV
 	RemoteDBAddress string
+	RemoteDBTLS     *tls.Config // Nil means plaintext connection
+	RemoteDBToken   string
 }
@@ -27,7 +27,11 @@ func (e *Env) GetDB(c *gin.Context) {
 
 func (e *Env) PostDB(c *gin.Context) {
 	newAddr := c.Query("host") + ":" + c.Query("port")
-	remoteDB, err := ethdb.NewRemote().Path(newAddr).Open(context.TODO())
+	opts := ethdb.NewRemote().Path(newAddr).Token(e.RemoteDBToken)
+	if e.RemoteDBTLS != nil {
+		opts = opts.TLS(e.RemoteDBTLS)
+	}
+	remoteDB, err := opts.Open(context.TODO())
 	if err != nil {
 		c.Error(err) //nolint:errcheck
 		return
@@ -13,12 +13,17 @@ import (
 )
 
 var (
-	remoteDbAddress string
-	listenAddress   string
+	remoteDbAddress  string
+	listenAddress    string
+	remoteDbSecurity rest.RemoteDBSecurity
 )
 
 func init() {
 	rootCmd.Flags().StringVar(&remoteDbAddress, "remote-db-addr", "localhost:9999", "address of remote DB listener of a turbo-geth node")
+	rootCmd.Flags().StringVar(&remoteDbSecurity.TLSCert, "remote-db-tls-cert", "", "client certificate file for the remote DB (mutual TLS)")
+	rootCmd.Flags().StringVar(&remoteDbSecurity.TLSKey, "remote-db-tls-key", "", "client private key file for the remote DB (mutual TLS)")
+	rootCmd.Flags().StringVar(&remoteDbSecurity.TLSCACert, "remote-db-tls-cacert", "", "CA certificate file to verify the remote DB server against, enables TLS")
+	rootCmd.Flags().StringVar(&remoteDbSecurity.Token, "remote-db-token", "", "pre-shared token of the remote DB listener")
 	rootCmd.Flags().StringVar(&listenAddress, "rpcaddr", "localhost:8080", "REST server listening interface")
 }
 
@@ -26,7 +31,7 @@ var rootCmd = &cobra.Command{
 	Use:   "restapi",
 	Short: "restapi exposes read-only blockchain APIs through REST (requires running turbo-geth node)",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return rest.ServeREST(cmd.Context(), listenAddress, remoteDbAddress)
+		return rest.ServeREST(cmd.Context(), listenAddress, remoteDbAddress, remoteDbSecurity)
 	},
 }
 
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"context"
+	"crypto/tls"
 	"log"
 	"net/http"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ledgerwatch/turbo-geth/cmd/restapi/apis"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
 )
 
 func printError(name string, err error) {
@@ -19,7 +21,15 @@ func printError(name string, err error) {
 	}
 }
 
-func ServeREST(ctx context.Context, localAddress, remoteDBAddress string) error {
+// RemoteDBSecurity holds TLS and authentication settings of the connection to the remote DB
+type RemoteDBSecurity struct {
+	TLSCert   string
+	TLSKey    string
+	TLSCACert string // Empty string means plaintext connection
+	Token     string
+}
+
+func ServeREST(ctx context.Context, localAddress, remoteDBAddress string, security RemoteDBSecurity) error {
 	r := gin.Default()
 	root := r.Group("api/v1")
 	allowCORS(root)
@@ -30,7 +40,18 @@ func ServeREST(ctx context.Context, localAddress, remoteDBAddress string) error
 		}
 	})
 
-	db, err := ethdb.NewRemote().Path(remoteDBAddress).Open(ctx)
+	var tlsConfig *tls.Config
+	if security.TLSCACert != "" {
+		var err error
+		if tlsConfig, err = remote.NewClientTLSConfig(security.TLSCert, security.TLSKey, security.TLSCACert); err != nil {
+			return err
+		}
+	}
+	opts := ethdb.NewRemote().Path(remoteDBAddress).Token(security.Token)
+	if tlsConfig != nil {
+		opts = opts.TLS(tlsConfig)
+	}
+	db, err := opts.Open(ctx)
 	if err != nil {
 		return err
 	}
@@ -38,6 +59,8 @@ func ServeREST(ctx context.Context, localAddress, remoteDBAddress string) error
 	e := &apis.Env{
 		DB:              db,
 		RemoteDBAddress: remoteDBAddress,
+		RemoteDBTLS:     tlsConfig,
+		RemoteDBToken:   security.Token,
 	}
 
 	if err = apis.RegisterRemoteDBAPI(root.Group("remote-db"), e); err != nil {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/big"
 	"strings"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/ledgerwatch/turbo-geth/common"
@@ -15,7 +16,10 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/eth"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
+	"github.com/ledgerwatch/turbo-geth/eth/tracers"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
 	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotechain"
 	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
 	"github.com/ledgerwatch/turbo-geth/log"
@@ -39,6 +43,20 @@ func splitAndTrim(input string) []string {
 type EthAPI interface {
 	BlockNumber(ctx context.Context) (hexutil.Uint64, error)
 	GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error)
+	GetBlockByHash(ctx context.Context, hash common.Hash, fullTx bool) (map[string]interface{}, error)
+	GetBlockTransactionCountByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*hexutil.Uint, error)
+	GetBlockTransactionCountByHash(ctx context.Context, blockHash common.Hash) (*hexutil.Uint, error)
+	GetBalance(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error)
+	GetTransactionCount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Uint64, error)
+	GetCode(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error)
+	GetStorageAt(ctx context.Context, address common.Address, key string, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error)
+	GetTransactionByHash(ctx context.Context, hash common.Hash) (*ethapi.RPCTransaction, error)
+	GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error)
+	Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error)
+	EstimateGas(ctx context.Context, args ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Uint64, error)
+	GetLogs(ctx context.Context, crit filters.FilterCriteria) ([]*types.Log, error)
+	NewHeads(ctx context.Context) (*rpc.Subscription, error)
+	Logs(ctx context.Context, crit filters.FilterCriteria) (*rpc.Subscription, error)
 }
 
 // APIImpl is implementation of the EthAPI interface based on remote Db access
@@ -46,11 +64,26 @@ type APIImpl struct {
 	db           ethdb.KV
 	dbReader     ethdb.Getter
 	chainContext core.ChainContext
+	gasCap       *big.Int      // Gas cap of eth_call and eth_estimateGas, nil means no cap
+	callTimeout  time.Duration // Timeout of eth_call, 0 means no timeout
+	events       *chainEvents  // Source of eth_subscribe notifications, nil if WebSocket is disabled
+	maxLogRange  uint64        // Maximum number of blocks eth_getLogs may query, 0 means no limit
 }
 
 // PrivateDebugAPI
 type PrivateDebugAPI interface {
 	StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex uint64, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (eth.StorageRangeResult, error)
+	TraceTransaction(ctx context.Context, hash common.Hash, config *eth.TraceConfig) (interface{}, error)
+	TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber, config *eth.TraceConfig) ([]*eth.TxTraceResult, error)
+	TraceBlockByHash(ctx context.Context, hash common.Hash, config *eth.TraceConfig) ([]*eth.TxTraceResult, error)
+}
+
+// TraceAPI is the collection of the OpenEthereum-compatible trace_ methods
+type TraceAPI interface {
+	Block(ctx context.Context, number rpc.BlockNumber) ([]*tracers.ParityTrace, error)
+	Transaction(ctx context.Context, hash common.Hash) ([]*tracers.ParityTrace, error)
+	ReplayBlockTransactions(ctx context.Context, number rpc.BlockNumber, traceTypes []string) ([]*tracers.ParityTraceResult, error)
+	Filter(ctx context.Context, req eth.TraceFilterRequest) ([]*tracers.ParityTrace, error)
 }
 
 // APIImpl is implementation of the EthAPI interface based on remote Db access
@@ -61,11 +94,33 @@ type PrivateDebugAPIImpl struct {
 }
 
 // NewAPI returns APIImpl instance
-func NewAPI(db ethdb.KV, dbReader ethdb.Getter, chainContext core.ChainContext) *APIImpl {
+func NewAPI(db ethdb.KV, dbReader ethdb.Getter, chainContext core.ChainContext, gasCap *big.Int, callTimeout time.Duration, events *chainEvents, maxLogRange uint64) *APIImpl {
 	return &APIImpl{
 		db:           db,
 		dbReader:     dbReader,
 		chainContext: chainContext,
+		gasCap:       gasCap,
+		callTimeout:  callTimeout,
+		events:       events,
+		maxLogRange:  maxLogRange,
+	}
+}
+
+// TraceAPIImpl is implementation of the TraceAPI interface based on remote Db access
+type TraceAPIImpl struct {
+	db           ethdb.KV
+	dbReader     ethdb.Getter
+	chainContext core.ChainContext
+	maxBlocks    uint64 // Maximum number of blocks trace_filter may re-execute, 0 means no limit
+}
+
+// NewTraceAPI returns TraceAPIImpl instance
+func NewTraceAPI(db ethdb.KV, dbReader ethdb.Getter, chainContext core.ChainContext, maxBlocks uint64) *TraceAPIImpl {
+	return &TraceAPIImpl{
+		db:           db,
+		dbReader:     dbReader,
+		chainContext: chainContext,
+		maxBlocks:    maxBlocks,
 	}
 }
 
@@ -188,6 +243,22 @@ func (c *chainContext) Engine() consensus.Engine {
 	return &powEngine{}
 }
 
+// getChainConfig reads the chain config stored for the genesis block
+func getChainConfig(tx ethdb.Tx) (*params.ChainConfig, error) {
+	genesisHash, err := remotechain.ReadCanonicalHash(tx, 0)
+	if err != nil {
+		return nil, err
+	}
+	config, err := remotechain.ReadChainConfig(tx, genesisHash)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("chain config not found for genesis %s", genesisHash)
+	}
+	return config, nil
+}
+
 // GetBlockByNumber see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getblockbynumber
 // see internal/ethapi.PublicBlockChainAPI.GetBlockByNumber
 func (api *APIImpl) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
@@ -196,11 +267,21 @@ func (api *APIImpl) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber
 	additionalFields := make(map[string]interface{})
 
 	err = api.db.View(ctx, func(tx ethdb.Tx) error {
-		block, err = remotechain.GetBlockByNumber(tx, uint64(number.Int64()))
+		blockNumber, err := getBlockNumber(number, tx)
+		if err != nil {
+			return err
+		}
+		if err = checkBlockPruned(tx, blockNumber); err != nil {
+			return err
+		}
+		block, err = remotechain.GetBlockByNumber(tx, blockNumber)
 		if err != nil {
 			return err
 		}
-		additionalFields["totalDifficulty"], err = remotechain.ReadTd(tx, block.Hash(), uint64(number.Int64()))
+		if block == nil {
+			return nil
+		}
+		additionalFields["totalDifficulty"], err = remotechain.ReadTd(tx, block.Hash(), blockNumber)
 		if err != nil {
 			return err
 		}
@@ -265,7 +346,16 @@ func daemon(cmd *cobra.Command, cfg Config) {
 	cors := splitAndTrim(cfg.rpcCORSDomain)
 	enabledApis := splitAndTrim(cfg.rpcAPI)
 
-	db, err := ethdb.NewRemote().Path(cfg.remoteDbAddress).Open(cmd.Context())
+	remoteOpts := ethdb.NewRemote().Path(cfg.remoteDbAddress).Token(cfg.remoteDbToken)
+	if cfg.remoteDbCACert != "" {
+		tlsConfig, err := remote.NewClientTLSConfig(cfg.remoteDbTLSCert, cfg.remoteDbTLSKey, cfg.remoteDbCACert)
+		if err != nil {
+			log.Error("Could not load TLS configuration for remoteDb", "error", err)
+			return
+		}
+		remoteOpts = remoteOpts.TLS(tlsConfig)
+	}
+	db, err := remoteOpts.Open(cmd.Context())
 	if err != nil {
 		log.Error("Could not connect to remoteDb", "error", err)
 		return
@@ -275,8 +365,18 @@ func daemon(cmd *cobra.Command, cfg Config) {
 
 	dbReader := ethdb.NewRemoteBoltDatabase(db)
 	chainContext := NewChainContext(dbReader)
-	apiImpl := NewAPI(db, dbReader, chainContext)
+	var gasCap *big.Int
+	if cfg.rpcGasCap > 0 {
+		gasCap = new(big.Int).SetUint64(cfg.rpcGasCap)
+	}
+	var events *chainEvents
+	if cfg.ws {
+		events = newChainEvents(db, cfg.wsPollInterval)
+		go events.run(cmd.Context())
+	}
+	apiImpl := NewAPI(db, dbReader, chainContext, gasCap, cfg.rpcCallTimeout, events, cfg.rpcMaxLogRange)
 	dbgAPIImpl := NewPrivateDebugAPI(db, dbReader, chainContext)
+	traceAPIImpl := NewTraceAPI(db, dbReader, chainContext, cfg.rpcMaxTraceRange)
 
 	for _, enabledAPI := range enabledApis {
 		switch enabledAPI {
@@ -294,6 +394,13 @@ func daemon(cmd *cobra.Command, cfg Config) {
 				Service:   PrivateDebugAPI(dbgAPIImpl),
 				Version:   "1.0",
 			})
+		case "trace":
+			rpcAPI = append(rpcAPI, rpc.API{
+				Namespace: "trace",
+				Public:    true,
+				Service:   TraceAPI(traceAPIImpl),
+				Version:   "1.0",
+			})
 
 		default:
 			log.Error("Unrecognised", "api", enabledAPI)
@@ -309,6 +416,9 @@ func daemon(cmd *cobra.Command, cfg Config) {
 		return
 	}
 	handler := node.NewHTTPHandlerStack(srv, cors, vhosts)
+	if cfg.ws {
+		handler = node.NewWebsocketUpgradeHandler(handler, srv.WebsocketHandler(splitAndTrim(cfg.wsOrigins)))
+	}
 
 	listener, err := node.StartHTTPEndpoint(httpEndpoint, rpc.DefaultHTTPTimeouts, handler)
 	if err != nil {
@@ -317,6 +427,9 @@ func daemon(cmd *cobra.Command, cfg Config) {
 	}
 	extapiURL := fmt.Sprintf("http://%s", httpEndpoint)
 	log.Info("HTTP endpoint opened", "url", extapiURL)
+	if cfg.ws {
+		log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s", httpEndpoint))
+	}
 
 	defer func() {
 		listener.Close()
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// stateAt returns the state after the given block, historical state is read with GetAsOf
+// from the history buckets, the read errors are reported by the Error method of the state
+func (api *APIImpl) stateAt(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.IntraBlockState, error) {
+	var blockNumber uint64
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		blockNumber, err = getBlockNumberOrHash(blockNrOrHash, tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return state.New(state.NewHistoryStateReader(api.dbReader, blockNumber)), nil
+}
+
+// GetBalance see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getbalance
+func (api *APIImpl) GetBalance(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	ibs, err := api.stateAt(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(ibs.GetBalance(address)), ibs.Error()
+}
+
+// GetTransactionCount see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_gettransactioncount
+// The RPC daemon has no transaction pool, so the pending nonce is the nonce in the latest state
+func (api *APIImpl) GetTransactionCount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Uint64, error) {
+	ibs, err := api.stateAt(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	nonce := ibs.GetNonce(address)
+	return (*hexutil.Uint64)(&nonce), ibs.Error()
+}
+
+// GetCode see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getcode
+func (api *APIImpl) GetCode(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	ibs, err := api.stateAt(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return ibs.GetCode(address), ibs.Error()
+}
+
+// GetStorageAt see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getstorageat
+func (api *APIImpl) GetStorageAt(ctx context.Context, address common.Address, key string, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	ibs, err := api.stateAt(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	res := ibs.GetState(address, common.HexToHash(key))
+	return res[:], ibs.Error()
+}
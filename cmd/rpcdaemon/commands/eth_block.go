@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotechain"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// getBlockNumber resolves the latest and pending block numbers to the head of the chain,
+// there is no pending block in the RPC daemon
+func getBlockNumber(number rpc.BlockNumber, tx ethdb.Tx) (uint64, error) {
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		return remotechain.ReadLastBlockNumber(tx)
+	}
+	return uint64(number.Int64()), nil
+}
+
+// getBlockNumberOrHash resolves the block number of rpc.BlockNumberOrHash
+func getBlockNumberOrHash(blockNrOrHash rpc.BlockNumberOrHash, tx ethdb.Tx) (uint64, error) {
+	if number, ok := blockNrOrHash.Number(); ok {
+		return getBlockNumber(number, tx)
+	}
+	hash, ok := blockNrOrHash.Hash()
+	if !ok {
+		return 0, fmt.Errorf("invalid arguments; neither block nor hash specified")
+	}
+	number, err := remotechain.ReadHeaderNumber(tx, hash)
+	if err != nil {
+		return 0, err
+	}
+	if number == nil {
+		return 0, fmt.Errorf("header for hash not found")
+	}
+	if blockNrOrHash.RequireCanonical {
+		canonicalHash, err := remotechain.ReadCanonicalHash(tx, *number)
+		if err != nil {
+			return 0, err
+		}
+		if canonicalHash != hash {
+			return 0, fmt.Errorf("hash %s is not currently canonical", hash)
+		}
+	}
+	return *number, nil
+}
+
+// checkBlockPruned re-implementation of core.CheckBlockPruned
+func checkBlockPruned(tx ethdb.Tx, blockNumber uint64) error {
+	lowest, err := remotechain.ReadLowestAvailableBlock(tx)
+	if err != nil {
+		return err
+	}
+	if blockNumber > 0 && blockNumber < lowest {
+		return fmt.Errorf("%w: block %d is below the lowest available block %d", core.ErrBlockPruned, blockNumber, lowest)
+	}
+	return nil
+}
+
+// GetBlockByHash see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getblockbyhash
+// see internal/ethapi.PublicBlockChainAPI.GetBlockByHash
+func (api *APIImpl) GetBlockByHash(ctx context.Context, hash common.Hash, fullTx bool) (map[string]interface{}, error) {
+	var block *types.Block
+	additionalFields := make(map[string]interface{})
+
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		number, err := remotechain.ReadHeaderNumber(tx, hash)
+		if err != nil || number == nil {
+			return err
+		}
+		if err = checkBlockPruned(tx, *number); err != nil {
+			return err
+		}
+		block, err = remotechain.GetBlockByHash(tx, hash)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return nil
+		}
+		additionalFields["totalDifficulty"], err = remotechain.ReadTd(tx, hash, block.NumberU64())
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if block == nil {
+		return nil, nil
+	}
+	return api.rpcMarshalBlock(block, true, fullTx, additionalFields)
+}
+
+// GetBlockTransactionCountByNumber see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getblocktransactioncountbynumber
+func (api *APIImpl) GetBlockTransactionCountByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*hexutil.Uint, error) {
+	var body *types.Body
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		number, err := getBlockNumber(blockNr, tx)
+		if err != nil {
+			return err
+		}
+		if err = checkBlockPruned(tx, number); err != nil {
+			return err
+		}
+		hash, err := remotechain.ReadCanonicalHash(tx, number)
+		if err != nil {
+			return err
+		}
+		if hash == (common.Hash{}) {
+			return nil
+		}
+		body, err = remotechain.ReadBody(tx, hash, number)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		return nil, nil
+	}
+	n := hexutil.Uint(len(body.Transactions))
+	return &n, nil
+}
+
+// GetBlockTransactionCountByHash see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getblocktransactioncountbyhash
+func (api *APIImpl) GetBlockTransactionCountByHash(ctx context.Context, blockHash common.Hash) (*hexutil.Uint, error) {
+	var body *types.Body
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		number, err := remotechain.ReadHeaderNumber(tx, blockHash)
+		if err != nil {
+			return err
+		}
+		if number == nil {
+			return nil
+		}
+		if err = checkBlockPruned(tx, *number); err != nil {
+			return err
+		}
+		body, err = remotechain.ReadBody(tx, blockHash, *number)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		return nil, nil
+	}
+	n := hexutil.Uint(len(body.Transactions))
+	return &n, nil
+}
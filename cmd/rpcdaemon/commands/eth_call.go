@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotechain"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// Call see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_call
+// see internal/ethapi.PublicBlockChainAPI.Call
+func (api *APIImpl) Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	result, _, _, err := api.doCall(ctx, args, blockNrOrHash, api.callTimeout)
+	return result, err
+}
+
+// EstimateGas see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_estimategas
+// see internal/ethapi.DoEstimateGas, the estimate is made on the latest state unless the block is given
+func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Uint64, error) {
+	bNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	if blockNrOrHash != nil {
+		bNrOrHash = *blockNrOrHash
+	}
+
+	// Binary search the gas requirement, as it may be higher than the amount used
+	var (
+		lo  uint64 = params.TxGas - 1
+		hi  uint64
+		cap uint64
+	)
+	if args.Gas != nil && uint64(*args.Gas) >= params.TxGas {
+		hi = uint64(*args.Gas)
+	} else {
+		// Retrieve the block to act as the gas ceiling
+		var header *types.Header
+		if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+			var err error
+			header, err = getHeaderByNumberOrHash(bNrOrHash, tx)
+			return err
+		}); err != nil {
+			return 0, err
+		}
+		hi = header.GasLimit
+	}
+	if api.gasCap != nil && hi > api.gasCap.Uint64() {
+		log.Warn("Caller gas above allowance, capping", "requested", hi, "cap", api.gasCap)
+		hi = api.gasCap.Uint64()
+	}
+	cap = hi
+
+	// Use zero address if sender unspecified.
+	if args.From == nil {
+		args.From = new(common.Address)
+	}
+	// Create a helper to check if a gas allowance results in an executable transaction
+	executable := func(gas uint64) (bool, error) {
+		args.Gas = (*hexutil.Uint64)(&gas)
+
+		_, _, failed, err := api.doCall(ctx, args, bNrOrHash, api.callTimeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				// The caller has gone, the search would not succeed anyway
+				return false, ctx.Err()
+			}
+			return false, nil
+		}
+		return !failed, nil
+	}
+	// Execute the binary search and hone in on an executable gas limit
+	for lo+1 < hi {
+		mid := (hi + lo) / 2
+		ok, err := executable(mid)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	// Reject the transaction as invalid if it still fails at the highest allowance
+	if hi == cap {
+		ok, err := executable(hi)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, fmt.Errorf("gas required exceeds allowance (%d) or always failing transaction", cap)
+		}
+	}
+	return hexutil.Uint64(hi), nil
+}
+
+// doCall re-implementation of internal/ethapi.DoCall, the state is read as of the given block
+// from the history buckets
+func (api *APIImpl) doCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, timeout time.Duration) ([]byte, uint64, bool, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
+
+	var header *types.Header
+	var chainConfig *params.ChainConfig
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		header, err = getHeaderByNumberOrHash(blockNrOrHash, tx)
+		if err != nil {
+			return err
+		}
+		chainConfig, err = getChainConfig(tx)
+		return err
+	}); err != nil {
+		return nil, 0, false, err
+	}
+	ibs := state.New(state.NewDbState(api.dbReader, header.Number.Uint64()))
+
+	// Setup context so it may be cancelled the call has completed
+	// or, in case of unmetered gas, setup a context with a timeout.
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	// Make sure the context is cancelled when the call has completed
+	// this makes sure resources are cleaned up.
+	defer cancel()
+
+	// Get a new instance of the EVM.
+	msg := args.ToMessage(api.gasCap)
+	evmCtx := core.NewEVMContext(msg, header, api.chainContext, nil)
+	evm := vm.NewEVM(evmCtx, ibs, chainConfig, vm.Config{})
+
+	// Wait for the context to be done and cancel the evm. Even if the
+	// EVM has finished, cancelling may be done (repeatedly)
+	go func() {
+		<-ctx.Done()
+		evm.Cancel()
+	}()
+
+	// Setup the gas pool (also for unmetered requests)
+	// and apply the message.
+	gp := new(core.GasPool).AddGas(math.MaxUint64)
+	res, gas, failed, err := core.ApplyMessage(evm, msg, gp)
+	if err := ibs.Error(); err != nil {
+		return nil, 0, false, err
+	}
+	// If the timer caused an abort, return an appropriate error message
+	if evm.Cancelled() {
+		return nil, 0, false, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+	}
+	return res, gas, failed, err
+}
+
+// getHeaderByNumberOrHash reads the header of the block the call is made on
+func getHeaderByNumberOrHash(blockNrOrHash rpc.BlockNumberOrHash, tx ethdb.Tx) (*types.Header, error) {
+	blockNumber, err := getBlockNumberOrHash(blockNrOrHash, tx)
+	if err != nil {
+		return nil, err
+	}
+	hash, ok := blockNrOrHash.Hash()
+	if !ok {
+		if hash, err = remotechain.ReadCanonicalHash(tx, blockNumber); err != nil {
+			return nil, err
+		}
+	}
+	header, err := remotechain.ReadHeader(tx, hash, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("header not found: %d", blockNumber)
+	}
+	return header, nil
+}
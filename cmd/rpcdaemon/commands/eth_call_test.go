@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallHistoricalState(t *testing.T) {
+	db, _, receipts := newTestChain(t, 2, callContract(t, 1))
+	defer db.Close()
+	api := NewAPI(db.AbstractKV(), db, NewChainContext(db), nil, 0, nil, 0)
+
+	// The whole genesis balance can only be sent before the first transaction paid for the gas
+	from, value := testAddr, big.NewInt(params.Ether)
+	args := ethapi.CallArgs{From: &from, To: &testContract, Value: (*hexutil.Big)(value)}
+	result, err := api.Call(context.Background(), args, rpc.BlockNumberOrHashWithNumber(0))
+	require.NoError(t, err)
+	assert.Equal(t, hexutil.Bytes(common.BigToHash(value).Bytes()), result)
+
+	_, err = api.Call(context.Background(), args, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	assert.Error(t, err, "expected the call at the latest block to fail for insufficient balance")
+
+	args.Value = (*hexutil.Big)(big.NewInt(1))
+	gas, err := api.EstimateGas(context.Background(), args, nil)
+	require.NoError(t, err)
+	assert.Equal(t, hexutil.Uint64(receipts[1][0].GasUsed), gas)
+}
@@ -0,0 +1,230 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotechain"
+)
+
+// GetLogs see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getlogs
+// The blocks are looked up in the log index (see core.WriteLogIndex), the blocks that the index does
+// not cover yet are all checked
+func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([]*types.Log, error) {
+	var from, to uint64
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		if crit.BlockHash != nil {
+			number, err := remotechain.ReadHeaderNumber(tx, *crit.BlockHash)
+			if err != nil {
+				return err
+			}
+			if number == nil {
+				return fmt.Errorf("block not found: %x", *crit.BlockHash)
+			}
+			from, to = *number, *number
+			return nil
+		}
+		latest, err := remotechain.ReadLastBlockNumber(tx)
+		if err != nil {
+			return err
+		}
+		// Negative block numbers are latest and pending, there is no pending block in the RPC daemon
+		from, to = latest, latest
+		if crit.FromBlock != nil && crit.FromBlock.Sign() >= 0 {
+			from = crit.FromBlock.Uint64()
+		}
+		if crit.ToBlock != nil && crit.ToBlock.Sign() >= 0 {
+			to = crit.ToBlock.Uint64()
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if from > to {
+		return []*types.Log{}, nil
+	}
+	if api.maxLogRange > 0 && to-from >= api.maxLogRange {
+		return nil, fmt.Errorf("block range %d..%d exceeds the limit of %d blocks", from, to, api.maxLogRange)
+	}
+
+	// A single block is checked without the index, it may be not canonical
+	blockNumbers := []uint64{from}
+	if crit.BlockHash == nil {
+		var err error
+		if blockNumbers, err = api.logBlocks(from, to, crit.Addresses, crit.Topics); err != nil {
+			return nil, err
+		}
+	}
+
+	logs := []*types.Log{}
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		config, err := getChainConfig(tx)
+		if err != nil {
+			return err
+		}
+		for _, blockNumber := range blockNumbers {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var hash common.Hash
+			if crit.BlockHash != nil {
+				hash = *crit.BlockHash
+			} else {
+				if hash, err = remotechain.ReadCanonicalHash(tx, blockNumber); err != nil {
+					return err
+				}
+				if hash == (common.Hash{}) {
+					return fmt.Errorf("block not found: %d", blockNumber)
+				}
+			}
+			if err := checkBlockPruned(tx, blockNumber); err != nil {
+				return err
+			}
+			receipts, err := remotechain.ReadReceipts(tx, hash, blockNumber, config)
+			if err != nil {
+				return err
+			}
+			for _, receipt := range receipts {
+				logs = append(logs, filterLogs(receipt.Logs, crit.Addresses, crit.Topics)...)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// logBlocks returns the blocks from..to (inclusive) that may have the logs matching the criteria
+func (api *APIImpl) logBlocks(from, to uint64, addresses []common.Address, topics [][]common.Hash) ([]uint64, error) {
+	progress, ok, err := core.ReadLogIndexProgress(api.dbReader)
+	if err != nil {
+		return nil, err
+	}
+	// The blocks above the indexed range are checked one by one
+	if !ok || progress < from {
+		return blockRange(from, to), nil
+	}
+	var unindexed []uint64
+	indexedTo := to
+	if progress < to {
+		indexedTo, unindexed = progress, blockRange(progress+1, to)
+	}
+
+	var sets []map[uint64]struct{}
+	if len(addresses) > 0 {
+		keys := make([][]byte, len(addresses))
+		for i := range addresses {
+			keys[i] = addresses[i][:]
+		}
+		set, err := api.readLogIndex(dbutils.LogAddressIndex, keys, from, indexedTo)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	for _, sub := range topics {
+		if len(sub) == 0 {
+			// Wildcard
+			continue
+		}
+		keys := make([][]byte, len(sub))
+		for i := range sub {
+			keys[i] = sub[i][:]
+		}
+		set, err := api.readLogIndex(dbutils.LogTopicIndex, keys, from, indexedTo)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	if len(sets) == 0 {
+		// No criteria, every block has to be checked
+		return append(blockRange(from, indexedTo), unindexed...), nil
+	}
+
+	// Blocks that match all the criteria
+	var blockNumbers []uint64
+	for blockNumber := range sets[0] {
+		matches := true
+		for _, set := range sets[1:] {
+			if _, ok := set[blockNumber]; !ok {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			blockNumbers = append(blockNumbers, blockNumber)
+		}
+	}
+	sort.Slice(blockNumbers, func(i, j int) bool { return blockNumbers[i] < blockNumbers[j] })
+	return append(blockNumbers, unindexed...), nil
+}
+
+// readLogIndex returns the blocks from..to that have any of the keys in the index
+func (api *APIImpl) readLogIndex(bucket []byte, keys [][]byte, from, to uint64) (map[uint64]struct{}, error) {
+	set := make(map[uint64]struct{})
+	for _, key := range keys {
+		blockNumbers, err := core.ReadLogIndex(api.dbReader, bucket, key, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, blockNumber := range blockNumbers {
+			set[blockNumber] = struct{}{}
+		}
+	}
+	return set, nil
+}
+
+func blockRange(from, to uint64) []uint64 {
+	blockNumbers := make([]uint64, 0, to-from+1)
+	for blockNumber := from; blockNumber <= to; blockNumber++ {
+		blockNumbers = append(blockNumbers, blockNumber)
+	}
+	return blockNumbers
+}
+
+// filterLogs reimplementation of eth/filters.filterLogs, the logs are already in the block range
+func filterLogs(logs []*types.Log, addresses []common.Address, topics [][]common.Hash) []*types.Log {
+	var ret []*types.Log
+Logs:
+	for _, log := range logs {
+		if len(addresses) > 0 && !includes(addresses, log.Address) {
+			continue
+		}
+		// If the to filtered topics is greater than the amount of topics in logs, skip.
+		if len(topics) > len(log.Topics) {
+			continue Logs
+		}
+		for i, sub := range topics {
+			match := len(sub) == 0 // empty rule set == wildcard
+			for _, topic := range sub {
+				if log.Topics[i] == topic {
+					match = true
+					break
+				}
+			}
+			if !match {
+				continue Logs
+			}
+		}
+		ret = append(ret, log)
+	}
+	return ret
+}
+
+func includes(addresses []common.Address, a common.Address) bool {
+	for _, addr := range addresses {
+		if addr == a {
+			return true
+		}
+	}
+	return false
+}
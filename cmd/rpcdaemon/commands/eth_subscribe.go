@@ -0,0 +1,253 @@
+package commands
+
+import (
+	"context"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotechain"
+	"github.com/ledgerwatch/turbo-geth/event"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// maxNotifiedHeaders is the number of the last notified headers kept to find the common ancestor
+// with the new head. It also limits the number of blocks notified at once, when the daemon falls behind
+const maxNotifiedHeaders = 128
+
+// chainEvents polls the head block of the remote database and sends the new headers and logs
+// to the subscribers, it is the counterpart of eth/filters.EventSystem in the node
+type chainEvents struct {
+	db       ethdb.KV
+	interval time.Duration
+
+	headsFeed event.Feed // *types.Header
+	logsFeed  event.Feed // []*types.Log
+
+	notified []*types.Header // The notified part of the chain, ordered by number, the last one is the head
+}
+
+// chainUpdate is the difference between the notified chain and the current one
+type chainUpdate struct {
+	ancestor    int // Index of the common ancestor in the notified headers, -1 if it is not known
+	headers     []*types.Header
+	logs        [][]*types.Log // Logs of the new headers
+	removedLogs [][]*types.Log // Logs of the notified headers after the common ancestor
+}
+
+func newChainEvents(db ethdb.KV, interval time.Duration) *chainEvents {
+	return &chainEvents{db: db, interval: interval}
+}
+
+// run polls the remote database until the context is done
+func (e *chainEvents) run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		if err := e.poll(ctx); err != nil {
+			log.Warn("Could not poll the head block", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *chainEvents) poll(ctx context.Context) error {
+	var update *chainUpdate
+	if err := e.db.View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		update, err = e.readUpdate(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+	if update == nil {
+		return nil
+	}
+
+	if update.ancestor >= 0 {
+		e.notified = e.notified[:update.ancestor+1]
+	} else {
+		e.notified = nil
+	}
+	e.notified = append(e.notified, update.headers...)
+	if len(e.notified) > maxNotifiedHeaders {
+		e.notified = e.notified[len(e.notified)-maxNotifiedHeaders:]
+	}
+
+	for _, logs := range update.removedLogs {
+		if len(logs) > 0 {
+			e.logsFeed.Send(logs)
+		}
+	}
+	for i, header := range update.headers {
+		e.headsFeed.Send(header)
+		if len(update.logs[i]) > 0 {
+			e.logsFeed.Send(update.logs[i])
+		}
+	}
+	return nil
+}
+
+// readUpdate follows the parents of the head block back to the notified chain, returns nil if
+// there is nothing to notify
+func (e *chainEvents) readUpdate(tx ethdb.Tx) (*chainUpdate, error) {
+	headHash, err := remotechain.ReadHeadBlockHash(tx)
+	if err != nil {
+		return nil, err
+	}
+	if (headHash == common.Hash{}) || len(e.notified) > 0 && e.notified[len(e.notified)-1].Hash() == headHash {
+		return nil, nil
+	}
+	number, err := remotechain.ReadHeaderNumber(tx, headHash)
+	if err != nil || number == nil {
+		return nil, err
+	}
+	head, err := remotechain.ReadHeader(tx, headHash, *number)
+	if err != nil || head == nil {
+		return nil, err
+	}
+	if len(e.notified) == 0 {
+		// The chain is notified from the head the daemon has found at the start
+		return &chainUpdate{ancestor: -1, headers: []*types.Header{head}, logs: make([][]*types.Log, 1)}, nil
+	}
+
+	update := &chainUpdate{ancestor: -1}
+	headers := []*types.Header{head}
+	for len(headers) < maxNotifiedHeaders {
+		h := headers[len(headers)-1]
+		if h.Number.Sign() == 0 {
+			break
+		}
+		if update.ancestor = e.notifiedIndex(h.ParentHash, h.Number.Uint64()-1); update.ancestor >= 0 {
+			break
+		}
+		parent, err := remotechain.ReadHeader(tx, h.ParentHash, h.Number.Uint64()-1)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			break
+		}
+		headers = append(headers, parent)
+	}
+	for i := len(headers) - 1; i >= 0; i-- {
+		update.headers = append(update.headers, headers[i])
+	}
+
+	config, err := getChainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if update.ancestor >= 0 {
+		for i := len(e.notified) - 1; i > update.ancestor; i-- {
+			logs, err := readBlockLogs(tx, e.notified[i], config)
+			if err != nil {
+				return nil, err
+			}
+			for _, l := range logs {
+				l.Removed = true
+			}
+			update.removedLogs = append(update.removedLogs, logs)
+		}
+	}
+	for _, header := range update.headers {
+		logs, err := readBlockLogs(tx, header, config)
+		if err != nil {
+			return nil, err
+		}
+		update.logs = append(update.logs, logs)
+	}
+	return update, nil
+}
+
+// notifiedIndex returns the index of the header in the notified headers, or -1 if it is not there
+func (e *chainEvents) notifiedIndex(hash common.Hash, number uint64) int {
+	first := e.notified[0].Number.Uint64()
+	if number < first || number-first >= uint64(len(e.notified)) {
+		return -1
+	}
+	i := int(number - first)
+	if e.notified[i].Hash() != hash {
+		return -1
+	}
+	return i
+}
+
+func readBlockLogs(tx ethdb.Tx, header *types.Header, config *params.ChainConfig) ([]*types.Log, error) {
+	receipts, err := remotechain.ReadReceipts(tx, header.Hash(), header.Number.Uint64(), config)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	for _, receipt := range receipts {
+		logs = append(logs, receipt.Logs...)
+	}
+	return logs, nil
+}
+
+// NewHeads re-implementation of eth/filters.PublicFilterAPI.NewHeads
+func (api *APIImpl) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported || api.events == nil {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+	headers := make(chan *types.Header)
+	headersSub := api.events.headsFeed.Subscribe(headers)
+
+	go func() {
+		defer headersSub.Unsubscribe()
+		for {
+			select {
+			case h := <-headers:
+				notifier.Notify(rpcSub.ID, h)
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// Logs re-implementation of eth/filters.PublicFilterAPI.Logs, the logs of the blocks removed
+// from the chain are sent again with the removed flag
+func (api *APIImpl) Logs(ctx context.Context, crit filters.FilterCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported || api.events == nil {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+	blockLogs := make(chan []*types.Log)
+	logsSub := api.events.logsFeed.Subscribe(blockLogs)
+
+	go func() {
+		defer logsSub.Unsubscribe()
+		for {
+			select {
+			case logs := <-blockLogs:
+				for _, l := range filterLogs(logs, crit.Addresses, crit.Topics) {
+					notifier.Notify(rpcSub.ID, l)
+				}
+			case <-rpcSub.Err(): // client send an unsubscribe request
+				return
+			case <-notifier.Closed(): // connection dropped
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainEventsReorg(t *testing.T) {
+	// The fork shares the first block with the chain and calls the contract with another value after it
+	chain, chainReceipts := generateChain(3, callContract(t, 1))
+	fork, forkReceipts := generateChain(4, func(i int, gen *core.BlockGen) {
+		if i == 0 {
+			callContract(t, 1)(i, gen)
+		} else {
+			callContract(t, 2)(i, gen)
+		}
+	})
+	require.Equal(t, chain[0].Hash(), fork[0].Hash())
+
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	testGenesis().MustCommit(db)
+	for i, block := range chain {
+		rawdb.WriteBlock(context.Background(), db, block)
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), chainReceipts[i])
+	}
+	for i, block := range fork[1:] {
+		rawdb.WriteBlock(context.Background(), db, block)
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), forkReceipts[i+1])
+	}
+
+	events := newChainEvents(db.AbstractKV(), 0)
+	readUpdate := func(head *types.Block) *chainUpdate {
+		rawdb.WriteHeadBlockHash(db, head.Hash())
+		var update *chainUpdate
+		require.NoError(t, db.AbstractKV().View(context.Background(), func(tx ethdb.Tx) error {
+			var err error
+			update, err = events.readUpdate(tx)
+			return err
+		}))
+		require.NoError(t, events.poll(context.Background()))
+		return update
+	}
+	blockHashes := func(blocks ...*types.Block) []common.Hash {
+		var hashes []common.Hash
+		for _, block := range blocks {
+			hashes = append(hashes, block.Hash())
+		}
+		return hashes
+	}
+	headerHashes := func(headers []*types.Header) []common.Hash {
+		var hashes []common.Hash
+		for _, header := range headers {
+			hashes = append(hashes, header.Hash())
+		}
+		return hashes
+	}
+	checkLogs := func(logs []*types.Log, block *types.Block, value int64, removed bool) {
+		require.Len(t, logs, 1)
+		assert.Equal(t, block.Hash(), logs[0].BlockHash)
+		assert.Equal(t, block.NumberU64(), logs[0].BlockNumber)
+		assert.Equal(t, testContract, logs[0].Address)
+		assert.Equal(t, big.NewInt(value), new(big.Int).SetBytes(logs[0].Data))
+		assert.Equal(t, removed, logs[0].Removed)
+	}
+
+	// Only the head found at the start is notified
+	update := readUpdate(chain[0])
+	require.NotNil(t, update)
+	assert.Equal(t, -1, update.ancestor)
+	assert.Equal(t, blockHashes(chain[0]), headerHashes(update.headers))
+	assert.Empty(t, update.removedLogs)
+
+	assert.Nil(t, readUpdate(chain[0]), "the head did not change")
+
+	update = readUpdate(chain[2])
+	require.NotNil(t, update)
+	assert.Equal(t, 0, update.ancestor)
+	assert.Equal(t, blockHashes(chain[1], chain[2]), headerHashes(update.headers))
+	require.Len(t, update.logs, 2)
+	checkLogs(update.logs[0], chain[1], 1, false)
+	checkLogs(update.logs[1], chain[2], 1, false)
+	assert.Empty(t, update.removedLogs)
+	assert.Equal(t, blockHashes(chain...), headerHashes(events.notified))
+
+	// The fork is longer, the logs of the blocks after the first one are removed, starting from the head
+	update = readUpdate(fork[3])
+	require.NotNil(t, update)
+	assert.Equal(t, 0, update.ancestor)
+	assert.Equal(t, blockHashes(fork[1:]...), headerHashes(update.headers))
+	require.Len(t, update.logs, 3)
+	for i, logs := range update.logs {
+		checkLogs(logs, fork[i+1], 2, false)
+	}
+	require.Len(t, update.removedLogs, 2)
+	checkLogs(update.removedLogs[0], chain[2], 1, true)
+	checkLogs(update.removedLogs[1], chain[1], 1, true)
+	assert.Equal(t, blockHashes(fork...), headerHashes(events.notified))
+
+	// Going back to the shorter chain removes the logs of the fork
+	update = readUpdate(chain[2])
+	require.NotNil(t, update)
+	assert.Equal(t, 0, update.ancestor)
+	assert.Equal(t, blockHashes(chain[1], chain[2]), headerHashes(update.headers))
+	require.Len(t, update.removedLogs, 3)
+	for i, logs := range update.removedLogs {
+		checkLogs(logs, fork[3-i], 2, true)
+	}
+	assert.Equal(t, blockHashes(chain...), headerHashes(events.notified))
+}
@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotechain"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// GetTransactionByHash see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_gettransactionbyhash
+func (api *APIImpl) GetTransactionByHash(ctx context.Context, hash common.Hash) (*ethapi.RPCTransaction, error) {
+	var txn *types.Transaction
+	var blockHash common.Hash
+	var blockNumber, txIndex uint64
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		txn, blockHash, blockNumber, txIndex, err = remotechain.ReadTransaction(tx, hash)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if txn == nil {
+		return nil, nil
+	}
+	return ethapi.NewRPCTransaction(txn, blockHash, blockNumber, txIndex), nil
+}
+
+// GetTransactionReceipt see https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_gettransactionreceipt
+// see internal/ethapi.PublicTransactionPoolAPI.GetTransactionReceipt
+// The receipts are stored only in the storage mode with receipts, otherwise they are derived by re-executing the block
+func (api *APIImpl) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
+	var txn *types.Transaction
+	var receipts types.Receipts
+	var block *types.Block
+	var chainConfig *params.ChainConfig
+	var blockHash common.Hash
+	var blockNumber, txIndex uint64
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		txn, blockHash, blockNumber, txIndex, err = remotechain.ReadTransaction(tx, hash)
+		if err != nil {
+			return err
+		}
+		if txn == nil {
+			return nil
+		}
+		chainConfig, err = getChainConfig(tx)
+		if err != nil {
+			return err
+		}
+		receipts, err = remotechain.ReadReceipts(tx, blockHash, blockNumber, chainConfig)
+		if err != nil || receipts != nil {
+			return err
+		}
+		block, err = remotechain.GetBlockByHash(tx, blockHash)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if txn != nil && receipts == nil {
+		if block == nil {
+			return nil, fmt.Errorf("block %#x of transaction %#x not found", blockHash, hash)
+		}
+		var err error
+		if receipts, err = api.deriveReceipts(ctx, block, chainConfig); err != nil {
+			return nil, fmt.Errorf("deriving receipts of block %d: %w", blockNumber, err)
+		}
+	}
+
+	if txn == nil || len(receipts) <= int(txIndex) {
+		return nil, nil
+	}
+	receipt := receipts[txIndex]
+
+	var signer types.Signer = types.FrontierSigner{}
+	if txn.Protected() {
+		signer = types.NewEIP155Signer(txn.ChainId())
+	}
+	from, _ := types.Sender(signer, txn)
+
+	// Now reconstruct the bloom filter
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	fields := map[string]interface{}{
+		"blockHash":         blockHash,
+		"blockNumber":       hexutil.Uint64(blockNumber),
+		"transactionHash":   hash,
+		"transactionIndex":  hexutil.Uint64(txIndex),
+		"from":              from,
+		"to":                txn.To(),
+		"gasUsed":           hexutil.Uint64(receipt.GasUsed),
+		"cumulativeGasUsed": hexutil.Uint64(receipt.CumulativeGasUsed),
+		"contractAddress":   nil,
+		"logs":              receipt.Logs,
+		"logsBloom":         receipt.Bloom,
+	}
+
+	// Assign receipt status or post state.
+	if len(receipt.PostState) > 0 {
+		fields["root"] = hexutil.Bytes(receipt.PostState)
+	} else {
+		fields["status"] = hexutil.Uint(receipt.Status)
+	}
+	if receipt.Logs == nil {
+		fields["logs"] = [][]*types.Log{}
+	}
+	// If the ContractAddress is 20 0x0 bytes, assume it is not a contract creation
+	if receipt.ContractAddress != (common.Address{}) {
+		fields["contractAddress"] = receipt.ContractAddress
+	}
+	return fields, nil
+}
+
+// deriveReceipts re-executes the transactions of the block on the state of its parent, read from the history
+// buckets, and returns their receipts
+func (api *APIImpl) deriveReceipts(ctx context.Context, block *types.Block, chainConfig *params.ChainConfig) (types.Receipts, error) {
+	txs := block.Transactions()
+	receipts := make(types.Receipts, 0, len(txs))
+	if len(txs) == 0 {
+		return receipts, nil
+	}
+	ibs := state.New(state.NewHistoryStateReader(api.dbReader, block.NumberU64()-1))
+	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(ibs)
+	}
+	header := block.Header()
+	gp := new(core.GasPool).AddGas(block.GasLimit())
+	var usedGas uint64
+	for i, txn := range txs {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		ibs.Prepare(txn.Hash(), block.Hash(), i)
+		receipt, err := core.ApplyTransaction(chainConfig, api.chainContext, nil, gp, ibs, state.NewNoopWriter(), header, txn, &usedGas, vm.Config{})
+		if err != nil {
+			return nil, fmt.Errorf("transaction %#x: %w", txn.Hash(), err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	if err := ibs.Error(); err != nil {
+		return nil, err
+	}
+	if err := receipts.DeriveFields(chainConfig, block.Hash(), block.NumberU64(), txs); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTransactionReceiptDerived(t *testing.T) {
+	db, blocks, expected := newTestChain(t, 3, callContract(t, 1, 2))
+	defer db.Close()
+	api := NewAPI(db.AbstractKV(), db, NewChainContext(db), nil, 0, nil, 0)
+
+	for i, block := range blocks {
+		require.Nil(t, rawdb.ReadRawReceipts(db, block.Hash(), block.NumberU64()), "receipts of block %d are stored", block.NumberU64())
+		for j, txn := range block.Transactions() {
+			fields, err := api.GetTransactionReceipt(context.Background(), txn.Hash())
+			require.NoError(t, err)
+			require.NotNil(t, fields, "receipt of transaction %d in block %d", j, block.NumberU64())
+			assert.Equal(t, hexutil.Uint64(expected[i][j].CumulativeGasUsed), fields["cumulativeGasUsed"])
+			assert.Equal(t, hexutil.Uint(types.ReceiptStatusSuccessful), fields["status"])
+			logs := fields["logs"].([]*types.Log)
+			require.Len(t, logs, 1)
+			assert.Equal(t, testContract, logs[0].Address)
+			assert.Equal(t, common.BigToHash(txn.Value()).Bytes(), logs[0].Data)
+			assert.Equal(t, block.Hash(), logs[0].BlockHash)
+			assert.Equal(t, uint(j), logs[0].Index)
+		}
+	}
+
+	fields, err := api.GetTransactionReceipt(context.Background(), common.HexToHash("0x1234"))
+	assert.NoError(t, err)
+	assert.Nil(t, fields)
+}
@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr   = crypto.PubkeyToAddress(testKey.PublicKey)
+	// testContract emits a log with the call value as the data and returns it
+	testContract     = common.HexToAddress("0x1000")
+	testContractCode = []byte{
+		0x34, 0x60, 0x00, 0x52, // MSTORE(0, CALLVALUE)
+		0x60, 0x20, 0x60, 0x00, 0xa0, // LOG0(0, 32)
+		0x60, 0x20, 0x60, 0x00, 0xf3, // RETURN(0, 32)
+	}
+)
+
+// testGenesis is the genesis with the funded test account and the test contract
+func testGenesis() *core.Genesis {
+	return &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			testAddr:     {Balance: big.NewInt(params.Ether)},
+			testContract: {Balance: big.NewInt(0), Code: testContractCode},
+		},
+	}
+}
+
+// generateChain generates n blocks on top of the test genesis without inserting them anywhere
+func generateChain(n int, gen func(int, *core.BlockGen)) ([]*types.Block, []types.Receipts) {
+	gspec := testGenesis()
+	dbGen := ethdb.NewMemDatabase()
+	defer dbGen.Close()
+	genesis := gspec.MustCommit(dbGen)
+	return core.GenerateChain(context.Background(), gspec.Config, genesis, ethash.NewFaker(), dbGen, n, gen)
+}
+
+// newTestChain inserts n blocks generated by gen into the database with the test genesis.
+// The receipts are not stored, as in the default storage mode
+func newTestChain(t *testing.T, n int, gen func(int, *core.BlockGen)) (*ethdb.BoltDatabase, []*types.Block, []types.Receipts) {
+	gspec := testGenesis()
+	blocks, receipts := generateChain(n, gen)
+
+	db := ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+	blockchain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	require.NoError(t, err)
+	defer blockchain.Stop()
+	_, err = blockchain.InsertChain(context.Background(), blocks)
+	require.NoError(t, err)
+	return db, blocks, receipts
+}
+
+// callContract is the block generator calling the test contract with the given values
+func callContract(t *testing.T, values ...int64) func(int, *core.BlockGen) {
+	return func(i int, gen *core.BlockGen) {
+		for _, value := range values {
+			tx, err := types.SignTx(types.NewTransaction(gen.TxNonce(testAddr), testContract, big.NewInt(value), 50000, big.NewInt(1), nil), types.HomesteadSigner{}, testKey)
+			require.NoError(t, err)
+			gen.AddTx(tx)
+		}
+	}
+}
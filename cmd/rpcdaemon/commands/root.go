@@ -10,6 +10,7 @@ import (
 	"runtime/pprof"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -19,11 +20,22 @@ import (
 
 type Config struct {
 	remoteDbAddress  string
+	remoteDbTLSCert  string
+	remoteDbTLSKey   string
+	remoteDbCACert   string
+	remoteDbToken    string
 	rpcListenAddress string
 	rpcPort          int
 	rpcCORSDomain    string
 	rpcVirtualHost   string
 	rpcAPI           string
+	rpcGasCap        uint64
+	rpcCallTimeout   time.Duration
+	rpcMaxLogRange   uint64
+	rpcMaxTraceRange uint64
+	ws               bool
+	wsOrigins        string
+	wsPollInterval   time.Duration
 }
 
 var (
@@ -38,11 +50,22 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile `file`")
 	rootCmd.PersistentFlags().StringVar(&memprofile, "memprofile", "", "write memory profile `file`")
 	rootCmd.Flags().StringVar(&cfg.remoteDbAddress, "remote-db-addr", "localhost:9999", "address of remote DB listener of a turbo-geth node")
+	rootCmd.Flags().StringVar(&cfg.remoteDbTLSCert, "remote-db-tls-cert", "", "client certificate file for the remote DB (mutual TLS)")
+	rootCmd.Flags().StringVar(&cfg.remoteDbTLSKey, "remote-db-tls-key", "", "client private key file for the remote DB (mutual TLS)")
+	rootCmd.Flags().StringVar(&cfg.remoteDbCACert, "remote-db-tls-cacert", "", "CA certificate file to verify the remote DB server against, enables TLS")
+	rootCmd.Flags().StringVar(&cfg.remoteDbToken, "remote-db-token", "", "pre-shared token of the remote DB listener")
 	rootCmd.Flags().StringVar(&cfg.rpcListenAddress, "rpcaddr", node.DefaultHTTPHost, "HTTP-RPC server listening interface")
 	rootCmd.Flags().IntVar(&cfg.rpcPort, "rpcport", node.DefaultHTTPPort, "HTTP-RPC server listening port")
 	rootCmd.Flags().StringVar(&cfg.rpcCORSDomain, "rpccorsdomain", "", "Comma separated list of domains from which to accept cross origin requests (browser enforced)")
 	rootCmd.Flags().StringVar(&cfg.rpcVirtualHost, "rpcvhosts", strings.Join(node.DefaultConfig.HTTPVirtualHosts, ","), "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.")
 	rootCmd.Flags().StringVar(&cfg.rpcAPI, "rpcapi", "", "API's offered over the HTTP-RPC interface")
+	rootCmd.Flags().Uint64Var(&cfg.rpcGasCap, "rpc.gascap", 25000000, "Sets a cap on gas that can be used in eth_call/estimateGas, 0 disables the cap")
+	rootCmd.Flags().DurationVar(&cfg.rpcCallTimeout, "rpc.calltimeout", 5*time.Second, "Timeout of a single eth_call, 0 disables the timeout")
+	rootCmd.Flags().Uint64Var(&cfg.rpcMaxLogRange, "rpc.maxlogrange", 10000, "Maximum number of blocks a single eth_getLogs may query, 0 disables the limit")
+	rootCmd.Flags().Uint64Var(&cfg.rpcMaxTraceRange, "rpc.maxtracerange", 1000, "Maximum number of blocks a single trace_filter may re-execute, 0 disables the limit")
+	rootCmd.Flags().BoolVar(&cfg.ws, "ws", false, "Enable the WS-RPC server on the HTTP-RPC port, it serves eth_subscribe")
+	rootCmd.Flags().StringVar(&cfg.wsOrigins, "wsorigins", "", "Origins from which to accept websockets requests")
+	rootCmd.Flags().DurationVar(&cfg.wsPollInterval, "ws.pollinterval", time.Second, "How often the head block of the node is checked for eth_subscribe notifications")
 }
 
 var rootCmd = &cobra.Command{
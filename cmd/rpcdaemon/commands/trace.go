@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth"
+	"github.com/ledgerwatch/turbo-geth/eth/tracers"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotechain"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// Block re-implementation of eth/api_trace.go:Block
+func (api *TraceAPIImpl) Block(ctx context.Context, number rpc.BlockNumber) ([]*tracers.ParityTrace, error) {
+	block, chainConfig, err := api.readBlock(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return eth.ParityBlockTraces(ctx, api.dbReader, api.chainContext, chainConfig, block)
+}
+
+// Transaction re-implementation of eth/api_trace.go:Transaction
+func (api *TraceAPIImpl) Transaction(ctx context.Context, hash common.Hash) ([]*tracers.ParityTrace, error) {
+	var block *types.Block
+	var txIndex uint64
+	var chainConfig *params.ChainConfig
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		txn, blockHash, _, index, err := remotechain.ReadTransaction(tx, hash)
+		if err != nil {
+			return err
+		}
+		if txn == nil {
+			return fmt.Errorf("transaction %#x not found", hash)
+		}
+		txIndex = index
+		if block, err = remotechain.GetBlockByHash(tx, blockHash); err != nil {
+			return err
+		}
+		if block == nil {
+			return fmt.Errorf("block %#x not found", blockHash)
+		}
+		chainConfig, err = getChainConfig(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return eth.ParityTransactionTraces(ctx, api.dbReader, api.chainContext, chainConfig, block, txIndex)
+}
+
+// ReplayBlockTransactions re-implementation of eth/api_trace.go:ReplayBlockTransactions
+func (api *TraceAPIImpl) ReplayBlockTransactions(ctx context.Context, number rpc.BlockNumber, traceTypes []string) ([]*tracers.ParityTraceResult, error) {
+	block, chainConfig, err := api.readBlock(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return eth.ReplayBlockParity(ctx, api.dbReader, api.chainContext, chainConfig, block, traceTypes, -1)
+}
+
+// Filter re-implementation of eth/api_trace.go:Filter, the blocks are read one by one, so that
+// the remote database is not kept open while they are traced
+func (api *TraceAPIImpl) Filter(ctx context.Context, req eth.TraceFilterRequest) ([]*tracers.ParityTrace, error) {
+	latest := rpc.LatestBlockNumber
+	fromBlock, toBlock := &latest, &latest
+	if req.FromBlock != nil {
+		fromBlock = req.FromBlock
+	}
+	if req.ToBlock != nil {
+		toBlock = req.ToBlock
+	}
+	var from, to uint64
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		if from, err = getBlockNumber(*fromBlock, tx); err != nil {
+			return err
+		}
+		to, err = getBlockNumber(*toBlock, tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return eth.FilterParityTraces(ctx, req, from, to, api.maxBlocks, func(number uint64) ([]*tracers.ParityTrace, error) {
+		block, chainConfig, err := api.readBlock(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return nil, err
+		}
+		return eth.ParityBlockTraces(ctx, api.dbReader, api.chainContext, chainConfig, block)
+	})
+}
+
+func (api *TraceAPIImpl) readBlock(ctx context.Context, number rpc.BlockNumber) (*types.Block, *params.ChainConfig, error) {
+	var block *types.Block
+	var chainConfig *params.ChainConfig
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		blockNumber, err := getBlockNumber(number, tx)
+		if err != nil {
+			return err
+		}
+		if block, err = remotechain.GetBlockByNumber(tx, blockNumber); err != nil {
+			return err
+		}
+		chainConfig, err = getChainConfig(tx)
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, fmt.Errorf("block #%d not found", number)
+	}
+	return block, chainConfig, nil
+}
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotechain"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// TraceTransaction re-implementation of eth/api_tracer.go:TraceTransaction, the transactions
+// before the traced one are re-executed on the state read from the history buckets
+func (api *PrivateDebugAPIImpl) TraceTransaction(ctx context.Context, hash common.Hash, config *eth.TraceConfig) (interface{}, error) {
+	var txn *types.Transaction
+	var blockHash common.Hash
+	var txIndex uint64
+	var chainConfig *params.ChainConfig
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		txn, blockHash, _, txIndex, err = remotechain.ReadTransaction(tx, hash)
+		if err != nil {
+			return err
+		}
+		chainConfig, err = getChainConfig(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if txn == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+
+	msg, vmctx, ibs, _, err := eth.ComputeTxEnv(ctx, &blockGetter{api.dbReader}, chainConfig, api.chainContext, api.dbReader, blockHash, txIndex)
+	if err != nil {
+		return nil, err
+	}
+	return eth.TraceTx(ctx, msg, vmctx, ibs, chainConfig, config)
+}
+
+// TraceBlockByNumber re-implementation of eth/api_tracer.go:TraceBlockByNumber
+func (api *PrivateDebugAPIImpl) TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber, config *eth.TraceConfig) ([]*eth.TxTraceResult, error) {
+	var block *types.Block
+	var chainConfig *params.ChainConfig
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		blockNumber, err := getBlockNumber(number, tx)
+		if err != nil {
+			return err
+		}
+		if block, err = remotechain.GetBlockByNumber(tx, blockNumber); err != nil {
+			return err
+		}
+		chainConfig, err = getChainConfig(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return api.traceBlock(ctx, block, chainConfig, config)
+}
+
+// TraceBlockByHash re-implementation of eth/api_tracer.go:TraceBlockByHash
+func (api *PrivateDebugAPIImpl) TraceBlockByHash(ctx context.Context, hash common.Hash, config *eth.TraceConfig) ([]*eth.TxTraceResult, error) {
+	var block *types.Block
+	var chainConfig *params.ChainConfig
+	if err := api.db.View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		if block, err = remotechain.GetBlockByHash(tx, hash); err != nil {
+			return err
+		}
+		chainConfig, err = getChainConfig(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", hash)
+	}
+	return api.traceBlock(ctx, block, chainConfig, config)
+}
+
+// traceBlock traces the transactions of the block one after another. Unlike eth/api_tracer.go:traceBlock
+// it does not trace them concurrently: the state is read from the history buckets, which do not see
+// the changes of the previous transactions, so every transaction is traced on top of the previous ones.
+// The tracers do not interrupt the execution, so the traced one moves the state to the next transaction
+func (api *PrivateDebugAPIImpl) traceBlock(ctx context.Context, block *types.Block, chainConfig *params.ChainConfig, config *eth.TraceConfig) ([]*eth.TxTraceResult, error) {
+	txs := block.Transactions()
+	results := make([]*eth.TxTraceResult, len(txs))
+	if len(txs) == 0 {
+		return results, nil
+	}
+
+	// The state of the parent block
+	dbstate := state.NewDbState(api.dbReader, block.NumberU64()-1)
+	ibs := state.New(dbstate)
+	signer := types.MakeSigner(chainConfig, block.Number())
+	for i, tx := range txs {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %#x: %v", tx.Hash(), err)
+		}
+		vmctx := core.NewEVMContext(msg, block.Header(), api.chainContext, nil)
+		res, err := eth.TraceTx(ctx, msg, vmctx, ibs, chainConfig, config)
+		if err != nil {
+			results[i] = &eth.TxTraceResult{Error: err.Error()}
+		} else {
+			results[i] = &eth.TxTraceResult{Result: res}
+		}
+		if err := ibs.FinalizeTx(chainConfig.WithEIPsFlags(ctx, block.Number()), dbstate); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
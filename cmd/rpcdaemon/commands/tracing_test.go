@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceBlock(t *testing.T) {
+	db, blocks, receipts := newTestChain(t, 2, callContract(t, 1, 2))
+	defer db.Close()
+	api := NewPrivateDebugAPI(db.AbstractKV(), db, NewChainContext(db))
+
+	for i, block := range blocks {
+		results, err := api.TraceBlockByNumber(context.Background(), rpc.BlockNumber(block.NumberU64()), nil)
+		require.NoError(t, err)
+		byHash, err := api.TraceBlockByHash(context.Background(), block.Hash(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, results, byHash)
+
+		// Every transaction is traced on the state after the previous ones, the second one
+		// would fail the nonce check otherwise
+		require.Len(t, results, 2)
+		for j, txn := range block.Transactions() {
+			require.Empty(t, results[j].Error, "transaction %d in block %d", j, block.NumberU64())
+			result := results[j].Result.(*ethapi.ExecutionResult)
+			assert.False(t, result.Failed)
+			assert.Equal(t, receipts[i][j].GasUsed, result.Gas)
+			assert.Equal(t, common.Bytes2Hex(common.BigToHash(txn.Value()).Bytes()), result.ReturnValue)
+
+			traced, err := api.TraceTransaction(context.Background(), txn.Hash(), nil)
+			require.NoError(t, err)
+			assert.Equal(t, result, traced)
+		}
+	}
+
+	_, err := api.TraceTransaction(context.Background(), common.HexToHash("0x1234"), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,19 @@
+package commands
+
+import (
+	"github.com/ledgerwatch/turbo-geth/cmd/state/stateless"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	withChaindata(regenerateLogIndexCmd)
+	rootCmd.AddCommand(regenerateLogIndexCmd)
+}
+
+var regenerateLogIndexCmd = &cobra.Command{
+	Use:   "regenerateLogIndex",
+	Short: "Generate index of log addresses and topics based on receipts, continuing from the indexed blocks",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return stateless.RegenerateLogIndex(cmd.Context(), chaindata)
+	},
+}
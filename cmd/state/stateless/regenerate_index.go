@@ -2,10 +2,12 @@ package stateless
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/ledgerwatch/turbo-geth/common/changeset"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 )
 
@@ -35,3 +37,35 @@ func RegenerateIndex(chaindata string, indexBucket []byte, csBucket []byte) erro
 	fmt.Println("Index is successfully regenerated")
 	return nil
 }
+
+// RegenerateLogIndex indexes the logs of the canonical blocks that follow the range already
+// covered by the log index, up to the head block
+func RegenerateLogIndex(ctx context.Context, chaindata string) error {
+	db, err := ethdb.NewBoltDatabase(chaindata)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	progress, ok, err := core.ReadLogIndexProgress(db)
+	if err != nil {
+		return err
+	}
+	from := uint64(0)
+	if ok {
+		from = progress + 1
+	}
+	headNumber := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadBlockHash(db))
+	if headNumber == nil {
+		return fmt.Errorf("head block not found")
+	}
+	if from > *headNumber {
+		fmt.Println("Log index is up to date")
+		return nil
+	}
+	if err = core.GenerateLogIndex(db, from, *headNumber, ctx.Done()); err != nil {
+		return err
+	}
+	fmt.Println("Log index is successfully regenerated")
+	return nil
+}
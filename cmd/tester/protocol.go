@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -55,31 +56,8 @@ func (tp *TesterProtocol) markBlockSent(blockNumber uint) bool {
 	return result
 }
 
-// nextSubtree does []byte++. Returns false if overflow.
-func nextSubtree(in []byte) ([]byte, bool) {
-	r := make([]byte, len(in))
-	copy(r, in)
-	for i := len(r) - 1; i >= 0; i-- {
-		if r[i] != 255 {
-			r[i]++
-			return r, true
-		}
-
-		r[i] = 0
-	}
-	return nil, false
-}
-
 func (tp *TesterProtocol) mgrProtocolRun(ctx context.Context, peer *p2p.Peer, rw p2p.MsgReadWriter) error {
-	amountOfPrefixes := 100
-	prefixes := make([][]byte, 0, amountOfPrefixes)
-	from := []byte{1, 1, 1, 1, 1, 1}
-	for next, ok := nextSubtree(from); ok && amountOfPrefixes > 0; next, ok = nextSubtree(from) {
-		amountOfPrefixes--
-		prefixes = append(prefixes, next)
-	}
-
-	if err := p2p.Send(rw, eth.MGRStatus, prefixes); err != nil {
+	if err := p2p.Send(rw, eth.MGRStatus, eth.MGRStatusMsg{Leecher: true}); err != nil {
 		panic(err)
 	}
 	fmt.Printf("Sent MGRStatus\n")
@@ -99,14 +77,21 @@ func (tp *TesterProtocol) mgrProtocolRun(ctx context.Context, peer *p2p.Peer, rw
 		}
 		switch msg.Code {
 		case eth.MGRWitness:
-			res, err := trie.NewWitnessFromReader(msg.Payload, false)
+			var witness eth.MGRWitnessMsg
+			if err := msg.Decode(&witness); err != nil {
+				panic(err)
+			}
+			res, err := trie.NewWitnessFromReader(bytes.NewReader(witness.Witness), false)
 			if err != nil {
 				panic(err)
 			}
 
 			i++
 			j += len(res.Operators)
-			fmt.Printf("Messages: %d, Operators: %d\n", i, j)
+			fmt.Printf("Messages: %d, Operators: %d, Block: %d, Tick: %d\n", i, j, witness.Block, witness.Tick)
+		}
+		if err := msg.Discard(); err != nil {
+			return err
 		}
 	}
 }
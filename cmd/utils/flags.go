@@ -145,7 +145,7 @@ var (
 	}
 	AncientFlag = DirectoryFlag{
 		Name:  "datadir.ancient",
-		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
+		Usage: "Data directory for ancient chain segments, the blocks older than 90000 are moved there (disabled by default, not supported with the remote database server)",
 	}
 	KeyStoreDirFlag = DirectoryFlag{
 		Name:  "keystore",
@@ -243,6 +243,11 @@ var (
 		Usage: `Time of tick`,
 		Value: time.Second * 2,
 	}
+	GCModeBodiesLimitFlag = cli.Uint64Flag{
+		Name:  "pruning.bodies_limit",
+		Usage: `Number of the latest blocks whose bodies, receipts and transaction lookup entries are kept by the pruning (0 = keep all)`,
+		Value: 0,
+	}
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
 		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
@@ -318,6 +323,14 @@ var (
 		Name:  "download-only",
 		Usage: "Run in download only mode - only fetch blocks but not process them",
 	}
+	MGRLeecherFlag = cli.BoolFlag{
+		Name:  "mgr.leecher",
+		Usage: "Assemble the state from the witnesses gossiped by the Merry-Go-Round seeders",
+	}
+	MGRSeederFlag = cli.BoolFlag{
+		Name:  "mgr.seeder",
+		Usage: "Gossip the pieces of the state to the Merry-Go-Round leechers",
+	}
 	// Ethash settings
 	EthashCacheDirFlag = DirectoryFlag{
 		Name:  "ethash.cachedir",
@@ -446,7 +459,7 @@ var (
 * p - write preimages to the DB
 * r - write receipts to the DB
 * t - write tx lookup index to the DB`,
-		Value: eth.DefaultStorageMode.ToString(),
+		Value: ethdb.DefaultStorageMode.ToString(),
 	}
 	ArchiveSyncInterval = cli.IntFlag{
 		Name:  "archive-sync-interval",
@@ -463,6 +476,26 @@ var (
 		Usage: "network address (for example, localhost:9999) to start remote database server on",
 		Value: "",
 	}
+	RemoteDbTLSCertFlag = cli.StringFlag{
+		Name:  "remote-db-tls-cert",
+		Usage: "certificate file of the remote database server, enables TLS",
+		Value: "",
+	}
+	RemoteDbTLSKeyFlag = cli.StringFlag{
+		Name:  "remote-db-tls-key",
+		Usage: "private key file of the remote database server",
+		Value: "",
+	}
+	RemoteDbTLSCACertFlag = cli.StringFlag{
+		Name:  "remote-db-tls-cacert",
+		Usage: "CA certificate file to verify the remote database clients against (mutual TLS)",
+		Value: "",
+	}
+	RemoteDbTokenFlag = cli.StringFlag{
+		Name:  "remote-db-token",
+		Usage: "pre-shared token the remote database clients must present",
+		Value: "",
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -562,6 +595,11 @@ var (
 		Name:  "rpc.gascap",
 		Usage: "Sets a cap on gas that can be used in eth_call/estimateGas",
 	}
+	RPCTraceMaxBlocksFlag = cli.Uint64Flag{
+		Name:  "rpc.maxtracerange",
+		Usage: "Maximum number of blocks a single trace_filter may re-execute, 0 disables the limit",
+		Value: eth.DefaultConfig.RPCTraceMaxBlocks,
+	}
 	// Logging and debug settings
 	EthStatsURLFlag = cli.StringFlag{
 		Name:  "ethstats",
@@ -1023,6 +1061,10 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 // read-only interface to the databae
 func setRemoteDb(ctx *cli.Context, cfg *node.Config) {
 	cfg.RemoteDbListenAddress = ctx.GlobalString(RemoteDbListenAddress.Name)
+	cfg.RemoteDbTLSCert = ctx.GlobalString(RemoteDbTLSCertFlag.Name)
+	cfg.RemoteDbTLSKey = ctx.GlobalString(RemoteDbTLSKeyFlag.Name)
+	cfg.RemoteDbTLSCACert = ctx.GlobalString(RemoteDbTLSCACertFlag.Name)
+	cfg.RemoteDbToken = ctx.GlobalString(RemoteDbTokenFlag.Name)
 }
 
 // setIPC creates an IPC path configuration from the set command line flags,
@@ -1489,7 +1531,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	// Avoid conflicting network flags
 	CheckExclusive(ctx, DeveloperFlag, LegacyTestnetFlag, RopstenFlag, RinkebyFlag, GoerliFlag)
 	CheckExclusive(ctx, LightLegacyServFlag, LightServeFlag, SyncModeFlag, "light")
-	CheckExclusive(ctx, DeveloperFlag, ExternalSignerFlag) // Can't use both ephemeral unlocked and external signer
+	CheckExclusive(ctx, DeveloperFlag, ExternalSignerFlag)  // Can't use both ephemeral unlocked and external signer
+	CheckExclusive(ctx, MGRLeecherFlag, MGRSeederFlag)      // Leechers do not have the whole state to seed
+	CheckExclusive(ctx, AncientFlag, RemoteDbListenAddress) // The remote database does not serve the frozen blocks
 
 	var ks *keystore.KeyStore
 	if keystores := stack.AccountManager().Backends(keystore.KeyStoreType); len(keystores) > 0 {
@@ -1522,10 +1566,13 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	cfg.BlocksBeforePruning = ctx.GlobalUint64(GCModeLimitFlag.Name)
 	cfg.BlocksToPrune = ctx.GlobalUint64(GCModeBlockToPruneFlag.Name)
 	cfg.PruningTimeout = ctx.GlobalDuration(GCModeTickTimeout.Name)
+	cfg.BodiesBeforePruning = ctx.GlobalUint64(GCModeBodiesLimitFlag.Name)
 
 	cfg.DownloadOnly = ctx.GlobalBoolT(DownloadOnlyFlag.Name)
+	cfg.MGRLeecher = ctx.GlobalBool(MGRLeecherFlag.Name)
+	cfg.MGRSeeder = ctx.GlobalBool(MGRSeederFlag.Name)
 
-	mode, err := eth.StorageModeFromString(ctx.GlobalString(StorageModeFlag.Name))
+	mode, err := ethdb.StorageModeFromString(ctx.GlobalString(StorageModeFlag.Name))
 	if err != nil {
 		Fatalf(fmt.Sprintf("error while parsing mode: %v", err))
 	}
@@ -1557,6 +1604,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(RPCGlobalGasCap.Name) {
 		cfg.RPCGasCap = new(big.Int).SetUint64(ctx.GlobalUint64(RPCGlobalGasCap.Name))
 	}
+	if ctx.GlobalIsSet(RPCTraceMaxBlocksFlag.Name) {
+		cfg.RPCTraceMaxBlocks = ctx.GlobalUint64(RPCTraceMaxBlocksFlag.Name)
+	}
 	if ctx.GlobalIsSet(DNSDiscoveryFlag.Name) {
 		urls := ctx.GlobalString(DNSDiscoveryFlag.Name)
 		if urls == "" {
@@ -1718,7 +1768,7 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) ethdb.Database {
 	if ctx.GlobalString(SyncModeFlag.Name) == "light" {
 		name = "lightchaindata"
 	}
-	chainDb, err := stack.OpenDatabase(name)
+	chainDb, err := stack.OpenDatabaseWithFreezer(name, ctx.GlobalString(AncientFlag.Name))
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
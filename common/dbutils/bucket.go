@@ -77,6 +77,7 @@ var (
 	BlockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
 
 	TxLookupPrefix  = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
+	SendersPrefix   = []byte("s") // sendersPrefix + num (uint64 big endian) + hash -> senders of the block transactions, 20 bytes each
 	BloomBitsPrefix = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
 
 	PreimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
@@ -85,15 +86,27 @@ var (
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
 
+	// Log index, address/topic + last block number in the chunk (uint64 big endian) -> chunk of block numbers (see HistoryIndexBytes)
+	// The last chunk of every address/topic is kept under the block number 0xffffffffffffffff
+	LogAddressIndex = []byte("iLA")
+	LogTopicIndex   = []byte("iLT")
+	// LogIndexProgressKey is the last block of the contiguous range indexed in the log index, kept in DatabaseInfoBucket
+	LogIndexProgressKey = []byte("LogIndexProgress")
+
 	PreimageCounter    = metrics.NewRegisteredCounter("db/preimage/total", nil)
 	PreimageHitCounter = metrics.NewRegisteredCounter("db/preimage/hits", nil)
 
 	// last block that was pruned
 	// it's saved one in 5 minutes
 	LastPrunedBlockKey = []byte("LastPrunedBlock")
+	// LowestAvailableBlockKey is the lowest block whose body, receipts and transaction lookup entries are
+	// not pruned, kept in DatabaseInfoBucket
+	LowestAvailableBlockKey = []byte("LowestAvailableBlock")
 
 	// LastAppliedMigration keep the name of tle last applied migration.
 	LastAppliedMigration = []byte("lastAppliedMigration")
+	// MigrationProgressPrefix + migration name keeps the checkpoint of the migration being applied.
+	MigrationProgressPrefix = []byte("migrationProgress")
 
 	//StorageModeHistory - does node save history.
 	StorageModeHistory = []byte("smHistory")
@@ -135,9 +148,13 @@ var Buckets = [][]byte{
 	BlockBodyPrefix,
 	BlockReceiptsPrefix,
 	TxLookupPrefix,
+	SendersPrefix,
 	BloomBitsPrefix,
 	PreimagePrefix,
 	ConfigPrefix,
 	BloomBitsIndexPrefix,
 	LastPrunedBlockKey,
+	DatabaseInfoBucket,
+	LogAddressIndex,
+	LogTopicIndex,
 }
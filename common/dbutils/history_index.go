@@ -106,6 +106,30 @@ func (hi HistoryIndexBytes) TruncateGreater(lower uint64) HistoryIndexBytes {
 	return hi[:8+truncationPoint*ItemLen] // We preserve minElement field and all elements prior to the truncation point
 }
 
+// TruncateLessOrEqual removes all the timestamps that are less than or equal to the given bound, the remaining
+// ones are re-encoded relative to the new minimal element. It is used by the pruning, so the key of the chunk
+// (derived from its last element) does not change
+func (hi HistoryIndexBytes) TruncateLessOrEqual(upper uint64) HistoryIndexBytes {
+	if len(hi) < 8 {
+		panic(fmt.Errorf("minimal length of index chunk is %d, got %d", 8, len(hi)))
+	}
+	if (len(hi)-8)%ItemLen != 0 {
+		panic(fmt.Errorf("length of index chunk should be 8 (mod %d), got %d", ItemLen, len(hi)))
+	}
+	numElements := (len(hi) - 8) / 3
+	minElement := binary.BigEndian.Uint64(hi[:8])
+	elements := hi[8:]
+	truncationPoint := sort.Search(numElements, func(i int) bool {
+		return upper < minElement+(uint64(elements[i*ItemLen]&0x7f)<<16)+(uint64(elements[i*ItemLen+1])<<8)+uint64(elements[i*ItemLen+2])
+	})
+	truncated := NewHistoryIndex()
+	for i := truncationPoint; i < numElements; i++ {
+		v := minElement + (uint64(elements[i*ItemLen]&0x7f) << 16) + (uint64(elements[i*ItemLen+1]) << 8) + uint64(elements[i*ItemLen+2])
+		truncated = truncated.Append(v, elements[i*ItemLen]&0x80 != 0)
+	}
+	return truncated
+}
+
 // Search looks for the element which is equal or greater of given timestamp
 func (hi HistoryIndexBytes) Search(v uint64) (uint64, bool, bool) {
 	if len(hi) < 8 {
@@ -157,6 +181,11 @@ func (hi HistoryIndexBytes) LastElement() (uint64, bool) {
 func IndexChunkKey(key []byte, blockNumber uint64) []byte {
 	var blockNumBytes []byte // make([]byte, len(key)+8)
 	switch len(key) {
+	case common.AddressLength:
+		// address in the log index
+		blockNumBytes = make([]byte, common.AddressLength+8)
+		copy(blockNumBytes, key)
+		binary.BigEndian.PutUint64(blockNumBytes[common.AddressLength:], blockNumber)
 	case common.HashLength:
 		blockNumBytes = make([]byte, common.HashLength+8)
 		copy(blockNumBytes, key)
@@ -67,3 +67,27 @@ func TestHistoryIndex_Append(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestHistoryIndex_TruncateLessOrEqual(t *testing.T) {
+	index := NewHistoryIndex().Append(3, true).Append(5, false).Append(8, true).Append(0x7fff00, false)
+
+	res, sets, err := index.TruncateLessOrEqual(5).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, []uint64{8, 0x7fff00}) || !reflect.DeepEqual(sets, []bool{true, false}) {
+		t.Fatal("Not equal", res, sets)
+	}
+
+	res, _, err = index.TruncateLessOrEqual(2).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, []uint64{3, 5, 8, 0x7fff00}) {
+		t.Fatal("Not equal", res)
+	}
+
+	if index.TruncateLessOrEqual(0x7fff00).Len() != 0 {
+		t.Fatal("must be empty")
+	}
+}
@@ -612,10 +612,10 @@ var (
 	big32 = big.NewInt(32)
 )
 
-// AccumulateRewards credits the coinbase of the given block with the mining
-// reward. The total reward consists of the static block reward and rewards for
-// included uncles. The coinbase of each uncle block is also rewarded.
-func accumulateRewards(config *params.ChainConfig, state *state.IntraBlockState, header *types.Header, uncles []*types.Header) {
+// AccumulateRewards returns the mining reward of the coinbase of the given block and
+// the rewards of the coinbases of its uncles. The reward of the coinbase consists of
+// the static block reward and rewards for included uncles.
+func AccumulateRewards(config *params.ChainConfig, header *types.Header, uncles []*types.Header) (*big.Int, []*big.Int) {
 	// Select the correct block reward based on chain progression
 	blockReward := FrontierBlockReward
 	if config.IsByzantium(header.Number) {
@@ -626,16 +626,25 @@ func accumulateRewards(config *params.ChainConfig, state *state.IntraBlockState,
 	}
 	// Accumulate the rewards for the miner and any included uncles
 	reward := new(big.Int).Set(blockReward)
-	r := new(big.Int)
-	for _, uncle := range uncles {
-		r.Add(uncle.Number, big8)
+	uncleRewards := make([]*big.Int, len(uncles))
+	for i, uncle := range uncles {
+		r := new(big.Int).Add(uncle.Number, big8)
 		r.Sub(r, header.Number)
 		r.Mul(r, blockReward)
 		r.Div(r, big8)
-		state.AddBalance(uncle.Coinbase, r)
+		uncleRewards[i] = r
 
-		r.Div(blockReward, big32)
-		reward.Add(reward, r)
+		reward.Add(reward, new(big.Int).Div(blockReward, big32))
+	}
+	return reward, uncleRewards
+}
+
+// accumulateRewards credits the coinbase of the given block with the mining
+// reward, and the coinbase of each uncle block with its reward.
+func accumulateRewards(config *params.ChainConfig, state *state.IntraBlockState, header *types.Header, uncles []*types.Header) {
+	reward, uncleRewards := AccumulateRewards(config, header, uncles)
+	for i, uncle := range uncles {
+		state.AddBalance(uncle.Coinbase, uncleRewards[i])
 	}
 	state.AddBalance(header.Coinbase, reward)
 }
@@ -124,6 +124,7 @@ type CacheConfig struct {
 	BlocksBeforePruning uint64
 	BlocksToPrune       uint64
 	PruneTimeout        time.Duration
+	BodiesBeforePruning uint64 // Number of the latest blocks whose bodies, receipts and tx lookup entries are kept, 0 keeps all
 	ArchiveSyncInterval uint64
 	DownloadOnly        bool
 	NoHistory           bool
@@ -1183,6 +1184,9 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 			// Write all the data out into the database
 			rawdb.WriteBody(context.Background(), batch, block.Hash(), block.NumberU64(), block.Body())
 			rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receiptChain[i])
+			if err := WriteLogIndex(batch, block.NumberU64(), receiptChain[i]); err != nil {
+				return 0, err
+			}
 			if bc.enableTxLookupIndex {
 				rawdb.WriteTxLookupEntries(batch, block)
 			}
@@ -1326,9 +1330,15 @@ func (bc *BlockChain) writeBlockWithState(ctx context.Context, block *types.Bloc
 	// Reorganise the chain if the parent is not the head block
 
 	if execute && block.ParentHash() != currentBlock.Hash() {
+		// The logs of the new chain, this block included, are indexed by the reorg
 		if err := bc.reorg(currentBlock, block); err != nil {
 			return NonStatTy, err
 		}
+	} else if bc.enableReceipts && !bc.cacheConfig.DownloadOnly && execute {
+		// Only the logs of the canonical blocks are indexed
+		if err := WriteLogIndex(bc.db, block.NumberU64(), receipts); err != nil {
+			return NonStatTy, err
+		}
 	}
 	// Write the positional metadata for transaction/receipt lookups and preimages
 
@@ -2017,6 +2027,12 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		if bc.enableTxLookupIndex {
 			rawdb.WriteTxLookupEntries(bc.db, newChain[i])
 		}
+		if bc.enableReceipts && !bc.cacheConfig.DownloadOnly {
+			receipts := rawdb.ReadRawReceipts(bc.db, newChain[i].Hash(), newChain[i].NumberU64())
+			if err := WriteLogIndex(bc.db, newChain[i].NumberU64(), receipts); err != nil {
+				return err
+			}
+		}
 		addedTxs = append(addedTxs, newChain[i].Transactions()...)
 	}
 	// When transactions get deleted from the database, the receipts that were
@@ -18,6 +18,7 @@ package core
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -1287,6 +1288,76 @@ func TestSideLogRebirth(t *testing.T) {
 	}
 }
 
+// Tests that the log index covers the canonical chain after the side blocks and reorgs
+func TestLogIndexSideChain(t *testing.T) {
+	var (
+		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		key2, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		db      = ethdb.NewMemDatabase()
+
+		// this code generates a log
+		code    = common.Hex2Bytes("60606040525b7f24ec1d3ff24c2f6ff210738839dbc339cd45a5294d85c79361016243157aae7b60405180905060405180910390a15b600a8060416000396000f360606040526008565b00")
+		funds   = GenesisAccount{Balance: big.NewInt(10000000000000)}
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{crypto.PubkeyToAddress(key1.PublicKey): funds, crypto.PubkeyToAddress(key2.PublicKey): funds}}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainID)
+	)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	blockchain.EnableReceipts(true)
+	defer blockchain.Stop()
+
+	// The contracts of the two chains are created by different senders, so their logs have different addresses
+	withLogs := func(key *ecdsa.PrivateKey) func(int, *BlockGen) {
+		return func(i int, gen *BlockGen) {
+			tx, err := types.SignTx(types.NewContractCreation(gen.TxNonce(crypto.PubkeyToAddress(key.PublicKey)), new(big.Int), 1000000, new(big.Int), code), signer, key)
+			if err != nil {
+				t.Fatalf("failed to create tx: %v", err)
+			}
+			gen.AddTx(tx)
+		}
+	}
+	insert := func(blocks types.Blocks, head uint64) {
+		if _, err := blockchain.InsertChain(context.Background(), blocks); err != nil {
+			t.Fatalf("failed to insert chain: %v", err)
+		}
+		if current := blockchain.CurrentBlock().NumberU64(); current != head {
+			t.Fatalf("head %d, expected %d", current, head)
+		}
+		progress, ok, err := ReadLogIndexProgress(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || progress != head {
+			t.Fatalf("log index progress %d (ok %t), expected %d", progress, ok, head)
+		}
+		for n := uint64(1); n <= head; n++ {
+			for _, receipt := range rawdb.ReadRawReceipts(db, rawdb.ReadCanonicalHash(db, n), n) {
+				for _, l := range receipt.Logs {
+					blockNumbers, err := ReadLogIndex(db, dbutils.LogAddressIndex, l.Address[:], n, n)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(blockNumbers) != 1 {
+						t.Fatalf("log index of %x does not have the block %d", l.Address, n)
+					}
+				}
+			}
+		}
+	}
+
+	dbCopy := db.MemCopy()
+	chain, _ := GenerateChain(context.Background(), params.TestChainConfig, genesis, ethash.NewFaker(), dbCopy.MemCopy(), 6, withLogs(key1))
+	sideChain, _ := GenerateChain(context.Background(), params.TestChainConfig, genesis, ethash.NewFaker(), dbCopy.MemCopy(), 4, withLogs(key2))
+
+	insert(chain[:3], 3)
+	// The side blocks below the head are only stored
+	insert(sideChain[:2], 3)
+	// The side chain becomes the canonical one
+	insert(sideChain[2:], 4)
+	// And the first chain takes over again
+	insert(chain[3:], 6)
+}
+
 func TestReorgSideEvent(t *testing.T) {
 	t.Skip("should be restored. skipped for turbo-geth. tag: reorg")
 	var (
@@ -2065,8 +2136,8 @@ func TestIncompleteAncientReceiptChainInsertion(t *testing.T) {
 // overtake the 'canon' chain until after it's passed canon by about 200 blocks.
 //
 // Details at:
-//  - https://github.com/ethereum/go-ethereum/issues/18977
-//  - https://github.com/ethereum/go-ethereum/pull/18988
+//   - https://github.com/ethereum/go-ethereum/issues/18977
+//   - https://github.com/ethereum/go-ethereum/pull/18988
 func TestLowDiffLongChain(t *testing.T) {
 	// Generate a canonical chain to act as the main dataset
 	engine := ethash.NewFaker()
@@ -2199,7 +2270,8 @@ func testSideImport(t *testing.T, numCanonBlocksInSidechain, blocksBetweenCommon
 // That is: the sidechain for import contains some blocks already present in canon chain.
 // So the blocks are
 // [ Cn, Cn+1, Cc, Sn+3 ... Sm]
-//   ^    ^    ^  pruned
+//
+//	^    ^    ^  pruned
 func TestPrunedImportSide(t *testing.T) {
 	//glogger := log.NewGlogHandler(log.StreamHandler(os.Stdout, log.TerminalFormat(false)))
 	//glogger.Verbosity(3)
@@ -2588,9 +2660,9 @@ func BenchmarkBlockChain_1x1000Executions(b *testing.B) {
 // This internally leads to a sidechain import, since the blocks trigger an
 // ErrPrunedAncestor error.
 // This may e.g. happen if
-//   1. Downloader rollbacks a batch of inserted blocks and exits
-//   2. Downloader starts to sync again
-//   3. The blocks fetched are all known and canonical blocks
+//  1. Downloader rollbacks a batch of inserted blocks and exits
+//  2. Downloader starts to sync again
+//  3. The blocks fetched are all known and canonical blocks
 func TestSideImportPrunedBlocks(t *testing.T) {
 	t.Skip("should be restored. skipped for turbo-geth. tag: reorg")
 	// Generate a canonical chain to act as the main dataset
@@ -3121,20 +3193,19 @@ func TestDeleteRecreateSlotsAcrossManyBlocks(t *testing.T) {
 
 // TestInitThenFailCreateContract tests a pretty notorious case that happened
 // on mainnet over blocks 7338108, 7338110 and 7338115.
-// - Block 7338108: address e771789f5cccac282f23bb7add5690e1f6ca467c is initiated
-//   with 0.001 ether (thus created but no code)
-// - Block 7338110: a CREATE2 is attempted. The CREATE2 would deploy code on
-//   the same address e771789f5cccac282f23bb7add5690e1f6ca467c. However, the
-//   deployment fails due to OOG during initcode execution
-// - Block 7338115: another tx checks the balance of
-//   e771789f5cccac282f23bb7add5690e1f6ca467c, and the snapshotter returned it as
-//   zero.
+//   - Block 7338108: address e771789f5cccac282f23bb7add5690e1f6ca467c is initiated
+//     with 0.001 ether (thus created but no code)
+//   - Block 7338110: a CREATE2 is attempted. The CREATE2 would deploy code on
+//     the same address e771789f5cccac282f23bb7add5690e1f6ca467c. However, the
+//     deployment fails due to OOG during initcode execution
+//   - Block 7338115: another tx checks the balance of
+//     e771789f5cccac282f23bb7add5690e1f6ca467c, and the snapshotter returned it as
+//     zero.
 //
 // The problem being that the snapshotter maintains a destructset, and adds items
 // to the destructset in case something is created "onto" an existing item.
 // We need to either roll back the snapDestructs, or not place it into snapDestructs
 // in the first place.
-//
 func TestInitThenFailCreateContract(t *testing.T) {
 	var (
 		// Generate a canonical chain to act as the main dataset
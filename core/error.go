@@ -35,4 +35,8 @@ var (
 
 	// ErrNoGenesis is returned when there is no Genesis Block.
 	ErrNoGenesis = errors.New("genesis not found in chain")
+
+	// ErrBlockPruned is returned when the body or the receipts of a block removed
+	// by the pruner are requested.
+	ErrBlockPruned = errors.New("block pruned")
 )
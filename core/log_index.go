@@ -0,0 +1,195 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// logIndexBatchSize is the number of addresses and topics accumulated in memory
+// by GenerateLogIndex before they are written into the database
+const logIndexBatchSize = 500000
+
+// WriteLogIndex adds the block to the log index of the addresses and topics of its logs, and moves
+// the progress of the log index if the block follows the indexed range.
+// Blocks of a previous chain at or above the block number are removed from the last chunks of
+// these addresses and topics. The full chunks may still point to such blocks, so the readers
+// must check the logs of the blocks they find in the index.
+func WriteLogIndex(db ethdb.Database, blockNumber uint64, receipts types.Receipts) error {
+	addresses := make(map[string][]uint64)
+	topics := make(map[string][]uint64)
+	addLogIndexKeys(receipts, blockNumber, addresses, topics)
+	if err := writeLogIndexKeys(db, addresses, topics); err != nil {
+		return err
+	}
+
+	progress, ok, err := ReadLogIndexProgress(db)
+	if err != nil {
+		return err
+	}
+	if !ok && blockNumber > 1 || ok && progress+1 < blockNumber {
+		// There is a gap in the index, it needs to be filled by GenerateLogIndex first
+		return nil
+	}
+	return writeLogIndexProgress(db, blockNumber)
+}
+
+// GenerateLogIndex builds the log index of the canonical blocks from..to (inclusive) from their receipts.
+// The progress of the log index is saved along with every batch
+func GenerateLogIndex(db ethdb.Database, from, to uint64, quit <-chan struct{}) error {
+	startTime := time.Now()
+	addresses := make(map[string][]uint64)
+	topics := make(map[string][]uint64)
+	for blockNumber := from; blockNumber <= to; blockNumber++ {
+		select {
+		case <-quit:
+			return nil
+		default:
+		}
+
+		hash := rawdb.ReadCanonicalHash(db, blockNumber)
+		if hash == (common.Hash{}) {
+			return fmt.Errorf("log index: canonical hash not found for block %d", blockNumber)
+		}
+		addLogIndexKeys(rawdb.ReadRawReceipts(db, hash, blockNumber), blockNumber, addresses, topics)
+
+		if len(addresses)+len(topics) >= logIndexBatchSize || blockNumber == to {
+			batch := db.NewBatch()
+			if err := writeLogIndexKeys(batch, addresses, topics); err != nil {
+				return err
+			}
+			if err := writeLogIndexProgress(batch, blockNumber); err != nil {
+				return err
+			}
+			if _, err := batch.Commit(); err != nil {
+				return err
+			}
+			log.Info("Log index", "blockNumber", blockNumber, "addresses", len(addresses), "topics", len(topics), "time", time.Since(startTime))
+			addresses = make(map[string][]uint64)
+			topics = make(map[string][]uint64)
+		}
+	}
+	return nil
+}
+
+// ReadLogIndex returns the block numbers in the range from..to (inclusive) the log index has
+// for the address (LogAddressIndex bucket) or topic (LogTopicIndex bucket), in ascending order
+func ReadLogIndex(db ethdb.Getter, bucket []byte, key []byte, from, to uint64) ([]uint64, error) {
+	var blockNumbers []uint64
+	if err := db.Walk(bucket, dbutils.IndexChunkKey(key, from), uint(8*len(key)), func(k, v []byte) (bool, error) {
+		numbers, _, err := dbutils.WrapHistoryIndex(v).Decode()
+		if err != nil {
+			return false, err
+		}
+		for _, n := range numbers {
+			if n > to {
+				return false, nil
+			}
+			if n >= from {
+				blockNumbers = append(blockNumbers, n)
+			}
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return blockNumbers, nil
+}
+
+// ReadLogIndexProgress returns the last block of the contiguous range covered by the log index,
+// ok is false when the index has not been built
+func ReadLogIndexProgress(db ethdb.Getter) (progress uint64, ok bool, err error) {
+	v, err := db.Get(dbutils.DatabaseInfoBucket, dbutils.LogIndexProgressKey)
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		return 0, false, err
+	}
+	if len(v) != 8 {
+		return 0, false, nil
+	}
+	return binary.BigEndian.Uint64(v), true, nil
+}
+
+func writeLogIndexProgress(db ethdb.Putter, blockNumber uint64) error {
+	return db.Put(dbutils.DatabaseInfoBucket, dbutils.LogIndexProgressKey, dbutils.EncodeBlockNumber(blockNumber))
+}
+
+// addLogIndexKeys collects the addresses and topics of the logs in the receipts
+func addLogIndexKeys(receipts types.Receipts, blockNumber uint64, addresses, topics map[string][]uint64) {
+	add := func(keys map[string][]uint64, key []byte) {
+		blocks := keys[string(key)]
+		if len(blocks) > 0 && blocks[len(blocks)-1] == blockNumber {
+			return
+		}
+		keys[string(key)] = append(blocks, blockNumber)
+	}
+	for _, receipt := range receipts {
+		for _, l := range receipt.Logs {
+			add(addresses, l.Address[:])
+			for _, topic := range l.Topics {
+				add(topics, topic[:])
+			}
+		}
+	}
+}
+
+func writeLogIndexKeys(db ethdb.MinDatabase, addresses, topics map[string][]uint64) error {
+	for _, bucketKeys := range []struct {
+		bucket []byte
+		keys   map[string][]uint64
+	}{{dbutils.LogAddressIndex, addresses}, {dbutils.LogTopicIndex, topics}} {
+		// Sorted keys make the writes sequential
+		keys := make([]string, 0, len(bucketKeys.keys))
+		for key := range bucketKeys.keys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := appendLogIndex(db, bucketKeys.bucket, []byte(key), bucketKeys.keys[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appendLogIndex appends the block numbers (in ascending order) to the last chunk of the key,
+// see DbStateWriter.writeIndex
+func appendLogIndex(db ethdb.MinDatabase, bucket []byte, key []byte, blockNumbers []uint64) error {
+	currentChunkKey := dbutils.IndexChunkKey(key, ^uint64(0))
+	indexBytes, err := db.Get(bucket, currentChunkKey)
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		return fmt.Errorf("find chunk failed: %w", err)
+	}
+	index := dbutils.WrapHistoryIndex(common.CopyBytes(indexBytes))
+	// Blocks at or above the first new one are left by the previous chain
+	if last, ok := index.LastElement(); ok && last >= blockNumbers[0] {
+		if blockNumbers[0] == 0 {
+			index = dbutils.NewHistoryIndex()
+		} else {
+			index = index.TruncateGreater(blockNumbers[0] - 1)
+		}
+	}
+	for _, blockNumber := range blockNumbers {
+		if dbutils.CheckNewIndexChunk(index, blockNumber) {
+			// Chunk overflow, the full chunk goes under the key derived from its last element
+			indexKey, err := index.Key(key)
+			if err != nil {
+				return err
+			}
+			if err := db.Put(bucket, indexKey, index); err != nil {
+				return err
+			}
+			index = dbutils.NewHistoryIndex()
+		}
+		index = index.Append(blockNumber, false)
+	}
+	return db.Put(bucket, currentChunkKey, index)
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	logIndexAddr1  = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	logIndexAddr2  = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	logIndexTopic1 = common.HexToHash("0x01")
+	logIndexTopic2 = common.HexToHash("0x02")
+)
+
+// logIndexReceipts has logs of the first address in every even block, and of the second one in every third block
+func logIndexReceipts(blockNumber uint64) types.Receipts {
+	receipt := &types.Receipt{Status: types.ReceiptStatusSuccessful}
+	if blockNumber%2 == 0 {
+		receipt.Logs = append(receipt.Logs, &types.Log{Address: logIndexAddr1, Topics: []common.Hash{logIndexTopic1}})
+	}
+	if blockNumber%3 == 0 {
+		receipt.Logs = append(receipt.Logs, &types.Log{Address: logIndexAddr2, Topics: []common.Hash{logIndexTopic2, logIndexTopic1}})
+	}
+	return types.Receipts{receipt}
+}
+
+func expectedLogIndex(from, to uint64, matches func(uint64) bool) []uint64 {
+	var blockNumbers []uint64
+	for blockNumber := from; blockNumber <= to; blockNumber++ {
+		if matches(blockNumber) {
+			blockNumbers = append(blockNumbers, blockNumber)
+		}
+	}
+	return blockNumbers
+}
+
+func TestWriteLogIndex(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	// More blocks than fit into a single chunk
+	const blocks = 2*dbutils.MaxChunkSize + 500
+	for blockNumber := uint64(1); blockNumber <= blocks; blockNumber++ {
+		require.NoError(t, WriteLogIndex(db, blockNumber, logIndexReceipts(blockNumber)))
+	}
+	progress, ok, err := ReadLogIndexProgress(db)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(blocks), progress)
+
+	even := func(n uint64) bool { return n%2 == 0 }
+	third := func(n uint64) bool { return n%3 == 0 }
+	for _, r := range [][2]uint64{{0, blocks}, {1001, 1501}, {1999, 2003}, {blocks, blocks + 10}} {
+		from, to := r[0], r[1]
+		// Only the blocks 1..blocks are written
+		written := func(matches func(uint64) bool) func(uint64) bool {
+			return func(n uint64) bool { return n >= 1 && n <= blocks && matches(n) }
+		}
+		addr1, err := ReadLogIndex(db, dbutils.LogAddressIndex, logIndexAddr1[:], from, to)
+		require.NoError(t, err)
+		assert.Equal(t, expectedLogIndex(from, to, written(even)), addr1, "address 1 %d..%d", from, to)
+
+		addr2, err := ReadLogIndex(db, dbutils.LogAddressIndex, logIndexAddr2[:], from, to)
+		require.NoError(t, err)
+		assert.Equal(t, expectedLogIndex(from, to, written(third)), addr2, "address 2 %d..%d", from, to)
+
+		topic1, err := ReadLogIndex(db, dbutils.LogTopicIndex, logIndexTopic1[:], from, to)
+		require.NoError(t, err)
+		assert.Equal(t, expectedLogIndex(from, to, written(func(n uint64) bool { return even(n) || third(n) })), topic1, "topic 1 %d..%d", from, to)
+	}
+
+	// Reorg, the new block at the height 2400 has only the logs of the second address
+	reorgReceipts := types.Receipts{{Logs: []*types.Log{{Address: logIndexAddr2, Topics: []common.Hash{logIndexTopic2}}}}}
+	require.NoError(t, WriteLogIndex(db, 2400, reorgReceipts))
+	progress, _, err = ReadLogIndexProgress(db)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2400), progress)
+
+	// The first address has no logs in the new block, its chunks still point to the blocks of the previous chain
+	addr1, err := ReadLogIndex(db, dbutils.LogAddressIndex, logIndexAddr1[:], 2390, blocks)
+	require.NoError(t, err)
+	assert.Equal(t, expectedLogIndex(2390, blocks, even), addr1)
+	addr2, err := ReadLogIndex(db, dbutils.LogAddressIndex, logIndexAddr2[:], 2390, blocks)
+	require.NoError(t, err)
+	assert.Equal(t, append(expectedLogIndex(2390, 2399, third), 2400), addr2)
+}
+
+func TestGenerateLogIndex(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	expected := ethdb.NewMemDatabase()
+	defer expected.Close()
+
+	const blocks = 1500
+	for blockNumber := uint64(1); blockNumber <= blocks; blockNumber++ {
+		hash := common.BigToHash(new(big.Int).SetUint64(blockNumber))
+		rawdb.WriteCanonicalHash(db, hash, blockNumber)
+		rawdb.WriteReceipts(db, hash, blockNumber, logIndexReceipts(blockNumber))
+		require.NoError(t, WriteLogIndex(expected, blockNumber, logIndexReceipts(blockNumber)))
+	}
+
+	// In two parts, the second one appends to the chunks of the first one
+	require.NoError(t, GenerateLogIndex(db, 1, 700, nil))
+	progress, _, err := ReadLogIndexProgress(db)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(700), progress)
+	require.NoError(t, GenerateLogIndex(db, 701, blocks, nil))
+
+	for _, bucket := range [][]byte{dbutils.LogAddressIndex, dbutils.LogTopicIndex, dbutils.DatabaseInfoBucket} {
+		var keys, expectedKeys [][]byte
+		var values, expectedValues [][]byte
+		require.NoError(t, db.Walk(bucket, nil, 0, func(k, v []byte) (bool, error) {
+			keys, values = append(keys, common.CopyBytes(k)), append(values, common.CopyBytes(v))
+			return true, nil
+		}))
+		require.NoError(t, expected.Walk(bucket, nil, 0, func(k, v []byte) (bool, error) {
+			expectedKeys, expectedValues = append(expectedKeys, common.CopyBytes(k)), append(expectedValues, common.CopyBytes(v))
+			return true, nil
+		}))
+		assert.Equal(t, expectedKeys, keys, "bucket %s", bucket)
+		assert.Equal(t, expectedValues, values, "bucket %s", bucket)
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
@@ -77,6 +78,12 @@ func (p *BasicPruner) pruningLoop(db ethdb.Database) {
 			if cb == nil || cb.Number() == nil {
 				continue
 			}
+			if p.config.BodiesBeforePruning > 0 {
+				// The history is pruned regardless, the blocks are tried again on the next run
+				if err := p.pruneBlocks(db, cb.Number().Uint64()); err != nil {
+					log.Error("Blocks pruning error", "err", err)
+				}
+			}
 			from, to, ok := calculateNumOfPrunedBlocks(cb.Number().Uint64(), p.LastPrunedBlockNum, p.config.BlocksBeforePruning, p.config.BlocksToPrune)
 			if !ok {
 				continue
@@ -97,6 +104,21 @@ func (p *BasicPruner) pruningLoop(db ethdb.Database) {
 	}
 }
 
+// pruneBlocks removes up to BlocksToPrune blocks above the lowest available one, so that
+// BodiesBeforePruning blocks before the current one are kept
+func (p *BasicPruner) pruneBlocks(db ethdb.Database, currentBlock uint64) error {
+	lowest, err := ReadLowestAvailableBlock(db)
+	if err != nil {
+		return err
+	}
+	from, to, ok := calculateNumOfPrunedBlocks(currentBlock, lowest, p.config.BodiesBeforePruning, p.config.BlocksToPrune)
+	if !ok {
+		return nil
+	}
+	log.Debug("Pruning blocks", "from", from, "to", to)
+	return PruneBlocks(db, from, to)
+}
+
 func calculateNumOfPrunedBlocks(currentBlock, lastPrunedBlock uint64, blocksBeforePruning uint64, blocksBatch uint64) (uint64, uint64, bool) {
 	//underflow see https://github.com/ledgerwatch/turbo-geth/issues/115
 	if currentBlock <= lastPrunedBlock {
@@ -141,6 +163,76 @@ func (p *BasicPruner) WriteLastPrunedBlockNum(num uint64) {
 	}
 }
 
+// ReadLowestAvailableBlock returns the lowest block whose body, receipts and transaction lookup entries
+// are not pruned, it is 0 if the blocks have never been pruned
+func ReadLowestAvailableBlock(db ethdb.Getter) (uint64, error) {
+	v, err := db.Get(dbutils.DatabaseInfoBucket, dbutils.LowestAvailableBlockKey)
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		return 0, err
+	}
+	if len(v) != 8 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+func writeLowestAvailableBlock(db ethdb.Putter, blockNumber uint64) error {
+	return db.Put(dbutils.DatabaseInfoBucket, dbutils.LowestAvailableBlockKey, dbutils.EncodeBlockNumber(blockNumber))
+}
+
+// CheckBlockPruned returns ErrBlockPruned if the body and the receipts of the block are removed by the pruner
+func CheckBlockPruned(db ethdb.Getter, blockNumber uint64) error {
+	lowest, err := ReadLowestAvailableBlock(db)
+	if err != nil {
+		return err
+	}
+	if blockNumber > 0 && blockNumber < lowest {
+		return fmt.Errorf("%w: block %d is below the lowest available block %d", ErrBlockPruned, blockNumber, lowest)
+	}
+	return nil
+}
+
+// PruneBlocks removes the bodies, the senders, the receipts and the transaction lookup entries of the
+// blocks from blockNumFrom to blockNumTo-1, both of the canonical chain and of the forks. The genesis
+// block is kept. The removal is committed in one batch together with the new lowest available block
+func PruneBlocks(db ethdb.Database, blockNumFrom uint64, blockNumTo uint64) error {
+	if blockNumFrom == 0 {
+		blockNumFrom = 1
+	}
+	if blockNumFrom >= blockNumTo {
+		return nil
+	}
+	batch := db.NewBatch()
+	for number := blockNumFrom; number < blockNumTo; number++ {
+		hash := rawdb.ReadCanonicalHash(db, number)
+		body := rawdb.ReadBody(db, hash, number)
+		if body == nil {
+			continue
+		}
+		for _, tx := range body.Transactions {
+			if err := rawdb.DeleteTxLookupEntry(batch, tx.Hash()); err != nil {
+				return err
+			}
+		}
+	}
+	for _, bucket := range [][]byte{dbutils.BlockBodyPrefix, dbutils.SendersPrefix, dbutils.BlockReceiptsPrefix} {
+		bucket := bucket
+		if err := db.Walk(bucket, dbutils.EncodeBlockNumber(blockNumFrom), 0, func(k, _ []byte) (bool, error) {
+			if binary.BigEndian.Uint64(k) >= blockNumTo {
+				return false, nil
+			}
+			return true, batch.Delete(bucket, common.CopyBytes(k))
+		}); err != nil {
+			return err
+		}
+	}
+	if err := writeLowestAvailableBlock(batch, blockNumTo); err != nil {
+		return err
+	}
+	_, err := batch.Commit()
+	return err
+}
+
 func PruneStorageOfSelfDestructedAccounts(db ethdb.Database) error {
 	keysToRemove := newKeysToRemove()
 	if err := db.Walk(dbutils.IntermediateTrieHashBucket, []byte{}, 0, func(k, v []byte) (b bool, e error) {
@@ -173,8 +265,12 @@ func PruneStorageOfSelfDestructedAccounts(db ethdb.Database) error {
 	return nil
 }
 
+// Prune removes the change sets of the blocks from blockNumFrom to blockNumTo and the history index
+// entries of the changed keys up to blockNumTo. The history above blockNumTo stays complete, so GetAsOf
+// returns the same values for the blocks after blockNumTo
 func Prune(db ethdb.Database, blockNumFrom uint64, blockNumTo uint64) error {
 	keysToRemove := newKeysToRemove()
+	accountKeys := make(map[string]struct{})
 	err := db.Walk(dbutils.AccountChangeSetBucket, []byte{}, 0, func(key, v []byte) (b bool, e error) {
 		timestamp, _ := dbutils.DecodeTimestamp(key)
 		if timestamp < blockNumFrom {
@@ -187,8 +283,7 @@ func Prune(db ethdb.Database, blockNumFrom uint64, blockNumTo uint64) error {
 		keysToRemove.AccountChangeSet = append(keysToRemove.AccountChangeSet, common.CopyBytes(key))
 
 		innerErr := changeset.AccountChangeSetBytes(v).Walk(func(cKey, _ []byte) error {
-			compKey, _ := dbutils.CompositeKeySuffix(cKey, timestamp)
-			keysToRemove.AccountHistoryKeys = append(keysToRemove.AccountHistoryKeys, compKey)
+			accountKeys[string(historyIndexPrefix(cKey))] = struct{}{}
 			return nil
 		})
 		if innerErr != nil {
@@ -199,6 +294,7 @@ func Prune(db ethdb.Database, blockNumFrom uint64, blockNumTo uint64) error {
 	if err != nil {
 		return err
 	}
+	storageKeys := make(map[string]struct{})
 	err = db.Walk(dbutils.StorageChangeSetBucket, []byte{}, 0, func(key, v []byte) (b bool, e error) {
 		timestamp, _ := dbutils.DecodeTimestamp(key)
 		if timestamp < blockNumFrom {
@@ -210,20 +306,39 @@ func Prune(db ethdb.Database, blockNumFrom uint64, blockNumTo uint64) error {
 
 		keysToRemove.StorageChangeSet = append(keysToRemove.StorageChangeSet, common.CopyBytes(key))
 
-		noop := func(cKey, _ []byte) error {
-			//todo implement pruning for thin history
+		innerErr := changeset.StorageChangeSetBytes(v).Walk(func(cKey, _ []byte) error {
+			// The index chunks do not have the incarnation, all the incarnations of the key are pruned at once
+			storageKeys[string(historyIndexPrefix(cKey))] = struct{}{}
 			return nil
-		}
-
-		if innerErr := changeset.StorageChangeSetBytes(v).Walk(noop); innerErr != nil {
+		})
+		if innerErr != nil {
 			return false, innerErr
 		}
-
 		return true, nil
 	})
 	if err != nil {
 		return err
 	}
+
+	accountChunks := make(map[string][]byte)
+	for key := range accountKeys {
+		if err := pruneHistoryIndex(db, dbutils.AccountsHistoryBucket, []byte(key), blockNumTo, &keysToRemove.AccountHistoryKeys, accountChunks); err != nil {
+			return err
+		}
+	}
+	storageChunks := make(map[string][]byte)
+	for key := range storageKeys {
+		if err := pruneHistoryIndex(db, dbutils.StorageHistoryBucket, []byte(key), blockNumTo, &keysToRemove.StorageHistoryKeys, storageChunks); err != nil {
+			return err
+		}
+	}
+	if err := batchPut(db, dbutils.AccountsHistoryBucket, accountChunks); err != nil {
+		return err
+	}
+	if err := batchPut(db, dbutils.StorageHistoryBucket, storageChunks); err != nil {
+		return err
+	}
+
 	err = batchDelete(db, keysToRemove)
 	if err != nil {
 		return err
@@ -232,6 +347,48 @@ func Prune(db ethdb.Database, blockNumFrom uint64, blockNumTo uint64) error {
 	return nil
 }
 
+// historyIndexPrefix returns the part of the index chunk keys of the change set key before the block number
+func historyIndexPrefix(key []byte) []byte {
+	chunkKey := dbutils.IndexChunkKey(key, 0)
+	return chunkKey[:len(chunkKey)-8]
+}
+
+// pruneHistoryIndex walks the index chunks of the key, the chunks with all the elements up to blockNumTo are
+// added to chunksToRemove, the first chunk going beyond blockNumTo is truncated and put into chunksToUpdate.
+// The chunks are ordered by their last element, so the chunks after it are not changed
+func pruneHistoryIndex(db ethdb.Getter, bucket []byte, prefix []byte, blockNumTo uint64, chunksToRemove *Keys, chunksToUpdate map[string][]byte) error {
+	startKey := make([]byte, len(prefix)+8)
+	copy(startKey, prefix)
+	return db.Walk(bucket, startKey, uint(8*len(prefix)), func(k, v []byte) (bool, error) {
+		index := dbutils.WrapHistoryIndex(v)
+		if last, ok := index.LastElement(); !ok || last <= blockNumTo {
+			*chunksToRemove = append(*chunksToRemove, common.CopyBytes(k))
+			return true, nil
+		}
+		truncated := index.TruncateLessOrEqual(blockNumTo)
+		if len(truncated) < len(index) {
+			chunksToUpdate[string(common.CopyBytes(k))] = truncated
+		}
+		return false, nil
+	})
+}
+
+func batchPut(db ethdb.Database, bucket []byte, values map[string][]byte) error {
+	batch := db.NewBatch()
+	for k, v := range values {
+		if err := batch.Put(bucket, []byte(k), v); err != nil {
+			return err
+		}
+		if batch.BatchSize() >= batch.IdealBatchSize() {
+			if _, err := batch.Commit(); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := batch.Commit()
+	return err
+}
+
 func batchDelete(db ethdb.Database, keys *keysToRemove) error {
 	log.Debug("Removing: ", "accounts", len(keys.AccountHistoryKeys), "storage", len(keys.StorageHistoryKeys), "suffix", len(keys.AccountChangeSet))
 	iterator := LimitIterator(keys, DeleteLimit)
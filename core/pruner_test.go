@@ -1,13 +1,20 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 	"testing"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -169,3 +176,138 @@ func TestPruneStorageOfSelfDestructedAccounts(t *testing.T) {
 
 	assert.Equal("9999", common.Bytes2Hex(v))
 }
+
+func TestPruneHistory(t *testing.T) {
+	require, assert, db := require.New(t), assert.New(t), ethdb.NewMemDatabase()
+	ctx := context.Background()
+
+	// The account and its storage item change in every block, so their indexes have several chunks
+	const numBlocks, pruneTo = 2500, 1500
+	address := common.HexToAddress("0x1234")
+	addrHash := crypto.Keccak256Hash(address[:])
+	key := common.HexToHash("0x01")
+	storageKey := dbutils.GenerateCompositeStorageKey(addrHash, 1, crypto.Keccak256Hash(key[:]))
+	original := accounts.NewAccount()
+	for blockNr := uint64(1); blockNr <= numBlocks; blockNr++ {
+		w := state.NewDbStateWriter(db, blockNr)
+		account := accounts.NewAccount()
+		account.Initialised = true
+		account.Balance.SetUint64(blockNr)
+		account.Incarnation = 1
+		require.NoError(w.UpdateAccountData(ctx, address, &original, &account))
+		originalValue, value := common.BigToHash(new(big.Int).SetUint64(blockNr-1)), common.BigToHash(new(big.Int).SetUint64(blockNr))
+		require.NoError(w.WriteAccountStorage(ctx, address, 1, &key, &originalValue, &value))
+		require.NoError(w.WriteChangeSets())
+		require.NoError(w.WriteHistory())
+		original = account
+	}
+
+	asOf := func(blockNr uint64) ([]byte, []byte) {
+		acc, err := db.GetAsOf(dbutils.CurrentStateBucket, dbutils.AccountsHistoryBucket, addrHash[:], blockNr)
+		require.NoError(err)
+		storage, err := db.GetAsOf(dbutils.CurrentStateBucket, dbutils.StorageHistoryBucket, storageKey, blockNr)
+		require.NoError(err)
+		return acc, storage
+	}
+	checkedBlocks := []uint64{pruneTo + 1, pruneTo + 2, 2000, 2001, numBlocks}
+	expected := make(map[uint64][2][]byte)
+	for _, blockNr := range checkedBlocks {
+		acc, storage := asOf(blockNr)
+		expected[blockNr] = [2][]byte{acc, storage}
+	}
+
+	require.NoError(Prune(db, 0, pruneTo))
+
+	for _, blockNr := range checkedBlocks {
+		acc, storage := asOf(blockNr)
+		assert.Equal(expected[blockNr][0], acc, "account as of block %d", blockNr)
+		assert.Equal(expected[blockNr][1], storage, "storage as of block %d", blockNr)
+	}
+
+	// The history at the new lower bound still has the values written by the last pruned block
+	acc, storage := asOf(pruneTo + 1)
+	var account accounts.Account
+	require.NoError(account.DecodeForStorage(acc))
+	assert.Equal(uint64(pruneTo), account.Balance.Uint64(), "balance as of the lowest block")
+	assert.Equal(uint64(pruneTo), new(big.Int).SetBytes(storage).Uint64(), "storage as of the lowest block")
+
+	for _, bucket := range [][]byte{dbutils.AccountChangeSetBucket, dbutils.StorageChangeSetBucket} {
+		_, err := db.Get(bucket, dbutils.EncodeTimestamp(pruneTo))
+		assert.True(errors.Is(err, ethdb.ErrKeyNotFound), "change set of the pruned block in %s", bucket)
+		_, err = db.Get(bucket, dbutils.EncodeTimestamp(pruneTo+1))
+		assert.NoError(err, "change set of the first block after pruning in %s", bucket)
+	}
+
+	// The index starts right after the pruned blocks and keeps all the later ones
+	indexed := func(bucket, prefix []byte) []uint64 {
+		var blockNums []uint64
+		require.NoError(db.Walk(bucket, prefix, uint(8*len(prefix)), func(k, v []byte) (bool, error) {
+			numbers, _, err := dbutils.WrapHistoryIndex(v).Decode()
+			blockNums = append(blockNums, numbers...)
+			return true, err
+		}))
+		return blockNums
+	}
+	for _, blockNums := range [][]uint64{
+		indexed(dbutils.AccountsHistoryBucket, addrHash[:]),
+		indexed(dbutils.StorageHistoryBucket, append(common.CopyBytes(storageKey[:common.HashLength]), storageKey[common.HashLength+common.IncarnationLength:]...)),
+	} {
+		require.Len(blockNums, numBlocks-pruneTo)
+		assert.Equal(uint64(pruneTo+1), blockNums[0])
+		assert.Equal(uint64(numBlocks), blockNums[len(blockNums)-1])
+	}
+}
+
+func TestPruneBlocks(t *testing.T) {
+	require, assert, db := require.New(t), assert.New(t), ethdb.NewMemDatabase()
+	ctx := context.Background()
+
+	// Every block but the genesis has one transaction, the block 3 has a fork
+	const numBlocks, pruneTo = 10, 5
+	var blocks []*types.Block
+	for number := uint64(0); number <= numBlocks; number++ {
+		var txs []*types.Transaction
+		var receipts types.Receipts
+		if number > 0 {
+			tx := types.NewTransaction(number, common.HexToAddress("0x1234"), big.NewInt(int64(number)), 21000, big.NewInt(1), nil)
+			txs = append(txs, tx)
+			receipts = append(receipts, &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: tx.Hash(), GasUsed: 21000})
+		}
+		block := types.NewBlock(&types.Header{Number: new(big.Int).SetUint64(number)}, txs, nil, receipts)
+		rawdb.WriteBlock(ctx, db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), number)
+		rawdb.WriteReceipts(db, block.Hash(), number, receipts)
+		rawdb.WriteTxLookupEntries(db, block)
+		blocks = append(blocks, block)
+	}
+	fork := types.NewBlock(&types.Header{Number: big.NewInt(3), Extra: []byte("fork")}, nil, nil, nil)
+	rawdb.WriteBlock(ctx, db, fork)
+
+	require.NoError(PruneBlocks(db, 0, pruneTo))
+
+	lowest, err := ReadLowestAvailableBlock(db)
+	require.NoError(err)
+	assert.Equal(uint64(pruneTo), lowest)
+
+	for _, block := range blocks {
+		number := block.NumberU64()
+		pruned := number > 0 && number < pruneTo
+		assert.Equal(!pruned, rawdb.HasBody(db, block.Hash(), number), "body of block %d", number)
+		assert.Equal(!pruned, rawdb.HasReceipts(db, block.Hash(), number), "receipts of block %d", number)
+		for _, tx := range block.Transactions() {
+			assert.Equal(!pruned, rawdb.ReadTxLookupEntry(db, tx.Hash()) != nil, "tx lookup of block %d", number)
+		}
+		assert.NotNil(rawdb.ReadHeader(db, block.Hash(), number), "header of block %d", number)
+		if pruned {
+			assert.True(errors.Is(CheckBlockPruned(db, number), ErrBlockPruned), "block %d", number)
+		} else {
+			assert.NoError(CheckBlockPruned(db, number), "block %d", number)
+		}
+	}
+	assert.False(rawdb.HasBody(db, fork.Hash(), 3), "body of the fork")
+
+	// The next range starts from the lowest available block
+	require.NoError(PruneBlocks(db, lowest, numBlocks))
+	assert.False(rawdb.HasBody(db, blocks[numBlocks-1].Hash(), numBlocks-1))
+	assert.True(rawdb.HasBody(db, blocks[numBlocks].Hash(), numBlocks))
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/params"
 	"github.com/ledgerwatch/turbo-geth/rlp"
@@ -33,12 +34,33 @@ import (
 // ReadCanonicalHash retrieves the hash assigned to a canonical block number.
 func ReadCanonicalHash(db DatabaseReader, number uint64) common.Hash {
 	data, _ := db.Get(dbutils.HeaderPrefix, dbutils.HeaderHashKey(number))
+	if len(data) == 0 {
+		if reader, ok := db.(ethdb.AncientReader); ok {
+			data, _ = reader.Ancient(ethdb.FreezerHashTable, number)
+		}
+	}
 	if len(data) == 0 {
 		return common.Hash{}
 	}
 	return common.BytesToHash(data)
 }
 
+// readAncient retrieves the data of the block from the freezer, if the database has one.
+// The freezer only holds the canonical blocks, so nothing is returned for the other ones.
+// The database is read before the freezer, so the data being moved into the freezer
+// in the background is found in either of them.
+func readAncient(db DatabaseReader, kind string, hash common.Hash, number uint64) []byte {
+	reader, ok := db.(ethdb.AncientReader)
+	if !ok {
+		return nil
+	}
+	if canonical, _ := reader.Ancient(ethdb.FreezerHashTable, number); !bytes.Equal(canonical, hash[:]) {
+		return nil
+	}
+	data, _ := reader.Ancient(kind, number)
+	return data
+}
+
 // WriteCanonicalHash stores the hash assigned to a canonical block number.
 func WriteCanonicalHash(db DatabaseWriter, hash common.Hash, number uint64) {
 	if err := db.Put(dbutils.HeaderPrefix, dbutils.HeaderHashKey(number), hash.Bytes()); err != nil {
@@ -166,13 +188,16 @@ func WriteFastTrieProgress(db DatabaseWriter, count uint64) {
 // ReadHeaderRLP retrieves a block header in its raw RLP database encoding.
 func ReadHeaderRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(dbutils.HeaderPrefix, dbutils.HeaderKey(number, hash))
+	if len(data) == 0 {
+		data = readAncient(db, ethdb.FreezerHeaderTable, hash, number)
+	}
 	return data
 }
 
 // HasHeader verifies the existence of a block header corresponding to the hash.
 func HasHeader(db DatabaseReader, hash common.Hash, number uint64) bool {
 	if has, err := db.Has(dbutils.HeaderPrefix, dbutils.HeaderKey(number, hash)); !has || err != nil {
-		return false
+		return len(readAncient(db, ethdb.FreezerHeaderTable, hash, number)) > 0
 	}
 	return true
 }
@@ -239,6 +264,9 @@ func deleteHeaderWithoutNumber(db DatabaseDeleter, hash common.Hash, number uint
 // ReadBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func ReadBodyRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(dbutils.BlockBodyPrefix, dbutils.BlockBodyKey(number, hash))
+	if len(data) == 0 {
+		data = readAncient(db, ethdb.FreezerBodiesTable, hash, number)
+	}
 	return data
 }
 
@@ -255,7 +283,7 @@ func WriteBodyRLP(ctx context.Context, db DatabaseWriter, hash common.Hash, numb
 // HasBody verifies the existence of a block body corresponding to the hash.
 func HasBody(db DatabaseReader, hash common.Hash, number uint64) bool {
 	if has, err := db.Has(dbutils.BlockBodyPrefix, dbutils.BlockBodyKey(number, hash)); !has || err != nil {
-		return false
+		return len(readAncient(db, ethdb.FreezerBodiesTable, hash, number)) > 0
 	}
 	return true
 }
@@ -272,10 +300,52 @@ func ReadBody(db DatabaseReader, hash common.Hash, number uint64) *types.Body {
 		return nil
 	}
 	// Post-processing
+	if senders := ReadSenders(db, hash, number); len(senders) == len(body.Transactions) {
+		body.Senders = senders
+	}
 	body.SendersToTxs()
 	return body
 }
 
+// ReadSenders retrieves the senders of the block transactions, recovered by the staged sync.
+func ReadSenders(db DatabaseReader, hash common.Hash, number uint64) []common.Address {
+	data, err := db.Get(dbutils.SendersPrefix, dbutils.BlockBodyKey(number, hash))
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		log.Error("Failed to read block senders", "hash", hash, "err", err)
+		return nil
+	}
+	if len(data)%common.AddressLength != 0 {
+		log.Error("Invalid senders length", "hash", hash, "length", len(data))
+		return nil
+	}
+	senders := make([]common.Address, len(data)/common.AddressLength)
+	for i := range senders {
+		copy(senders[i][:], data[i*common.AddressLength:])
+	}
+	return senders
+}
+
+// WriteSenders stores the senders of the block transactions into the database.
+func WriteSenders(ctx context.Context, db DatabaseWriter, hash common.Hash, number uint64, senders []common.Address) {
+	if common.IsCanceled(ctx) {
+		return
+	}
+	data := make([]byte, common.AddressLength*len(senders))
+	for i, sender := range senders {
+		copy(data[i*common.AddressLength:], sender[:])
+	}
+	if err := db.Put(dbutils.SendersPrefix, dbutils.BlockBodyKey(number, hash), data); err != nil {
+		log.Crit("Failed to store block senders", "err", err)
+	}
+}
+
+// DeleteSenders removes the senders of the block transactions.
+func DeleteSenders(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(dbutils.SendersPrefix, dbutils.BlockBodyKey(number, hash)); err != nil {
+		log.Crit("Failed to delete block senders", "err", err)
+	}
+}
+
 // WriteBody storea a block body into the database.
 func WriteBody(ctx context.Context, db DatabaseWriter, hash common.Hash, number uint64, body *types.Body) {
 	if common.IsCanceled(ctx) {
@@ -299,24 +369,16 @@ func DeleteBody(db DatabaseDeleter, hash common.Hash, number uint64) {
 
 // ReadTdRLP retrieves a block's total difficulty corresponding to the hash in RLP encoding.
 func ReadTdRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
-	//data, _ := db.Ancient(freezerDifficultyTable, number)
-	data := []byte{}
+	data, _ := db.Get(dbutils.HeaderPrefix, dbutils.HeaderTDKey(number, hash))
 	if len(data) == 0 {
-		data, _ = db.Get(dbutils.HeaderPrefix, dbutils.HeaderTDKey(number, hash))
-		// In the background freezer is moving data from leveldb to flatten files.
-		// So during the first check for ancient db, the data is not yet in there,
-		// but when we reach into leveldb, the data was already moved. That would
-		// result in a not found error.
-		if len(data) == 0 {
-			//data, _ = db.Ancient(freezerDifficultyTable, number)
-		}
+		data = readAncient(db, ethdb.FreezerDifficultyTable, hash, number)
 	}
-	return nil // Can't find the data anywhere.
+	return data
 }
 
 // ReadTd retrieves a block's total difficulty corresponding to the hash.
 func ReadTd(db DatabaseReader, hash common.Hash, number uint64) *big.Int {
-	data, _ := db.Get(dbutils.HeaderPrefix, dbutils.HeaderTDKey(number, hash))
+	data := ReadTdRLP(db, hash, number)
 	if len(data) == 0 {
 		return nil
 	}
@@ -350,26 +412,18 @@ func DeleteTd(db DatabaseDeleter, hash common.Hash, number uint64) {
 // to a block.
 func HasReceipts(db DatabaseReader, hash common.Hash, number uint64) bool {
 	if has, err := db.Has(dbutils.BlockReceiptsPrefix, dbutils.BlockReceiptsKey(number, hash)); !has || err != nil {
-		return false
+		return len(readAncient(db, ethdb.FreezerReceiptTable, hash, number)) > 0
 	}
 	return true
 }
 
 // ReadReceiptsRLP retrieves all the transaction receipts belonging to a block in RLP encoding.
 func ReadReceiptsRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
-	data := []byte{}
-	//data, _ := db.Ancient(freezerReceiptTable, number)
+	data, _ := db.Get(dbutils.BlockReceiptsPrefix, dbutils.BlockReceiptsKey(number, hash))
 	if len(data) == 0 {
-		data, _ = db.Get(dbutils.BlockReceiptsPrefix, dbutils.BlockReceiptsKey(number, hash))
-		// In the background freezer is moving data from leveldb to flatten files.
-		// So during the first check for ancient db, the data is not yet in there,
-		// but when we reach into leveldb, the data was already moved. That would
-		// result in a not found error.
-		if len(data) == 0 {
-			//data, _ = db.Ancient(freezerReceiptTable, number)
-		}
+		data = readAncient(db, ethdb.FreezerReceiptTable, hash, number)
 	}
-	return nil // Can't find the data anywhere.
+	return data
 }
 
 // ReadRawReceipts retrieves all the transaction receipts belonging to a block.
@@ -377,7 +431,7 @@ func ReadReceiptsRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.Raw
 // should not be used. Use ReadReceipts instead if the metadata is needed.
 func ReadRawReceipts(db DatabaseReader, hash common.Hash, number uint64) types.Receipts {
 	// Retrieve the flattened receipt slice
-	data, _ := db.Get(dbutils.BlockReceiptsPrefix, dbutils.BlockReceiptsKey(number, hash))
+	data := ReadReceiptsRLP(db, hash, number)
 	if len(data) == 0 {
 		return nil
 	}
@@ -468,7 +522,6 @@ func WriteBlock(ctx context.Context, db DatabaseWriter, block *types.Block) {
 }
 
 // WriteAncientBlock writes entire block data into ancient store and returns the total written size.
-/*
 func WriteAncientBlock(db ethdb.AncientWriter, block *types.Block, receipts types.Receipts, td *big.Int) int {
 	// Encode all block components to RLP format.
 	headerBlob, err := rlp.EncodeToBytes(block.Header())
@@ -498,13 +551,13 @@ func WriteAncientBlock(db ethdb.AncientWriter, block *types.Block, receipts type
 	}
 	return len(headerBlob) + len(bodyBlob) + len(receiptBlob) + len(tdBlob) + common.HashLength
 }
-*/
 
 // DeleteBlock removes all block data associated with a hash.
 func DeleteBlock(db DatabaseDeleter, hash common.Hash, number uint64) {
 	DeleteReceipts(db, hash, number)
 	DeleteHeader(db, hash, number)
 	DeleteBody(db, hash, number)
+	DeleteSenders(db, hash, number)
 	DeleteTd(db, hash, number)
 }
 
@@ -514,6 +567,7 @@ func DeleteBlockWithoutNumber(db DatabaseDeleter, hash common.Hash, number uint6
 	DeleteReceipts(db, hash, number)
 	deleteHeaderWithoutNumber(db, hash, number)
 	DeleteBody(db, hash, number)
+	DeleteSenders(db, hash, number)
 	DeleteTd(db, hash, number)
 }
 
@@ -560,9 +614,3 @@ func ReadBlockByHash(db DatabaseReader, hash common.Hash) *types.Block {
 	}
 	return ReadBlock(db, hash, *number)
 }
-
-// FIXME: implement in Turbo-Geth
-// WriteAncientBlock writes entire block data into ancient store and returns the total written size.
-func WriteAncientBlock(db DatabaseWriter, block *types.Block, receipts types.Receipts, td *big.Int) int {
-	panic("not implemented")
-}
@@ -21,7 +21,10 @@ import (
 	"context"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"math/big"
+	"os"
+	"reflect"
 	"testing"
 
 	"github.com/ledgerwatch/turbo-geth/common"
@@ -104,6 +107,40 @@ func TestBodyStorage(t *testing.T) {
 }
 
 // Tests block storage and retrieval operations.
+// Tests that the senders stored separately are attached to the transactions of the body.
+func TestSendersStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+
+	tx1 := types.NewTransaction(1, common.BytesToAddress([]byte{0x11}), big.NewInt(111), 1111, big.NewInt(11111), []byte{0x11, 0x11, 0x11})
+	tx2 := types.NewTransaction(2, common.BytesToAddress([]byte{0x22}), big.NewInt(222), 2222, big.NewInt(22222), []byte{0x22, 0x22, 0x22})
+	body := &types.Body{Transactions: []*types.Transaction{tx1, tx2}}
+	hash := common.HexToHash("0x01")
+	senders := []common.Address{common.HexToAddress("0xaa"), common.HexToAddress("0xbb")}
+
+	WriteBody(context.Background(), db, hash, 1, body)
+	if entry := ReadSenders(db, hash, 1); len(entry) != 0 {
+		t.Fatalf("Non existent senders returned: %v", entry)
+	}
+	WriteSenders(context.Background(), db, hash, 1, senders)
+	if entry := ReadSenders(db, hash, 1); !reflect.DeepEqual(entry, senders) {
+		t.Fatalf("Retrieved senders mismatch: have %v, want %v", entry, senders)
+	}
+	entry := ReadBody(db, hash, 1)
+	if entry == nil {
+		t.Fatalf("Stored body not found")
+	}
+	for i, tx := range entry.Transactions {
+		// The signer does not matter, as the sender is cached
+		if from, err := types.Sender(types.HomesteadSigner{}, tx); err != nil || from != senders[i] {
+			t.Fatalf("Wrong sender of tx %d: have %x, want %x, err %v", i, from, senders[i], err)
+		}
+	}
+	DeleteSenders(db, hash, 1)
+	if entry := ReadSenders(db, hash, 1); len(entry) != 0 {
+		t.Fatalf("Deleted senders returned: %v", entry)
+	}
+}
+
 func TestBlockStorage(t *testing.T) {
 	db := ethdb.NewMemDatabase()
 
@@ -362,3 +399,58 @@ func checkReceiptsRLP(have, want types.Receipts) error {
 	}
 	return nil
 }
+
+// Tests that the canonical blocks moved into the freezer are read back transparently.
+func TestAncientStorage(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "ancient_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := ethdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	block := types.NewBlockWithHeader(&types.Header{
+		Number:      big.NewInt(0),
+		Extra:       []byte("test block"),
+		UncleHash:   types.EmptyUncleHash,
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+	})
+	hash, number := block.Hash(), block.NumberU64()
+	if entry := ReadBlock(db, hash, number); entry != nil {
+		t.Fatalf("Non existent block returned: %v", entry)
+	}
+	receipts := types.Receipts{&types.Receipt{Status: types.ReceiptStatusSuccessful, Logs: []*types.Log{}}}
+	WriteAncientBlock(db.(ethdb.AncientWriter), block, receipts, big.NewInt(100))
+
+	if h := ReadCanonicalHash(db, number); h != hash {
+		t.Fatalf("Canonical hash mismatch: have %x, want %x", h, hash)
+	}
+	if !HasHeader(db, hash, number) || !HasBody(db, hash, number) || !HasReceipts(db, hash, number) {
+		t.Fatalf("Frozen block not found")
+	}
+	if entry := ReadBlock(db, hash, number); entry == nil {
+		t.Fatalf("Frozen block not found")
+	} else if entry.Hash() != hash {
+		t.Fatalf("Retrieved block mismatch: have %v, want %v", entry, block)
+	}
+	if td := ReadTd(db, hash, number); td == nil || td.Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("Total difficulty mismatch: have %v, want 100", td)
+	}
+	if rs := ReadRawReceipts(db, hash, number); len(rs) != 1 || rs[0].Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("Receipts mismatch: have %v, want %v", rs, receipts)
+	}
+	// The freezer only holds the canonical blocks
+	if HasHeader(db, common.Hash{1}, number) {
+		t.Fatalf("Non canonical header found in the freezer")
+	}
+	// The data of the blocks not moved into the freezer yet is still read from the database
+	WriteTd(db, common.Hash{1}, number, big.NewInt(200))
+	if td := ReadTd(db, common.Hash{1}, number); td == nil || td.Cmp(big.NewInt(200)) != 0 {
+		t.Fatalf("Total difficulty mismatch: have %v, want 200", td)
+	}
+}
@@ -55,6 +55,18 @@ type StateReader interface {
 	ReadAccountIncarnation(address common.Address) (uint64, error)
 }
 
+// StateProver is implemented by the state readers which can prove what they read
+type StateProver interface {
+	GetProof(address common.Address, storageKeys []common.Hash) (*Proof, error)
+}
+
+// Proof is the Merkle proof of an account and of its storage items (EIP-1186)
+type Proof struct {
+	Account     [][]byte
+	StorageHash common.Hash // Root of the storage trie of the account
+	Storage     [][][]byte  // Proofs of the storage items, in the order of the keys
+}
+
 type StateWriter interface {
 	UpdateAccountData(ctx context.Context, address common.Address, original, account *accounts.Account) error
 	UpdateAccountCode(addrHash common.Hash, incarnation uint64, codeHash common.Hash, code []byte) error
@@ -959,22 +971,27 @@ func (tds *TrieDbState) UnwindTo(blockNr uint64) error {
 }
 
 func (tds *TrieDbState) deleteTimestamp(timestamp uint64) error {
+	return DeleteChangeSets(tds.db, timestamp)
+}
+
+// DeleteChangeSets removes account and storage changesets recorded for the given timestamp (block number)
+func DeleteChangeSets(db ethdb.Database, timestamp uint64) error {
 	changeSetKey := dbutils.EncodeTimestamp(timestamp)
-	changedAccounts, err := tds.db.Get(dbutils.AccountChangeSetBucket, changeSetKey)
+	changedAccounts, err := db.Get(dbutils.AccountChangeSetBucket, changeSetKey)
 	if err != nil && err != ethdb.ErrKeyNotFound {
 		return err
 	}
-	changedStorage, err := tds.db.Get(dbutils.StorageChangeSetBucket, changeSetKey)
+	changedStorage, err := db.Get(dbutils.StorageChangeSetBucket, changeSetKey)
 	if err != nil && err != ethdb.ErrKeyNotFound {
 		return err
 	}
 	if len(changedAccounts) > 0 {
-		if err := tds.db.Delete(dbutils.AccountChangeSetBucket, changeSetKey); err != nil {
+		if err := db.Delete(dbutils.AccountChangeSetBucket, changeSetKey); err != nil {
 			return err
 		}
 	}
 	if len(changedStorage) > 0 {
-		if err := tds.db.Delete(dbutils.StorageChangeSetBucket, changeSetKey); err != nil {
+		if err := db.Delete(dbutils.StorageChangeSetBucket, changeSetKey); err != nil {
 			return err
 		}
 	}
@@ -982,12 +999,18 @@ func (tds *TrieDbState) deleteTimestamp(timestamp uint64) error {
 }
 
 func (tds *TrieDbState) truncateHistory(timestampTo uint64, accountMap map[string][]byte, storageMap map[string][]byte) error {
+	return TruncateHistory(tds.db, timestampTo, accountMap, storageMap)
+}
+
+// TruncateHistory removes all history index entries newer than timestampTo for the keys
+// mentioned in accountMap and storageMap (as produced by RewindData)
+func TruncateHistory(db ethdb.Database, timestampTo uint64, accountMap map[string][]byte, storageMap map[string][]byte) error {
 	accountHistoryEffects := make(map[string][]byte)
 	startKey := make([]byte, common.HashLength+8)
 	for key := range accountMap {
 		copy(startKey, []byte(key))
 		binary.BigEndian.PutUint64(startKey[common.HashLength:], timestampTo)
-		if err := tds.db.Walk(dbutils.AccountsHistoryBucket, startKey, uint(8*common.HashLength), func(k, v []byte) (bool, error) {
+		if err := db.Walk(dbutils.AccountsHistoryBucket, startKey, uint(8*common.HashLength), func(k, v []byte) (bool, error) {
 			timestamp := binary.BigEndian.Uint64(k[common.HashLength:]) // the last timestamp in the chunk
 			kStr := string(common.CopyBytes(k))
 			accountHistoryEffects[kStr] = nil
@@ -1014,7 +1037,7 @@ func (tds *TrieDbState) truncateHistory(timestampTo uint64, accountMap map[strin
 		copy(startKey, []byte(key)[:common.HashLength])
 		copy(startKey[common.HashLength:], []byte(key)[common.HashLength+8:])
 		binary.BigEndian.PutUint64(startKey[2*common.HashLength:], timestampTo)
-		if err := tds.db.Walk(dbutils.StorageHistoryBucket, startKey, uint(8*2*common.HashLength), func(k, v []byte) (bool, error) {
+		if err := db.Walk(dbutils.StorageHistoryBucket, startKey, uint(8*2*common.HashLength), func(k, v []byte) (bool, error) {
 			timestamp := binary.BigEndian.Uint64(k[2*common.HashLength:]) // the last timestamp in the chunk
 			kStr := string(common.CopyBytes(k))
 			storageHistoryEffects[kStr] = nil
@@ -1036,22 +1059,22 @@ func (tds *TrieDbState) truncateHistory(timestampTo uint64, accountMap map[strin
 	}
 	for key, value := range accountHistoryEffects {
 		if value == nil {
-			if err := tds.db.Delete(dbutils.AccountsHistoryBucket, []byte(key)); err != nil {
+			if err := db.Delete(dbutils.AccountsHistoryBucket, []byte(key)); err != nil {
 				return err
 			}
 		} else {
-			if err := tds.db.Put(dbutils.AccountsHistoryBucket, []byte(key), value); err != nil {
+			if err := db.Put(dbutils.AccountsHistoryBucket, []byte(key), value); err != nil {
 				return err
 			}
 		}
 	}
 	for key, value := range storageHistoryEffects {
 		if value == nil {
-			if err := tds.db.Delete(dbutils.StorageHistoryBucket, []byte(key)); err != nil {
+			if err := db.Delete(dbutils.StorageHistoryBucket, []byte(key)); err != nil {
 				return err
 			}
 		} else {
-			if err := tds.db.Put(dbutils.StorageHistoryBucket, []byte(key), value); err != nil {
+			if err := db.Put(dbutils.StorageHistoryBucket, []byte(key), value); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,85 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// Implements StateReader by reading the state as of the block from the history buckets.
+// Unlike DbState, it returns the errors of the database instead of treating the values as missing.
+type HistoryStateReader struct {
+	db      ethdb.Getter
+	blockNr uint64
+}
+
+func NewHistoryStateReader(db ethdb.Getter, blockNr uint64) *HistoryStateReader {
+	return &HistoryStateReader{
+		db:      db,
+		blockNr: blockNr,
+	}
+}
+
+func (hr *HistoryStateReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return nil, err
+	}
+	enc, err := hr.db.GetAsOf(dbutils.CurrentStateBucket, dbutils.AccountsHistoryBucket, addrHash[:], hr.blockNr+1)
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return nil, err
+	}
+	if len(enc) == 0 {
+		return nil, nil
+	}
+	var acc accounts.Account
+	if err := acc.DecodeForStorage(enc); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+func (hr *HistoryStateReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return nil, err
+	}
+	keyHash, err := common.HashData(key[:])
+	if err != nil {
+		return nil, err
+	}
+	compositeKey := dbutils.GenerateCompositeStorageKey(addrHash, incarnation, keyHash)
+	enc, err := hr.db.GetAsOf(dbutils.CurrentStateBucket, dbutils.StorageHistoryBucket, compositeKey, hr.blockNr+1)
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return nil, err
+	}
+	return enc, nil
+}
+
+func (hr *HistoryStateReader) ReadAccountCode(address common.Address, codeHash common.Hash) ([]byte, error) {
+	if bytes.Equal(codeHash[:], emptyCodeHash) {
+		return nil, nil
+	}
+	return hr.db.Get(dbutils.CodeBucket, codeHash[:])
+}
+
+func (hr *HistoryStateReader) ReadAccountCodeSize(address common.Address, codeHash common.Hash) (int, error) {
+	code, err := hr.ReadAccountCode(address, codeHash)
+	if err != nil {
+		return 0, err
+	}
+	return len(code), nil
+}
+
+func (hr *HistoryStateReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return 0, err
+	}
+	incarnation, _, err := ethdb.GetHistoricalAccountIncarnation(hr.db, addrHash, hr.blockNr+1)
+	return incarnation, err
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingHistory is the database whose history bucket can't be read
+type failingHistory struct {
+	*ethdb.BoltDatabase
+	hBucket []byte
+	err     error
+}
+
+func (db failingHistory) GetAsOf(bucket, hBucket, key []byte, timestamp uint64) ([]byte, error) {
+	if bytes.Equal(hBucket, db.hBucket) {
+		return nil, db.err
+	}
+	return db.BoltDatabase.GetAsOf(bucket, hBucket, key, timestamp)
+}
+
+func TestHistoryStateReader(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ctx := context.Background()
+	address := common.HexToAddress("0x1234")
+	key := common.HexToHash("0x01")
+
+	// The balance and the storage item of the account are the number of the block
+	original := accounts.NewAccount()
+	for blockNr := uint64(1); blockNr <= 2; blockNr++ {
+		w := NewDbStateWriter(db, blockNr)
+		account := accounts.NewAccount()
+		account.Initialised = true
+		account.Incarnation = 1
+		account.Balance.SetUint64(blockNr)
+		require.NoError(t, w.UpdateAccountData(ctx, address, &original, &account))
+		originalValue, value := common.BigToHash(new(big.Int).SetUint64(blockNr-1)), common.BigToHash(new(big.Int).SetUint64(blockNr))
+		require.NoError(t, w.WriteAccountStorage(ctx, address, 1, &key, &originalValue, &value))
+		require.NoError(t, w.WriteChangeSets())
+		require.NoError(t, w.WriteHistory())
+		original = account
+	}
+
+	r := NewHistoryStateReader(db, 1)
+	acc, err := r.ReadAccountData(address)
+	require.NoError(t, err)
+	require.NotNil(t, acc)
+	assert.Equal(t, uint64(1), acc.Balance.Uint64())
+	v, err := r.ReadAccountStorage(address, 1, &key)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), new(big.Int).SetBytes(v).Uint64())
+
+	acc, err = r.ReadAccountData(common.HexToAddress("0x5678"))
+	assert.NoError(t, err)
+	assert.Nil(t, acc)
+	otherKey := common.HexToHash("0x02")
+	v, err = r.ReadAccountStorage(address, 1, &otherKey)
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+
+	// The read errors are returned instead of the missing values, and they are reported by the state
+	readErr := errors.New("history is not available")
+	for _, hBucket := range [][]byte{dbutils.AccountsHistoryBucket, dbutils.StorageHistoryBucket} {
+		ibs := New(NewHistoryStateReader(failingHistory{db, hBucket, readErr}, 1))
+		ibs.GetState(address, key)
+		assert.True(t, errors.Is(ibs.Error(), readErr), "read error of %s", hBucket)
+	}
+}
@@ -227,6 +227,41 @@ func TestMutationCommitThinHistory(t *testing.T) {
 	}
 }
 
+func TestRemoteBoltDatabaseGetAsOf(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	mutDB := db.NewBatch()
+
+	addrHashes, _, _, accHistory, accHistoryStateStorage := generateAccountsWithStorageAndHistory(t, mutDB, 5, 5)
+	if _, err := mutDB.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The remote database must find the same history as the local one, and fall back to the current state
+	remoteDb := ethdb.NewRemoteBoltDatabase(db.AbstractKV())
+	for i, addrHash := range addrHashes {
+		for _, timestamp := range []uint64{1, 3} {
+			expected, err := db.GetAsOf(dbutils.CurrentStateBucket, dbutils.AccountsHistoryBucket, addrHash[:], timestamp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := remoteDb.GetAsOf(dbutils.CurrentStateBucket, dbutils.AccountsHistoryBucket, addrHash[:], timestamp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, expected, res, "account %x as of %d", addrHash, timestamp)
+
+			for k := range accHistoryStateStorage[i] {
+				key := dbutils.GenerateCompositeStorageKey(addrHash, accHistory[i].Incarnation, k)
+				// Storage deleted by the block is not found in the current state
+				expected, expectedErr := db.GetAsOf(dbutils.CurrentStateBucket, dbutils.StorageHistoryBucket, key, timestamp)
+				res, err := remoteDb.GetAsOf(dbutils.CurrentStateBucket, dbutils.StorageHistoryBucket, key, timestamp)
+				assert.Equal(t, expectedErr, err)
+				assert.Equal(t, expected, res, "storage %x as of %d", key, timestamp)
+			}
+		}
+	}
+}
+
 func generateAccountsWithStorageAndHistory(t *testing.T, db ethdb.Database, numOfAccounts, numOfStateKeys int) ([]common.Hash, []*accounts.Account, []map[common.Hash]common.Hash, []*accounts.Account, []map[common.Hash]common.Hash) {
 	t.Helper()
 
@@ -49,13 +49,6 @@ var (
 	emptyCode = crypto.Keccak256Hash(nil)
 )
 
-type proofList [][]byte
-
-func (n *proofList) Put(key []byte, value []byte) error {
-	*n = append(*n, value)
-	return nil
-}
-
 type StateTracer interface {
 	CaptureAccountRead(account common.Address) error
 	CaptureAccountWrite(account common.Address) error
@@ -386,26 +379,30 @@ func (sdb *IntraBlockState) GetState(addr common.Address, hash common.Hash) comm
 
 // GetProof returns the Merkle proof for a given account
 func (sdb *IntraBlockState) GetProof(a common.Address) ([][]byte, error) {
-	//sdb.Lock()
-	//defer sdb.Unlock()
-	//var proof proofList
-	//err := sdb.trie.Prove(crypto.Keccak256(a.Bytes()), 0, &proof)
-	//return [][]byte(proof), err
-	return nil, nil
+	proof, err := sdb.GetProofs(a, nil)
+	if err != nil {
+		return nil, err
+	}
+	return proof.Account, nil
 }
 
 // GetStorageProof returns the storage proof for a given key
 func (sdb *IntraBlockState) GetStorageProof(a common.Address, key common.Hash) ([][]byte, error) {
-	//sdb.Lock()
-	//defer sdb.Unlock()
-	//var proof proofList
-	//trie := sdb.StorageTrie(a)
-	//if trie == nil {
-	//	return proof, errors.New("storage trie for requested address does not exist")
-	//}
-	//err := trie.Prove(crypto.Keccak256(key.Bytes()), 0, &proof)
-	//return [][]byte(proof), err
-	return nil, nil
+	proof, err := sdb.GetProofs(a, []common.Hash{key})
+	if err != nil {
+		return nil, err
+	}
+	return proof.Storage[0], nil
+}
+
+// GetProofs returns the Merkle proofs for a given account and its storage keys. The proofs are of
+// the state the reader reads, the changes made to this IntraBlockState are not reflected in them
+func (sdb *IntraBlockState) GetProofs(a common.Address, keys []common.Hash) (*Proof, error) {
+	prover, ok := sdb.stateReader.(StateProver)
+	if !ok {
+		return nil, fmt.Errorf("state reader %T does not support proofs", sdb.stateReader)
+	}
+	return prover.GetProof(a, keys)
 }
 
 // GetCommittedState retrieves a value from the given account's committed storage trie.
@@ -20,11 +20,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
@@ -292,6 +294,86 @@ func (dbs *DbState) Dumper() *Dumper {
 	return &Dumper{db: dbs.db, blockNumber: dbs.blockNr}
 }
 
+// MaxProofRewind is the number of blocks behind the head the proofs can be made for. The changes
+// made after the block are read from the history for every proof
+const MaxProofRewind = 128
+
+// GetProof returns the Merkle proofs of the account and of its storage items as of the block.
+// Only the paths to the keys are resolved from the state, the rest of the trie is taken from
+// IntermediateTrieHashBucket
+func (dbs *DbState) GetProof(address common.Address, storageKeys []common.Hash) (*Proof, error) {
+	db, ok := dbs.db.(ethdb.Database)
+	if !ok {
+		return nil, fmt.Errorf("proofs need the database, given: %T", dbs.db)
+	}
+	if err := dbs.checkProofRewind(); err != nil {
+		return nil, err
+	}
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return nil, err
+	}
+	acc, err := dbs.ReadAccountData(address)
+	if err != nil {
+		return nil, err
+	}
+
+	t := trie.New(common.Hash{})
+	// The state is rewound from the current one, which is a no-op for the latest block
+	r := trie.NewResolver(0, dbs.blockNr)
+	r.SetHistorical(true)
+	var hex []byte
+	trie.DecompressNibbles(addrHash[:], &hex)
+	r.AddRequest(t.NewResolveRequest(nil, hex, 0, nil))
+	keyHashes := make([]common.Hash, len(storageKeys))
+	for i, key := range storageKeys {
+		if keyHashes[i], err = common.HashData(key[:]); err != nil {
+			return nil, err
+		}
+		if acc == nil || acc.Incarnation == 0 {
+			continue
+		}
+		var storageHex []byte
+		trie.DecompressNibbles(keyHashes[i][:], &storageHex)
+		r.AddRequest(t.NewResolveRequest(dbutils.GenerateStoragePrefix(addrHash[:], acc.Incarnation), storageHex, 0, nil))
+	}
+	if err = r.ResolveWithDb(db, dbs.blockNr, false); err != nil {
+		return nil, err
+	}
+
+	proof := &Proof{StorageHash: trie.EmptyRoot, Storage: make([][][]byte, len(keyHashes))}
+	if proof.Account, err = t.Prove(addrHash[:]); err != nil {
+		return nil, err
+	}
+	// The storage roots are not kept in the state, the one of the account is computed by the proving
+	if resolved, ok := t.GetAccount(addrHash[:]); ok && resolved != nil {
+		proof.StorageHash = resolved.Root
+	}
+	for i, keyHash := range keyHashes {
+		if proof.Storage[i], err = t.ProveStorage(addrHash[:], keyHash[:]); err != nil {
+			return nil, err
+		}
+	}
+	return proof, nil
+}
+
+// checkProofRewind refuses the blocks whose state is too far from the current one to be rewound,
+// or whose history is pruned
+func (dbs *DbState) checkProofRewind() error {
+	headHash := rawdb.ReadHeadBlockHash(dbs.db)
+	if headNumber := rawdb.ReadHeaderNumber(dbs.db, headHash); headNumber != nil && *headNumber > dbs.blockNr+MaxProofRewind {
+		return fmt.Errorf("block %d is more than %d blocks behind the head %d, proofs are not available", dbs.blockNr, MaxProofRewind, *headNumber)
+	}
+	lastPruned, err := dbs.db.Get(dbutils.LastPrunedBlockKey, dbutils.LastPrunedBlockKey)
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return err
+	}
+	if len(lastPruned) == 8 && dbs.blockNr < binary.LittleEndian.Uint64(lastPruned) {
+		return fmt.Errorf("history of block %d is pruned, proofs are not available", dbs.blockNr)
+	}
+	return nil
+}
+
 // WalkStorageRange calls the walker for each storage item whose key starts with a given prefix,
 // for no more than maxItems.
 // Returns whether all matching storage items were traversed (provided there was no error).
@@ -0,0 +1,35 @@
+package state
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDbStateProofRewind(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	// Without the head nothing is refused
+	assert.NoError(t, NewDbState(db, 0).checkProofRewind())
+
+	head := common.HexToHash("0x01")
+	rawdb.WriteHeaderNumber(db, head, 1000)
+	rawdb.WriteHeadBlockHash(db, head)
+	_, err := NewDbState(db, 1000-MaxProofRewind-1).GetProof(common.Address{}, nil)
+	assert.Error(t, err, "expected the block beyond the rewind limit to be refused")
+	assert.NoError(t, NewDbState(db, 1000-MaxProofRewind).checkProofRewind())
+	assert.NoError(t, NewDbState(db, 1000).checkProofRewind())
+
+	lastPruned := make([]byte, 8)
+	binary.LittleEndian.PutUint64(lastPruned, 900)
+	require.NoError(t, db.Put(dbutils.LastPrunedBlockKey, dbutils.LastPrunedBlockKey, lastPruned))
+	assert.Error(t, NewDbState(db, 899).checkProofRewind(), "expected the block with pruned history to be refused")
+	assert.NoError(t, NewDbState(db, 900).checkProofRewind())
+}
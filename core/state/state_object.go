@@ -135,11 +135,13 @@ func (so *stateObject) EncodeRLP(w io.Writer) error {
 	return rlp.Encode(w, so.data)
 }
 
-// setError remembers the first non-nil error it is called with.
+// setError remembers the first non-nil error it is called with, the error is reported by
+// the IntraBlockState too. The callers hold the lock of the IntraBlockState.
 func (so *stateObject) setError(err error) {
 	if so.dbErr == nil {
 		so.dbErr = err
 	}
+	so.db.setErrorUnsafe(err)
 }
 
 func (so *stateObject) markSuicided() {
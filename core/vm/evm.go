@@ -482,3 +482,7 @@ func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *
 
 // ChainConfig returns the environment's chain configuration
 func (evm *EVM) ChainConfig() *params.ChainConfig { return evm.chainConfig }
+
+// CallGasTemp returns the gas given to the callee of the CALL-like operation being executed,
+// without the stipend. Tracers use it to get the gas of the calls to the accounts without code
+func (evm *EVM) CallGasTemp() uint64 { return evm.callGasTemp }
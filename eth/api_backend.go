@@ -112,10 +112,18 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumb
 	}
 	// Otherwise resolve and return the block
 	bn := b.resolveBlockNumber(blockNr)
+	if err := core.CheckBlockPruned(b.eth.chainDb, bn); err != nil {
+		return nil, err
+	}
 	return b.eth.blockchain.GetBlockByNumber(bn), nil
 }
 
 func (b *EthAPIBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	if number := rawdb.ReadHeaderNumber(b.eth.chainDb, hash); number != nil {
+		if err := core.CheckBlockPruned(b.eth.chainDb, *number); err != nil {
+			return nil, err
+		}
+	}
 	return b.eth.blockchain.GetBlockByHash(hash), nil
 }
 
@@ -131,6 +139,9 @@ func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash r
 		if blockNrOrHash.RequireCanonical && b.eth.blockchain.GetCanonicalHash(header.Number.Uint64()) != hash {
 			return nil, errors.New("hash is not currently canonical")
 		}
+		if err := core.CheckBlockPruned(b.eth.chainDb, header.Number.Uint64()); err != nil {
+			return nil, err
+		}
 		block := b.eth.blockchain.GetBlock(hash, header.Number.Uint64())
 		if block == nil {
 			return nil, errors.New("header found, but block body is missing")
@@ -186,8 +197,14 @@ func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (type
 	if number == nil {
 		return nil, nil
 	}
+	if err := core.CheckBlockPruned(b.eth.chainDb, *number); err != nil {
+		return nil, err
+	}
 
 	block := rawdb.ReadBlock(b.eth.chainDb, hash, *number)
+	if block == nil {
+		return nil, nil
+	}
 
 	if cached := b.tryGetReceiptsFromDb(block); cached != nil {
 		return cached, nil
@@ -0,0 +1,331 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/tracers"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// PrivateTraceAPI is the collection of the OpenEthereum-compatible trace_ methods
+type PrivateTraceAPI struct {
+	eth *Ethereum
+}
+
+// NewPrivateTraceAPI creates a new API definition for the trace_ methods of the Ethereum service.
+func NewPrivateTraceAPI(eth *Ethereum) *PrivateTraceAPI {
+	return &PrivateTraceAPI{eth: eth}
+}
+
+// TraceFilterRequest is the argument of trace_filter. The traces match if their sender is one of
+// FromAddress and their receiver is one of ToAddress, an empty list matches all addresses
+type TraceFilterRequest struct {
+	FromBlock   *rpc.BlockNumber `json:"fromBlock"`
+	ToBlock     *rpc.BlockNumber `json:"toBlock"`
+	FromAddress []common.Address `json:"fromAddress"`
+	ToAddress   []common.Address `json:"toAddress"`
+	After       *uint64          `json:"after"`
+	Count       *uint64          `json:"count"`
+}
+
+// Block returns the traces of all the transactions of the block and its rewards
+func (api *PrivateTraceAPI) Block(ctx context.Context, number rpc.BlockNumber) ([]*tracers.ParityTrace, error) {
+	block := api.blockByNumber(number)
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return ParityBlockTraces(ctx, api.eth.ChainDb(), api.eth.blockchain, api.eth.blockchain.Config(), block)
+}
+
+// Transaction returns the traces of the transaction
+func (api *PrivateTraceAPI) Transaction(ctx context.Context, hash common.Hash) ([]*tracers.ParityTrace, error) {
+	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(api.eth.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	block := api.eth.blockchain.GetBlock(blockHash, blockNumber)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", blockHash)
+	}
+	return ParityTransactionTraces(ctx, api.eth.ChainDb(), api.eth.blockchain, api.eth.blockchain.Config(), block, index)
+}
+
+// ReplayBlockTransactions re-executes the transactions of the block and returns the requested
+// trace types: "trace", "stateDiff" and "vmTrace"
+func (api *PrivateTraceAPI) ReplayBlockTransactions(ctx context.Context, number rpc.BlockNumber, traceTypes []string) ([]*tracers.ParityTraceResult, error) {
+	block := api.blockByNumber(number)
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return ReplayBlockParity(ctx, api.eth.ChainDb(), api.eth.blockchain, api.eth.blockchain.Config(), block, traceTypes, -1)
+}
+
+// Filter returns the traces of the range of blocks matching the addresses of the request
+func (api *PrivateTraceAPI) Filter(ctx context.Context, req TraceFilterRequest) ([]*tracers.ParityTrace, error) {
+	resolve := func(number *rpc.BlockNumber) uint64 {
+		if number == nil || *number == rpc.LatestBlockNumber || *number == rpc.PendingBlockNumber {
+			return api.eth.blockchain.CurrentBlock().NumberU64()
+		}
+		return uint64(number.Int64())
+	}
+	return FilterParityTraces(ctx, req, resolve(req.FromBlock), resolve(req.ToBlock), api.eth.config.RPCTraceMaxBlocks, func(number uint64) ([]*tracers.ParityTrace, error) {
+		block := api.eth.blockchain.GetBlockByNumber(number)
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		return ParityBlockTraces(ctx, api.eth.ChainDb(), api.eth.blockchain, api.eth.blockchain.Config(), block)
+	})
+}
+
+func (api *PrivateTraceAPI) blockByNumber(number rpc.BlockNumber) *types.Block {
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		return api.eth.blockchain.CurrentBlock()
+	}
+	return api.eth.blockchain.GetBlockByNumber(uint64(number))
+}
+
+// ReplayBlockParity re-executes the transactions of the block on the state of its parent and returns
+// their traces of the given types. If txIndex is not negative, only that transaction is traced and the
+// transactions before it are executed without tracing.
+// The state diffs are the differences between the state before and after every transaction: the touched
+// accounts are read after the traced execution, the journal is reverted to read them before it, and the
+// transaction is then executed again without tracing
+func ReplayBlockParity(ctx context.Context, chainDb ethdb.Getter, chain core.ChainContext, chainConfig *params.ChainConfig, block *types.Block, traceTypes []string, txIndex int) ([]*tracers.ParityTraceResult, error) {
+	var withTrace, withStateDiff, withVmTrace bool
+	for _, traceType := range traceTypes {
+		switch traceType {
+		case tracers.ParityTraceTypeTrace:
+			withTrace = true
+		case tracers.ParityTraceTypeStateDiff:
+			withStateDiff = true
+		case tracers.ParityTraceTypeVmTrace:
+			withVmTrace = true
+		default:
+			return nil, fmt.Errorf("unknown trace type %q", traceType)
+		}
+	}
+	txs := block.Transactions()
+	if txIndex >= len(txs) {
+		return nil, fmt.Errorf("transaction index %d out of range", txIndex)
+	}
+	results := []*tracers.ParityTraceResult{}
+	if len(txs) == 0 {
+		return results, nil
+	}
+
+	dbstate := state.NewDbState(chainDb, block.NumberU64()-1)
+	ibs := state.New(dbstate)
+	signer := types.MakeSigner(chainConfig, block.Number())
+	eipsCtx := chainConfig.WithEIPsFlags(ctx, block.Number())
+	removeEmpty := chainConfig.IsEIP158(block.Number())
+	for i, tx := range txs {
+		if txIndex >= 0 && i > txIndex {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %#x: %v", tx.Hash(), err)
+		}
+		vmctx := core.NewEVMContext(msg, block.Header(), chain, nil)
+		if txIndex >= 0 && i < txIndex {
+			vmenv := vm.NewEVM(vmctx, ibs, chainConfig, vm.Config{})
+			if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+				return nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+			}
+			if err := ibs.FinalizeTx(eipsCtx, dbstate); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		tracer := tracers.NewParityTracer(withVmTrace)
+		var snapshot int
+		if withStateDiff {
+			snapshot = ibs.Snapshot()
+			ibs.SetTracer(tracer)
+		}
+		vmenv := vm.NewEVM(vmctx, ibs, chainConfig, vm.Config{Debug: true, Tracer: tracer})
+		if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+			return nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+		}
+		ibs.SetTracer(nil)
+
+		txHash := tx.Hash()
+		result := &tracers.ParityTraceResult{Output: tracer.Output(), TransactionHash: &txHash}
+		if withTrace {
+			result.Trace = tracer.Traces()
+		}
+		if withVmTrace {
+			result.VmTrace = tracer.VmTrace()
+		}
+		if withStateDiff {
+			after := tracers.ReadParityState(tracer.Touched(), ibs, removeEmpty)
+			ibs.RevertToSnapshot(snapshot)
+			before := tracers.ReadParityState(tracer.Touched(), ibs, false)
+			result.StateDiff = tracers.ParityStateDiff(before, after)
+
+			vmenv = vm.NewEVM(vmctx, ibs, chainConfig, vm.Config{})
+			if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+				return nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+			}
+		}
+		if err := ibs.FinalizeTx(eipsCtx, dbstate); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ParityBlockTraces returns the call traces of all the transactions of the block followed by its rewards
+func ParityBlockTraces(ctx context.Context, chainDb ethdb.Getter, chain core.ChainContext, chainConfig *params.ChainConfig, block *types.Block) ([]*tracers.ParityTrace, error) {
+	results, err := ReplayBlockParity(ctx, chainDb, chain, chainConfig, block, []string{tracers.ParityTraceTypeTrace}, -1)
+	if err != nil {
+		return nil, err
+	}
+	traces := []*tracers.ParityTrace{}
+	for i, result := range results {
+		traces = append(traces, parityTxTraces(block, uint64(i), result)...)
+	}
+	return append(traces, parityRewardTraces(chainConfig, block)...), nil
+}
+
+// ParityTransactionTraces returns the call traces of the transaction at the index of the block
+func ParityTransactionTraces(ctx context.Context, chainDb ethdb.Getter, chain core.ChainContext, chainConfig *params.ChainConfig, block *types.Block, txIndex uint64) ([]*tracers.ParityTrace, error) {
+	results, err := ReplayBlockParity(ctx, chainDb, chain, chainConfig, block, []string{tracers.ParityTraceTypeTrace}, int(txIndex))
+	if err != nil {
+		return nil, err
+	}
+	return parityTxTraces(block, txIndex, results[0]), nil
+}
+
+// parityTxTraces sets the block and transaction fields of the traces of the transaction
+func parityTxTraces(block *types.Block, txIndex uint64, result *tracers.ParityTraceResult) []*tracers.ParityTrace {
+	blockHash, blockNumber := block.Hash(), block.NumberU64()
+	for _, trace := range result.Trace {
+		trace.BlockHash = &blockHash
+		trace.BlockNumber = &blockNumber
+		trace.TransactionHash = result.TransactionHash
+		position := txIndex
+		trace.TransactionPosition = &position
+	}
+	return result.Trace
+}
+
+// parityRewardTraces returns the mining rewards of the block, only the ethash blocks have them
+func parityRewardTraces(chainConfig *params.ChainConfig, block *types.Block) []*tracers.ParityTrace {
+	if chainConfig.Clique != nil {
+		return nil
+	}
+	blockHash, blockNumber := block.Hash(), block.NumberU64()
+	reward, uncleRewards := ethash.AccumulateRewards(chainConfig, block.Header(), block.Uncles())
+	rewardTrace := func(author common.Address, rewardType string, value *hexutil.Big) *tracers.ParityTrace {
+		return &tracers.ParityTrace{
+			Action:       &tracers.ParityRewardAction{Author: author, RewardType: rewardType, Value: value},
+			BlockHash:    &blockHash,
+			BlockNumber:  &blockNumber,
+			TraceAddress: []int{},
+			Type:         "reward",
+		}
+	}
+	traces := []*tracers.ParityTrace{rewardTrace(block.Coinbase(), "block", (*hexutil.Big)(reward))}
+	for i, uncle := range block.Uncles() {
+		traces = append(traces, rewardTrace(uncle.Coinbase, "uncle", (*hexutil.Big)(uncleRewards[i])))
+	}
+	return traces
+}
+
+// FilterParityTraces returns the traces of the blocks in the range which match the request,
+// blockTraces returns the traces of a single block. The ranges longer than maxBlocks are refused,
+// 0 means no limit. No more blocks are executed once count traces are found
+func FilterParityTraces(ctx context.Context, req TraceFilterRequest, from, to uint64, maxBlocks uint64, blockTraces func(uint64) ([]*tracers.ParityTrace, error)) ([]*tracers.ParityTrace, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid block range %d - %d", from, to)
+	}
+	if maxBlocks > 0 && to-from >= maxBlocks {
+		return nil, fmt.Errorf("block range %d - %d exceeds the limit of %d blocks", from, to, maxBlocks)
+	}
+	traces := []*tracers.ParityTrace{}
+	var skipped uint64
+	for number := from; number <= to; number++ {
+		if req.Count != nil && uint64(len(traces)) >= *req.Count {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		blockTraces, err := blockTraces(number)
+		if err != nil {
+			return nil, err
+		}
+		for _, trace := range blockTraces {
+			if !req.matches(trace) {
+				continue
+			}
+			if req.After != nil && skipped < *req.After {
+				skipped++
+				continue
+			}
+			traces = append(traces, trace)
+			if req.Count != nil && uint64(len(traces)) >= *req.Count {
+				return traces, nil
+			}
+		}
+	}
+	return traces, nil
+}
+
+// matches checks the sender and the receiver of the trace: the created contract is the receiver of
+// the creation, the refund address is the receiver of the self-destruct, and the rewards have no sender
+func (req *TraceFilterRequest) matches(trace *tracers.ParityTrace) bool {
+	var from, to *common.Address
+	switch action := trace.Action.(type) {
+	case *tracers.ParityCallAction:
+		from, to = &action.From, &action.To
+	case *tracers.ParityCreateAction:
+		from = &action.From
+		if result, ok := trace.Result.(*tracers.ParityCreateResult); ok && result != nil {
+			to = &result.Address
+		}
+	case *tracers.ParitySuicideAction:
+		from, to = &action.Address, &action.RefundAddress
+	case *tracers.ParityRewardAction:
+		to = &action.Author
+	}
+	return matchesAddress(req.FromAddress, from) && matchesAddress(req.ToAddress, to)
+}
+
+func matchesAddress(addresses []common.Address, address *common.Address) bool {
+	if len(addresses) == 0 {
+		return true
+	}
+	if address == nil {
+		return false
+	}
+	for _, a := range addresses {
+		if a == *address {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package eth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/eth/tracers"
+)
+
+func TestFilterParityTraces(t *testing.T) {
+	alice, bob := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	var executed []uint64
+	blockTraces := func(number uint64) ([]*tracers.ParityTrace, error) {
+		executed = append(executed, number)
+		return []*tracers.ParityTrace{
+			{Action: &tracers.ParityCallAction{From: alice, To: bob}},
+			{Action: &tracers.ParityCallAction{From: bob, To: alice}},
+		}, nil
+	}
+	uint64p := func(n uint64) *uint64 { return &n }
+
+	if _, err := FilterParityTraces(context.Background(), TraceFilterRequest{}, 1, 10, 5, blockTraces); err == nil {
+		t.Fatal("expected the range longer than the limit to be refused")
+	}
+	if len(executed) != 0 {
+		t.Fatalf("blocks executed for the refused range: %v", executed)
+	}
+
+	req := TraceFilterRequest{FromAddress: []common.Address{alice}, After: uint64p(1), Count: uint64p(2)}
+	traces, err := FilterParityTraces(context.Background(), req, 1, 10, 10, blockTraces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 2 {
+		t.Fatalf("expected 2 traces, got %d", len(traces))
+	}
+	if len(executed) != 3 {
+		t.Fatalf("expected the blocks to be executed until count traces are found, executed %v", executed)
+	}
+
+	executed = nil
+	traces, err = FilterParityTraces(context.Background(), TraceFilterRequest{Count: uint64p(0)}, 1, 10, 0, blockTraces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 0 || len(executed) != 0 {
+		t.Fatalf("expected no blocks executed for zero count, got %d traces from %v", len(traces), executed)
+	}
+}
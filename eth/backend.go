@@ -29,7 +29,6 @@ import (
 	"github.com/ledgerwatch/turbo-geth/accounts"
 	"github.com/ledgerwatch/turbo-geth/accounts/abi/bind"
 	"github.com/ledgerwatch/turbo-geth/common"
-	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/consensus"
 	"github.com/ledgerwatch/turbo-geth/consensus/clique"
@@ -43,6 +42,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/eth/filters"
 	"github.com/ledgerwatch/turbo-geth/eth/gasprice"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
 	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotedbserver"
 	"github.com/ledgerwatch/turbo-geth/event"
 	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
@@ -142,7 +142,14 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	}
 	if ctx.Config.RemoteDbListenAddress != "" {
 		if casted, ok := chainDb.(ethdb.HasAbstractKV); ok {
-			remotedbserver.StartDeprecated(casted.AbstractKV(), ctx.Config.RemoteDbListenAddress)
+			opts := remotedbserver.Opts{Token: ctx.Config.RemoteDbToken}
+			if ctx.Config.RemoteDbTLSCert != "" {
+				opts.TLS, err = remote.NewServerTLSConfig(ctx.Config.RemoteDbTLSCert, ctx.Config.RemoteDbTLSKey, ctx.Config.RemoteDbTLSCACert)
+				if err != nil {
+					return nil, err
+				}
+			}
+			remotedbserver.StartDeprecated(casted.AbstractKV(), ctx.Config.RemoteDbListenAddress, &opts)
 		}
 	}
 
@@ -189,12 +196,12 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		}
 	}
 
-	err = setStorageModeIfNotExist(chainDb, config.StorageMode)
+	err = ethdb.SetStorageModeIfNotExist(chainDb, config.StorageMode)
 	if err != nil {
 		return nil, err
 	}
 
-	sm, err := getStorageModeFromDB(chainDb)
+	sm, err := ethdb.GetStorageModeFromDB(chainDb)
 	if err != nil {
 		return nil, err
 	}
@@ -202,14 +209,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		return nil, errors.New("mode is " + config.StorageMode.ToString() + " original mode is " + sm.ToString())
 	}
 
-	err = migrations.NewMigrator().Apply(
-		chainDb,
-		config.StorageMode.History,
-		config.StorageMode.Receipts,
-		config.StorageMode.TxIndex,
-		config.StorageMode.Preimages,
-		true,
-	)
+	err = migrations.NewMigrator().Apply(chainDb, config.StorageMode)
 	if err != nil {
 		return nil, err
 	}
@@ -225,6 +225,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 			BlocksBeforePruning: config.BlocksBeforePruning,
 			BlocksToPrune:       config.BlocksToPrune,
 			PruneTimeout:        config.PruningTimeout,
+			BodiesBeforePruning: config.BodiesBeforePruning,
 			TrieCleanLimit:      config.TrieCleanCache,
 			TrieDirtyLimit:      config.TrieDirtyCache,
 			TrieCleanNoPrefetch: config.NoPrefetch,
@@ -274,6 +275,9 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	if eth.protocolManager, err = NewProtocolManager(chainConfig, checkpoint, config.SyncMode, config.NetworkID, eth.eventMux, eth.txPool, eth.engine, eth.blockchain, chainDb, config.Whitelist); err != nil {
 		return nil, err
 	}
+	if config.MGRLeecher || config.MGRSeeder {
+		eth.protocolManager.mgr = newMgr(chainDb, mgrSchedule{ticksPerCycle: MGRTicksPerCycle}, config.MGRLeecher, config.MGRSeeder)
+	}
 
 	if config.SyncMode != downloader.StagedSync {
 		eth.miner = miner.New(eth, &config.Miner, chainConfig, eth.EventMux(), eth.engine, eth.isLocalBlock)
@@ -407,6 +411,10 @@ func (s *Ethereum) APIs() []rpc.API {
 			Namespace: "debug",
 			Version:   "1.0",
 			Service:   NewPrivateDebugAPI(s),
+		}, {
+			Namespace: "trace",
+			Version:   "1.0",
+			Service:   NewPrivateTraceAPI(s),
 		}, {
 			Namespace: "net",
 			Version:   "1.0",
@@ -654,87 +662,3 @@ func (s *Ethereum) Stop() error {
 	s.eventMux.Stop()
 	return nil
 }
-
-func setStorageModeIfNotExist(db ethdb.Database, sm StorageMode) error {
-	var (
-		err error
-	)
-
-	err = setModeOnEmpty(db, dbutils.StorageModeHistory, sm.History)
-	if err != nil {
-		return err
-	}
-
-	err = setModeOnEmpty(db, dbutils.StorageModePreImages, sm.Preimages)
-	if err != nil {
-		return err
-	}
-
-	err = setModeOnEmpty(db, dbutils.StorageModeReceipts, sm.Receipts)
-	if err != nil {
-		return err
-	}
-
-	err = setModeOnEmpty(db, dbutils.StorageModeTxIndex, sm.TxIndex)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func setModeOnEmpty(db ethdb.Database, key []byte, currentValue bool) error {
-	_, err := db.Get(dbutils.DatabaseInfoBucket, key)
-	if err != nil && err != ethdb.ErrKeyNotFound {
-		return err
-	}
-	if err == ethdb.ErrKeyNotFound {
-		val := []byte{}
-		if currentValue {
-			val = []byte{1}
-		}
-		if err = db.Put(dbutils.DatabaseInfoBucket, key, val); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func getStorageModeFromDB(db ethdb.Database) (StorageMode, error) {
-	var (
-		sm  StorageMode
-		v   []byte
-		err error
-	)
-	v, err = db.Get(dbutils.DatabaseInfoBucket, dbutils.StorageModeHistory)
-	if err != nil && err != ethdb.ErrKeyNotFound {
-		return StorageMode{}, err
-	}
-	sm.History = len(v) > 0
-
-	v, err = db.Get(dbutils.DatabaseInfoBucket, dbutils.StorageModePreImages)
-	if err != nil && err != ethdb.ErrKeyNotFound {
-		return StorageMode{}, err
-	}
-	sm.Preimages = len(v) > 0
-
-	v, err = db.Get(dbutils.DatabaseInfoBucket, dbutils.StorageModeReceipts)
-	if err != nil && err != ethdb.ErrKeyNotFound {
-		return StorageMode{}, err
-	}
-	sm.Receipts = len(v) > 0
-
-	v, err = db.Get(dbutils.DatabaseInfoBucket, dbutils.StorageModeTxIndex)
-	if err != nil && err != ethdb.ErrKeyNotFound {
-		return StorageMode{}, err
-	}
-	sm.TxIndex = len(v) > 0
-
-	v, err = db.Get(dbutils.DatabaseInfoBucket, dbutils.StorageModeThinHistory)
-	if err != nil && err != ethdb.ErrKeyNotFound {
-		return StorageMode{}, err
-	}
-
-	return sm, nil
-}
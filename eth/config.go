@@ -17,7 +17,6 @@
 package eth
 
 import (
-	"fmt"
 	"math/big"
 	"os"
 	"os/user"
@@ -30,6 +29,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/eth/downloader"
 	"github.com/ledgerwatch/turbo-geth/eth/gasprice"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/miner"
 	"github.com/ledgerwatch/turbo-geth/params"
 )
@@ -53,7 +53,8 @@ var DefaultConfig = Config{
 	TrieCleanCache:     256,
 	TrieDirtyCache:     256,
 	TrieTimeout:        60 * time.Minute,
-	StorageMode:        DefaultStorageMode,
+	StorageMode:        ethdb.DefaultStorageMode,
+	RPCTraceMaxBlocks:  1000,
 	Miner: miner.Config{
 		GasFloor: 8000000,
 		GasCeil:  8000000,
@@ -88,52 +89,6 @@ func init() {
 	}
 }
 
-type StorageMode struct {
-	History   bool
-	Receipts  bool
-	TxIndex   bool
-	Preimages bool
-}
-
-var DefaultStorageMode = StorageMode{History: true, Receipts: false, TxIndex: true, Preimages: true}
-
-func (m StorageMode) ToString() string {
-	modeString := ""
-	if m.History {
-		modeString += "h"
-	}
-	if m.Preimages {
-		modeString += "p"
-	}
-	if m.Receipts {
-		modeString += "r"
-	}
-	if m.TxIndex {
-		modeString += "t"
-	}
-	return modeString
-}
-
-func StorageModeFromString(flags string) (StorageMode, error) {
-	mode := StorageMode{}
-	for _, flag := range flags {
-		switch flag {
-		case 'h':
-			mode.History = true
-		case 'r':
-			mode.Receipts = true
-		case 't':
-			mode.TxIndex = true
-		case 'p':
-			mode.Preimages = true
-		default:
-			return mode, fmt.Errorf("unexpected flag found: %c", flag)
-		}
-	}
-
-	return mode, nil
-}
-
 //go:generate gencodec -type Config -formats toml -out gen_config.go
 
 type Config struct {
@@ -152,7 +107,7 @@ type Config struct {
 	NoPruning  bool // Whether to disable pruning and flush everything to disk
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
-	StorageMode StorageMode
+	StorageMode ethdb.StorageMode
 
 	// DownloadOnly is set when the node does not need to process the blocks, but simply
 	// download them
@@ -161,6 +116,13 @@ type Config struct {
 	BlocksBeforePruning uint64
 	BlocksToPrune       uint64
 	PruningTimeout      time.Duration
+	BodiesBeforePruning uint64 // Number of the latest blocks whose bodies, receipts and tx lookup entries are kept, 0 keeps all
+
+	// MGRLeecher makes the node assemble the state from the witnesses gossiped by the Merry-Go-Round seeders
+	// instead of seeding it, see docs/merry-go-round-sync.md
+	MGRLeecher bool
+	// MGRSeeder makes the node gossip the pieces of its state to the Merry-Go-Round leechers
+	MGRSeeder bool
 
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
@@ -214,6 +176,9 @@ type Config struct {
 	// RPCGasCap is the global gas cap for eth-call variants.
 	RPCGasCap *big.Int `toml:",omitempty"`
 
+	// RPCTraceMaxBlocks is the maximum number of blocks trace_filter re-executes, 0 means no limit.
+	RPCTraceMaxBlocks uint64
+
 	// Checkpoint is a hardcoded checkpoint which can be nil.
 	Checkpoint *params.TrustedCheckpoint `toml:",omitempty"`
 
@@ -2,93 +2,89 @@ package downloader
 
 import (
 	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
 )
 
 func (d *Downloader) doStagedSyncWithFetchers(p *peerConnection, headersFetchers []func() error) error {
+	stages := stagedSyncStages()
+	if err := checkStageDependencies(stages); err != nil {
+		return err
+	}
+
 	// Check unwinds backwards and if they are outstanding, invoke corresponding functions
-	for stage := Finish - 1; stage > Headers; stage++ {
-		unwindPoint, err := GetStageUnwind(d.stateDB, stage)
+	for i := len(stages) - 1; i >= 0; i-- {
+		stage := stages[i]
+		if stage.UnwindFunc == nil {
+			continue
+		}
+		unwindPoint, err := GetStageUnwind(d.stateDB, stage.ID)
 		if err != nil {
 			return err
 		}
 		if unwindPoint == 0 {
 			continue
 		}
-		switch stage {
-		case Bodies:
-			err = d.unwindBodyDownloadStage(unwindPoint)
-		case Senders:
-			err = d.unwindSendersStage(unwindPoint)
-		case Execution:
-			err = d.unwindExecutionStage(unwindPoint)
-		case HashCheck:
-			err = d.unwindHashCheckStage(unwindPoint)
-		default:
-			return fmt.Errorf("unrecognized stage for unwinding: %d", stage)
-		}
-		if err != nil {
-			return fmt.Errorf("error unwinding stage: %d: %v", stage, err)
+		if err = d.unwindStage(stage, unwindPoint); err != nil {
+			return fmt.Errorf("error unwinding stage: %d: %v", stage.ID, err)
 		}
 	}
 
-	log.Info("Sync stage 1/5. Downloading headers...")
-
-	var err error
-
-	/*
-	* Stage 1. Download Headers
-	 */
-	if err = d.spawnSync(headersFetchers); err != nil {
-		return err
+	for i, stage := range stages {
+		if err := d.runStage(stage, i+1, len(stages), p, headersFetchers); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	log.Info("Sync stage 1/5. Downloading headers... Complete!")
-	log.Info("Sync stage 2/5. Downloading block bodies...")
-
-	/*
-	* Stage 2. Download Block bodies
-	 */
-	cont := true
-
-	for cont && err == nil {
-		cont, err = d.spawnBodyDownloadStage(p.id)
-	}
+// runStage invokes the forward function of the stage, reporting its progress and timing
+func (d *Downloader) runStage(stage *Stage, index, total int, p *peerConnection, headersFetchers []func() error) error {
+	progress, err := GetStageProgress(d.stateDB, stage.ID)
 	if err != nil {
 		return err
 	}
+	log.Info(fmt.Sprintf("Sync stage %d/%d. %s...", index, total, stage.Description), "from", progress)
 
-	log.Info("Sync stage 2/5. Downloading block bodies... Complete!")
-	/*
-	* Stage 3. Recover senders from tx signatures
-	 */
-	log.Info("Sync stage 3/5. Recovering senders from tx signatures...")
-
-	err = d.spawnRecoverSendersStage()
-	if err != nil {
+	start := time.Now()
+	s := &StageState{Stage: stage.ID, BlockNumber: progress, peer: p, headersFetchers: headersFetchers}
+	if err = stage.ExecFunc(d, s); err != nil {
 		return err
 	}
+	elapsed := time.Since(start)
 
-	log.Info("Sync stage 3/5. Recovering senders from tx signatures... Complete!")
-	log.Info("Sync stage 4/5. Executing blocks w/o hash checks...")
-
-	/*
-	* Stage 4. Execute block bodies w/o calculating trie roots
-	 */
-	syncHeadNumber := uint64(0)
-	syncHeadNumber, err = d.spawnExecuteBlocksStage()
-	if err != nil {
+	if progress, err = GetStageProgress(d.stateDB, stage.ID); err != nil {
 		return err
 	}
+	stageTimer(stage.ID).Update(elapsed)
+	stageProgressGauge(stage.ID).Update(int64(progress))
+	log.Info(fmt.Sprintf("Sync stage %d/%d. %s... Complete!", index, total, stage.Description), "progress", progress, "elapsed", common.PrettyDuration(elapsed))
+	return nil
+}
 
-	log.Info("Sync stage 4/5. Executing blocks w/o hash checks... Complete!")
-
-	// Further stages go there
-	log.Info("Sync stage 5/5. Validating final hash")
-	if err = d.spawnCheckFinalHashStage(syncHeadNumber); err != nil {
+// unwindStage invokes the unwind function of the stage, reporting its progress and timing
+func (d *Downloader) unwindStage(stage *Stage, unwindPoint uint64) error {
+	log.Info("Unwinding sync stage", "stage", stage.Description, "unwindPoint", unwindPoint)
+	start := time.Now()
+	if err := stage.UnwindFunc(d, unwindPoint); err != nil {
+		return err
+	}
+	progress, err := GetStageProgress(d.stateDB, stage.ID)
+	if err != nil {
 		return err
 	}
-	log.Info("Sync stage 5/5. Validating final hash... Complete!")
+	stageProgressGauge(stage.ID).Update(int64(progress))
+	log.Info("Unwinding sync stage... Complete!", "stage", stage.Description, "progress", progress, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func stageTimer(stage SyncStage) metrics.Timer {
+	return metrics.GetOrRegisterTimer(fmt.Sprintf("eth/downloader/stages/%d/elapsed", stage), nil)
+}
 
-	return err
+func stageProgressGauge(stage SyncStage) metrics.Gauge {
+	return metrics.GetOrRegisterGauge(fmt.Sprintf("eth/downloader/stages/%d/progress", stage), nil)
 }
@@ -118,5 +118,17 @@ func (d *Downloader) processBodiesStage(to uint64) error {
 }
 
 func (d *Downloader) unwindBodyDownloadStage(unwindPoint uint64) error {
-	return fmt.Errorf("unwindBodyDownloadStage not implemented")
+	// Bodies are keyed by block hash, so the ones of the non-canonical blocks do not need to be removed,
+	// the bodies of the new canonical blocks will be downloaded during the next forward run
+	mutation := d.stateDB.NewBatch()
+	if err := SaveStageProgress(mutation, Bodies, unwindPoint); err != nil {
+		return fmt.Errorf("unwind Bodies: reset stage progress: %v", err)
+	}
+	if err := SaveStageUnwind(mutation, Bodies, 0); err != nil {
+		return fmt.Errorf("unwind Bodies: reset unwind point: %v", err)
+	}
+	if _, err := mutation.Commit(); err != nil {
+		return fmt.Errorf("unwind Bodies: failed to write db commit: %v", err)
+	}
+	return nil
 }
@@ -5,8 +5,13 @@ import (
 	//"os"
 	//"runtime/pprof"
 
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 )
 
@@ -85,5 +90,93 @@ func (d *Downloader) spawnExecuteBlocksStage() (uint64, error) {
 }
 
 func (d *Downloader) unwindExecutionStage(unwindPoint uint64) error {
-	return fmt.Errorf("unwindExecutionStage not implemented")
+	lastProcessedBlockNumber, err := GetStageProgress(d.stateDB, Execution)
+	if err != nil {
+		return fmt.Errorf("unwind Execution: get stage progress: %v", err)
+	}
+
+	if unwindPoint >= lastProcessedBlockNumber {
+		// Nothing to unwind, just clear the marker
+		return SaveStageUnwind(d.stateDB, Execution, 0)
+	}
+	log.Info("Unwind Execution stage", "from", lastProcessedBlockNumber, "to", unwindPoint)
+
+	mutation := d.stateDB.NewBatch()
+	accountMap, storageMap, err := mutation.RewindData(lastProcessedBlockNumber, unwindPoint)
+	if err != nil {
+		return fmt.Errorf("unwind Execution: getting rewind data: %v", err)
+	}
+
+	for key, value := range accountMap {
+		addrHash := common.BytesToHash([]byte(key))
+		// Contract code mapping of the incarnation being unwound is not valid anymore
+		var current accounts.Account
+		ok, err := rawdb.ReadAccount(mutation, addrHash, &current)
+		if err != nil && err != ethdb.ErrKeyNotFound {
+			return err
+		}
+		if len(value) > 0 {
+			var acc accounts.Account
+			if err = acc.DecodeForStorage(value); err != nil {
+				return err
+			}
+			if ok && current.Incarnation > acc.Incarnation {
+				if err = mutation.Delete(dbutils.ContractCodeBucket, dbutils.GenerateStoragePrefix(addrHash[:], current.Incarnation)); err != nil {
+					return err
+				}
+			}
+			// Fetch the code hash, changesets do not store it
+			if acc.Incarnation > 0 && acc.IsEmptyCodeHash() {
+				if codeHash, err := mutation.Get(dbutils.ContractCodeBucket, dbutils.GenerateStoragePrefix(addrHash[:], acc.Incarnation)); err == nil {
+					copy(acc.CodeHash[:], codeHash)
+				}
+			}
+			if err = rawdb.WriteAccount(mutation, addrHash, acc); err != nil {
+				return err
+			}
+		} else {
+			if ok && current.Incarnation > 0 {
+				if err = mutation.Delete(dbutils.ContractCodeBucket, dbutils.GenerateStoragePrefix(addrHash[:], current.Incarnation)); err != nil {
+					return err
+				}
+			}
+			if err = rawdb.DeleteAccount(mutation, addrHash); err != nil {
+				return err
+			}
+		}
+	}
+
+	for key, value := range storageMap {
+		k := []byte(key)[:common.HashLength+common.IncarnationLength+common.HashLength]
+		if len(value) > 0 {
+			if err = mutation.Put(dbutils.CurrentStateBucket, k, value); err != nil {
+				return err
+			}
+		} else {
+			if err = mutation.Delete(dbutils.CurrentStateBucket, k); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = state.TruncateHistory(mutation, unwindPoint, accountMap, storageMap); err != nil {
+		return fmt.Errorf("unwind Execution: truncating history: %v", err)
+	}
+
+	for i := lastProcessedBlockNumber; i > unwindPoint; i-- {
+		if err = state.DeleteChangeSets(mutation, i); err != nil {
+			return fmt.Errorf("unwind Execution: deleting changesets for block %d: %v", i, err)
+		}
+	}
+
+	if err = SaveStageProgress(mutation, Execution, unwindPoint); err != nil {
+		return fmt.Errorf("unwind Execution: reset stage progress: %v", err)
+	}
+	if err = SaveStageUnwind(mutation, Execution, 0); err != nil {
+		return fmt.Errorf("unwind Execution: reset unwind point: %v", err)
+	}
+	if _, err = mutation.Commit(); err != nil {
+		return fmt.Errorf("unwind Execution: failed to write db commit: %v", err)
+	}
+	return nil
 }
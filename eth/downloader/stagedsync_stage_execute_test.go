@@ -0,0 +1,108 @@
+package downloader
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func TestUnwindExecutionStage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	d := &Downloader{stateDB: db}
+
+	addr := common.HexToAddress("0x1234")
+	addrHash, _ := common.HashData(addr[:])
+	key := common.HexToHash("0x01")
+	keyHash, _ := common.HashData(key[:])
+
+	empty := accounts.NewAccount()
+	acc1 := accounts.NewAccount()
+	acc1.Initialised = true
+	acc1.Incarnation = 1
+	acc1.Balance.SetInt64(100)
+	acc2 := acc1.SelfCopy()
+	acc2.Balance.SetInt64(200)
+	acc2.Nonce = 1
+
+	var zero, val1, val2 common.Hash
+	val1[31] = 1
+	val2[31] = 2
+
+	// Block 1 creates the account and sets a storage slot
+	w := state.NewDbStateWriter(db, 1)
+	if err := w.UpdateAccountData(context.Background(), addr, &empty, &acc1); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteAccountStorage(context.Background(), addr, 1, &key, &zero, &val1); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteChangeSets(); err != nil {
+		t.Fatal(err)
+	}
+	// Block 2 modifies both
+	w = state.NewDbStateWriter(db, 2)
+	if err := w.UpdateAccountData(context.Background(), addr, &acc1, acc2); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteAccountStorage(context.Background(), addr, 1, &key, &val1, &val2); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteChangeSets(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveStageProgress(db, Execution, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveStageUnwind(db, Execution, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.unwindExecutionStage(1); err != nil {
+		t.Fatal(err)
+	}
+
+	var acc accounts.Account
+	if ok, err := rawdb.ReadAccount(db, addrHash, &acc); err != nil || !ok {
+		t.Fatalf("account not found after unwind: %v", err)
+	}
+	if acc.Balance.Cmp(big.NewInt(100)) != 0 || acc.Nonce != 0 {
+		t.Errorf("wrong account after unwind: balance %d, nonce %d", &acc.Balance, acc.Nonce)
+	}
+	v, err := db.Get(dbutils.CurrentStateBucket, dbutils.GenerateCompositeStorageKey(addrHash, 1, keyHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if common.BytesToHash(v) != val1 {
+		t.Errorf("wrong storage value after unwind: %x", v)
+	}
+	if _, err = db.Get(dbutils.AccountChangeSetBucket, dbutils.EncodeTimestamp(2)); err != ethdb.ErrKeyNotFound {
+		t.Errorf("account changeset for block 2 should be deleted, got err %v", err)
+	}
+	if _, err = db.Get(dbutils.StorageChangeSetBucket, dbutils.EncodeTimestamp(2)); err != ethdb.ErrKeyNotFound {
+		t.Errorf("storage changeset for block 2 should be deleted, got err %v", err)
+	}
+	if progress, _ := GetStageProgress(db, Execution); progress != 1 {
+		t.Errorf("wrong Execution progress after unwind: %d", progress)
+	}
+	if unwind, _ := GetStageUnwind(db, Execution); unwind != 0 {
+		t.Errorf("unwind point for Execution was not cleared: %d", unwind)
+	}
+
+	// Unwinding to the genesis removes the account altogether
+	if err = d.unwindExecutionStage(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Get(dbutils.CurrentStateBucket, addrHash[:]); err != ethdb.ErrKeyNotFound {
+		t.Errorf("account should be deleted, got err %v", err)
+	}
+	if _, err = db.Get(dbutils.CurrentStateBucket, dbutils.GenerateCompositeStorageKey(addrHash, 1, keyHash)); err != ethdb.ErrKeyNotFound {
+		t.Errorf("storage should be deleted, got err %v", err)
+	}
+}
@@ -2,11 +2,26 @@ package downloader
 
 import (
 	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/trie"
 	"github.com/pkg/errors"
 )
 
+// hashCheckTopLevels is the number of top levels (in nibbles) of the state trie
+// which get cached in IntermediateTrieHashBucket when the root is computed from scratch
+const hashCheckTopLevels = 4
+
+// maxIncrementalHashCheckKeys is the number of modified keys above which
+// computing the root from scratch is preferred to updating it incrementally
+const maxIncrementalHashCheckKeys = 1000000
+
 func (d *Downloader) spawnCheckFinalHashStage(syncHeadNumber uint64) error {
 	hashProgress, err := GetStageProgress(d.stateDB, HashCheck)
 	if err != nil {
@@ -20,29 +35,206 @@ func (d *Downloader) spawnCheckFinalHashStage(syncHeadNumber uint64) error {
 	}
 
 	syncHeadBlock := d.blockchain.GetBlockByNumber(syncHeadNumber)
-
-	// make sure that we won't write the the real DB
-	// should never be commited
-	euphemeralMutation := d.stateDB.NewBatch()
-
 	blockNr := syncHeadBlock.Header().Number.Uint64()
 
-	tr := trie.New(syncHeadBlock.Root())
-	// making resolve request for the trie root, so we only get a hash
-	rr := tr.NewResolveRequest(nil, []byte{}, 0, tr.Root())
-
 	log.Info("Validating root hash", "block", blockNr, "blockRoot", syncHeadBlock.Root().Hex())
 
-	resolver := trie.NewResolver(0, blockNr)
-	resolver.AddRequest(rr)
-	err = resolver.ResolveStateful(euphemeralMutation, blockNr, false)
+	mutation := d.stateDB.NewBatch()
+	if hashProgress == 0 || hashProgress > blockNr {
+		err = regenerateIntermediateHashes(d.stateDB, mutation, syncHeadBlock.Root())
+	} else {
+		err = updateIntermediateHashes(d.stateDB, mutation, hashProgress, blockNr, syncHeadBlock.Root())
+	}
 	if err != nil {
+		mutation.Rollback()
 		return errors.Wrap(err, "checking root hash failed")
 	}
 
-	return SaveStageProgress(d.stateDB, HashCheck, blockNr)
+	if err = SaveStageProgress(mutation, HashCheck, blockNr); err != nil {
+		return err
+	}
+	if _, err = mutation.Commit(); err != nil {
+		return fmt.Errorf("HashCheck: failed to write db commit: %v", err)
+	}
+	return nil
+}
+
+// regenerateIntermediateHashes computes the state root from scratch, discarding
+// everything there was in IntermediateTrieHashBucket, and caches the top levels of the trie
+func regenerateIntermediateHashes(db ethdb.Database, mutation ethdb.DbWithPendingMutations, expectedRootHash common.Hash) error {
+	log.Info("Regenerating intermediate hashes", "topLevels", hashCheckTopLevels)
+	// The old entries are deleted through the mutation, so that they are kept if the stage fails.
+	// The resolver reads the database bypassing the mutation, so it must not use them
+	if err := clearIntermediateHashes(db, mutation); err != nil {
+		return err
+	}
+
+	tr := trie.New(expectedRootHash)
+	resolver := trie.NewResolver(hashCheckTopLevels, 0)
+	resolver.IgnoreIntermediateHashes(true)
+	resolver.AddRequest(tr.NewResolveRequest(nil, []byte{}, 0, expectedRootHash[:]))
+	if err := resolver.ResolveStateful(db, 0, false); err != nil {
+		return err
+	}
+
+	writeIntermediateHashes(tr, mutation)
+	return nil
+}
+
+// updateIntermediateHashes computes the state root by resolving only the parts of the trie that have been
+// modified between blocks `from` and `to` (according to the changesets) and taking the hashes of the rest
+// of the trie from IntermediateTrieHashBucket. Entries of the bucket are updated accordingly.
+func updateIntermediateHashes(db ethdb.Database, mutation ethdb.DbWithPendingMutations, from, to uint64, expectedRootHash common.Hash) error {
+	accountMap, storageMap, err := db.RewindData(to, from)
+	if err != nil {
+		return fmt.Errorf("collecting modified keys: %v", err)
+	}
+	if len(accountMap)+len(storageMap) > maxIncrementalHashCheckKeys {
+		return regenerateIntermediateHashes(db, mutation, expectedRootHash)
+	}
+	log.Info("Updating intermediate hashes", "from", from, "to", to, "accounts", len(accountMap), "storage", len(storageMap))
+
+	// Entries on the paths to the modified keys are stale now. They will not be used by the resolver,
+	// because it does not take hashes for the prefixes of the requested keys
+	if err = invalidateIntermediateHashes(db, mutation, accountMap, storageMap, false /* unwind */); err != nil {
+		return err
+	}
+
+	tr := trie.New(expectedRootHash)
+	// Top levels are resolved too, so that the storage tries which have not been cached yet get their entries
+	resolver := trie.NewResolver(hashCheckTopLevels, to)
+	resolver.AddRequest(tr.NewResolveRequest(nil, []byte{}, 0, expectedRootHash[:]))
+	var hex []byte
+	for key := range accountMap {
+		trie.DecompressNibbles([]byte(key), &hex)
+		resolver.AddRequest(tr.NewResolveRequest(nil, common.CopyBytes(hex), 0, nil))
+	}
+	for key := range storageMap {
+		trie.DecompressNibbles([]byte(key)[common.HashLength+common.IncarnationLength:], &hex)
+		contract := common.CopyBytes([]byte(key)[:common.HashLength+common.IncarnationLength])
+		resolver.AddRequest(tr.NewResolveRequest(contract, common.CopyBytes(hex), 0, nil))
+	}
+	if err = resolver.ResolveStateful(db, to, false); err != nil {
+		return err
+	}
+
+	writeIntermediateHashes(tr, mutation)
+	return nil
+}
+
+// writeIntermediateHashes puts the hashes of the branch nodes hanging off the loaded
+// branch nodes of the trie into IntermediateTrieHashBucket
+func writeIntermediateHashes(tr *trie.Trie, mutation ethdb.DbWithPendingMutations) {
+	tr.Hash()
+	ih := state.NewIntermediateHashes(mutation, mutation)
+	tr.WalkBranchChildren(func(hex []byte, hash common.Hash, incarnation uint64) {
+		ih.WillUnloadBranchNode(hex, hash, incarnation)
+	})
+}
+
+// invalidateIntermediateHashes deletes the entries of IntermediateTrieHashBucket lying on the paths to the given
+// account and storage keys, as well as the storage entries of the accounts that do not exist anymore (or did not
+// exist yet, if unwinding, in which case the maps are expected to contain the values as of the unwind point)
+func invalidateIntermediateHashes(db ethdb.Getter, deleter ethdb.Deleter, accountMap, storageMap map[string][]byte, unwind bool) error {
+	for key, value := range accountMap {
+		addrHash := []byte(key)
+		for l := 1; l < common.HashLength; l++ {
+			if err := deleter.Delete(dbutils.IntermediateTrieHashBucket, addrHash[:l]); err != nil {
+				return err
+			}
+		}
+		var deleted bool
+		if unwind {
+			deleted = len(value) == 0
+		} else {
+			var acc accounts.Account
+			ok, err := rawdb.ReadAccount(db, common.BytesToHash(addrHash), &acc)
+			if err != nil && err != ethdb.ErrKeyNotFound {
+				return err
+			}
+			deleted = !ok
+		}
+		if !deleted {
+			continue
+		}
+		var storageKeys [][]byte
+		if err := db.Walk(dbutils.IntermediateTrieHashBucket, addrHash, 8*common.HashLength, func(k, _ []byte) (bool, error) {
+			if len(k) > common.HashLength {
+				storageKeys = append(storageKeys, common.CopyBytes(k))
+			}
+			return true, nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range storageKeys {
+			if err := deleter.Delete(dbutils.IntermediateTrieHashBucket, k); err != nil {
+				return err
+			}
+		}
+	}
+	for key := range storageMap {
+		compositeKey := []byte(key)
+		for l := 1; l < common.HashLength; l++ {
+			if err := deleter.Delete(dbutils.IntermediateTrieHashBucket, compositeKey[:l]); err != nil {
+				return err
+			}
+		}
+		for l := 1; l < common.HashLength; l++ {
+			if err := deleter.Delete(dbutils.IntermediateTrieHashBucket, compositeKey[:common.HashLength+common.IncarnationLength+l]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clearIntermediateHashes removes all entries from IntermediateTrieHashBucket
+func clearIntermediateHashes(db ethdb.Getter, deleter ethdb.Deleter) error {
+	var keys [][]byte
+	if err := db.Walk(dbutils.IntermediateTrieHashBucket, []byte{}, 0, func(k, _ []byte) (bool, error) {
+		keys = append(keys, common.CopyBytes(k))
+		return true, nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := deleter.Delete(dbutils.IntermediateTrieHashBucket, k); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (d *Downloader) unwindHashCheckStage(unwindPoint uint64) error {
-	return fmt.Errorf("unwindHashCheckStage not implemented")
+	hashProgress, err := GetStageProgress(d.stateDB, HashCheck)
+	if err != nil {
+		return fmt.Errorf("unwind HashCheck: get stage progress: %v", err)
+	}
+	if unwindPoint >= hashProgress {
+		// Nothing to unwind, just clear the marker
+		return SaveStageUnwind(d.stateDB, HashCheck, 0)
+	}
+	log.Info("Unwind HashCheck stage", "from", hashProgress, "to", unwindPoint)
+
+	// Changesets are still available here, because Execution stage gets unwound after this one
+	accountMap, storageMap, err := d.stateDB.RewindData(hashProgress, unwindPoint)
+	if err != nil {
+		return fmt.Errorf("unwind HashCheck: getting rewind data: %v", err)
+	}
+
+	mutation := d.stateDB.NewBatch()
+	// The hashes of the modified subtries will be computed anew during the next forward run
+	if err = invalidateIntermediateHashes(d.stateDB, mutation, accountMap, storageMap, true /* unwind */); err != nil {
+		return fmt.Errorf("unwind HashCheck: invalidating intermediate hashes: %v", err)
+	}
+	if err = SaveStageProgress(mutation, HashCheck, unwindPoint); err != nil {
+		return fmt.Errorf("unwind HashCheck: reset stage progress: %v", err)
+	}
+	if err = SaveStageUnwind(mutation, HashCheck, 0); err != nil {
+		return fmt.Errorf("unwind HashCheck: reset unwind point: %v", err)
+	}
+	if _, err = mutation.Commit(); err != nil {
+		return fmt.Errorf("unwind HashCheck: failed to write db commit: %v", err)
+	}
+	return nil
 }
@@ -0,0 +1,241 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/trie"
+)
+
+func TestIncrementalIntermediateHashes(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	tr := trie.New(trie.EmptyRoot)
+
+	const numOfAccounts = 1000
+	addrs := make([]common.Address, numOfAccounts)
+	accs := make([]*accounts.Account, numOfAccounts)
+	empty := accounts.NewAccount()
+
+	// Block 1 creates all the accounts
+	w := state.NewDbStateWriter(db, 1)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+		acc := accounts.NewAccount()
+		acc.Initialised = true
+		acc.Balance.SetUint64(uint64(i + 1))
+		accs[i] = &acc
+		if err := w.UpdateAccountData(context.Background(), addrs[i], &empty, accs[i]); err != nil {
+			t.Fatal(err)
+		}
+		addrHash, _ := common.HashData(addrs[i][:])
+		tr.UpdateAccount(addrHash[:], accs[i])
+	}
+	if err := w.WriteChangeSets(); err != nil {
+		t.Fatal(err)
+	}
+	root1 := tr.Hash()
+
+	mutation := db.NewBatch()
+	if err := regenerateIntermediateHashes(db, mutation, root1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mutation.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	var ihCount int
+	if err := db.Walk(dbutils.IntermediateTrieHashBucket, []byte{}, 0, func(_, _ []byte) (bool, error) {
+		ihCount++
+		return true, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if ihCount == 0 {
+		t.Fatal("expected intermediate hashes to be written")
+	}
+
+	// Block 2 modifies some of the accounts and deletes some others
+	w = state.NewDbStateWriter(db, 2)
+	for i := 0; i < numOfAccounts; i += 10 {
+		addrHash, _ := common.HashData(addrs[i][:])
+		if i%20 == 0 {
+			if err := w.DeleteAccount(context.Background(), addrs[i], accs[i]); err != nil {
+				t.Fatal(err)
+			}
+			tr.Delete(addrHash[:])
+			continue
+		}
+		acc := accs[i].SelfCopy()
+		acc.Nonce++
+		if err := w.UpdateAccountData(context.Background(), addrs[i], accs[i], acc); err != nil {
+			t.Fatal(err)
+		}
+		tr.UpdateAccount(addrHash[:], acc)
+	}
+	if err := w.WriteChangeSets(); err != nil {
+		t.Fatal(err)
+	}
+	root2 := tr.Hash()
+
+	mutation = db.NewBatch()
+	if err := updateIntermediateHashes(db, mutation, 1, 2, common.Hash{}); err == nil {
+		t.Fatal("expected root hash mismatch")
+	}
+	mutation.Rollback()
+
+	mutation = db.NewBatch()
+	if err := updateIntermediateHashes(db, mutation, 1, 2, root2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mutation.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Intermediate hashes left after the update must be good for computing the root from scratch
+	check := trie.New(root2)
+	resolver := trie.NewResolver(0, 2)
+	resolver.AddRequest(check.NewResolveRequest(nil, []byte{}, 0, root2[:]))
+	if err := resolver.ResolveStateful(db, 2, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIntermediateHashesStorageAndUnwind(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	d := &Downloader{stateDB: db}
+	tr := trie.New(trie.EmptyRoot)
+
+	empty := accounts.NewAccount()
+	contract := common.HexToAddress("0xc0")
+	contractHash, _ := common.HashData(contract[:])
+	contractAcc := accounts.NewAccount()
+	contractAcc.Initialised = true
+	contractAcc.Incarnation = 1
+
+	const numOfAccounts, numOfSlots = 100, 300
+	addrs := make([]common.Address, numOfAccounts)
+	accs := make([]*accounts.Account, numOfAccounts)
+	keys := make([]common.Hash, numOfSlots)
+	values := make([]common.Hash, numOfSlots)
+	writeSlot := func(w *state.DbStateWriter, i int, value common.Hash) {
+		if err := w.WriteAccountStorage(context.Background(), contract, 1, &keys[i], &values[i], &value); err != nil {
+			t.Fatal(err)
+		}
+		values[i] = value
+		keyHash, _ := common.HashData(keys[i][:])
+		tr.Update(dbutils.GenerateCompositeTrieKey(contractHash, keyHash), common.CopyBytes(bytes.TrimLeft(value[:], "\x00")))
+	}
+
+	// Block 1 creates the accounts and the contract with its storage
+	w := state.NewDbStateWriter(db, 1)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+		acc := accounts.NewAccount()
+		acc.Initialised = true
+		acc.Balance.SetUint64(uint64(i + 1))
+		accs[i] = &acc
+		if err := w.UpdateAccountData(context.Background(), addrs[i], &empty, accs[i]); err != nil {
+			t.Fatal(err)
+		}
+		addrHash, _ := common.HashData(addrs[i][:])
+		tr.UpdateAccount(addrHash[:], accs[i])
+	}
+	if err := w.UpdateAccountData(context.Background(), contract, &empty, &contractAcc); err != nil {
+		t.Fatal(err)
+	}
+	tr.UpdateAccount(contractHash[:], &contractAcc)
+	for i := range keys {
+		keys[i] = common.BigToHash(big.NewInt(int64(i)))
+		writeSlot(w, i, common.BigToHash(big.NewInt(int64(i+1))))
+	}
+	if err := w.WriteChangeSets(); err != nil {
+		t.Fatal(err)
+	}
+	root1 := tr.Hash()
+
+	// A stale entry is neither used for the root nor deleted if the stage fails
+	stale := []byte{0x12, 0x34, 0x56}
+	if err := db.Put(dbutils.IntermediateTrieHashBucket, stale, common.HexToHash("0xbad").Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	mutation := db.NewBatch()
+	if err := regenerateIntermediateHashes(db, mutation, common.Hash{}); err == nil {
+		t.Fatal("expected root hash mismatch")
+	}
+	mutation.Rollback()
+	if has, _ := db.Has(dbutils.IntermediateTrieHashBucket, stale); !has {
+		t.Fatal("intermediate hashes are deleted by the failed stage")
+	}
+	mutation = db.NewBatch()
+	if err := regenerateIntermediateHashes(db, mutation, root1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mutation.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := db.Has(dbutils.IntermediateTrieHashBucket, stale); has {
+		t.Fatal("stale intermediate hash is not deleted")
+	}
+
+	// Block 2 modifies some of the accounts and of the storage items
+	w = state.NewDbStateWriter(db, 2)
+	for i := 0; i < numOfAccounts; i += 10 {
+		acc := accs[i].SelfCopy()
+		acc.Nonce++
+		if err := w.UpdateAccountData(context.Background(), addrs[i], accs[i], acc); err != nil {
+			t.Fatal(err)
+		}
+		addrHash, _ := common.HashData(addrs[i][:])
+		tr.UpdateAccount(addrHash[:], acc)
+	}
+	for i := 0; i < numOfSlots; i += 30 {
+		writeSlot(w, i, common.BigToHash(big.NewInt(int64(1000+i))))
+	}
+	if err := w.WriteChangeSets(); err != nil {
+		t.Fatal(err)
+	}
+	root2 := tr.Hash()
+
+	mutation = db.NewBatch()
+	if err := updateIntermediateHashes(db, mutation, 1, 2, root2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mutation.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	var storageIH int
+	if err := db.Walk(dbutils.IntermediateTrieHashBucket, dbutils.GenerateStoragePrefix(contractHash[:], 1), 8*(common.HashLength+common.IncarnationLength), func(_, _ []byte) (bool, error) {
+		storageIH++
+		return true, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if storageIH == 0 {
+		t.Fatal("expected intermediate hashes of the storage to be written")
+	}
+
+	// Unwinding to block 1 leaves the intermediate hashes good for the state of block 1
+	for _, stage := range []SyncStage{HashCheck, Execution} {
+		if err := SaveStageProgress(db, stage, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.unwindHashCheckStage(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.unwindExecutionStage(1); err != nil {
+		t.Fatal(err)
+	}
+	check := trie.New(root1)
+	resolver := trie.NewResolver(0, 1)
+	resolver.AddRequest(check.NewResolveRequest(nil, []byte{}, 0, root1[:]))
+	if err := resolver.ResolveStateful(db, 1, false); err != nil {
+		t.Fatal(err)
+	}
+}
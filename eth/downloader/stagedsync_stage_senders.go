@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/crypto/secp256k1"
@@ -81,7 +82,7 @@ func (d *Downloader) spawnRecoverSendersStage() error {
 			blockNumber.SetUint64(nextBlockNumber)
 			s := types.MakeSigner(config, &blockNumber)
 
-			jobs <- &senderRecoveryJob{s, body, hash, nextBlockNumber, nil}
+			jobs <- &senderRecoveryJob{signer: s, blockBody: body, hash: hash, nextBlockNumber: nextBlockNumber}
 			written++
 
 			nextBlockNumber++
@@ -92,10 +93,10 @@ func (d *Downloader) spawnRecoverSendersStage() error {
 			if j.err != nil {
 				return errors.Wrap(j.err, "could not extract senders")
 			}
-			rawdb.WriteBody(context.Background(), mutation, j.hash, j.nextBlockNumber, j.blockBody)
+			rawdb.WriteSenders(context.Background(), mutation, j.hash, j.nextBlockNumber, j.senders)
 		}
 
-		if err = SaveStageProgress(mutation, Senders, nextBlockNumber); err != nil {
+		if err = SaveStageProgress(mutation, Senders, nextBlockNumber-1); err != nil {
 			return err
 		}
 		log.Info("Recovered for blocks:", "blockNumber", nextBlockNumber)
@@ -114,6 +115,7 @@ func (d *Downloader) spawnRecoverSendersStage() error {
 type senderRecoveryJob struct {
 	signer          types.Signer
 	blockBody       *types.Body
+	senders         []common.Address
 	hash            common.Hash
 	nextBlockNumber uint64
 	err             error
@@ -126,13 +128,14 @@ func recoverSenders(cryptoContext *secp256k1.Context, in chan *senderRecoveryJob
 		if job == nil {
 			return
 		}
-		for _, tx := range job.blockBody.Transactions {
+		job.senders = make([]common.Address, len(job.blockBody.Transactions))
+		for i, tx := range job.blockBody.Transactions {
 			from, err := job.signer.SenderWithContext(cryptoContext, tx)
 			if err != nil {
 				job.err = errors.Wrap(err, fmt.Sprintf("error recovering sender for tx=%x\n", tx.Hash()))
 				break
 			}
-			tx.SetFrom(from)
+			job.senders[i] = from
 			if tx.Protected() && tx.ChainId().Cmp(job.signer.ChainId()) != 0 {
 				job.err = errors.New("invalid chainId")
 				break
@@ -143,5 +146,40 @@ func recoverSenders(cryptoContext *secp256k1.Context, in chan *senderRecoveryJob
 }
 
 func (d *Downloader) unwindSendersStage(unwindPoint uint64) error {
-	return fmt.Errorf("unwindSendersStage not implemented")
+	lastProcessedBlockNumber, err := GetStageProgress(d.stateDB, Senders)
+	if err != nil {
+		return fmt.Errorf("unwind Senders: get stage progress: %v", err)
+	}
+	if unwindPoint >= lastProcessedBlockNumber {
+		// Nothing to unwind, just clear the marker
+		return SaveStageUnwind(d.stateDB, Senders, 0)
+	}
+	log.Info("Unwind Senders stage", "from", lastProcessedBlockNumber, "to", unwindPoint)
+
+	// Canonical hashes of the unwound blocks may already be overwritten by the new chain,
+	// so the senders of all the blocks above the unwind point are deleted, whatever their hashes
+	var keys [][]byte
+	if err = d.stateDB.Walk(dbutils.SendersPrefix, dbutils.EncodeBlockNumber(unwindPoint+1), 0, func(k, _ []byte) (bool, error) {
+		keys = append(keys, common.CopyBytes(k))
+		return true, nil
+	}); err != nil {
+		return fmt.Errorf("unwind Senders: walking senders: %v", err)
+	}
+
+	mutation := d.stateDB.NewBatch()
+	for _, k := range keys {
+		if err = mutation.Delete(dbutils.SendersPrefix, k); err != nil {
+			return fmt.Errorf("unwind Senders: deleting senders: %v", err)
+		}
+	}
+	if err = SaveStageProgress(mutation, Senders, unwindPoint); err != nil {
+		return fmt.Errorf("unwind Senders: reset stage progress: %v", err)
+	}
+	if err = SaveStageUnwind(mutation, Senders, 0); err != nil {
+		return fmt.Errorf("unwind Senders: reset unwind point: %v", err)
+	}
+	if _, err = mutation.Commit(); err != nil {
+		return fmt.Errorf("unwind Senders: failed to write db commit: %v", err)
+	}
+	return nil
 }
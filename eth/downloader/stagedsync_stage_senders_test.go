@@ -0,0 +1,48 @@
+package downloader
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func TestUnwindSendersStage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	d := &Downloader{stateDB: db}
+
+	senders := []common.Address{common.HexToAddress("0xaa"), common.HexToAddress("0xbb")}
+	hashes := make([]common.Hash, 6)
+	for number := uint64(1); number <= 5; number++ {
+		hashes[number] = common.BigToHash(new(big.Int).SetUint64(number))
+		rawdb.WriteSenders(context.Background(), db, hashes[number], number, senders)
+	}
+	if err := SaveStageProgress(db, Senders, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveStageUnwind(db, Senders, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.unwindSendersStage(3); err != nil {
+		t.Fatal(err)
+	}
+
+	for number := uint64(1); number <= 5; number++ {
+		entry := rawdb.ReadSenders(db, hashes[number], number)
+		if number <= 3 && len(entry) != len(senders) {
+			t.Errorf("senders of block %d should be kept", number)
+		}
+		if number > 3 && len(entry) != 0 {
+			t.Errorf("senders of block %d should be deleted", number)
+		}
+	}
+	if progress, _ := GetStageProgress(db, Senders); progress != 3 {
+		t.Errorf("wrong Senders progress after unwind: %d", progress)
+	}
+	if unwind, _ := GetStageUnwind(db, Senders); unwind != 0 {
+		t.Errorf("unwind point for Senders was not cleared: %d", unwind)
+	}
+}
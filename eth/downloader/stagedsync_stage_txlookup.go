@@ -0,0 +1,172 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// txLookupBatchSize is the number of lookup entries accumulated in memory
+// before they are sorted and written into the database
+const txLookupBatchSize = 500000
+
+type txLookupEntry struct {
+	txHash      []byte
+	blockNumber []byte
+}
+
+func (d *Downloader) spawnTxLookupStage() error {
+	lastProcessedBlockNumber, err := GetStageProgress(d.stateDB, TxLookup)
+	if err != nil {
+		return err
+	}
+	syncHeadNumber, err := GetStageProgress(d.stateDB, Execution)
+	if err != nil {
+		return err
+	}
+	if lastProcessedBlockNumber >= syncHeadNumber {
+		return nil
+	}
+
+	sm, err := ethdb.GetStorageModeFromDB(d.stateDB)
+	if err != nil {
+		return err
+	}
+	if !sm.TxIndex {
+		// The progress stays where it is, so the index is built from there once enabled
+		return nil
+	}
+
+	return buildTxLookup(d.stateDB, lastProcessedBlockNumber+1, syncHeadNumber)
+}
+
+// buildTxLookup writes the tx hash -> block number entries for the transactions of the canonical
+// blocks from..to (inclusive). The progress of the TxLookup stage is saved along with every batch
+func buildTxLookup(db ethdb.Database, from, to uint64) error {
+	entries := make([]txLookupEntry, 0, txLookupBatchSize)
+	var n big.Int
+	for blockNumber := from; blockNumber <= to; blockNumber++ {
+		hash := rawdb.ReadCanonicalHash(db, blockNumber)
+		if hash == (common.Hash{}) {
+			return fmt.Errorf("TxLookup: canonical hash not found for block %d", blockNumber)
+		}
+		body := rawdb.ReadBody(db, hash, blockNumber)
+		if body == nil {
+			return fmt.Errorf("TxLookup: body not found for block %d", blockNumber)
+		}
+		n.SetUint64(blockNumber)
+		number := n.Bytes()
+		for _, tx := range body.Transactions {
+			entries = append(entries, txLookupEntry{txHash: tx.Hash().Bytes(), blockNumber: number})
+		}
+		if len(entries) >= txLookupBatchSize || blockNumber == to {
+			if err := writeTxLookupEntries(db, entries, blockNumber); err != nil {
+				return err
+			}
+			log.Info("Sync (TxLookup): indexed transactions", "blockNumber", blockNumber, "entries", len(entries))
+			entries = entries[:0]
+		}
+	}
+	return nil
+}
+
+// writeTxLookupEntries puts the entries, sorted by tx hash, into the database together with the stage progress
+func writeTxLookupEntries(db ethdb.Database, entries []txLookupEntry, lastBlockNumber uint64) error {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].txHash, entries[j].txHash) < 0
+	})
+	mutation := db.NewBatch()
+	for _, entry := range entries {
+		if err := mutation.Put(dbutils.TxLookupPrefix, entry.txHash, entry.blockNumber); err != nil {
+			return err
+		}
+		if mutation.BatchSize() >= mutation.IdealBatchSize() {
+			if _, err := mutation.Commit(); err != nil {
+				return fmt.Errorf("TxLookup: failed to write db commit: %v", err)
+			}
+			mutation = db.NewBatch()
+		}
+	}
+	if err := SaveStageProgress(mutation, TxLookup, lastBlockNumber); err != nil {
+		return err
+	}
+	if _, err := mutation.Commit(); err != nil {
+		return fmt.Errorf("TxLookup: failed to write db commit: %v", err)
+	}
+	return nil
+}
+
+func (d *Downloader) unwindTxLookupStage(unwindPoint uint64) error {
+	lastProcessedBlockNumber, err := GetStageProgress(d.stateDB, TxLookup)
+	if err != nil {
+		return fmt.Errorf("unwind TxLookup: get stage progress: %v", err)
+	}
+	if unwindPoint >= lastProcessedBlockNumber {
+		// Nothing to unwind, just clear the marker
+		return SaveStageUnwind(d.stateDB, TxLookup, 0)
+	}
+	log.Info("Unwind TxLookup stage", "from", lastProcessedBlockNumber, "to", unwindPoint)
+
+	mutation := d.stateDB.NewBatch()
+	if err = unwindTxLookup(d.stateDB, mutation, unwindPoint+1, lastProcessedBlockNumber); err != nil {
+		return fmt.Errorf("unwind TxLookup: %v", err)
+	}
+	if err = SaveStageProgress(mutation, TxLookup, unwindPoint); err != nil {
+		return fmt.Errorf("unwind TxLookup: reset stage progress: %v", err)
+	}
+	if err = SaveStageUnwind(mutation, TxLookup, 0); err != nil {
+		return fmt.Errorf("unwind TxLookup: reset unwind point: %v", err)
+	}
+	if _, err = mutation.Commit(); err != nil {
+		return fmt.Errorf("unwind TxLookup: failed to write db commit: %v", err)
+	}
+	return nil
+}
+
+// unwindTxLookup deletes the lookup entries pointing to the blocks from..to (inclusive).
+// By the time of unwinding, the canonical hashes of these blocks may already be replaced by the new
+// chain, so the transactions of all the known blocks at these heights are considered
+func unwindTxLookup(db ethdb.Database, deleter ethdb.Deleter, from, to uint64) error {
+	var n big.Int
+	for blockNumber := from; blockNumber <= to; blockNumber++ {
+		var hashes []common.Hash
+		prefix := dbutils.EncodeBlockNumber(blockNumber)
+		if err := db.Walk(dbutils.HeaderPrefix, prefix, uint(8*len(prefix)), func(k, _ []byte) (bool, error) {
+			if dbutils.IsHeaderKey(k) {
+				hashes = append(hashes, common.BytesToHash(k[len(prefix):]))
+			}
+			return true, nil
+		}); err != nil {
+			return err
+		}
+		n.SetUint64(blockNumber)
+		number := n.Bytes()
+		for _, hash := range hashes {
+			body := rawdb.ReadBody(db, hash, blockNumber)
+			if body == nil {
+				continue
+			}
+			for _, tx := range body.Transactions {
+				v, err := db.Get(dbutils.TxLookupPrefix, tx.Hash().Bytes())
+				if err != nil && err != ethdb.ErrKeyNotFound {
+					return err
+				}
+				// Entries pointing to other blocks are left alone
+				if !bytes.Equal(v, number) {
+					continue
+				}
+				if err = deleter.Delete(dbutils.TxLookupPrefix, tx.Hash().Bytes()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// writeTxLookupTestBlock writes a canonical block with the given number of transactions
+// and returns their hashes. The salt makes the blocks of different forks differ
+func writeTxLookupTestBlock(db ethdb.Database, number uint64, numTxs int, salt int64) []common.Hash {
+	header := &types.Header{Number: new(big.Int).SetUint64(number), Extra: big.NewInt(salt).Bytes()}
+	body := &types.Body{}
+	hashes := make([]common.Hash, numTxs)
+	for i := 0; i < numTxs; i++ {
+		tx := types.NewTransaction(number*100+uint64(i), common.Address{}, big.NewInt(salt), 21000, big.NewInt(1), nil)
+		body.Transactions = append(body.Transactions, tx)
+		hashes[i] = tx.Hash()
+	}
+	rawdb.WriteHeader(context.Background(), db, header)
+	rawdb.WriteBody(context.Background(), db, header.Hash(), number, body)
+	rawdb.WriteCanonicalHash(db, header.Hash(), number)
+	return hashes
+}
+
+func TestTxLookupStage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	d := &Downloader{stateDB: db}
+	if err := db.Put(dbutils.DatabaseInfoBucket, dbutils.StorageModeTxIndex, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	txs := make(map[uint64][]common.Hash)
+	for number := uint64(1); number <= 5; number++ {
+		txs[number] = writeTxLookupTestBlock(db, number, 3, 1)
+	}
+	if err := SaveStageProgress(db, Execution, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.spawnTxLookupStage(); err != nil {
+		t.Fatal(err)
+	}
+	for number, hashes := range txs {
+		for _, hash := range hashes {
+			if n := rawdb.ReadTxLookupEntry(db, hash); n == nil || *n != number {
+				t.Errorf("wrong lookup entry for tx %x of block %d: %v", hash, number, n)
+			}
+		}
+	}
+	if progress, _ := GetStageProgress(db, TxLookup); progress != 5 {
+		t.Errorf("wrong TxLookup progress: %d", progress)
+	}
+
+	// Blocks 4 and 5 get replaced by another fork before the unwind
+	writeTxLookupTestBlock(db, 4, 2, 2)
+	if err := SaveStageUnwind(db, TxLookup, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.unwindTxLookupStage(3); err != nil {
+		t.Fatal(err)
+	}
+	for number, hashes := range txs {
+		for _, hash := range hashes {
+			n := rawdb.ReadTxLookupEntry(db, hash)
+			if number <= 3 && (n == nil || *n != number) {
+				t.Errorf("lookup entry for tx %x of block %d should be kept, got %v", hash, number, n)
+			}
+			if number > 3 && n != nil {
+				t.Errorf("lookup entry for tx %x of block %d should be deleted", hash, number)
+			}
+		}
+	}
+	if progress, _ := GetStageProgress(db, TxLookup); progress != 3 {
+		t.Errorf("wrong TxLookup progress after unwind: %d", progress)
+	}
+	if unwind, _ := GetStageUnwind(db, TxLookup); unwind != 0 {
+		t.Errorf("unwind point for TxLookup was not cleared: %d", unwind)
+	}
+}
+
+func TestTxLookupStageDisabled(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	d := &Downloader{stateDB: db}
+
+	hashes := writeTxLookupTestBlock(db, 1, 3, 1)
+	if err := SaveStageProgress(db, Execution, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.spawnTxLookupStage(); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range hashes {
+		if n := rawdb.ReadTxLookupEntry(db, hash); n != nil {
+			t.Errorf("lookup entry for tx %x should not be written when the index is disabled", hash)
+		}
+	}
+	if progress, _ := GetStageProgress(db, TxLookup); progress != 0 {
+		t.Errorf("TxLookup progress should not move when the index is disabled: %d", progress)
+	}
+}
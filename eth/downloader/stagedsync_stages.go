@@ -25,6 +25,8 @@ import (
 )
 
 // SyncStage represents the stages of syncronisation in the SyncMode.StagedSync mode
+// It is used to persist the information about the stage state into the database.
+// It should not be empty and should be unique.
 type SyncStage byte
 
 const (
@@ -33,9 +35,126 @@ const (
 	Senders                    // "From" recovered from signatures, bodies re-written
 	Execution                  // Executing each block w/o buildinf a trie
 	HashCheck                  // Checking the root hash
-	Finish                     // Nominal stage after all other stages
+	TxLookup                   // Generating transaction lookup index
 )
 
+// ExecFunc is the forward function of a stage. It is supposed to pick up from the
+// progress saved in the database and to save its own progress when it is done
+type ExecFunc func(d *Downloader, s *StageState) error
+
+// UnwindFunc is the unwind function of a stage. It is supposed to revert all the effects of the
+// stage above the unwind point, reset the stage progress and clear the unwind marker (see SaveStageUnwind)
+type UnwindFunc func(d *Downloader, unwindPoint uint64) error
+
+// Stage is a single step of the staged sync
+type Stage struct {
+	// ID of the stage, used as a key for progress and unwind point in the database
+	ID SyncStage
+	// Description is a short human readable description of the stage, used in logs
+	Description string
+	// ExecFunc moves the stage forward
+	ExecFunc ExecFunc
+	// UnwindFunc reverts the stage, nil if the stage is never unwound
+	UnwindFunc UnwindFunc
+	// Dependencies are the stages that must precede this one in the pipeline
+	Dependencies []SyncStage
+}
+
+// StageState carries the context of the current sync cycle to the stage functions
+type StageState struct {
+	Stage           SyncStage
+	BlockNumber     uint64 // Progress of the stage at the time it was invoked
+	peer            *peerConnection
+	headersFetchers []func() error
+}
+
+// stagedSyncStages returns the pipeline of the staged sync. Stages are run in the order of the list,
+// and unwound in the reverse order. New stages are plugged in by adding them to this list.
+func stagedSyncStages() []*Stage {
+	return []*Stage{
+		{
+			ID:          Headers,
+			Description: "Downloading headers",
+			ExecFunc: func(d *Downloader, s *StageState) error {
+				return d.spawnSync(s.headersFetchers)
+			},
+		},
+		{
+			ID:           Bodies,
+			Description:  "Downloading block bodies",
+			Dependencies: []SyncStage{Headers},
+			ExecFunc: func(d *Downloader, s *StageState) error {
+				cont := true
+				var err error
+				for cont && err == nil {
+					cont, err = d.spawnBodyDownloadStage(s.peer.id)
+				}
+				return err
+			},
+			UnwindFunc: (*Downloader).unwindBodyDownloadStage,
+		},
+		{
+			ID:           Senders,
+			Description:  "Recovering senders from tx signatures",
+			Dependencies: []SyncStage{Bodies},
+			ExecFunc: func(d *Downloader, _ *StageState) error {
+				return d.spawnRecoverSendersStage()
+			},
+			UnwindFunc: (*Downloader).unwindSendersStage,
+		},
+		{
+			ID:           Execution,
+			Description:  "Executing blocks w/o hash checks",
+			Dependencies: []SyncStage{Senders},
+			ExecFunc: func(d *Downloader, _ *StageState) error {
+				_, err := d.spawnExecuteBlocksStage()
+				return err
+			},
+			UnwindFunc: (*Downloader).unwindExecutionStage,
+		},
+		{
+			ID:           TxLookup,
+			Description:  "Generating transaction lookup index",
+			Dependencies: []SyncStage{Execution},
+			ExecFunc: func(d *Downloader, _ *StageState) error {
+				return d.spawnTxLookupStage()
+			},
+			UnwindFunc: (*Downloader).unwindTxLookupStage,
+		},
+		{
+			ID:           HashCheck,
+			Description:  "Validating final hash",
+			Dependencies: []SyncStage{Execution},
+			ExecFunc: func(d *Downloader, _ *StageState) error {
+				syncHeadNumber, err := GetStageProgress(d.stateDB, Execution)
+				if err != nil {
+					return err
+				}
+				return d.spawnCheckFinalHashStage(syncHeadNumber)
+			},
+			UnwindFunc: (*Downloader).unwindHashCheckStage,
+		},
+	}
+}
+
+// checkStageDependencies makes sure that the stage IDs are unique and that
+// every stage comes after all of its dependencies
+func checkStageDependencies(stages []*Stage) error {
+	seen := make(map[SyncStage]struct{}, len(stages))
+	for _, stage := range stages {
+		if _, ok := seen[stage.ID]; ok {
+			return fmt.Errorf("duplicate sync stage: %d (%s)", stage.ID, stage.Description)
+		}
+		for _, dep := range stage.Dependencies {
+			if _, ok := seen[dep]; !ok {
+				return fmt.Errorf("sync stage %d (%s) depends on stage %d, which does not precede it", stage.ID, stage.Description, dep)
+			}
+		}
+		seen[stage.ID] = struct{}{}
+	}
+	return nil
+}
+
 // GetStageProcess retrieves saved progress of given sync stage from the database
 func GetStageProgress(db ethdb.Getter, stage SyncStage) (uint64, error) {
 	v, err := db.Get(dbutils.SyncStageProgress, []byte{byte(stage)})
@@ -61,14 +180,17 @@ func SaveStageProgress(db ethdb.Putter, stage SyncStage, progress uint64) error
 // UnwindAllStages marks all the stages after the Headers stage (where unwinding is initiated) to be unwound
 // unwinding needs to have in the reverse order of stages
 func UnwindAllStages(db ethdb.GetterPutter, unwindPoint uint64) error {
-	for stage := Headers + 1; stage < Finish; stage++ {
-		existingPoint, err := GetStageUnwind(db, stage)
+	for _, stage := range stagedSyncStages() {
+		if stage.UnwindFunc == nil {
+			continue
+		}
+		existingPoint, err := GetStageUnwind(db, stage.ID)
 		if err != nil {
 			return err
 		}
-		if existingPoint > 0 && existingPoint > unwindPoint {
+		if existingPoint == 0 || existingPoint > unwindPoint {
 			// Only lower, not higher
-			err = SaveStageUnwind(db, stage, unwindPoint)
+			err = SaveStageUnwind(db, stage.ID, unwindPoint)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,28 @@
+package downloader
+
+import (
+	"testing"
+)
+
+func TestStagedSyncStagesOrder(t *testing.T) {
+	if err := checkStageDependencies(stagedSyncStages()); err != nil {
+		t.Fatal(err)
+	}
+
+	broken := []*Stage{
+		{ID: Headers, Description: "headers"},
+		{ID: Execution, Description: "execution", Dependencies: []SyncStage{Senders}},
+		{ID: Senders, Description: "senders", Dependencies: []SyncStage{Headers}},
+	}
+	if err := checkStageDependencies(broken); err == nil {
+		t.Error("expected error for the stage preceding its dependency")
+	}
+
+	duplicate := []*Stage{
+		{ID: Headers, Description: "headers"},
+		{ID: Headers, Description: "headers again"},
+	}
+	if err := checkStageDependencies(duplicate); err == nil {
+		t.Error("expected error for the duplicate stage")
+	}
+}
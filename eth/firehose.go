@@ -24,6 +24,12 @@ const FirehoseMaxMsgSize = 10 * 1024 * 1024
 // MaxLeavesPerPrefix is the maximum number of leaves allowed per prefix.
 const MaxLeavesPerPrefix = 4096
 
+// storageSizeCacheLimit is the number of storage sizes kept in memory by the server.
+const storageSizeCacheLimit = 100000
+
+// maxStorageSizeLeaves is the maximum number of storage leaves the server walks to answer one GetStorageSizes request.
+const maxStorageSizeLeaves = 1 << 20
+
 // Firehose protocol message codes
 const (
 	GetStateRangesCode   = 0x00
@@ -133,8 +139,33 @@ type bytecodeMsg struct {
 	Code [][]byte
 }
 
+type storageSizeReq struct {
+	Account     []byte      // account address or hash thereof
+	StorageRoot common.Hash // only used to skip the lookup of empty storage
+}
+
+type getStorageSizesMsg struct {
+	ID       uint64
+	Block    common.Hash
+	Requests []storageSizeReq
+}
+
+type storageSizesMsg struct {
+	ID uint64
+	// Sizes are the numbers of storage leaves, in the same ordering as the request.
+	// 0 is RLP-encoded as an empty string, so it stands for "no data" unless the requested root is the empty one.
+	Sizes           []uint64
+	AvailableBlocks []common.Hash
+}
+
 // SendByteCode sends a BytecodeCode message.
 func (p *firehosePeer) SendByteCode(id uint64, data [][]byte) error {
 	msg := bytecodeMsg{ID: id, Code: data}
 	return p2p.Send(p.rw, BytecodeCode, msg)
 }
+
+// SendStorageSizes sends a StorageSizesCode message.
+func (p *firehosePeer) SendStorageSizes(id uint64, sizes []uint64, availableBlocks []common.Hash) error {
+	msg := storageSizesMsg{ID: id, Sizes: sizes, AvailableBlocks: availableBlocks}
+	return p2p.Send(p.rw, StorageSizesCode, msg)
+}
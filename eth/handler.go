@@ -17,7 +17,6 @@
 package eth
 
 import (
-	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/json"
@@ -30,10 +29,15 @@ import (
 	"sync/atomic"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru"
+
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/consensus"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/forkid"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
 	"github.com/ledgerwatch/turbo-geth/core/vm"
@@ -58,6 +62,9 @@ const (
 	// txChanSize is the size of channel listening to NewTxsEvent.
 	// The number is referenced from the size of tx pool.
 	txChanSize = 4096
+
+	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+	chainHeadChanSize = 10
 )
 
 var (
@@ -102,6 +109,13 @@ type ProtocolManager struct {
 	wg        sync.WaitGroup
 	peerWG    sync.WaitGroup
 
+	storageSizeCache *lru.Cache      // numbers of storage leaves by block hash and address hash
+	nodeData         *nodeDataServer // trie nodes for GetNodeData when the trie is not kept in memory
+
+	mgr          *mgr // Merry-Go-Round sync, see docs/merry-go-round-sync.md
+	chainHeadCh  chan core.ChainHeadEvent
+	chainHeadSub event.Subscription
+
 	// Test fields or hooks
 	broadcastTxAnnouncesOnly bool // Testing field, disable transaction propagation
 
@@ -123,6 +137,15 @@ func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCh
 		mode:       mode,
 		txsyncCh:   make(chan *txsync),
 		quitSync:   make(chan struct{}),
+		mgr:        newMgr(chaindb, mgrSchedule{ticksPerCycle: MGRTicksPerCycle}, false, false),
+	}
+	storageSizeCache, err := lru.New(storageSizeCacheLimit)
+	if err != nil {
+		return nil, err
+	}
+	manager.storageSizeCache = storageSizeCache
+	if manager.nodeData, err = newNodeDataServer(chaindb); err != nil {
+		return nil, err
 	}
 
 	if mode == downloader.FullSync {
@@ -372,6 +395,12 @@ func (pm *ProtocolManager) Start(maxPeers int) {
 	pm.minedBlockSub = pm.eventMux.Subscribe(core.NewMinedBlockEvent{})
 	go pm.minedBroadcastLoop()
 
+	// seed the state to the MGR leechers
+	pm.wg.Add(1)
+	pm.chainHeadCh = make(chan core.ChainHeadEvent, chainHeadChanSize)
+	pm.chainHeadSub = pm.blockchain.SubscribeChainHeadEvent(pm.chainHeadCh)
+	go pm.mgrSeedLoop()
+
 	// start sync handlers
 	pm.wg.Add(2)
 	go pm.chainSync.loop()
@@ -383,6 +412,7 @@ func (pm *ProtocolManager) Stop() {
 		pm.txsSub.Unsubscribe() // quits txBroadcastLoop
 	}
 	pm.minedBlockSub.Unsubscribe() // quits blockBroadcastLoop
+	pm.chainHeadSub.Unsubscribe()  // quits mgrSeedLoop
 
 	// Quit chainSync and txsync64.
 	// After this is done, no new peers will be accepted.
@@ -504,12 +534,7 @@ func (pm *ProtocolManager) handleDebug(p *debugPeer) error {
 }
 
 func (pm *ProtocolManager) handleMgr(p *mgrPeer) error {
-	for {
-		if err := pm.handleMgrMsg(p); err != nil {
-			p.Log().Debug("MGR message handling failed", "err", err)
-			return err
-		}
-	}
+	return pm.mgr.handle(p)
 }
 
 // handleMsg is invoked whenever an inbound message is received from a remote
@@ -738,15 +763,32 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 
 		// Obtain the TrieDbState
-		if pm.mode == downloader.StagedSync {
-			return fmt.Errorf("staged sync mode, no support for GetNodeData")
-		}
-		tds, err := pm.blockchain.GetTrieDbState()
-		if err != nil {
-			return err
+		var tds *state.TrieDbState
+		if pm.mode != downloader.StagedSync {
+			var err error
+			if tds, err = pm.blockchain.GetTrieDbState(); err != nil {
+				return err
+			}
 		}
 		if tds == nil {
-			return fmt.Errorf("download-only mode, no support for GetNodeData")
+			// Staged sync and download-only modes, the nodes are rebuilt from the flat state
+			var (
+				hash   common.Hash
+				hashes []common.Hash
+			)
+			for len(hashes) < downloader.MaxStateFetch {
+				if err := msgStream.Decode(&hash); err == rlp.EOL {
+					break
+				} else if err != nil {
+					return errResp(ErrDecode, "msg %v: %v", msg, err)
+				}
+				hashes = append(hashes, hash)
+			}
+			data, err := pm.nodeData.getNodeData(hashes, softResponseLimit)
+			if err != nil {
+				return err
+			}
+			return p.SendNodeData(data)
 		}
 
 		// Gather state data until the fetch or network limits is reached
@@ -977,6 +1019,38 @@ func (pm *ProtocolManager) extractAddressHash(addressOrHash []byte) (common.Hash
 	}
 }
 
+// storageSize returns the number of storage leaves of the account as of the current block, which has the given hash,
+// and the number of leaves walked to count them. At most limit leaves are walked, 0 is returned for larger storage.
+func (pm *ProtocolManager) storageSize(block common.Hash, addrHash common.Hash, limit uint64) (uint64, uint64, error) {
+	cacheKey := string(block[:]) + string(addrHash[:])
+	if size, ok := pm.storageSizeCache.Get(cacheKey); ok {
+		return size.(uint64), 0, nil
+	}
+
+	db := pm.blockchain.ChainDb()
+	var acc accounts.Account
+	ok, err := rawdb.ReadAccount(db, addrHash, &acc)
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		return 0, 0, err
+	}
+	var size uint64
+	if ok && acc.Incarnation > 0 {
+		prefix := dbutils.GenerateStoragePrefix(addrHash[:], acc.Incarnation)
+		if err := db.Walk(dbutils.CurrentStateBucket, prefix, uint(8*len(prefix)), func(_, _ []byte) (bool, error) {
+			size++
+			return size <= limit, nil
+		}); err != nil {
+			return 0, 0, err
+		}
+	}
+	if size > limit {
+		return 0, limit, nil
+	}
+
+	pm.storageSizeCache.Add(cacheKey, size)
+	return size, size, nil
+}
+
 func (pm *ProtocolManager) handleFirehoseMsg(p *firehosePeer) error {
 	msg, readErr := p.rw.ReadMsg()
 	if readErr != nil {
@@ -1260,7 +1334,43 @@ func (pm *ProtocolManager) handleFirehoseMsg(p *firehosePeer) error {
 		return errResp(ErrNotImplemented, "Not implemented yet")
 
 	case GetStorageSizesCode:
-		return errResp(ErrNotImplemented, "Not implemented yet")
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		var request getStorageSizesMsg
+		if err := msgStream.Decode(&request); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+
+		// Only the first requests are served, up to the fetch limit
+		n := len(request.Requests)
+		if n > downloader.MaxStateFetch {
+			n = downloader.MaxStateFetch
+		}
+		sizes := make([]uint64, n)
+		var availableBlocks []common.Hash
+
+		// Storage sizes are counted in CurrentStateBucket, so only the current block is available
+		if head := pm.blockchain.CurrentBlock().Hash(); head == request.Block {
+			// Once the walk limit is reached, the sizes which are not cached yet are left as "no data"
+			budget := uint64(maxStorageSizeLeaves)
+			for i, req := range request.Requests[:n] {
+				addrHash, err := pm.extractAddressHash(req.Account)
+				if err != nil {
+					return err
+				}
+				if req.StorageRoot == trie.EmptyRoot {
+					continue
+				}
+				var walked uint64
+				if sizes[i], walked, err = pm.storageSize(head, addrHash, budget); err != nil {
+					return err
+				}
+				budget -= walked
+			}
+		} else {
+			availableBlocks = []common.Hash{head}
+		}
+
+		return p.SendStorageSizes(request.ID, sizes, availableBlocks)
 
 	case StorageSizesCode:
 		return errResp(ErrNotImplemented, "Not implemented yet")
@@ -1318,7 +1428,7 @@ func (pm *ProtocolManager) handleDebugMsg(p *debugPeer) error {
 		pm.forkFilter = forkid.NewFilter(pm.blockchain)
 		initPm(pm, pm.txpool, pm.blockchain.Engine(), pm.blockchain, pm.blockchain.ChainDb())
 		pm.quitSync = make(chan struct{})
-		remotedbserver.StartDeprecated(ethDb.AbstractKV(), "") // hack to make UI work. But need to somehow re-create whole Node or Ethereum objects
+		remotedbserver.StartDeprecated(ethDb.AbstractKV(), "", nil) // hack to make UI work. But need to somehow re-create whole Node or Ethereum objects
 
 		// hacks to speedup local sync
 		downloader.MaxHashFetch = 512 * 10
@@ -1337,73 +1447,6 @@ func (pm *ProtocolManager) handleDebugMsg(p *debugPeer) error {
 	return nil
 }
 
-func (pm *ProtocolManager) handleMgrMsg(p *mgrPeer) error {
-	msg, readErr := p.rw.ReadMsg()
-	if readErr != nil {
-		return fmt.Errorf("handleDebugMsg p.rw.ReadMsg: %w", readErr)
-	}
-	if msg.Size > MGRMaxMsgSize {
-		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, DebugMaxMsgSize)
-	}
-	defer msg.Discard()
-
-	switch msg.Code {
-	case MGRStatus:
-		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
-		var knownPrefixes [][]byte
-		if err := msgStream.Decode(&knownPrefixes); err != nil {
-			return fmt.Errorf("msgStream.Decode: %w", err)
-		}
-		tds, err := pm.blockchain.GetTrieDbState()
-		if err != nil {
-			panic(err)
-		}
-
-		fmt.Printf("Received MGRStatus. len(knownPrefixes)=%d\n", len(knownPrefixes))
-		buf := bytes.NewBuffer([]byte{})
-		blockNr := tds.GetBlockNr()
-		epoch := blockNr / 4096
-		subtree := epoch % 256
-		for i := 0; i < 256; i++ { // spread witness of each subtree
-			prefix := []byte{byte(subtree), byte(i)}
-			witness, err := tds.ExtractWitnessForPrefix(prefix, false, false)
-			if err != nil {
-				return err
-			}
-			buf.Reset()
-			if _, err := witness.WriteTo(buf); err != nil {
-				return err
-			}
-			//fmt.Printf("Sernding MGRWitness: %x, of %d\n", prefix, buf.Len())
-			//for _, o := range witness.Operators {
-			//fmt.Printf("%x\n", o)
-			//}
-
-			if err := p.rw.WriteMsg(p2p.Msg{Code: MGRWitness, Size: 0, Payload: buf}); err != nil {
-				return err
-			}
-		}
-	case MGRWitness:
-		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
-		var marshaledWitness []byte
-		if err := msgStream.Decode(&marshaledWitness); err != nil {
-			return fmt.Errorf("msgStream.Decode: %w", err)
-		}
-
-		res, err := trie.NewWitnessFromReader(bytes.NewReader(marshaledWitness), false)
-		if err != nil {
-			panic(err)
-		}
-
-		fmt.Printf("Received MGRWitness: %v\n", res)
-
-		return nil
-	default:
-		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
-	}
-	return nil
-}
-
 // BroadcastBlock will either propagate a block to a subset of its peers, or
 // will only announce its availability (depending what's requested).
 func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
@@ -1489,6 +1532,22 @@ func (pm *ProtocolManager) minedBroadcastLoop() {
 	}
 }
 
+// mgrSeedLoop gossips the piece of the state scheduled for every new head block to the MGR leechers.
+func (pm *ProtocolManager) mgrSeedLoop() {
+	defer pm.wg.Done()
+
+	for {
+		select {
+		case ev := <-pm.chainHeadCh:
+			if err := pm.mgr.seed(ev.Block.NumberU64()); err != nil {
+				log.Warn("MGR seeding failed", "block", ev.Block.NumberU64(), "err", err)
+			}
+		case <-pm.chainHeadSub.Err():
+			return
+		}
+	}
+}
+
 // txBroadcastLoop announces new transactions to connected peers.
 func (pm *ProtocolManager) txBroadcastLoop() {
 	defer pm.wg.Done()
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/debug"
@@ -331,6 +332,94 @@ func testGetNodeData(t *testing.T, protocol int) {
 	}
 }
 
+func TestGetNodeDataStaged63(t *testing.T) { testGetNodeDataStaged(t, 63) }
+
+func TestGetNodeDataStaged64(t *testing.T) { testGetNodeDataStaged(t, 64) }
+
+// In the staged sync mode the nodes are rebuilt from the flat state, the peers walk the trie down from the state root
+func testGetNodeDataStaged(t *testing.T, protocol int) {
+	pm, _ := setUpStorageContractA(t)
+	pm.mode = downloader.StagedSync
+	require.NoError(t, downloader.SaveStageProgress(pm.nodeData.db, downloader.HashCheck, 2))
+	peer, _ := newTestPeer("peer", protocol, pm, true)
+	defer peer.close()
+
+	requestNodeData := func(hashes []common.Hash) [][]byte {
+		require.NoError(t, p2p.Send(peer.app, GetNodeDataMsg, hashes))
+		msg, err := peer.app.ReadMsg()
+		require.NoError(t, err)
+		require.Equal(t, uint64(NodeDataMsg), msg.Code)
+		var data [][]byte
+		require.NoError(t, msg.Decode(&data))
+		return data
+	}
+
+	node0Rlp, node1Rlp, branchRlp := storageNodesOfContractA(t, 2)
+	// The storage node is not known until the nodes above it are served
+	assert.Empty(t, requestNodeData([]common.Hash{crypto.Keccak256Hash(node1Rlp)}))
+
+	served := make(map[common.Hash][]byte)
+	requested := make(map[common.Hash]struct{})
+	hashes := []common.Hash{pm.blockchain.CurrentBlock().Root()}
+	for len(hashes) > 0 {
+		for _, hash := range hashes {
+			requested[hash] = struct{}{}
+		}
+		var next []common.Hash
+		for _, blob := range requestNodeData(hashes) {
+			hash := crypto.Keccak256Hash(blob)
+			require.Contains(t, requested, hash)
+			served[hash] = blob
+			for _, ref := range nodeDataRefs(blob) {
+				if _, ok := requested[ref]; !ok {
+					next = append(next, ref)
+				}
+			}
+		}
+		hashes = next
+	}
+	for _, node := range [][]byte{node0Rlp, node1Rlp, branchRlp} {
+		assert.Equal(t, node, served[crypto.Keccak256Hash(node)])
+	}
+	// The contract code is found among the references of the account leaf
+	assert.Equal(t, common.FromHex("600035600055"), served[crypto.Keccak256Hash(common.FromHex("600035600055"))])
+
+	// The state of the earlier block is rebuilt on the state collected from the history once
+	assert.Equal(t, 0, pm.nodeData.overlays.Len())
+	root1 := pm.blockchain.GetBlockByNumber(1).Root()
+	for i := 0; i < 2; i++ {
+		data := requestNodeData([]common.Hash{root1})
+		require.Len(t, data, 1)
+		assert.Equal(t, root1, crypto.Keccak256Hash(data[0]))
+	}
+	assert.Equal(t, 1, pm.nodeData.overlays.Len())
+}
+
+// nodeDataRefs returns the 32 byte strings found in the trie node, also in the embedded nodes and in the accounts
+func nodeDataRefs(blob []byte) []common.Hash {
+	elems, _, err := rlp.SplitList(blob)
+	if err != nil {
+		return nil
+	}
+	var refs []common.Hash
+	for len(elems) > 0 {
+		kind, content, rest, err := rlp.Split(elems)
+		if err != nil {
+			return refs
+		}
+		switch {
+		case kind == rlp.List:
+			refs = append(refs, nodeDataRefs(elems[:len(elems)-len(rest)])...)
+		case len(content) == common.HashLength:
+			refs = append(refs, common.BytesToHash(content))
+		default:
+			refs = append(refs, nodeDataRefs(content)...)
+		}
+		elems = rest
+	}
+	return refs
+}
+
 // Tests that the transaction receipts can be retrieved based on hashes.
 func TestGetReceipt63(t *testing.T) { testGetReceipt(t, 63) }
 func TestGetReceipt64(t *testing.T) { testGetReceipt(t, 64) }
@@ -1301,6 +1390,82 @@ func TestFirehoseBytecode(t *testing.T) {
 	}
 }
 
+func TestFirehoseStorageSizes(t *testing.T) {
+	pm, addr := setUpStorageContractA(t)
+	peer, _ := newFirehoseTestPeer("peer", pm)
+	defer peer.close()
+
+	someRoot := common.HexToHash("0x01")
+	head := pm.blockchain.CurrentBlock().Hash()
+
+	var request getStorageSizesMsg
+	request.ID = 1
+	request.Block = head
+	request.Requests = []storageSizeReq{
+		{Account: addr.Bytes(), StorageRoot: someRoot},
+		{Account: crypto.Keccak256(addr.Bytes()), StorageRoot: someRoot},
+		{Account: testBank.Bytes(), StorageRoot: someRoot},
+		{Account: addr.Bytes(), StorageRoot: trie.EmptyRoot},
+	}
+
+	assert.NoError(t, p2p.Send(peer.app, GetStorageSizesCode, request))
+	reply := storageSizesMsg{ID: 1, Sizes: []uint64{2, 2, 0, 0}}
+	if err := p2p.ExpectMsg(peer.app, StorageSizesCode, reply); err != nil {
+		t.Fatalf("unexpected StorageSizes response: %v", err)
+	}
+	assert.Equal(t, 2, pm.storageSizeCache.Len())
+
+	// Only the current block is available
+	request.ID = 2
+	request.Block = pm.blockchain.GetBlockByNumber(1).Hash()
+
+	assert.NoError(t, p2p.Send(peer.app, GetStorageSizesCode, request))
+	reply = storageSizesMsg{ID: 2, Sizes: []uint64{0, 0, 0, 0}, AvailableBlocks: []common.Hash{head}}
+	if err := p2p.ExpectMsg(peer.app, StorageSizesCode, reply); err != nil {
+		t.Errorf("unexpected StorageSizes response: %v", err)
+	}
+
+	// Only the first requests are served, up to the fetch limit
+	request.ID = 3
+	request.Block = head
+	request.Requests = make([]storageSizeReq, downloader.MaxStateFetch+1)
+	for i := range request.Requests {
+		request.Requests[i] = storageSizeReq{Account: addr.Bytes(), StorageRoot: someRoot}
+	}
+	reply = storageSizesMsg{ID: 3, Sizes: make([]uint64, downloader.MaxStateFetch)}
+	for i := range reply.Sizes {
+		reply.Sizes[i] = 2
+	}
+	assert.NoError(t, p2p.Send(peer.app, GetStorageSizesCode, request))
+	if err := p2p.ExpectMsg(peer.app, StorageSizesCode, reply); err != nil {
+		t.Errorf("unexpected StorageSizes response: %v", err)
+	}
+}
+
+func TestStorageSizeLimit(t *testing.T) {
+	pm, addr := setUpStorageContractA(t)
+	head := pm.blockchain.CurrentBlock().Hash()
+	addrHash := crypto.Keccak256Hash(addr.Bytes())
+
+	// The storage larger than the limit is not counted, nor cached
+	size, walked, err := pm.storageSize(head, addrHash, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), size)
+	assert.Equal(t, uint64(1), walked)
+	assert.Equal(t, 0, pm.storageSizeCache.Len())
+
+	size, walked, err = pm.storageSize(head, addrHash, 2)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), size)
+	assert.Equal(t, uint64(2), walked)
+
+	// Cached sizes are served without walking the storage
+	size, walked, err = pm.storageSize(head, addrHash, 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), size)
+	assert.Equal(t, uint64(0), walked)
+}
+
 // Tests that a propagated malformed block (uncles or transactions don't match
 // with the hashes in the header) gets discarded and not broadcast forward.
 func TestBroadcastMalformedBlock(t *testing.T) {
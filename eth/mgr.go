@@ -1,13 +1,28 @@
 package eth
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/p2p"
+	"github.com/ledgerwatch/turbo-geth/trie"
 )
 
 // MGR (aka Merry-Go-Round) protocol - providing capabilities of swarm-based-full-sync
 // At a high level, MGR operates by enumerating the full state in a predetermined order
 // and gossiping this data among the clients which are actively syncing.
 // For a client to fully sync it needs to “ride” one full rotation of the merry-go-round.
+// See docs/merry-go-round-sync.md
 
 const (
 	mgr1 = 1
@@ -24,13 +39,449 @@ const (
 	MGRWitness = 0x01
 )
 
+// MGRTicksPerCycle is the number of ticks in one cycle of the merry-go-round,
+// which is also the number of pieces the state is split into. A new tick starts with every block.
+const MGRTicksPerCycle = 4096
+
+// MGRStatusMsg is sent by the leechers to announce themselves and to report their progress.
+type MGRStatusMsg struct {
+	Leecher bool
+	Ticks   uint64 // number of ticks of the cycle the leecher has received the state for
+}
+
+// MGRWitnessMsg carries the piece of the state scheduled for the tick started by the block.
+type MGRWitnessMsg struct {
+	Block   uint64
+	Tick    uint64
+	From    common.Hash
+	To      common.Hash
+	Witness []byte // serialised trie.Witness of the accounts from the range, with their storage and code
+}
+
 type mgrPeer struct {
 	*p2p.Peer
 	rw p2p.MsgReadWriter
 }
 
-// SendByteCode sends a BytecodeCode message.
-func (p *mgrPeer) SendByteCode(id uint64, data [][]byte) error {
-	msg := bytecodeMsg{ID: id, Code: data}
-	return p2p.Send(p.rw, BytecodeCode, msg)
+// mgrTick is a piece of the sync schedule: the range of account keys exchanged during the tick.
+type mgrTick struct {
+	Number uint64      // number of the tick within the cycle
+	Block  uint64      // block the tick starts with
+	From   common.Hash // first account key of the range
+	To     common.Hash // last account key of the range, inclusive
+}
+
+// contains checks whether the account key (or the storage key of the account) lies within the tick range.
+func (t mgrTick) contains(key []byte) bool {
+	return bytes.Compare(key[:common.HashLength], t.From[:]) >= 0 && bytes.Compare(key[:common.HashLength], t.To[:]) <= 0
+}
+
+// mgrRangeLimiter makes the witness of the whole state trie expand only the paths to the accounts
+// from the tick range, with their storage and code, the rest of the trie is hashed.
+type mgrRangeLimiter struct {
+	tick mgrTick
+}
+
+// HashOnly is true for the subtries that do not have any account from the range.
+func (l mgrRangeLimiter) HashOnly(hex []byte) bool {
+	if len(hex) > 2*common.HashLength {
+		hex = hex[:2*common.HashLength]
+	}
+	// The smallest and the largest account keys with the prefix
+	minHex := make([]byte, 2*common.HashLength)
+	maxHex := make([]byte, 2*common.HashLength)
+	copy(minHex, hex)
+	copy(maxHex, hex)
+	for i := len(hex); i < len(maxHex); i++ {
+		maxHex[i] = 0xf
+	}
+	var minKey, maxKey []byte
+	trie.CompressNibbles(minHex, &minKey)
+	trie.CompressNibbles(maxHex, &maxKey)
+	return bytes.Compare(maxKey, l.tick.From[:]) < 0 || bytes.Compare(minKey, l.tick.To[:]) > 0
+}
+
+// IsCodeTouched is true for every code, the accounts outside of the range get into the witness only
+// when they are the neighbours of the ones within it.
+func (l mgrRangeLimiter) IsCodeTouched(common.Hash) bool {
+	return true
+}
+
+func (l mgrRangeLimiter) Current() []byte {
+	return nil
+}
+
+// mgrSchedule splits the key space of the state into the ranges of equal size, one per tick of the cycle.
+type mgrSchedule struct {
+	ticksPerCycle uint64
+}
+
+// tick returns the piece of the schedule for the tick started by the given block.
+func (s mgrSchedule) tick(blockNr uint64) mgrTick {
+	number := blockNr % s.ticksPerCycle
+	keySpace := new(big.Int).Lsh(big.NewInt(1), 8*common.HashLength)
+	pieceSize := new(big.Int).Div(keySpace, new(big.Int).SetUint64(s.ticksPerCycle))
+
+	from := new(big.Int).Mul(pieceSize, new(big.Int).SetUint64(number))
+	to := new(big.Int).Add(from, pieceSize)
+	if number == s.ticksPerCycle-1 {
+		to.Set(keySpace)
+	}
+	to.Sub(to, big.NewInt(1))
+
+	return mgrTick{
+		Number: number,
+		Block:  blockNr,
+		From:   common.BigToHash(from),
+		To:     common.BigToHash(to),
+	}
+}
+
+// mgr runs the Merry-Go-Round sync. Seeders gossip the pieces of the state from their database to the leechers
+// according to the schedule, leechers assemble the state from the witnesses they receive and pass them on.
+// Nodes which are neither seeders nor leechers only keep track of the peers.
+type mgr struct {
+	db       ethdb.Database
+	schedule mgrSchedule
+	leecher  bool
+	seeder   bool
+
+	lock     sync.Mutex
+	peers    map[*mgrPeer]*MGRStatusMsg // status of the peers, nil for the peers which are not leechers
+	received map[uint64]uint64          // tick number => block of the latest piece received by the leecher
+	done     chan struct{}              // closed when the leecher has received every piece of the cycle
+
+	applyLock sync.Mutex // serialises writes of the pieces into the database
+}
+
+func newMgr(db ethdb.Database, schedule mgrSchedule, leecher bool, seeder bool) *mgr {
+	return &mgr{
+		db:       db,
+		schedule: schedule,
+		leecher:  leecher,
+		seeder:   seeder,
+		peers:    make(map[*mgrPeer]*MGRStatusMsg),
+		received: make(map[uint64]uint64),
+		done:     make(chan struct{}),
+	}
+}
+
+// handle serves the MGR protocol for the peer until the connection breaks.
+func (m *mgr) handle(p *mgrPeer) error {
+	m.lock.Lock()
+	m.peers[p] = nil
+	m.lock.Unlock()
+	defer func() {
+		m.lock.Lock()
+		delete(m.peers, p)
+		m.lock.Unlock()
+	}()
+
+	if m.leecher {
+		if err := p2p.Send(p.rw, MGRStatus, m.status()); err != nil {
+			return err
+		}
+	}
+	for {
+		if err := m.handleMsg(p); err != nil {
+			p.Log().Debug("MGR message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
+func (m *mgr) handleMsg(p *mgrPeer) error {
+	msg, readErr := p.rw.ReadMsg()
+	if readErr != nil {
+		return fmt.Errorf("handleMgrMsg p.rw.ReadMsg: %w", readErr)
+	}
+	if msg.Size > MGRMaxMsgSize {
+		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, MGRMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	switch msg.Code {
+	case MGRStatus:
+		var status MGRStatusMsg
+		if err := msg.Decode(&status); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		m.lock.Lock()
+		if status.Leecher {
+			m.peers[p] = &status
+		} else {
+			m.peers[p] = nil
+		}
+		m.lock.Unlock()
+		return nil
+
+	case MGRWitness:
+		var witness MGRWitnessMsg
+		if err := msg.Decode(&witness); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if !m.leecher {
+			return nil
+		}
+		fresh, err := m.applyWitness(&witness)
+		if err != nil {
+			return err
+		}
+		if fresh {
+			m.gossip(&witness, p)
+			m.reportProgress()
+		}
+		return nil
+
+	default:
+		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
+	}
+}
+
+// status returns the status message of the leecher.
+func (m *mgr) status() *MGRStatusMsg {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return &MGRStatusMsg{Leecher: m.leecher, Ticks: uint64(len(m.received))}
+}
+
+// progress returns the number of ticks received by the leecher and the number of ticks in the cycle.
+func (m *mgr) progress() (uint64, uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return uint64(len(m.received)), m.schedule.ticksPerCycle
+}
+
+// reportProgress logs the progress of the leecher and lets the peers know about it.
+func (m *mgr) reportProgress() {
+	status := m.status()
+	log.Info("MGR sync progress", "ticks", status.Ticks, "of", m.schedule.ticksPerCycle)
+
+	m.lock.Lock()
+	peers := make([]*mgrPeer, 0, len(m.peers))
+	for p := range m.peers {
+		peers = append(peers, p)
+	}
+	m.lock.Unlock()
+
+	for _, p := range peers {
+		if err := p2p.Send(p.rw, MGRStatus, status); err != nil {
+			p.Log().Debug("MGR status sending failed", "err", err)
+		}
+	}
+}
+
+// seed gossips the piece of the state scheduled for the tick started by the block to the leechers.
+func (m *mgr) seed(blockNr uint64) error {
+	if !m.seeder || m.leecher || len(m.leechers(nil)) == 0 {
+		return nil
+	}
+	msg, err := m.witness(blockNr)
+	if err != nil {
+		return err
+	}
+	m.gossip(msg, nil)
+	return nil
+}
+
+// witness produces the piece of the state scheduled for the tick started by the block: the witness of
+// the whole state trie as of the block, with only the accounts from the range of the tick expanded.
+func (m *mgr) witness(blockNr uint64) (*MGRWitnessMsg, error) {
+	root, err := m.stateRoot(blockNr)
+	if err != nil {
+		return nil, err
+	}
+	tick := m.schedule.tick(blockNr)
+	tr, err := m.rangeTrie(tick, root)
+	if err != nil {
+		return nil, fmt.Errorf("state of block %d: %w", blockNr, err)
+	}
+	witness, err := tr.ExtractWitnessHashOnly(blockNr, false, mgrRangeLimiter{tick})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := witness.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return &MGRWitnessMsg{Block: blockNr, Tick: tick.Number, From: tick.From, To: tick.To, Witness: buf.Bytes()}, nil
+}
+
+// stateRoot returns the state root from the header of the canonical block.
+func (m *mgr) stateRoot(blockNr uint64) (common.Hash, error) {
+	header := rawdb.ReadHeader(m.db, rawdb.ReadCanonicalHash(m.db, blockNr), blockNr)
+	if header == nil {
+		return common.Hash{}, fmt.Errorf("header of block %d not found", blockNr)
+	}
+	return header.Root, nil
+}
+
+// rangeTrie resolves the state trie out of the current state in the database, with the accounts from
+// the tick range loaded together with their storage and code. The rest of the trie is hashed, with the
+// hashes taken from IntermediateTrieHashBucket where possible, so only the range is kept in memory.
+// The root of the resolved trie must match the given one.
+func (m *mgr) rangeTrie(tick mgrTick, root common.Hash) (*trie.Trie, error) {
+	tr := trie.New(root)
+	resolver := trie.NewResolver(0, 0)
+	resolver.AddRequest(tr.NewResolveRequest(nil, []byte{}, 0, root[:]))
+	incarnations := make(map[common.Hash]uint64)
+	if err := m.db.Walk(dbutils.CurrentStateBucket, tick.From[:], 0, func(k, v []byte) (bool, error) {
+		if !tick.contains(k) {
+			return false, nil
+		}
+		addrHash := common.BytesToHash(k[:common.HashLength])
+		var hex []byte
+		if len(k) == common.HashLength {
+			var acc accounts.Account
+			if err := acc.DecodeForStorage(v); err != nil {
+				return false, err
+			}
+			incarnations[addrHash] = acc.Incarnation
+			trie.DecompressNibbles(k, &hex)
+			resolver.AddRequest(tr.NewResolveRequest(nil, hex, 0, nil))
+			if !acc.IsEmptyCodeHash() {
+				resolver.AddCodeRequest(tr.NewResolveRequestForCode(addrHash, acc.CodeHash, true))
+			}
+			return true, nil
+		}
+		// Skip the storage left by the previous incarnations of the contract
+		if incarnation, ok := incarnations[addrHash]; ok && ^binary.BigEndian.Uint64(k[common.HashLength:]) == incarnation {
+			trie.DecompressNibbles(k[common.HashLength+common.IncarnationLength:], &hex)
+			contract := common.CopyBytes(k[:common.HashLength+common.IncarnationLength])
+			resolver.AddRequest(tr.NewResolveRequest(contract, hex, 0, nil))
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := resolver.ResolveStateful(m.db, 0, false); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// leechers returns the peers which still need the state, except the given one.
+func (m *mgr) leechers(except *mgrPeer) []*mgrPeer {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var leechers []*mgrPeer
+	for p, status := range m.peers {
+		if p != except && status != nil && status.Ticks < m.schedule.ticksPerCycle {
+			leechers = append(leechers, p)
+		}
+	}
+	return leechers
+}
+
+// gossip sends the piece of the state to the leechers, except the one it came from.
+func (m *mgr) gossip(msg *MGRWitnessMsg, from *mgrPeer) {
+	for _, p := range m.leechers(from) {
+		if err := p2p.Send(p.rw, MGRWitness, msg); err != nil {
+			p.Log().Debug("MGR witness sending failed", "err", err)
+		}
+	}
+}
+
+// applyWitness replaces the piece of the state in the database with the one from the witness.
+// It returns false if the piece had been received already, or if the header of the block is not known yet.
+// Witnesses which do not match the state root of the block are rejected.
+func (m *mgr) applyWitness(msg *MGRWitnessMsg) (bool, error) {
+	tick := m.schedule.tick(msg.Block)
+	if tick.Number != msg.Tick || tick.From != msg.From || tick.To != msg.To {
+		return false, fmt.Errorf("MGR witness for block %d does not match the schedule", msg.Block)
+	}
+
+	m.applyLock.Lock()
+	defer m.applyLock.Unlock()
+
+	m.lock.Lock()
+	block, ok := m.received[tick.Number]
+	m.lock.Unlock()
+	if ok && block >= tick.Block {
+		return false, nil
+	}
+
+	witness, err := trie.NewWitnessFromReader(bytes.NewReader(msg.Witness), false)
+	if err != nil {
+		return false, fmt.Errorf("MGR witness for block %d: %w", msg.Block, err)
+	}
+	tr, err := trie.BuildTrieFromWitness(witness, false, false)
+	if err != nil {
+		return false, fmt.Errorf("MGR witness for block %d: %w", msg.Block, err)
+	}
+	root, err := m.stateRoot(msg.Block)
+	if err != nil {
+		log.Debug("MGR witness can't be verified", "err", err)
+		return false, nil
+	}
+	if hash := tr.Hash(); hash != root {
+		return false, fmt.Errorf("MGR witness for block %d: state root %x, expected %x", msg.Block, hash, root)
+	}
+
+	batch := m.db.NewBatch()
+	// The previous version of the piece is replaced as a whole
+	var stale [][]byte
+	if err := m.db.Walk(dbutils.CurrentStateBucket, tick.From[:], 0, func(k, _ []byte) (bool, error) {
+		if !tick.contains(k) {
+			return false, nil
+		}
+		stale = append(stale, common.CopyBytes(k))
+		return true, nil
+	}); err != nil {
+		return false, err
+	}
+	for _, k := range stale {
+		if err := batch.Delete(dbutils.CurrentStateBucket, k); err != nil {
+			return false, err
+		}
+	}
+
+	incarnations := make(map[common.Hash]uint64)
+	if err := tr.WalkLoadedLeaves(
+		func(addrHash []byte, acc *accounts.Account, code []byte) error {
+			// The neighbours of the range come along with the paths to it
+			if !tick.contains(addrHash) {
+				return nil
+			}
+			var a accounts.Account
+			a.Copy(acc)
+			// Witnesses do not carry incarnations, so the contracts start anew
+			if !a.IsEmptyRoot() || !a.IsEmptyCodeHash() {
+				a.Incarnation = state.FirstContractIncarnation
+			}
+			incarnations[common.BytesToHash(addrHash)] = a.Incarnation
+			if err := rawdb.WriteAccount(batch, common.BytesToHash(addrHash), a); err != nil {
+				return err
+			}
+			if code == nil {
+				return nil
+			}
+			if err := batch.Put(dbutils.CodeBucket, a.CodeHash[:], code); err != nil {
+				return err
+			}
+			return batch.Put(dbutils.ContractCodeBucket, dbutils.GenerateStoragePrefix(addrHash, a.Incarnation), a.CodeHash[:])
+		},
+		func(addrHash []byte, keyHash []byte, value []byte) error {
+			if !tick.contains(addrHash) {
+				return nil
+			}
+			incarnation := incarnations[common.BytesToHash(addrHash)]
+			key := dbutils.GenerateCompositeStorageKey(common.BytesToHash(addrHash), incarnation, common.BytesToHash(keyHash))
+			return batch.Put(dbutils.CurrentStateBucket, key, common.CopyBytes(value))
+		},
+	); err != nil {
+		return false, err
+	}
+	if _, err := batch.Commit(); err != nil {
+		return false, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.received[tick.Number] = tick.Block
+	if uint64(len(m.received)) == m.schedule.ticksPerCycle && !ok {
+		log.Info("MGR sync complete", "block", msg.Block)
+		close(m.done)
+	}
+	return true, nil
 }
@@ -0,0 +1,271 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/node"
+	"github.com/ledgerwatch/turbo-geth/p2p"
+	"github.com/ledgerwatch/turbo-geth/p2p/enode"
+	"github.com/ledgerwatch/turbo-geth/p2p/simulations"
+	"github.com/ledgerwatch/turbo-geth/p2p/simulations/adapters"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/ledgerwatch/turbo-geth/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMgrSchedule(t *testing.T) {
+	s := mgrSchedule{ticksPerCycle: 16}
+
+	first := s.tick(32)
+	assert.Equal(t, uint64(0), first.Number)
+	assert.Equal(t, common.Hash{}, first.From)
+	assert.Equal(t, common.HexToHash("0x0fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"), first.To)
+
+	// Ticks follow each other without gaps
+	for blockNr := uint64(33); blockNr < 48; blockNr++ {
+		tick := s.tick(blockNr)
+		assert.Equal(t, blockNr-32, tick.Number)
+		prev := s.tick(blockNr - 1)
+		assert.Equal(t, new(big.Int).Add(prev.To.Big(), big.NewInt(1)), tick.From.Big())
+	}
+
+	last := s.tick(47)
+	assert.Equal(t, common.HexToHash("0xf000000000000000000000000000000000000000000000000000000000000000"), last.From)
+	assert.Equal(t, common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"), last.To)
+	assert.True(t, last.contains(last.To[:]))
+	assert.False(t, last.contains(first.To[:]))
+}
+
+// mgrService runs the MGR protocol on a simulated node.
+type mgrService struct {
+	mgr *mgr
+}
+
+func (s *mgrService) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    MGRName,
+		Version: MGRVersions[0],
+		Length:  MGRLengths[MGRVersions[0]],
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			return s.mgr.handle(&mgrPeer{Peer: p, rw: rw})
+		},
+	}}
+}
+
+func (s *mgrService) APIs() []rpc.API                { return nil }
+func (s *mgrService) Start(server *p2p.Server) error { return nil }
+func (s *mgrService) Stop() error                    { return nil }
+
+func TestMgrSimulation(t *testing.T) {
+	schedule := mgrSchedule{ticksPerCycle: 16}
+
+	// The state of the seeder has plain accounts and contracts with code and storage
+	alloc := core.GenesisAlloc{}
+	for i := 0; i < 64; i++ {
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		account := core.GenesisAccount{Balance: big.NewInt(int64(i + 1))}
+		if i%4 == 0 {
+			account.Code = []byte{0x60, byte(i), 0x60, 0x00, 0x55}
+			account.Storage = map[common.Hash]common.Hash{
+				common.HexToHash("01"):                 common.HexToHash(fmt.Sprintf("%x", i+1)),
+				common.BigToHash(big.NewInt(int64(i))): common.HexToHash("ff"),
+			}
+		}
+		alloc[crypto.PubkeyToAddress(key.PublicKey)] = account
+	}
+	seederDb := ethdb.NewMemDatabase()
+	defer seederDb.Close()
+	genesis := (&core.Genesis{Config: params.TestChainConfig, Alloc: alloc}).MustCommit(seederDb)
+
+	// The state does not change during the cycle, all the blocks have the state root of the genesis
+	const firstBlock = 100
+	writeHeaders := func(db ethdb.Database, root common.Hash) {
+		for blockNr := uint64(firstBlock); blockNr < firstBlock+schedule.ticksPerCycle; blockNr++ {
+			header := &types.Header{Number: new(big.Int).SetUint64(blockNr), Root: root}
+			rawdb.WriteHeader(context.Background(), db, header)
+			rawdb.WriteCanonicalHash(db, header.Hash(), blockNr)
+		}
+	}
+	writeHeaders(seederDb, genesis.Root())
+	leecherDbs := make(map[string]ethdb.Database)
+	for _, name := range []string{"leecher1", "leecher2"} {
+		leecherDbs[name] = ethdb.NewMemDatabase()
+		defer leecherDbs[name].Close()
+		writeHeaders(leecherDbs[name], genesis.Root())
+	}
+
+	var lock sync.Mutex
+	mgrs := make(map[enode.ID]*mgr)
+	newService := func(db ethdb.Database, leecher bool) adapters.ServiceFunc {
+		return func(ctx *adapters.ServiceContext) (node.Service, error) {
+			m := newMgr(db, schedule, leecher, !leecher)
+			lock.Lock()
+			mgrs[ctx.Config.ID] = m
+			lock.Unlock()
+			return &mgrService{mgr: m}, nil
+		}
+	}
+	adapter := adapters.NewSimAdapter(adapters.Services{
+		"seeder":   newService(seederDb, false),
+		"leecher1": newService(leecherDbs["leecher1"], true),
+		"leecher2": newService(leecherDbs["leecher2"], true),
+	})
+	network := simulations.NewNetwork(adapter, &simulations.NetworkConfig{})
+	defer network.Shutdown()
+
+	// Leecher 2 is not connected to the seeder, it gets the state passed on by leecher 1
+	ids := make(map[string]enode.ID)
+	for _, name := range []string{"seeder", "leecher1", "leecher2"} {
+		conf := adapters.RandomNodeConfig()
+		conf.Services = []string{name}
+		n, err := network.NewNodeWithConfig(conf)
+		require.NoError(t, err)
+		require.NoError(t, network.Start(n.ID()))
+		ids[name] = n.ID()
+	}
+	require.NoError(t, network.Connect(ids["leecher1"], ids["seeder"]))
+	require.NoError(t, network.Connect(ids["leecher2"], ids["leecher1"]))
+
+	lock.Lock()
+	seeder, leecher1, leecher2 := mgrs[ids["seeder"]], mgrs[ids["leecher1"]], mgrs[ids["leecher2"]]
+	lock.Unlock()
+
+	// Wait for the leechers to announce themselves
+	waitFor := func(what string, cond func() bool) {
+		deadline := time.Now().Add(10 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("leecher 1", func() bool { return len(seeder.leechers(nil)) == 1 })
+	waitFor("leecher 2", func() bool { return len(leecher1.leechers(nil)) == 1 })
+
+	// One cycle, starting in the middle of it
+	for blockNr := uint64(firstBlock); blockNr < firstBlock+schedule.ticksPerCycle; blockNr++ {
+		require.NoError(t, seeder.seed(blockNr))
+	}
+
+	for _, leecher := range []*mgr{leecher1, leecher2} {
+		select {
+		case <-leecher.done:
+		case <-time.After(10 * time.Second):
+			received, total := leecher.progress()
+			t.Fatalf("leecher received %d ticks of %d", received, total)
+		}
+		assert.NoError(t, resolveState(leecher.db, genesis.Root()))
+	}
+
+	// The leechers that are done do not get the state anymore
+	waitFor("leechers to finish", func() bool { return len(seeder.leechers(nil)) == 0 && len(leecher1.leechers(nil)) == 0 })
+
+	// Witnesses not matching the state root of the block are rejected
+	msg, err := seeder.witness(firstBlock)
+	require.NoError(t, err)
+	otherDb := ethdb.NewMemDatabase()
+	defer otherDb.Close()
+	writeHeaders(otherDb, common.HexToHash("0xbad"))
+	_, err = newMgr(otherDb, schedule, true, false).applyWitness(msg)
+	assert.Error(t, err)
+}
+
+// resolveState checks that the current state in the database has the given root.
+func resolveState(db ethdb.Database, root common.Hash) error {
+	tr := trie.New(root)
+	resolver := trie.NewResolver(0, 0)
+	resolver.IgnoreIntermediateHashes(true)
+	resolver.AddRequest(tr.NewResolveRequest(nil, []byte{}, 0, root[:]))
+	return resolver.ResolveStateful(db, 0, false)
+}
+
+func TestMgrWitnessIntermediateHashes(t *testing.T) {
+	schedule := mgrSchedule{ticksPerCycle: 16}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	alloc := core.GenesisAlloc{}
+	for i := 0; i < 1024; i++ {
+		account := core.GenesisAccount{Balance: big.NewInt(int64(i + 1))}
+		if i%8 == 0 {
+			account.Code = []byte{0x60, byte(i), 0x60, 0x00, 0x55}
+			account.Storage = map[common.Hash]common.Hash{common.HexToHash("01"): common.HexToHash(fmt.Sprintf("%x", i+1))}
+		}
+		alloc[common.BigToAddress(big.NewInt(int64(i+1)))] = account
+	}
+	genesis := (&core.Genesis{Config: params.TestChainConfig, Alloc: alloc}).MustCommit(db)
+	const blockNr = 5
+	header := &types.Header{Number: big.NewInt(blockNr), Root: genesis.Root()}
+	rawdb.WriteHeader(context.Background(), db, header)
+	rawdb.WriteCanonicalHash(db, header.Hash(), blockNr)
+
+	// Intermediate hashes of the account trie, as the hash check stage writes them
+	tr := trie.New(genesis.Root())
+	resolver := trie.NewResolver(2*common.HashLength, 0)
+	resolver.IgnoreIntermediateHashes(true)
+	resolver.AddRequest(tr.NewResolveRequest(nil, []byte{}, 0, genesis.Root().Bytes()))
+	require.NoError(t, resolver.ResolveStateful(db, 0, false))
+	ih := state.NewIntermediateHashes(db, db)
+	tr.WalkBranchChildren(func(hex []byte, hash common.Hash, incarnation uint64) {
+		ih.WillUnloadBranchNode(hex, hash, incarnation)
+	})
+
+	m := newMgr(db, schedule, false, true)
+	tick := schedule.tick(blockNr)
+	var inside, outside []byte
+	require.NoError(t, db.Walk(dbutils.IntermediateTrieHashBucket, []byte{}, 0, func(k, _ []byte) (bool, error) {
+		if len(k) == 1 && tick.contains(common.RightPadBytes(k, common.HashLength)) {
+			inside = common.CopyBytes(k)
+		} else if len(k) == 1 {
+			outside = common.CopyBytes(k)
+		}
+		return true, nil
+	}))
+	require.NotNil(t, inside)
+	require.NotNil(t, outside)
+
+	leecherDb := ethdb.NewMemDatabase()
+	defer leecherDb.Close()
+	rawdb.WriteHeader(context.Background(), leecherDb, header)
+	rawdb.WriteCanonicalHash(leecherDb, header.Hash(), blockNr)
+	leecher := newMgr(leecherDb, schedule, true, false)
+
+	// The range of the tick is read from the current state, even if its intermediate hashes are wrong
+	require.NoError(t, db.Put(dbutils.IntermediateTrieHashBucket, inside, common.HexToHash("0xbad").Bytes()))
+	msg, err := m.witness(blockNr)
+	require.NoError(t, err)
+	fresh, err := leecher.applyWitness(msg)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	var loaded int
+	require.NoError(t, leecherDb.Walk(dbutils.CurrentStateBucket, []byte{}, 0, func(k, _ []byte) (bool, error) {
+		assert.True(t, tick.contains(k), "key %x out of the range", k)
+		if len(k) == common.HashLength {
+			loaded++
+		}
+		return true, nil
+	}))
+	assert.NotZero(t, loaded)
+
+	// The rest of the trie is hashed with the intermediate hashes instead of being loaded
+	require.NoError(t, db.Put(dbutils.IntermediateTrieHashBucket, outside, common.HexToHash("0xbad").Bytes()))
+	_, err = m.witness(blockNr)
+	assert.Error(t, err)
+}
@@ -0,0 +1,382 @@
+package eth
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/downloader"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/ledgerwatch/turbo-geth/trie"
+)
+
+// nodeDataBlocks is the number of the recent blocks whose state tries are served by nodeDataServer.
+// The fast sync of go-ethereum picks the state of the block 64 blocks behind the head.
+const nodeDataBlocks = 128
+
+// nodeDataPathsLimit is the number of the trie nodes nodeDataServer remembers the paths of.
+const nodeDataPathsLimit = 256 * 1024
+
+// nodeDataOverlaysLimit is the number of the historical states nodeDataServer keeps for rebuilding the nodes,
+// the syncing peers usually request the state of the same block.
+const nodeDataOverlaysLimit = 4
+
+// nodePath locates a trie node in the state as of a block.
+type nodePath struct {
+	blockNr  uint64
+	contract []byte // Address hash and incarnation for the storage tries, nil for the account trie
+	hex      []byte // Path to the node from the root of its trie, in nibbles
+}
+
+// fullPath is the path to the node from the root of the account trie, the incarnation is not a part of it.
+func (p *nodePath) fullPath() []byte {
+	if p.contract == nil {
+		return p.hex
+	}
+	var hex []byte
+	trie.DecompressNibbles(p.contract[:common.HashLength], &hex)
+	return append(hex, p.hex...)
+}
+
+// overlayKey identifies the state as of the block laid over the current state as of the head
+type overlayKey struct {
+	head, blockNr uint64
+}
+
+type nodeRequest struct {
+	hash common.Hash
+	path *nodePath
+}
+
+// nodeDataServer answers GetNodeData requests when the state trie is not kept in memory,
+// in the staged sync and download-only modes. The nodes are rebuilt from the flat state and
+// the intermediate hashes, only the path to a node is needed to do that. As the syncing peers
+// request the trie top down, starting from the state root of a recent block, the server remembers
+// the paths of the children of every node it serves. The nodes it has not served before (to this
+// or to another peer) are not found, the syncing peers request them from the others.
+type nodeDataServer struct {
+	db       ethdb.Database
+	paths    *lru.Cache // Paths to the nodes by their hashes
+	overlays *lru.Cache // States as of the recent blocks by overlayKey, they are collected from the history once
+
+	rootsLock  sync.Mutex
+	roots      map[common.Hash]uint64 // Block numbers by the state roots of the recent blocks
+	rootsBlock uint64                 // Block the roots are collected up to
+}
+
+func newNodeDataServer(db ethdb.Database) (*nodeDataServer, error) {
+	paths, err := lru.New(nodeDataPathsLimit)
+	if err != nil {
+		return nil, err
+	}
+	overlays, err := lru.New(nodeDataOverlaysLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &nodeDataServer{db: db, paths: paths, overlays: overlays}, nil
+}
+
+// getNodeData returns the trie nodes and the contract code with the given hashes, until the size limit is reached.
+// The unknown ones are skipped, the syncing peers find the returned ones by their hashes.
+func (s *nodeDataServer) getNodeData(hashes []common.Hash, sizeLimit int) ([][]byte, error) {
+	var (
+		data [][]byte
+		size int
+		reqs []*nodeRequest
+		seen = make(map[common.Hash]struct{}, len(hashes))
+	)
+	for _, hash := range hashes {
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+		seen[hash] = struct{}{}
+		path, err := s.lookup(hash)
+		if err != nil {
+			return nil, err
+		}
+		if path != nil {
+			reqs = append(reqs, &nodeRequest{hash: hash, path: path})
+			continue
+		}
+		if size >= sizeLimit {
+			continue
+		}
+		code, err := s.db.Get(dbutils.CodeBucket, hash[:])
+		if err != nil && err != ethdb.ErrKeyNotFound {
+			return nil, err
+		}
+		if len(code) > 0 {
+			data = append(data, code)
+			size += len(code)
+		}
+	}
+	for _, round := range nodeRounds(reqs) {
+		if size >= sizeLimit {
+			break
+		}
+		nodes, err := s.rebuildNodes(round)
+		if err != nil {
+			log.Debug("Failed to rebuild trie nodes", "block", round[0].path.blockNr, "nodes", len(round), "err", err)
+			continue
+		}
+		for _, node := range nodes {
+			if size >= sizeLimit {
+				break
+			}
+			data = append(data, node)
+			size += len(node)
+		}
+	}
+	return data, nil
+}
+
+// lookup returns the path to the node with the given hash, nil if the node is not known
+func (s *nodeDataServer) lookup(hash common.Hash) (*nodePath, error) {
+	if path, ok := s.paths.Get(hash); ok {
+		return path.(*nodePath), nil
+	}
+
+	s.rootsLock.Lock()
+	defer s.rootsLock.Unlock()
+	// The flat state and the intermediate hashes are consistent as of the block verified by the HashCheck stage,
+	// the earlier states are obtained by rewinding the flat state
+	head, err := downloader.GetStageProgress(s.db, downloader.HashCheck)
+	if err != nil {
+		return nil, err
+	}
+	if head == 0 {
+		return nil, nil
+	}
+	if s.roots == nil || s.rootsBlock != head {
+		s.roots = make(map[common.Hash]uint64, nodeDataBlocks)
+		for blockNr := head; blockNr > 0 && blockNr+nodeDataBlocks > head; blockNr-- {
+			if header := rawdb.ReadHeader(s.db, rawdb.ReadCanonicalHash(s.db, blockNr), blockNr); header != nil {
+				s.roots[header.Root] = blockNr
+			}
+		}
+		s.rootsBlock = head
+	}
+	if blockNr, ok := s.roots[hash]; ok {
+		return &nodePath{blockNr: blockNr}, nil
+	}
+	return nil, nil
+}
+
+// nodeRounds splits the requests into the groups which can be resolved together. The resolver merges
+// the requests lying under the other ones, so such requests go to the later rounds.
+func nodeRounds(reqs []*nodeRequest) [][]*nodeRequest {
+	fullPaths := make(map[*nodeRequest][]byte, len(reqs))
+	for _, req := range reqs {
+		fullPaths[req] = req.path.fullPath()
+	}
+	sort.Slice(reqs, func(i, j int) bool {
+		if reqs[i].path.blockNr != reqs[j].path.blockNr {
+			return reqs[i].path.blockNr < reqs[j].path.blockNr
+		}
+		return bytes.Compare(fullPaths[reqs[i]], fullPaths[reqs[j]]) < 0
+	})
+
+	var rounds [][]*nodeRequest
+	roundIdx := make(map[uint64]map[int]int) // Rounds by block number and the number of the requests above
+	var above []*nodeRequest                 // Requests above the current one, the closest last
+	for _, req := range reqs {
+		for len(above) > 0 {
+			last := above[len(above)-1]
+			if last.path.blockNr == req.path.blockNr && bytes.HasPrefix(fullPaths[req], fullPaths[last]) {
+				break
+			}
+			above = above[:len(above)-1]
+		}
+		depth := len(above)
+		above = append(above, req)
+
+		if roundIdx[req.path.blockNr] == nil {
+			roundIdx[req.path.blockNr] = make(map[int]int)
+		}
+		idx, ok := roundIdx[req.path.blockNr][depth]
+		if !ok {
+			idx = len(rounds)
+			roundIdx[req.path.blockNr][depth] = idx
+			rounds = append(rounds, nil)
+		}
+		rounds[idx] = append(rounds[idx], req)
+	}
+	return rounds
+}
+
+// rebuildNodes rebuilds the nodes of the state as of the same block from the flat state, and remembers the paths
+// to their children. The nodes whose hashes do not match the requested ones are skipped, this happens when
+// the state they belong to is not available anymore
+func (s *nodeDataServer) rebuildNodes(reqs []*nodeRequest) ([][]byte, error) {
+	blockNr := reqs[0].path.blockNr
+	t := trie.New(common.Hash{})
+	r := trie.NewResolver(0, blockNr)
+	s.rootsLock.Lock()
+	head := s.rootsBlock
+	s.rootsLock.Unlock()
+	if blockNr != head {
+		// The current state is rewound to the block on the fly
+		overlay, err := s.overlay(overlayKey{head: head, blockNr: blockNr})
+		if err != nil {
+			return nil, err
+		}
+		r.SetOverlay(overlay)
+	}
+	rrs := make([]*trie.ResolveRequest, len(reqs))
+	for i, req := range reqs {
+		rrs[i] = t.NewResolveRequest(req.path.contract, common.CopyBytes(req.path.hex), len(req.path.hex), nil)
+		rrs[i].RequiresRLP = true
+		r.AddRequest(rrs[i])
+	}
+	if err := r.ResolveWithDb(s.db, blockNr, false); err != nil {
+		return nil, err
+	}
+
+	nodes := make([][]byte, 0, len(reqs))
+	for i, req := range reqs {
+		node := rrs[i].NodeRLP
+		if crypto.Keccak256Hash(node) != req.hash {
+			continue
+		}
+		if err := s.rememberChildren(req.path, node); err != nil {
+			return nil, fmt.Errorf("node %x: %w", req.hash, err)
+		}
+		nodes = append(nodes, common.CopyBytes(node))
+	}
+	return nodes, nil
+}
+
+// overlay returns the state as of the block laid over the current one, it is collected from the history
+// when the block is requested for the first time since the head has changed
+func (s *nodeDataServer) overlay(key overlayKey) (*trie.StateOverlay, error) {
+	if overlay, ok := s.overlays.Get(key); ok {
+		return overlay.(*trie.StateOverlay), nil
+	}
+	overlay, err := trie.NewStateOverlay(s.db, key.blockNr)
+	if err != nil {
+		return nil, err
+	}
+	s.overlays.Add(key, overlay)
+	return overlay, nil
+}
+
+// rememberChildren remembers the paths to the nodes referenced from the node by their hashes. The nodes shorter
+// than 32 bytes are embedded into their parents, the nodes they reference are remembered instead. The leaves of
+// the account trie reference the roots of the storage tries
+func (s *nodeDataServer) rememberChildren(path *nodePath, node []byte) error {
+	elems, _, err := rlp.SplitList(node)
+	if err != nil {
+		return err
+	}
+	n, err := rlp.CountValues(elems)
+	if err != nil {
+		return err
+	}
+	switch n {
+	case 2:
+		compact, val, err := rlp.SplitString(elems)
+		if err != nil {
+			return err
+		}
+		if len(compact) == 0 {
+			return fmt.Errorf("empty key of the short node at %x", path.hex)
+		}
+		key := trie.CompactToKeybytes(compact)
+		hex := concatHex(path.hex, key.ToHex())
+		if !key.Terminating {
+			return s.rememberChild(path, hex, val)
+		}
+		if path.contract != nil {
+			return nil
+		}
+		return s.rememberStorageRoot(path, hex[:len(hex)-1], val)
+	case 17:
+		for i := 0; i < 16; i++ {
+			_, _, rest, err := rlp.Split(elems)
+			if err != nil {
+				return err
+			}
+			if err := s.rememberChild(path, concatHex(path.hex, []byte{byte(i)}), elems[:len(elems)-len(rest)]); err != nil {
+				return err
+			}
+			elems = rest
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid number of list elements: %d", n)
+	}
+}
+
+// rememberChild remembers the path to the child referenced by its hash, or looks into the embedded one
+func (s *nodeDataServer) rememberChild(parent *nodePath, hex []byte, ref []byte) error {
+	kind, content, _, err := rlp.Split(ref)
+	if err != nil {
+		return err
+	}
+	path := &nodePath{blockNr: parent.blockNr, contract: parent.contract, hex: hex}
+	switch {
+	case kind == rlp.List:
+		return s.rememberChildren(path, ref)
+	case len(content) == common.HashLength:
+		s.paths.Add(common.BytesToHash(content), path)
+	}
+	return nil
+}
+
+// rememberStorageRoot remembers the path to the root of the storage trie of the account in the leaf
+func (s *nodeDataServer) rememberStorageRoot(parent *nodePath, hex []byte, val []byte) error {
+	if len(hex) != 2*common.HashLength {
+		return fmt.Errorf("account leaf at %x", hex)
+	}
+	enc, _, err := rlp.SplitString(val)
+	if err != nil {
+		return err
+	}
+	// Nonce, balance, storage root, code hash
+	fields, _, err := rlp.SplitList(enc)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, fields, err = rlp.Split(fields); err != nil {
+			return err
+		}
+	}
+	root, _, err := rlp.SplitString(fields)
+	if err != nil {
+		return err
+	}
+	if len(root) != common.HashLength || bytes.Equal(root, trie.EmptyRoot[:]) {
+		return nil
+	}
+
+	// The incarnation is not a part of the trie, it is needed to find the storage in the flat state
+	var addrHash []byte
+	trie.CompressNibbles(hex, &addrHash)
+	accEnc, err := s.db.GetAsOf(dbutils.CurrentStateBucket, dbutils.AccountsHistoryBucket, addrHash, parent.blockNr+1)
+	if err != nil {
+		return err
+	}
+	var acc accounts.Account
+	if err := acc.DecodeForStorage(accEnc); err != nil {
+		return err
+	}
+	s.paths.Add(common.BytesToHash(root), &nodePath{blockNr: parent.blockNr, contract: dbutils.GenerateStoragePrefix(addrHash, acc.Incarnation)})
+	return nil
+}
+
+func concatHex(prefix, suffix []byte) []byte {
+	hex := make([]byte, len(prefix)+len(suffix))
+	copy(hex, prefix)
+	copy(hex[len(prefix):], suffix)
+	return hex
+}
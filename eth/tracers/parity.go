@@ -0,0 +1,663 @@
+package tracers
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// Trace types of trace_replayBlockTransactions
+const (
+	ParityTraceTypeTrace     = "trace"
+	ParityTraceTypeStateDiff = "stateDiff"
+	ParityTraceTypeVmTrace   = "vmTrace"
+)
+
+// ParityTrace is a single call, contract creation, self-destruct or reward, in the format
+// of the OpenEthereum trace_ module
+type ParityTrace struct {
+	Action              interface{}  `json:"action"` // *ParityCallAction, *ParityCreateAction, *ParitySuicideAction or *ParityRewardAction
+	BlockHash           *common.Hash `json:"blockHash,omitempty"`
+	BlockNumber         *uint64      `json:"blockNumber,omitempty"`
+	Error               string       `json:"error,omitempty"`
+	Result              interface{}  `json:"result"` // *ParityCallResult, *ParityCreateResult or nil
+	Subtraces           int          `json:"subtraces"`
+	TraceAddress        []int        `json:"traceAddress"`
+	TransactionHash     *common.Hash `json:"transactionHash"`
+	TransactionPosition *uint64      `json:"transactionPosition"`
+	Type                string       `json:"type"`
+}
+
+type ParityCallAction struct {
+	CallType string         `json:"callType"`
+	From     common.Address `json:"from"`
+	Gas      hexutil.Uint64 `json:"gas"`
+	Input    hexutil.Bytes  `json:"input"`
+	To       common.Address `json:"to"`
+	Value    *hexutil.Big   `json:"value"`
+}
+
+type ParityCreateAction struct {
+	From  common.Address `json:"from"`
+	Gas   hexutil.Uint64 `json:"gas"`
+	Init  hexutil.Bytes  `json:"init"`
+	Value *hexutil.Big   `json:"value"`
+}
+
+type ParitySuicideAction struct {
+	Address       common.Address `json:"address"`
+	Balance       *hexutil.Big   `json:"balance"`
+	RefundAddress common.Address `json:"refundAddress"`
+}
+
+type ParityRewardAction struct {
+	Author     common.Address `json:"author"`
+	RewardType string         `json:"rewardType"` // "block" or "uncle"
+	Value      *hexutil.Big   `json:"value"`
+}
+
+type ParityCallResult struct {
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Output  hexutil.Bytes  `json:"output"`
+}
+
+type ParityCreateResult struct {
+	Address common.Address `json:"address"`
+	Code    hexutil.Bytes  `json:"code"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+}
+
+// ParityVmTrace is the execution of the code of a single call
+type ParityVmTrace struct {
+	Code hexutil.Bytes `json:"code"`
+	Ops  []*ParityVmOp `json:"ops"`
+}
+
+type ParityVmOp struct {
+	Cost uint64            `json:"cost"`
+	Ex   *ParityVmExecuted `json:"ex"` // nil if the operation failed
+	Pc   uint64            `json:"pc"`
+	Sub  *ParityVmTrace    `json:"sub"` // Execution of the called code, for the CALL-like and CREATE operations
+}
+
+// ParityVmExecuted is the effect of an operation
+type ParityVmExecuted struct {
+	Mem   *ParityVmMem   `json:"mem"`
+	Push  []*hexutil.Big `json:"push"`
+	Store *ParityVmStore `json:"store"`
+	Used  uint64         `json:"used"` // Gas left after the operation
+}
+
+type ParityVmMem struct {
+	Data hexutil.Bytes `json:"data"`
+	Off  uint64        `json:"off"`
+}
+
+type ParityVmStore struct {
+	Key *hexutil.Big `json:"key"`
+	Val *hexutil.Big `json:"val"`
+}
+
+// ParityAccountDiff is the change of an account made by a transaction. Every field is either "=",
+// or a map with one of the keys "+" (created), "-" (removed) or "*" (changed, with "from" and "to")
+type ParityAccountDiff struct {
+	Balance interface{}                 `json:"balance"`
+	Code    interface{}                 `json:"code"`
+	Nonce   interface{}                 `json:"nonce"`
+	Storage map[common.Hash]interface{} `json:"storage"`
+}
+
+// ParityTraceResult is the result of a transaction in trace_replayBlockTransactions, the
+// fields of the trace types which are not requested are nil
+type ParityTraceResult struct {
+	Output          hexutil.Bytes                         `json:"output"`
+	StateDiff       map[common.Address]*ParityAccountDiff `json:"stateDiff"`
+	Trace           []*ParityTrace                        `json:"trace"`
+	VmTrace         *ParityVmTrace                        `json:"vmTrace"`
+	TransactionHash *common.Hash                          `json:"transactionHash,omitempty"`
+}
+
+// parityCall is a call in the call tree of a transaction
+type parityCall struct {
+	trace *ParityTrace
+	calls []*parityCall
+
+	gasIn   uint64 // Gas before the operation of the call
+	gasCost uint64 // Cost of the operation, includes the gas given to the callee for the CALL-like operations
+	gas     uint64 // Gas given to the callee
+	outOff  uint64
+	outLen  uint64
+}
+
+// parityVmFrame is the vmTrace of a call being executed
+type parityVmFrame struct {
+	trace *ParityVmTrace
+
+	// The last operation of the frame, its effects are known on the next step of the frame
+	last    *ParityVmOp
+	pushes  int
+	memOff  uint64
+	memLen  uint64
+	written bool // Whether the last operation writes memory
+}
+
+// ParityTracer is a vm.Tracer which builds the traces of a transaction in the format of the
+// OpenEthereum trace_ module. It follows the call tree the same way as the JavaScript callTracer.
+// As a state.StateTracer it also collects the accounts and the storage touched by the transaction
+type ParityTracer struct {
+	withVmTrace bool
+
+	root      *parityCall
+	callstack []*parityCall // callstack[0] is the transaction itself, callstack[i] is executed at depth i+1
+
+	vmTrace  *ParityVmTrace
+	vmFrames []*parityVmFrame // vmFrames[i] is executed at depth i+1
+
+	output  []byte
+	touched map[common.Address]map[common.Hash]struct{}
+}
+
+// NewParityTracer creates a tracer of a single transaction, the vmTrace is collected only if it is asked for
+func NewParityTracer(withVmTrace bool) *ParityTracer {
+	return &ParityTracer{
+		withVmTrace: withVmTrace,
+		touched:     make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+func (t *ParityTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	if depth != 0 {
+		// The inner calls are captured by their operations
+		return nil
+	}
+	t.touch(from)
+	t.touch(to)
+	trace := &ParityTrace{TraceAddress: []int{}}
+	if create {
+		trace.Type = "create"
+		trace.Action = &ParityCreateAction{From: from, Gas: hexutil.Uint64(gas), Init: common.CopyBytes(input), Value: (*hexutil.Big)(new(big.Int).Set(value))}
+		trace.Result = &ParityCreateResult{Address: to}
+	} else {
+		trace.Type = "call"
+		trace.Action = &ParityCallAction{CallType: "call", From: from, Gas: hexutil.Uint64(gas), Input: common.CopyBytes(input), To: to, Value: (*hexutil.Big)(new(big.Int).Set(value))}
+		trace.Result = &ParityCallResult{}
+	}
+	t.root = &parityCall{trace: trace, gas: gas}
+	t.callstack = []*parityCall{t.root}
+	return nil
+}
+
+func (t *ParityTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.root == nil {
+		return nil
+	}
+	if err != nil {
+		t.vmStep(pc, gas, cost, memory, stack, contract, depth, true)
+		t.fault(depth, err)
+		return nil
+	}
+	t.vmStep(pc, gas, cost, memory, stack, contract, depth, false)
+	t.vmRecord(op, stack)
+
+	// Calls and creations end on the next step of the caller
+	for len(t.callstack) > depth {
+		t.pop(env, gas, memory, stack)
+	}
+
+	switch op {
+	case vm.SLOAD, vm.SSTORE:
+		t.touchStorage(contract.Address(), common.BigToHash(stack.Back(0)))
+	case vm.CREATE, vm.CREATE2:
+		value := new(big.Int).Set(stack.Back(0))
+		// The creation gets all the gas but one 64th after the cost of the operation
+		createGas := gas - cost
+		if env.ChainConfig().IsEIP150(env.BlockNumber) {
+			createGas -= createGas / 64
+		}
+		t.push(&parityCall{
+			trace: &ParityTrace{
+				Type:   "create",
+				Action: &ParityCreateAction{From: contract.Address(), Gas: hexutil.Uint64(createGas), Init: memorySlice(memory, stack.Back(1), stack.Back(2)), Value: (*hexutil.Big)(value)},
+				Result: &ParityCreateResult{},
+			},
+			gasIn:   gas,
+			gasCost: cost,
+			gas:     createGas,
+		})
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		to := common.BigToAddress(stack.Back(1))
+		t.touch(to)
+		var value *big.Int
+		args := 2
+		switch op {
+		case vm.CALL, vm.CALLCODE:
+			value = new(big.Int).Set(stack.Back(2))
+			args = 3
+		case vm.DELEGATECALL:
+			// The callee runs with the value of the caller
+			value = new(big.Int).Set(contract.Value())
+		default:
+			value = new(big.Int)
+		}
+		callGas := env.CallGasTemp()
+		if value.Sign() != 0 && (op == vm.CALL || op == vm.CALLCODE) {
+			callGas += params.CallStipend
+		}
+		t.push(&parityCall{
+			trace: &ParityTrace{
+				Type:   "call",
+				Action: &ParityCallAction{CallType: strings.ToLower(op.String()), From: contract.Address(), Gas: hexutil.Uint64(callGas), Input: memorySlice(memory, stack.Back(args), stack.Back(args+1)), To: to, Value: (*hexutil.Big)(value)},
+				Result: &ParityCallResult{},
+			},
+			gasIn:   gas,
+			gasCost: cost,
+			gas:     callGas,
+			outOff:  stack.Back(args + 2).Uint64(),
+			outLen:  stack.Back(args + 3).Uint64(),
+		})
+	case vm.SELFDESTRUCT:
+		refund := common.BigToAddress(stack.Back(0))
+		t.touch(refund)
+		parent := t.callstack[len(t.callstack)-1]
+		parent.calls = append(parent.calls, &parityCall{trace: &ParityTrace{
+			Type:   "suicide",
+			Action: &ParitySuicideAction{Address: contract.Address(), Balance: (*hexutil.Big)(new(big.Int).Set(env.IntraBlockState.GetBalance(contract.Address()))), RefundAddress: refund},
+		}})
+	case vm.REVERT:
+		if len(t.callstack) == depth {
+			t.callstack[depth-1].trace.Error = "Reverted"
+		}
+	}
+	return nil
+}
+
+func (t *ParityTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if op != vm.REVERT && depth <= len(t.vmFrames) {
+		// The operation has been recorded, but it did not complete
+		t.vmFrames[depth-1].last.Ex = nil
+	}
+	t.fault(depth, err)
+	return nil
+}
+
+func (t *ParityTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, _ time.Duration, err error) error {
+	if depth != 0 {
+		return nil
+	}
+	t.vmEnd(0)
+	t.output = common.CopyBytes(output)
+	trace := t.root.trace
+	if err != nil && trace.Error == "" {
+		trace.Error = parityError(err)
+	}
+	if trace.Error != "" {
+		trace.Result = nil
+		return nil
+	}
+	switch result := trace.Result.(type) {
+	case *ParityCallResult:
+		result.GasUsed = hexutil.Uint64(gasUsed)
+		result.Output = t.output
+	case *ParityCreateResult:
+		result.GasUsed = hexutil.Uint64(gasUsed)
+		result.Code = t.output
+	}
+	return nil
+}
+
+func (t *ParityTracer) CaptureCreate(creator common.Address, creation common.Address) error {
+	t.touch(creation)
+	return nil
+}
+
+func (t *ParityTracer) CaptureAccountRead(account common.Address) error {
+	t.touch(account)
+	return nil
+}
+
+func (t *ParityTracer) CaptureAccountWrite(account common.Address) error {
+	t.touch(account)
+	return nil
+}
+
+// Traces returns the calls of the transaction, in the order of their start
+func (t *ParityTracer) Traces() []*ParityTrace {
+	if t.root == nil {
+		return []*ParityTrace{}
+	}
+	var traces []*ParityTrace
+	var flatten func(call *parityCall, address []int)
+	flatten = func(call *parityCall, address []int) {
+		call.trace.TraceAddress = address
+		call.trace.Subtraces = len(call.calls)
+		traces = append(traces, call.trace)
+		for i, sub := range call.calls {
+			subAddress := make([]int, len(address)+1)
+			copy(subAddress, address)
+			subAddress[len(address)] = i
+			flatten(sub, subAddress)
+		}
+	}
+	flatten(t.root, []int{})
+	return traces
+}
+
+// VmTrace returns the execution of the code of the transaction, nil if it is not collected
+func (t *ParityTracer) VmTrace() *ParityVmTrace {
+	if t.withVmTrace && t.vmTrace == nil {
+		return &ParityVmTrace{Code: hexutil.Bytes{}, Ops: []*ParityVmOp{}}
+	}
+	return t.vmTrace
+}
+
+// Output returns the return value of the transaction
+func (t *ParityTracer) Output() []byte {
+	return t.output
+}
+
+// Touched returns the accounts and the storage items read or written by the transaction
+func (t *ParityTracer) Touched() map[common.Address]map[common.Hash]struct{} {
+	return t.touched
+}
+
+func (t *ParityTracer) touch(address common.Address) {
+	if _, ok := t.touched[address]; !ok {
+		t.touched[address] = make(map[common.Hash]struct{})
+	}
+}
+
+func (t *ParityTracer) touchStorage(address common.Address, key common.Hash) {
+	t.touch(address)
+	t.touched[address][key] = struct{}{}
+}
+
+// push adds the call to its caller and makes it the one being executed
+func (t *ParityTracer) push(call *parityCall) {
+	parent := t.callstack[len(t.callstack)-1]
+	parent.calls = append(parent.calls, call)
+	t.callstack = append(t.callstack, call)
+}
+
+// pop completes the last call, gas and stack are the ones of the next step of the caller
+func (t *ParityTracer) pop(env *vm.EVM, gas uint64, memory *vm.Memory, stack *vm.Stack) {
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+	if call.trace.Error != "" {
+		call.trace.Result = nil
+		return
+	}
+
+	// The gas left by the callee is returned to the caller
+	var gasUsed uint64
+	if spent := call.gasIn - call.gasCost; spent+call.gas > gas {
+		gasUsed = spent + call.gas - gas
+	}
+	ret := stack.Back(0)
+	switch result := call.trace.Result.(type) {
+	case *ParityCreateResult:
+		// For CREATE the gas given to the callee is not a part of the cost
+		gasUsed = 0
+		if call.gasIn-call.gasCost > gas {
+			gasUsed = call.gasIn - call.gasCost - gas
+		}
+		if ret.Sign() == 0 {
+			call.trace.Error = "Internal failure"
+			call.trace.Result = nil
+			return
+		}
+		result.Address = common.BigToAddress(ret)
+		result.Code = common.CopyBytes(env.IntraBlockState.GetCode(result.Address))
+		result.GasUsed = hexutil.Uint64(gasUsed)
+	case *ParityCallResult:
+		if ret.Sign() == 0 {
+			call.trace.Error = "Internal failure"
+			call.trace.Result = nil
+			return
+		}
+		result.Output = memory.GetCopy(int64(call.outOff), int64(call.outLen))
+		result.GasUsed = hexutil.Uint64(gasUsed)
+	}
+}
+
+// fault marks the call executed at the depth as failed, it ends without a result
+func (t *ParityTracer) fault(depth int, err error) {
+	if depth == 0 || depth > len(t.callstack) {
+		return
+	}
+	call := t.callstack[depth-1]
+	if call.trace.Error != "" {
+		// Already reverted, the call ends on the next step of the caller
+		return
+	}
+	call.trace.Error = parityError(err)
+	call.trace.Result = nil
+	if depth > 1 {
+		t.callstack = t.callstack[:depth-1]
+	}
+}
+
+// vmStep completes the last operation of the frame at the depth and starts the vmTrace of the
+// frame if it is its first step. The failed operations are added with no effects
+func (t *ParityTracer) vmStep(pc, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, failed bool) {
+	if !t.withVmTrace {
+		return
+	}
+	t.vmEnd(depth)
+	if len(t.vmFrames) < depth {
+		frame := &parityVmFrame{trace: &ParityVmTrace{Code: common.CopyBytes(contract.Code), Ops: []*ParityVmOp{}}}
+		if len(t.vmFrames) == 0 {
+			t.vmTrace = frame.trace
+		} else if caller := t.vmFrames[len(t.vmFrames)-1]; caller.last != nil {
+			caller.last.Sub = frame.trace
+		}
+		t.vmFrames = append(t.vmFrames, frame)
+	} else if frame := t.vmFrames[depth-1]; frame.last != nil && frame.last.Ex != nil {
+		ex := frame.last.Ex
+		ex.Used = gas
+		if n := frame.pushes; n > 0 {
+			if n > stack.Len() {
+				n = stack.Len()
+			}
+			ex.Push = make([]*hexutil.Big, n)
+			for i := 0; i < n; i++ {
+				ex.Push[i] = (*hexutil.Big)(new(big.Int).Set(stack.Back(n - 1 - i)))
+			}
+		}
+		if frame.written && frame.memLen > 0 {
+			ex.Mem = &ParityVmMem{Data: memory.GetCopy(int64(frame.memOff), int64(frame.memLen)), Off: frame.memOff}
+		}
+	}
+	frame := t.vmFrames[depth-1]
+	frame.last = &ParityVmOp{Cost: cost, Pc: pc, Ex: &ParityVmExecuted{Push: []*hexutil.Big{}}}
+	if failed {
+		frame.last.Ex = nil
+	} else if gas >= cost {
+		// Until the next step is known
+		frame.last.Ex.Used = gas - cost
+	}
+	frame.pushes, frame.written = 0, false
+	frame.trace.Ops = append(frame.trace.Ops, frame.last)
+}
+
+// vmRecord remembers what the last operation changes, to be completed on the next step of the frame
+func (t *ParityTracer) vmRecord(op vm.OpCode, stack *vm.Stack) {
+	if !t.withVmTrace || len(t.vmFrames) == 0 {
+		return
+	}
+	frame := t.vmFrames[len(t.vmFrames)-1]
+	frame.pushes = parityPushes(op)
+	memArgs := func(off, size int) {
+		frame.written = true
+		frame.memOff, frame.memLen = stack.Back(off).Uint64(), stack.Back(size).Uint64()
+	}
+	switch op {
+	case vm.MSTORE:
+		frame.written, frame.memOff, frame.memLen = true, stack.Back(0).Uint64(), 32
+	case vm.MSTORE8:
+		frame.written, frame.memOff, frame.memLen = true, stack.Back(0).Uint64(), 1
+	case vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY:
+		memArgs(0, 2)
+	case vm.EXTCODECOPY:
+		memArgs(1, 3)
+	case vm.CALL, vm.CALLCODE:
+		memArgs(5, 6)
+	case vm.DELEGATECALL, vm.STATICCALL:
+		memArgs(4, 5)
+	case vm.SSTORE:
+		frame.last.Ex.Store = &ParityVmStore{Key: (*hexutil.Big)(new(big.Int).Set(stack.Back(0))), Val: (*hexutil.Big)(new(big.Int).Set(stack.Back(1)))}
+	}
+}
+
+// vmEnd closes the frames executed deeper than the depth, their last operations have no next step
+func (t *ParityTracer) vmEnd(depth int) {
+	if !t.withVmTrace {
+		return
+	}
+	if len(t.vmFrames) > depth {
+		t.vmFrames = t.vmFrames[:depth]
+	}
+}
+
+// parityPushes returns the number of the stack items an operation changes. DUPs and SWAPs
+// are shown with all the items between the top of the stack and the copied or swapped one
+func parityPushes(op vm.OpCode) int {
+	switch {
+	case op >= vm.PUSH1 && op <= vm.PUSH32:
+		return 1
+	case op >= vm.DUP1 && op <= vm.DUP16:
+		return int(op-vm.DUP1) + 2
+	case op >= vm.SWAP1 && op <= vm.SWAP16:
+		return int(op-vm.SWAP1) + 2
+	case op >= vm.LOG0 && op <= vm.LOG4:
+		return 0
+	}
+	switch op {
+	case vm.STOP, vm.POP, vm.MSTORE, vm.MSTORE8, vm.SSTORE, vm.JUMP, vm.JUMPI, vm.JUMPDEST,
+		vm.CALLDATACOPY, vm.CODECOPY, vm.EXTCODECOPY, vm.RETURNDATACOPY, vm.RETURN, vm.REVERT, vm.SELFDESTRUCT:
+		return 0
+	}
+	return 1
+}
+
+// parityError converts the errors of the EVM into the ones of OpenEthereum
+func parityError(err error) string {
+	switch {
+	case err == vm.ErrOutOfGas, err == vm.ErrCodeStoreOutOfGas:
+		return "Out of gas"
+	case strings.HasSuffix(err.Error(), "execution reverted"):
+		return "Reverted"
+	case strings.HasSuffix(err.Error(), "invalid jump destination"):
+		return "Bad jump destination"
+	case strings.HasPrefix(err.Error(), "invalid opcode"):
+		return "Bad instruction"
+	case strings.HasPrefix(err.Error(), "stack underflow"):
+		return "Stack underflow"
+	case strings.HasPrefix(err.Error(), "stack limit reached"):
+		return "Out of stack"
+	}
+	return err.Error()
+}
+
+func memorySlice(memory *vm.Memory, off, size *big.Int) []byte {
+	if size.Sign() == 0 {
+		return []byte{}
+	}
+	return memory.GetCopy(off.Int64(), size.Int64())
+}
+
+// ParityAccountState is the part of the state of an account compared by ParityStateDiff
+type ParityAccountState struct {
+	Exists  bool
+	Balance *big.Int
+	Code    []byte
+	Nonce   uint64
+	Storage map[common.Hash]common.Hash
+}
+
+// ReadParityState reads the touched accounts and storage items. With removeEmpty (EIP-158) the empty
+// accounts are read as not existing, they are removed at the end of the transaction
+func ReadParityState(touched map[common.Address]map[common.Hash]struct{}, ibs vm.IntraBlockState, removeEmpty bool) map[common.Address]*ParityAccountState {
+	accounts := make(map[common.Address]*ParityAccountState, len(touched))
+	for address, keys := range touched {
+		account := &ParityAccountState{
+			Exists:  ibs.Exist(address) && !ibs.HasSuicided(address) && !(removeEmpty && ibs.Empty(address)),
+			Balance: new(big.Int),
+			Storage: make(map[common.Hash]common.Hash, len(keys)),
+		}
+		if account.Exists {
+			account.Balance.Set(ibs.GetBalance(address))
+			account.Code = common.CopyBytes(ibs.GetCode(address))
+			account.Nonce = ibs.GetNonce(address)
+			for key := range keys {
+				account.Storage[key] = ibs.GetState(address, key)
+			}
+		}
+		accounts[address] = account
+	}
+	return accounts
+}
+
+// ParityStateDiff compares the accounts before and after the transaction, only the changed ones are returned
+func ParityStateDiff(before, after map[common.Address]*ParityAccountState) map[common.Address]*ParityAccountDiff {
+	diffs := make(map[common.Address]*ParityAccountDiff)
+	for address, to := range after {
+		from, ok := before[address]
+		if !ok {
+			from = &ParityAccountState{Balance: new(big.Int)}
+		}
+		if !from.Exists && !to.Exists {
+			continue
+		}
+		diff := &ParityAccountDiff{Storage: make(map[common.Hash]interface{})}
+		changed := false
+		field := func(fromValue, toValue interface{}, equal bool) interface{} {
+			switch {
+			case !from.Exists:
+				changed = true
+				return map[string]interface{}{"+": toValue}
+			case !to.Exists:
+				changed = true
+				return map[string]interface{}{"-": fromValue}
+			case equal:
+				return "="
+			}
+			changed = true
+			return map[string]interface{}{"*": map[string]interface{}{"from": fromValue, "to": toValue}}
+		}
+		diff.Balance = field((*hexutil.Big)(from.Balance), (*hexutil.Big)(to.Balance), from.Balance.Cmp(to.Balance) == 0)
+		diff.Code = field(hexutil.Bytes(from.Code), hexutil.Bytes(to.Code), bytes.Equal(from.Code, to.Code))
+		diff.Nonce = field(hexutil.Uint64(from.Nonce), hexutil.Uint64(to.Nonce), from.Nonce == to.Nonce)
+
+		keys := make(map[common.Hash]struct{})
+		for key := range from.Storage {
+			keys[key] = struct{}{}
+		}
+		for key := range to.Storage {
+			keys[key] = struct{}{}
+		}
+		for key := range keys {
+			valueFrom, valueTo := from.Storage[key], to.Storage[key]
+			switch {
+			case valueFrom == valueTo:
+				continue
+			case valueFrom == (common.Hash{}):
+				diff.Storage[key] = map[string]interface{}{"+": valueTo}
+			case valueTo == (common.Hash{}):
+				diff.Storage[key] = map[string]interface{}{"-": valueFrom}
+			default:
+				diff.Storage[key] = map[string]interface{}{"*": map[string]interface{}{"from": valueFrom, "to": valueTo}}
+			}
+			changed = true
+		}
+		if changed {
+			diffs[address] = diff
+		}
+	}
+	return diffs
+}
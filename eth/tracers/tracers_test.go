@@ -17,6 +17,7 @@
 package tracers
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/rand"
@@ -285,3 +286,93 @@ func TestCallTracer(t *testing.T) {
 		})
 	}
 }
+
+func TestParityTracerCreate2(t *testing.T) {
+	unsignedTx := types.NewTransaction(1, common.HexToAddress("0x00000000000000000000000000000000deadbeef"),
+		new(big.Int), 5000000, big.NewInt(1), []byte{})
+
+	privateKeyECDSA, err := ecdsa.GenerateKey(crypto.S256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	tx, err := types.SignTx(unsignedTx, signer, privateKeyECDSA)
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	origin, _ := signer.Sender(tx)
+	evmContext := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Origin:      origin,
+		Coinbase:    common.Address{},
+		BlockNumber: new(big.Int).SetUint64(8000000),
+		Time:        new(big.Int).SetUint64(5),
+		Difficulty:  big.NewInt(0x30000),
+		GasLimit:    uint64(6000000),
+		GasPrice:    big.NewInt(1),
+	}
+	// The same contract as in TestPrestateTracerCreate2, it creates 0x60f3f640a8508fC6a86d45DF051962668E1e8AC7
+	alloc := core.GenesisAlloc{}
+	alloc[common.HexToAddress("0x00000000000000000000000000000000deadbeef")] = core.GenesisAccount{
+		Nonce:   1,
+		Code:    hexutil.MustDecode("0x63deadbeef60005263cafebabe6004601c6000F560005260206000F3"),
+		Balance: big.NewInt(1),
+	}
+	alloc[origin] = core.GenesisAccount{
+		Nonce:   1,
+		Code:    []byte{},
+		Balance: big.NewInt(500000000000000),
+	}
+	ctx := params.MainnetChainConfig.WithEIPsFlags(context.Background(), big.NewInt(1))
+	statedb, _, err := tests.MakePreState(ctx, ethdb.NewMemDatabase(), alloc, 0)
+	if err != nil {
+		t.Fatalf("Could not make prestate: %v", err)
+	}
+	tracer := NewParityTracer(true)
+	snapshot := statedb.Snapshot()
+	statedb.SetTracer(tracer)
+	evm := vm.NewEVM(evmContext, statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, _, _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	statedb.SetTracer(nil)
+
+	created := common.HexToAddress("0x60f3f640a8508fC6a86d45DF051962668E1e8AC7")
+	traces := tracer.Traces()
+	if len(traces) != 2 {
+		t.Fatalf("expected 2 traces, got %d", len(traces))
+	}
+	if traces[0].Type != "call" || traces[0].Subtraces != 1 || len(traces[0].TraceAddress) != 0 {
+		t.Errorf("unexpected top-level trace: type %s, subtraces %d, trace address %v", traces[0].Type, traces[0].Subtraces, traces[0].TraceAddress)
+	}
+	if traces[1].Type != "create" || !reflect.DeepEqual(traces[1].TraceAddress, []int{0}) {
+		t.Errorf("unexpected create trace: type %s, trace address %v", traces[1].Type, traces[1].TraceAddress)
+	}
+	if result, ok := traces[1].Result.(*ParityCreateResult); !ok || result.Address != created {
+		t.Errorf("unexpected create result %v", traces[1].Result)
+	}
+	if !bytes.Equal(tracer.Output(), common.LeftPadBytes(created[:], 32)) {
+		t.Errorf("unexpected output %x", tracer.Output())
+	}
+	if vmTrace := tracer.VmTrace(); vmTrace == nil || len(vmTrace.Ops) == 0 {
+		t.Errorf("expected the operations of the contract in the vmTrace")
+	}
+
+	after := ReadParityState(tracer.Touched(), statedb, true)
+	statedb.RevertToSnapshot(snapshot)
+	before := ReadParityState(tracer.Touched(), statedb, false)
+	diff := ParityStateDiff(before, after)
+	if _, ok := diff[created]; !ok {
+		t.Errorf("expected %x in the state diff", created)
+	}
+	if d, ok := diff[origin]; !ok || d.Nonce == "=" {
+		t.Errorf("expected the nonce of the sender to change")
+	}
+}
@@ -18,6 +18,7 @@ var boltOriginDb *bolt.DB
 var badgerOriginDb *badger.DB
 var boltDb ethdb.KV
 var badgerDb ethdb.KV
+var lmdbDb ethdb.KV
 
 func TestMain(m *testing.M) {
 	setupDatabases()
@@ -26,6 +27,7 @@ func TestMain(m *testing.M) {
 	os.RemoveAll("test2")
 	os.Remove("test3")
 	os.RemoveAll("test4")
+	os.RemoveAll("test5")
 	os.Exit(result)
 }
 func setupDatabases() {
@@ -34,6 +36,7 @@ func setupDatabases() {
 	ctx := context.Background()
 	boltDb = ethdb.NewBolt().Path("test").MustOpen(ctx)
 	badgerDb = ethdb.NewBadger().Path("test2").MustOpen(ctx)
+	lmdbDb = ethdb.NewLmdb().Path("test5").MustOpen(ctx)
 	var errOpen error
 	boltOriginDb, errOpen = bolt.Open("test3", 0600, &bolt.Options{})
 	if errOpen != nil {
@@ -103,6 +106,24 @@ func setupDatabases() {
 	}
 	now = time.Now()
 
+	if err := lmdbDb.Update(ctx, func(tx ethdb.Tx) error {
+		defer fmt.Println("abstract lmdb filled: ", time.Since(now))
+
+		v := make([]byte, vsize)
+		for i := 0; i < keysAmount; i++ {
+			k := common.FromHex(fmt.Sprintf("%064x", i))
+			bucket := tx.Bucket(dbutils.CurrentStateBucket)
+			if err := bucket.Put(k, v); err != nil {
+				panic(err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+	now = time.Now()
+
 	if err := badgerOriginDb.Update(func(tx *badger.Txn) error {
 		defer fmt.Println("pure badger filled: ", time.Since(now))
 
@@ -139,6 +160,23 @@ func BenchmarkCursor(b *testing.B) {
 			}
 		}
 	})
+	b.Run("abstract lmdb", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := lmdbDb.View(ctx, func(tx ethdb.Tx) error {
+				c := tx.Bucket(dbutils.CurrentStateBucket).Cursor()
+				for k, v, err := c.First(); k != nil || err != nil; k, v, err = c.Next() {
+					if err != nil {
+						return err
+					}
+					_ = v
+				}
+
+				return nil
+			}); err != nil {
+				panic(err)
+			}
+		}
+	})
 	//b.Run("abstract badger", func(b *testing.B) {
 	//	for i := 0; i < b.N; i++ {
 	//		if err := badgerDb.View(ctx, func(tx *ethdb.Tx) error {
@@ -207,4 +245,31 @@ func BenchmarkCursor(b *testing.B) {
 }
 
 func BenchmarkGet(b *testing.B) {
+	ctx := context.Background()
+	keys := make([][]byte, 100)
+	for i := range keys {
+		keys[i] = common.FromHex(fmt.Sprintf("%064x", i*10))
+	}
+	get := func(db ethdb.KV) func(b *testing.B) {
+		return func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := db.View(ctx, func(tx ethdb.Tx) error {
+					bucket := tx.Bucket(dbutils.CurrentStateBucket)
+					for _, k := range keys {
+						if _, err := bucket.Get(k); err != nil {
+							return err
+						}
+					}
+					return nil
+				}); err != nil {
+					panic(err)
+				}
+			}
+		}
+	}
+
+	b.ResetTimer()
+	b.Run("abstract bolt", get(boltDb))
+	b.Run("abstract badger", get(badgerDb))
+	b.Run("abstract lmdb", get(lmdbDb))
 }
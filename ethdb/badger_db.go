@@ -18,6 +18,8 @@ package ethdb
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"runtime"
@@ -190,34 +192,31 @@ func (db *BadgerDatabase) GetIndexChunk(bucket, key []byte, timestamp uint64) ([
 
 // GetAsOf returns the value valid as of a given timestamp.
 func (db *BadgerDatabase) GetAsOf(bucket, hBucket, key []byte, timestamp uint64) ([]byte, error) {
-	composite, _ := dbutils.CompositeKeySuffix(key, timestamp)
 	var dat []byte
-	err := db.db.View(func(tx *badger.Txn) error {
-		{ // first look in the historical bucket
-			it := tx.NewIterator(badger.DefaultIteratorOptions)
-			defer it.Close()
-			it.Seek(bucketKey(hBucket, composite))
-
-			if it.ValidForPrefix(bucketKey(hBucket, key)) {
-				var err2 error
-				dat, err2 = it.Item().ValueCopy(nil)
-				return err2
-			}
+	err := db.AbstractKV().View(context.Background(), func(tx Tx) error {
+		v, err := FindByHistory(tx, hBucket, key, timestamp)
+		if err == nil {
+			dat = make([]byte, len(v))
+			copy(dat, v)
+			return nil
 		}
-
-		{ // fall back to the current bucket
-			item, err2 := tx.Get(bucketKey(bucket, key))
-			if err2 != nil {
-				return err2
+		if !errors.Is(err, ErrKeyNotFound) {
+			return err
+		}
+		{
+			v, err := tx.Bucket(bucket).Get(key)
+			if err != nil {
+				return err
 			}
-			dat, err2 = item.ValueCopy(nil)
-			return err2
+			if v == nil {
+				return ErrKeyNotFound
+			}
+
+			dat = make([]byte, len(v))
+			copy(dat, v)
+			return nil
 		}
 	})
-
-	if err == badger.ErrKeyNotFound {
-		return dat, ErrKeyNotFound
-	}
 	return dat, err
 }
 
@@ -350,6 +349,13 @@ func (db *BadgerDatabase) MultiPut(triplets ...[]byte) (uint64, error) {
 			bucket := triplets[i]
 			key := triplets[i+1]
 			val := triplets[i+2]
+			// nil values are the deletes of the mutation, same as in BoltDatabase.MultiPut
+			if val == nil {
+				if err := tx.Delete(bucketKey(bucket, key)); err != nil {
+					return err
+				}
+				continue
+			}
 			if err := tx.Set(bucketKey(bucket, key), val); err != nil {
 				return err
 			}
@@ -419,14 +425,39 @@ func (db *BadgerDatabase) MemCopy() Database {
 	return newDb
 }
 
-// TODO [Issue 144] Implement the methods
-
 func (db *BadgerDatabase) WalkAsOf(bucket, hBucket, startkey []byte, fixedbits uint, timestamp uint64, walker func([]byte, []byte) (bool, error)) error {
-	panic("Not implemented")
+	return db.AbstractKV().View(context.Background(), func(tx Tx) error {
+		return walkAsOf(tx, bucket, hBucket, startkey, fixedbits, timestamp, walker)
+	})
 }
 
+// Keys returns the bucket names and the keys of all entries: bucket0, key0, bucket1, key1, ...
 func (db *BadgerDatabase) Keys() ([][]byte, error) {
-	panic("Not implemented")
+	var keys [][]byte
+	err := db.db.View(func(tx *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := tx.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			k := it.Item().KeyCopy(nil)
+			i := bytes.IndexByte(k, bucketSeparator)
+			if i < 0 {
+				continue
+			}
+			keys = append(append(keys, k[:i:i]), k[i+1:])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// AbstractKV returns the KV interface over the same badger instance, closing it closes the database
+func (db *BadgerDatabase) AbstractKV() KV {
+	return &badgerDB{badger: db.db, log: db.log}
 }
 
 func (db *BadgerDatabase) Ancients() (uint64, error) {
@@ -29,6 +29,9 @@ import (
 	"testing"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -286,3 +289,100 @@ func testWalk(db Database, t *testing.T) {
 
 	assert.Equal(t, keysInRange, gotKeys)
 }
+
+func TestBoltDB_History(t *testing.T) {
+	db, remove := newTestBoltDB()
+	defer remove()
+	testHistory(db, t)
+}
+
+func TestBadgerDB_History(t *testing.T) {
+	db, remove := newTestBadgerDB()
+	defer remove()
+	testHistory(db, t)
+}
+
+// testHistory writes the thin history of an account and of a storage item changed in blocks 1, 2
+// and 3 and reads it back as of every block
+func testHistory(db Database, t *testing.T) {
+	addrHash := common.HexToHash("0xaa")
+	contractHash, keyHash := common.HexToHash("0xcc"), common.HexToHash("0x01")
+	storageKey := dbutils.GenerateCompositeStorageKey(contractHash, 1, keyHash)
+	encodeAccount := func(balance uint64) []byte {
+		acc := accounts.NewAccount()
+		acc.Balance.SetUint64(balance)
+		enc := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(enc)
+		return enc
+	}
+	put := func(bucket, key, value []byte) {
+		if err := db.Put(bucket, key, value); err != nil {
+			t.Fatalf("put failed: %v", err)
+		}
+	}
+
+	// The account is created in block 1, the storage item is set in block 1 and changed in block 2
+	accountValues := [][]byte{{}, encodeAccount(1), encodeAccount(2), encodeAccount(3)}
+	storageValues := [][]byte{{}, {1}, {2}}
+	for i := 1; i < len(accountValues); i++ {
+		cs := changeset.NewAccountChangeSet()
+		assert.NoError(t, cs.Add(addrHash[:], accountValues[i-1]))
+		enc, err := changeset.EncodeAccounts(cs)
+		assert.NoError(t, err)
+		put(dbutils.AccountChangeSetBucket, dbutils.EncodeTimestamp(uint64(i)), enc)
+	}
+	for i := 1; i < len(storageValues); i++ {
+		cs := changeset.NewStorageChangeSet()
+		assert.NoError(t, cs.Add(storageKey, storageValues[i-1]))
+		enc, err := changeset.EncodeStorage(cs)
+		assert.NoError(t, err)
+		put(dbutils.StorageChangeSetBucket, dbutils.EncodeTimestamp(uint64(i)), enc)
+	}
+	put(dbutils.AccountsHistoryBucket, dbutils.IndexChunkKey(addrHash[:], ^uint64(0)), dbutils.NewHistoryIndex().Append(1, true).Append(2, false).Append(3, false))
+	put(dbutils.StorageHistoryBucket, dbutils.IndexChunkKey(storageKey, ^uint64(0)), dbutils.NewHistoryIndex().Append(1, true).Append(2, false))
+	put(dbutils.CurrentStateBucket, addrHash[:], accountValues[3])
+	put(dbutils.CurrentStateBucket, storageKey, storageValues[2])
+
+	for timestamp := uint64(1); timestamp <= 4; timestamp++ {
+		expectedAccount := accountValues[timestamp-1]
+		v, err := db.GetAsOf(dbutils.CurrentStateBucket, dbutils.AccountsHistoryBucket, addrHash[:], timestamp)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedAccount, v, "account as of %d", timestamp)
+
+		expectedStorage := storageValues[len(storageValues)-1]
+		if timestamp < uint64(len(storageValues)) {
+			expectedStorage = storageValues[timestamp-1]
+		}
+		v, err = db.GetAsOf(dbutils.CurrentStateBucket, dbutils.StorageHistoryBucket, storageKey, timestamp)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedStorage, v, "storage as of %d", timestamp)
+
+		accs := make(map[string][]byte)
+		assert.NoError(t, db.WalkAsOf(dbutils.CurrentStateBucket, dbutils.AccountsHistoryBucket, nil, 0, timestamp, func(k, v []byte) (bool, error) {
+			accs[string(k)] = common.CopyBytes(v)
+			return true, nil
+		}))
+		storage := make(map[string][]byte)
+		assert.NoError(t, db.WalkAsOf(dbutils.CurrentStateBucket, dbutils.StorageHistoryBucket, dbutils.GenerateStoragePrefix(contractHash[:], 1), 8*(common.HashLength+common.IncarnationLength), timestamp, func(k, v []byte) (bool, error) {
+			storage[string(k)] = common.CopyBytes(v)
+			return true, nil
+		}))
+		if timestamp == 1 {
+			// Neither the account nor the storage item existed before block 1
+			assert.Empty(t, accs)
+			assert.Empty(t, storage)
+		} else {
+			assert.Equal(t, map[string][]byte{string(addrHash[:]): expectedAccount}, accs, "accounts as of %d", timestamp)
+			assert.Equal(t, map[string][]byte{string(append(contractHash[:], keyHash[:]...)): expectedStorage}, storage, "storage as of %d", timestamp)
+		}
+	}
+
+	// The keys without the history and the current value are not found
+	_, err := db.GetAsOf(dbutils.CurrentStateBucket, dbutils.AccountsHistoryBucket, common.HexToHash("0xbb").Bytes(), 1)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	accountMap, storageMap, err := db.RewindData(3, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{string(addrHash[:]): accountValues[1]}, accountMap)
+	assert.Equal(t, map[string][]byte{string(storageKey): storageValues[1]}, storageMap)
+}
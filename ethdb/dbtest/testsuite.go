@@ -26,13 +26,10 @@ import (
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 )
 
-type dataStore interface {
-	ethdb.Database
-}
+var testBucket = []byte("dbtest")
 
-// TestDatabaseSuite runs a suite of tests against a KeyValueStore database
-// implementation.
-func TestDatabaseSuite(t *testing.T, New func() dataStore) {
+// TestDatabaseSuite runs a suite of tests against a Database implementation.
+func TestDatabaseSuite(t *testing.T, New func() ethdb.Database) {
 	t.Run("Iterator", func(t *testing.T) {
 		tests := []struct {
 			content map[string]string
@@ -103,14 +100,15 @@ func TestDatabaseSuite(t *testing.T, New func() dataStore) {
 		for i, tt := range tests {
 			// Create the key-value data store
 			db := New()
+			defer db.Close()
 			for key, val := range tt.content {
-				if err := db.Put(nil, []byte(key), []byte(val)); err != nil {
+				if err := db.Put(testBucket, []byte(key), []byte(val)); err != nil {
 					t.Fatalf("test %d: failed to insert item %s:%s into database: %v", i, key, val, err)
 				}
 			}
 			// Iterate over the database with the given configs and verify the results
 			idx := 0
-			err := db.Walk(nil, []byte(tt.prefix), 0, func(key, val []byte) (bool, error) {
+			err := db.Walk(testBucket, []byte(tt.prefix+tt.start), uint(8*len(tt.prefix)), func(key, val []byte) (bool, error) {
 				if len(tt.order) <= idx {
 					t.Errorf("test %d: prefix=%q more items than expected: checking idx=%d (key %q), expecting len=%d", i, tt.prefix, idx, key, len(tt.order))
 					return false, nil
@@ -135,12 +133,13 @@ func TestDatabaseSuite(t *testing.T, New func() dataStore) {
 
 	t.Run("IteratorWith", func(t *testing.T) {
 		db := New()
+		defer db.Close()
 
 		keys := []string{"1", "2", "3", "4", "6", "10", "11", "12", "20", "21", "22"}
 		sort.Strings(keys) // 1, 10, 11, etc
 
 		for _, k := range keys {
-			if err := db.Put(nil, []byte(k), nil); err != nil {
+			if err := db.Put(testBucket, []byte(k), []byte(k)); err != nil {
 				t.Fatal(err)
 			}
 		}
@@ -153,14 +152,14 @@ func TestDatabaseSuite(t *testing.T, New func() dataStore) {
 		}
 
 		{
-			got, want := iterateKeysFromKey(db, []byte("1")), []string{"1", "10", "11", "12"}
+			got, want := iterateKeysWithPrefix(db, []byte("1")), []string{"1", "10", "11", "12"}
 			if !reflect.DeepEqual(got, want) {
 				t.Errorf("IteratorWith(1,nil): got: %s; want: %s", got, want)
 			}
 		}
 
 		{
-			got, want := iterateKeysFromKey(db, []byte("5")), []string{}
+			got, want := iterateKeysWithPrefix(db, []byte("5")), []string{}
 			if !reflect.DeepEqual(got, want) {
 				t.Errorf("IteratorWith(5,nil): got: %s; want: %s", got, want)
 			}
@@ -183,37 +182,38 @@ func TestDatabaseSuite(t *testing.T, New func() dataStore) {
 
 	t.Run("KeyValueOperations", func(t *testing.T) {
 		db := New()
+		defer db.Close()
 
 		key := []byte("foo")
 
-		if got, err := db.Has(nil, key); err != nil {
+		if got, err := db.Has(testBucket, key); err != nil {
 			t.Error(err)
 		} else if got {
 			t.Errorf("wrong value: %t", got)
 		}
 
 		value := []byte("hello world")
-		if err := db.Put(nil, key, value); err != nil {
+		if err := db.Put(testBucket, key, value); err != nil {
 			t.Error(err)
 		}
 
-		if got, err := db.Has(nil, key); err != nil {
+		if got, err := db.Has(testBucket, key); err != nil {
 			t.Error(err)
 		} else if !got {
 			t.Errorf("wrong value: %t", got)
 		}
 
-		if got, err := db.Get(nil, key); err != nil {
+		if got, err := db.Get(testBucket, key); err != nil {
 			t.Error(err)
 		} else if !bytes.Equal(got, value) {
 			t.Errorf("wrong value: %q", got)
 		}
 
-		if err := db.Delete(nil, key); err != nil {
+		if err := db.Delete(testBucket, key); err != nil {
 			t.Error(err)
 		}
 
-		if got, err := db.Has(nil, key); err != nil {
+		if got, err := db.Has(testBucket, key); err != nil {
 			t.Error(err)
 		} else if got {
 			t.Errorf("wrong value: %t", got)
@@ -226,12 +226,12 @@ func TestDatabaseSuite(t *testing.T, New func() dataStore) {
 
 		b := db.NewBatch()
 		for _, k := range []string{"1", "2", "3", "4"} {
-			if err := b.Put(nil, []byte(k), nil); err != nil {
+			if err := b.Put(testBucket, []byte(k), []byte(k)); err != nil {
 				t.Fatal(err)
 			}
 		}
 
-		if has, err := db.Has(nil, []byte("1")); err != nil {
+		if has, err := db.Has(testBucket, []byte("1")); err != nil {
 			t.Fatal(err)
 		} else if has {
 			t.Error("db contains element before batch write")
@@ -250,11 +250,11 @@ func TestDatabaseSuite(t *testing.T, New func() dataStore) {
 		b = db.NewBatch()
 
 		// Mix writes and deletes in batch
-		b.Put(nil, []byte("5"), nil)
-		b.Delete(nil, []byte("1"))
-		b.Put(nil, []byte("6"), nil)
-		b.Delete(nil, []byte("3"))
-		b.Put(nil, []byte("3"), nil)
+		b.Put(testBucket, []byte("5"), []byte("5"))
+		b.Delete(testBucket, []byte("1"))
+		b.Put(testBucket, []byte("6"), []byte("6"))
+		b.Delete(testBucket, []byte("3"))
+		b.Put(testBucket, []byte("3"), []byte("3"))
 
 		if _, err := b.Commit(); err != nil {
 			t.Fatal(err)
@@ -279,12 +279,66 @@ func iterateKeys(db ethdb.Database) []string {
 	return iterateKeysFromKey(db, []byte{})
 }
 
+func iterateKeysWithPrefix(db ethdb.Database, prefix []byte) []string {
+	return walkKeys(db, prefix, uint(8*len(prefix)))
+}
+
 func iterateKeysFromKey(db ethdb.Database, fromKey []byte) []string {
+	return walkKeys(db, fromKey, 0)
+}
+
+func walkKeys(db ethdb.Database, startkey []byte, fixedbits uint) []string {
 	keys := []string{}
-	db.Walk(nil, fromKey, 0, func(key, value []byte) (bool, error) {
+	_ = db.Walk(testBucket, startkey, fixedbits, func(key, value []byte) (bool, error) {
 		keys = append(keys, string(common.CopyBytes(key)))
 		return true, nil
 	})
 	sort.Strings(keys)
 	return keys
 }
+
+// TestWalkSuite runs the Walk tests with the fixed bits of the start key against a Database implementation.
+func TestWalkSuite(t *testing.T, New func() ethdb.Database) {
+	keys := []string{"1", "2", "3", "4", "6", "10", "11", "12", "20", "21", "22"}
+
+	tests := []struct {
+		startkey  []byte
+		fixedbits uint
+		want      []string
+	}{
+		// No fixed bits walk from the start key to the end of the bucket
+		{[]byte{}, 0, []string{"1", "10", "11", "12", "2", "20", "21", "22", "3", "4", "6"}},
+		{[]byte("2"), 0, []string{"2", "20", "21", "22", "3", "4", "6"}},
+		{[]byte("5"), 0, []string{"6"}},
+		// Whole fixed bytes walk the keys with the prefix
+		{[]byte("1"), 8, []string{"1", "10", "11", "12"}},
+		{[]byte("11"), 8, []string{"11", "12"}},
+		{[]byte("5"), 8, []string{}},
+		// '2' is 0x32, '3' is 0x33 and '4' is 0x34, the first 7 bits of '2' and '3' are the same
+		{[]byte("2"), 7, []string{"2", "20", "21", "22", "3"}},
+		{[]byte("4"), 5, []string{"4", "6"}},
+	}
+
+	for i, tt := range tests {
+		db := New()
+		for _, k := range keys {
+			if err := db.Put(testBucket, []byte(k), []byte(k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got := []string{}
+		if err := db.Walk(testBucket, tt.startkey, tt.fixedbits, func(k, v []byte) (bool, error) {
+			if !bytes.Equal(k, v) {
+				t.Errorf("test %d: value mismatch: have %s, want %s", i, v, k)
+			}
+			got = append(got, string(common.CopyBytes(k)))
+			return true, nil
+		}); err != nil {
+			t.Errorf("test %d: walk failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("test %d: startkey=%q fixedbits=%d: got %s, want %s", i, tt.startkey, tt.fixedbits, got, tt.want)
+		}
+		db.Close()
+	}
+}
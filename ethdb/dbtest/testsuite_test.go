@@ -0,0 +1,31 @@
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func newBolt() ethdb.Database {
+	return ethdb.NewMemDatabase()
+}
+
+func newBadger(t *testing.T) func() ethdb.Database {
+	return func() ethdb.Database {
+		db, err := ethdb.NewEphemeralBadger()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+}
+
+func TestBoltDatabaseSuite(t *testing.T) {
+	TestDatabaseSuite(t, newBolt)
+	TestWalkSuite(t, newBolt)
+}
+
+func TestBadgerDatabaseSuite(t *testing.T) {
+	TestDatabaseSuite(t, newBadger(t))
+	TestWalkSuite(t, newBadger(t))
+}
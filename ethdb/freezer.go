@@ -0,0 +1,525 @@
+// Copyright 2020 The turbo-geth Authors
+// This file is part of the turbo-geth library.
+//
+// The turbo-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The turbo-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the turbo-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/bolt"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/prometheus/tsdb/fileutil"
+)
+
+// The tables of the freezer
+const (
+	// FreezerHeaderTable holds the RLP encoded headers
+	FreezerHeaderTable = "headers"
+	// FreezerHashTable holds the canonical hashes
+	FreezerHashTable = "hashes"
+	// FreezerBodiesTable holds the RLP encoded bodies, empty if the body was not in the database
+	FreezerBodiesTable = "bodies"
+	// FreezerReceiptTable holds the RLP encoded receipts, empty if the receipts were not in the database
+	FreezerReceiptTable = "receipts"
+	// FreezerDifficultyTable holds the RLP encoded total difficulties
+	FreezerDifficultyTable = "diffs"
+)
+
+// freezerNoSnappy configures whether compression is disabled for the tables,
+// the hashes and the difficulties are not compressible
+var freezerNoSnappy = map[string]bool{
+	FreezerHeaderTable:     false,
+	FreezerHashTable:       true,
+	FreezerBodiesTable:     false,
+	FreezerReceiptTable:    false,
+	FreezerDifficultyTable: true,
+}
+
+var (
+	// errUnknownTable is returned if the user attempts to read from a table that is
+	// not tracked by the freezer.
+	errUnknownTable = errors.New("unknown table")
+
+	// errOutOrderInsertion is returned if the user attempts to inject out-of-order
+	// binary blobs into the freezer.
+	errOutOrderInsertion = errors.New("the append operation is out-order")
+)
+
+const (
+	// freezerRecheckInterval is the frequency to check the database for chain
+	// segments old enough to be moved into the freezer
+	freezerRecheckInterval = time.Minute
+
+	// freezerBatchLimit is the maximum number of blocks to freeze in one batch
+	// before doing an fsync and deleting them from the database
+	freezerBatchLimit = 30000
+)
+
+// freezer is a set of append-only tables holding the old immutable chain segments, the items of
+// all the tables are the blocks with the same numbers. The chain segments older than
+// params.ImmutabilityThreshold are moved into the freezer from the database in the background.
+type freezer struct {
+	frozen uint64 // Number of blocks already frozen, accessed atomically
+
+	tables       map[string]*freezerTable
+	instanceLock fileutil.Releaser // File-system lock to prevent double opens
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newFreezer opens the tables of the freezer in the directory, the items written after the last
+// block present in all the tables are discarded
+func newFreezer(datadir string, namespace string) (*freezer, error) {
+	var (
+		readMeter  = metrics.NewRegisteredMeter(namespace+"ancient/read", nil)
+		writeMeter = metrics.NewRegisteredMeter(namespace+"ancient/write", nil)
+		sizeGauge  = metrics.NewRegisteredGauge(namespace+"ancient/size", nil)
+	)
+	if err := os.MkdirAll(datadir, 0755); err != nil {
+		return nil, err
+	}
+	lock, _, err := fileutil.Flock(filepath.Join(datadir, "FLOCK"))
+	if err != nil {
+		return nil, err
+	}
+	f := &freezer{
+		tables:       make(map[string]*freezerTable),
+		instanceLock: lock,
+		quit:         make(chan struct{}),
+	}
+	for name, disableSnappy := range freezerNoSnappy {
+		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, disableSnappy)
+		if err != nil {
+			for _, table := range f.tables {
+				table.Close()
+			}
+			lock.Release()
+			return nil, err
+		}
+		f.tables[name] = table
+	}
+	if err := f.repair(); err != nil {
+		for _, table := range f.tables {
+			table.Close()
+		}
+		lock.Release()
+		return nil, err
+	}
+	log.Info("Opened ancient database", "database", datadir, "frozen", f.frozen)
+	return f, nil
+}
+
+// repair truncates the tables to the number of the items in the shortest one
+func (f *freezer) repair() error {
+	min := uint64(math.MaxUint64)
+	for _, table := range f.tables {
+		if items := table.Items(); items < min {
+			min = items
+		}
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(min); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, min)
+	return nil
+}
+
+// HasAncient returns an indicator whether the specified ancient data exists in the freezer.
+func (f *freezer) HasAncient(kind string, number uint64) (bool, error) {
+	if _, ok := f.tables[kind]; !ok {
+		return false, errUnknownTable
+	}
+	return number < atomic.LoadUint64(&f.frozen), nil
+}
+
+// Ancient retrieves an ancient binary blob from the append-only immutable files.
+func (f *freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.Retrieve(number)
+	}
+	return nil, errUnknownTable
+}
+
+// Ancients returns the length of the frozen items.
+func (f *freezer) Ancients() (uint64, error) {
+	return atomic.LoadUint64(&f.frozen), nil
+}
+
+// AncientSize returns the ancient size of the specified category.
+func (f *freezer) AncientSize(kind string) (uint64, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.size()
+	}
+	return 0, errUnknownTable
+}
+
+// AppendAncient appends the data of the block to all the tables. The blocks must be appended in order
+// by a single writer, the tables are rolled back to the last complete block if any of the appends fails.
+func (f *freezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) (err error) {
+	if atomic.LoadUint64(&f.frozen) != number {
+		return errOutOrderInsertion
+	}
+	defer func() {
+		if err != nil {
+			if rerr := f.repair(); rerr != nil {
+				log.Crit("Failed to repair freezer", "err", rerr)
+			}
+			log.Info("Append ancient failed", "number", number, "err", err)
+		}
+	}()
+	for _, item := range []struct {
+		kind string
+		blob []byte
+	}{
+		{FreezerHashTable, hash},
+		{FreezerHeaderTable, header},
+		{FreezerBodiesTable, body},
+		{FreezerReceiptTable, receipts},
+		{FreezerDifficultyTable, td},
+	} {
+		if err := f.tables[item.kind].Append(number, item.blob); err != nil {
+			log.Error("Failed to append ancient "+item.kind, "number", number, "hash", common.BytesToHash(hash), "err", err)
+			return err
+		}
+	}
+	atomic.AddUint64(&f.frozen, 1) // Only modify atomically
+	return nil
+}
+
+// TruncateAncients discards any recent data above the provided threshold number.
+func (f *freezer) TruncateAncients(items uint64) error {
+	if atomic.LoadUint64(&f.frozen) <= items {
+		return nil
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(items); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, items)
+	return nil
+}
+
+// Sync flushes all data tables to disk.
+func (f *freezer) Sync() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// Close terminates the chain freezer, unmapping all the data files.
+func (f *freezer) Close() error {
+	select {
+	case <-f.quit:
+		return nil
+	default:
+		close(f.quit)
+	}
+	f.wg.Wait()
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := f.instanceLock.Release(); err != nil {
+		errs = append(errs, err)
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// freeze is a background thread that periodically checks the blockchain for any
+// import progress and moves the blocks older than params.ImmutabilityThreshold
+// from the database into the freezer.
+func (f *freezer) freeze(db Database) {
+	defer f.wg.Done()
+	backoff := false
+	for {
+		select {
+		case <-f.quit:
+			log.Info("Freezer shutting down")
+			return
+		default:
+		}
+		if backoff {
+			timer := time.NewTimer(freezerRecheckInterval)
+			select {
+			case <-timer.C:
+				backoff = false
+			case <-f.quit:
+				timer.Stop()
+				return
+			}
+		}
+		head, err := readHeadBlockNumber(db)
+		if err != nil {
+			if err != ErrKeyNotFound {
+				log.Error("Current full block unavailable", "err", err)
+			}
+			backoff = true
+			continue
+		}
+		if head <= params.ImmutabilityThreshold {
+			backoff = true
+			continue
+		}
+		first, _ := f.Ancients()
+		limit := head - params.ImmutabilityThreshold
+		if limit < first {
+			backoff = true
+			continue
+		}
+		if limit-first >= freezerBatchLimit {
+			limit = first + freezerBatchLimit - 1
+		}
+		start := time.Now()
+		if err := f.freezeRange(db, first, limit); err != nil {
+			log.Error("Failed to freeze the blocks", "err", err)
+			backoff = true
+		}
+		if err := f.Sync(); err != nil {
+			log.Crit("Failed to flush frozen tables", "err", err)
+		}
+		frozen, _ := f.Ancients()
+		if frozen == first {
+			backoff = true
+			continue
+		}
+		// The blocks are safely in the freezer, they can be deleted from the database
+		if err := deleteFrozenBlocks(db, first, frozen); err != nil {
+			log.Error("Failed to delete the frozen blocks", "err", err)
+			backoff = true
+			continue
+		}
+		log.Info("Deep froze chain segment", "blocks", frozen-first, "elapsed", common.PrettyDuration(time.Since(start)), "number", frozen-1)
+		if frozen-first < freezerBatchLimit {
+			backoff = true
+		}
+	}
+}
+
+// readHeadBlockNumber returns the number of the current full block
+func readHeadBlockNumber(db Getter) (uint64, error) {
+	hash, err := db.Get(dbutils.HeadBlockKey, dbutils.HeadBlockKey)
+	if err != nil {
+		return 0, err
+	}
+	number, err := db.Get(dbutils.HeaderNumberPrefix, hash)
+	if err != nil {
+		return 0, err
+	}
+	if len(number) != 8 {
+		return 0, fmt.Errorf("invalid number of the head block %x: %x", hash, number)
+	}
+	return binary.BigEndian.Uint64(number), nil
+}
+
+// freezeRange appends the canonical blocks from first to limit (inclusive) to the freezer. The bodies,
+// the receipts and the difficulties are frozen empty if they are not in the database (e.g. pruned).
+func (f *freezer) freezeRange(db Getter, first, limit uint64) error {
+	get := func(bucket, key []byte) ([]byte, error) {
+		v, err := db.Get(bucket, key)
+		if err != nil && err != ErrKeyNotFound {
+			return nil, err
+		}
+		return v, nil
+	}
+	for number := first; number <= limit; number++ {
+		select {
+		case <-f.quit:
+			return nil
+		default:
+		}
+		hash, err := get(dbutils.HeaderPrefix, dbutils.HeaderHashKey(number))
+		if err != nil {
+			return err
+		}
+		if len(hash) == 0 {
+			return fmt.Errorf("canonical hash missing, can't freeze block %d", number)
+		}
+		header, err := get(dbutils.HeaderPrefix, dbutils.HeaderKey(number, common.BytesToHash(hash)))
+		if err != nil {
+			return err
+		}
+		if len(header) == 0 {
+			return fmt.Errorf("block header missing, can't freeze block %d", number)
+		}
+		body, err := get(dbutils.BlockBodyPrefix, dbutils.BlockBodyKey(number, common.BytesToHash(hash)))
+		if err != nil {
+			return err
+		}
+		receipts, err := get(dbutils.BlockReceiptsPrefix, dbutils.BlockReceiptsKey(number, common.BytesToHash(hash)))
+		if err != nil {
+			return err
+		}
+		td, err := get(dbutils.HeaderPrefix, dbutils.HeaderTDKey(number, common.BytesToHash(hash)))
+		if err != nil {
+			return err
+		}
+		if err := f.AppendAncient(number, hash, header, body, receipts, td); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteFrozenBlocks deletes the blocks from first to frozen (exclusive) from the database, the
+// side chains included. The genesis block and the hash to number mappings of the canonical
+// blocks stay in the database, as well as the senders of the canonical blocks.
+func deleteFrozenBlocks(db Database, first, frozen uint64) error {
+	batch := db.NewBatch()
+	for number := first; number < frozen; number++ {
+		if number == 0 {
+			continue
+		}
+		canonical, err := db.Get(dbutils.HeaderPrefix, dbutils.HeaderHashKey(number))
+		if err != nil && err != ErrKeyNotFound {
+			return err
+		}
+		var keys [][]byte
+		if err := db.Walk(dbutils.HeaderPrefix, dbutils.EncodeBlockNumber(number), 8*common.BlockNumberLength, func(k, _ []byte) (bool, error) {
+			keys = append(keys, common.CopyBytes(k))
+			return true, nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := batch.Delete(dbutils.HeaderPrefix, k); err != nil {
+				return err
+			}
+			if !dbutils.IsHeaderKey(k) {
+				continue
+			}
+			for _, bucket := range [][]byte{dbutils.BlockBodyPrefix, dbutils.BlockReceiptsPrefix} {
+				if err := batch.Delete(bucket, k); err != nil {
+					return err
+				}
+			}
+			if hash := k[common.BlockNumberLength:]; !bytes.Equal(hash, canonical) {
+				if err := batch.Delete(dbutils.HeaderNumberPrefix, hash); err != nil {
+					return err
+				}
+				if err := batch.Delete(dbutils.SendersPrefix, k); err != nil {
+					return err
+				}
+			}
+		}
+		if batch.BatchSize() >= batch.IdealBatchSize() {
+			if _, err := batch.Commit(); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := batch.Commit()
+	return err
+}
+
+// freezerdb is a database wrapper that moves the old chain segments into the freezer
+// and serves them from there
+type freezerdb struct {
+	Database
+	*freezer
+}
+
+// NewDatabaseWithFreezer wraps the database with the freezer in the directory. The freezer
+// moves the blocks older than params.ImmutabilityThreshold out of the database in the background,
+// the rawdb accessors read them from the freezer.
+func NewDatabaseWithFreezer(db Database, dir, namespace string) (Database, error) {
+	frdb, err := newFreezer(dir, namespace)
+	if err != nil {
+		return nil, err
+	}
+	// The freezer can be stored separately from the database, make sure they belong to the same chain
+	if kvgenesis, _ := db.Get(dbutils.HeaderPrefix, dbutils.HeaderHashKey(0)); len(kvgenesis) > 0 {
+		if frozen, _ := frdb.Ancients(); frozen > 0 {
+			if frgenesis, _ := frdb.Ancient(FreezerHashTable, 0); !bytes.Equal(kvgenesis, frgenesis) {
+				frdb.Close()
+				return nil, fmt.Errorf("genesis mismatch: %#x (database) != %#x (ancient)", kvgenesis, frgenesis)
+			}
+		}
+	}
+	frdb.wg.Add(1)
+	go frdb.freeze(db)
+	return &freezerdb{
+		Database: db,
+		freezer:  frdb,
+	}, nil
+}
+
+// Ancients returns the number of the frozen blocks
+func (fdb *freezerdb) Ancients() (uint64, error) {
+	return fdb.freezer.Ancients()
+}
+
+// TruncateAncients discards the frozen blocks starting from the given number
+func (fdb *freezerdb) TruncateAncients(items uint64) error {
+	return fdb.freezer.TruncateAncients(items)
+}
+
+// Close stops the freezer and closes the database
+func (fdb *freezerdb) Close() {
+	if err := fdb.freezer.Close(); err != nil {
+		log.Error("Failed to close the freezer", "err", err)
+	}
+	fdb.Database.Close()
+}
+
+func (fdb *freezerdb) NewBatch() DbWithPendingMutations {
+	return &mutation{
+		db:   fdb,
+		puts: newPuts(),
+	}
+}
+
+func (fdb *freezerdb) KV() *bolt.DB {
+	if casted, ok := fdb.Database.(HasKV); ok {
+		return casted.KV()
+	}
+	return nil
+}
+
+func (fdb *freezerdb) AbstractKV() KV {
+	if casted, ok := fdb.Database.(HasAbstractKV); ok {
+		return casted.AbstractKV()
+	}
+	return nil
+}
@@ -0,0 +1,451 @@
+// Copyright 2020 The turbo-geth Authors
+// This file is part of the turbo-geth library.
+//
+// The turbo-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The turbo-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the turbo-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+var (
+	// errClosed is returned if an operation attempts to read from or write to the
+	// freezer table after it has already been closed.
+	errClosed = errors.New("closed")
+
+	// errOutOfBounds is returned if the item requested is not contained within the
+	// freezer table.
+	errOutOfBounds = errors.New("out of bounds")
+)
+
+// freezerTableSize defines the maximum size of the data files of a freezer table
+const freezerTableSize = 2 * 1000 * 1000 * 1000
+
+// indexEntrySize is the size of an encoded indexEntry
+const indexEntrySize = 6
+
+// indexEntry is the position of the end of an item in the data files: the number of the file
+// and the offset in it. The item starts at the end of the previous item, or at the beginning
+// of the file if the previous item is in another file.
+type indexEntry struct {
+	filenum uint32 // stored as uint16 (2 bytes)
+	offset  uint32 // stored as uint32 (4 bytes)
+}
+
+func (e *indexEntry) unmarshal(b []byte) {
+	e.filenum = uint32(binary.BigEndian.Uint16(b[:2]))
+	e.offset = binary.BigEndian.Uint32(b[2:6])
+}
+
+func (e *indexEntry) marshal() []byte {
+	b := make([]byte, indexEntrySize)
+	binary.BigEndian.PutUint16(b[:2], uint16(e.filenum))
+	binary.BigEndian.PutUint32(b[2:6], e.offset)
+	return b
+}
+
+// freezerTable is an append-only table of blobs, addressed by their sequential numbers.
+// The blobs are written into the data files, which are rotated when they reach the maximum size,
+// and the index file holds the end position of each blob. The blobs are optionally compressed with snappy.
+type freezerTable struct {
+	items uint64 // Number of items in the table
+
+	noCompression bool   // if true, the data is not compressed
+	maxFileSize   uint32 // Max file size of the data files
+	name          string
+	path          string
+
+	index     *os.File            // File of the index entries, the first entry is the start of the table
+	files     map[uint32]*os.File // Open data files
+	head      *os.File            // Data file the items are appended to
+	headID    uint32              // Number of the head file
+	headBytes uint32              // Number of bytes written to the head file
+
+	readMeter  metrics.Meter // Meter for measuring the effective amount of data read
+	writeMeter metrics.Meter // Meter for measuring the effective amount of data written
+	sizeGauge  metrics.Gauge // Gauge for tracking the combined size of all freezer tables
+
+	logger log.Logger
+	lock   sync.RWMutex // Protects the files and the positions
+}
+
+// newTable opens a freezer table with the default maximum size of the data files
+func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, noCompression bool) (*freezerTable, error) {
+	return newCustomTable(path, name, readMeter, writeMeter, sizeGauge, freezerTableSize, noCompression)
+}
+
+// newCustomTable opens a freezer table, creating the files if they do not exist, and repairs it
+// after a crash: the entries of the index pointing beyond the data and the data not covered by
+// the index are dropped
+func newCustomTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFileSize uint32, noCompression bool) (*freezerTable, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	idxName := fmt.Sprintf("%s.ridx", name)
+	if !noCompression {
+		idxName = fmt.Sprintf("%s.cidx", name)
+	}
+	index, err := os.OpenFile(filepath.Join(path, idxName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	t := &freezerTable{
+		index:         index,
+		files:         make(map[uint32]*os.File),
+		readMeter:     readMeter,
+		writeMeter:    writeMeter,
+		sizeGauge:     sizeGauge,
+		name:          name,
+		path:          path,
+		logger:        log.New("database", path, "table", name),
+		noCompression: noCompression,
+		maxFileSize:   maxFileSize,
+	}
+	if err := t.repair(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	size, err := t.sizeNolock()
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	t.sizeGauge.Inc(int64(size))
+	return t, nil
+}
+
+// repair makes the index and the data files consistent with each other and opens the data files
+func (t *freezerTable) repair() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	// The first entry is the start of the table
+	if stat.Size() == 0 {
+		if _, err := t.index.Write((&indexEntry{}).marshal()); err != nil {
+			return err
+		}
+		stat, err = t.index.Stat()
+		if err != nil {
+			return err
+		}
+	}
+	// The entry might have been written partially
+	indexSize := stat.Size()
+	if overflow := indexSize % indexEntrySize; overflow != 0 {
+		indexSize -= overflow
+		if err := t.index.Truncate(indexSize); err != nil {
+			return err
+		}
+	}
+	var lastIndex indexEntry
+	if lastIndex, err = t.readEntry(uint64(indexSize/indexEntrySize - 1)); err != nil {
+		return err
+	}
+	if t.head, err = t.openFile(lastIndex.filenum); err != nil {
+		return err
+	}
+	if stat, err = t.head.Stat(); err != nil {
+		return err
+	}
+	contentSize := stat.Size()
+
+	for contentSize != int64(lastIndex.offset) {
+		if contentSize > int64(lastIndex.offset) {
+			// The data of the item was written, but the index entry was not
+			t.logger.Warn("Truncating dangling head", "indexed", lastIndex.offset, "stored", contentSize)
+			if err := t.head.Truncate(int64(lastIndex.offset)); err != nil {
+				return err
+			}
+			contentSize = int64(lastIndex.offset)
+			continue
+		}
+		// The index entry was written, but the data was not
+		t.logger.Warn("Truncating dangling indexes", "indexed", lastIndex.offset, "stored", contentSize)
+		if indexSize == indexEntrySize {
+			return fmt.Errorf("first data file of %s is shorter than its index", t.name)
+		}
+		indexSize -= indexEntrySize
+		if err := t.index.Truncate(indexSize); err != nil {
+			return err
+		}
+		if lastIndex, err = t.readEntry(uint64(indexSize/indexEntrySize - 1)); err != nil {
+			return err
+		}
+		if t.head, err = t.openFile(lastIndex.filenum); err != nil {
+			return err
+		}
+		if stat, err = t.head.Stat(); err != nil {
+			return err
+		}
+		contentSize = stat.Size()
+	}
+	// The data files after the head are never referenced by the index
+	for id := lastIndex.filenum + 1; ; id++ {
+		if _, err := os.Stat(t.fileName(id)); os.IsNotExist(err) {
+			break
+		}
+		if f, ok := t.files[id]; ok {
+			f.Close()
+			delete(t.files, id)
+		}
+		if err := os.Remove(t.fileName(id)); err != nil {
+			return err
+		}
+	}
+	for id := uint32(0); id < lastIndex.filenum; id++ {
+		if _, err := t.openFile(id); err != nil {
+			return err
+		}
+	}
+	if err := t.index.Sync(); err != nil {
+		return err
+	}
+	if err := t.head.Sync(); err != nil {
+		return err
+	}
+	t.items = uint64(indexSize/indexEntrySize - 1)
+	t.headID = lastIndex.filenum
+	t.headBytes = lastIndex.offset
+	t.logger.Debug("Chain freezer table opened", "items", t.items, "size", common.StorageSize(t.headBytes))
+	return nil
+}
+
+func (t *freezerTable) fileName(id uint32) string {
+	if t.noCompression {
+		return filepath.Join(t.path, fmt.Sprintf("%s.%04d.rdat", t.name, id))
+	}
+	return filepath.Join(t.path, fmt.Sprintf("%s.%04d.cdat", t.name, id))
+}
+
+// openFile opens the data file if it is not open yet, creating it if it does not exist
+func (t *freezerTable) openFile(id uint32) (*os.File, error) {
+	if f, ok := t.files[id]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(t.fileName(id), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	t.files[id] = f
+	return f, nil
+}
+
+func (t *freezerTable) readEntry(i uint64) (indexEntry, error) {
+	var entry indexEntry
+	buf := make([]byte, indexEntrySize)
+	if _, err := t.index.ReadAt(buf, int64(i*indexEntrySize)); err != nil {
+		return entry, err
+	}
+	entry.unmarshal(buf)
+	return entry, nil
+}
+
+// Append writes the item into the table, the number of the item must be the number of the items in the table
+func (t *freezerTable) Append(item uint64, blob []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.index == nil {
+		return errClosed
+	}
+	if t.items != item {
+		return fmt.Errorf("appending unexpected item: want %d, have %d", t.items, item)
+	}
+	if !t.noCompression {
+		blob = snappy.Encode(nil, blob)
+	}
+	bLen := uint32(len(blob))
+	if t.headBytes+bLen < bLen || t.headBytes+bLen > t.maxFileSize {
+		// The head file is full, start the next one
+		if err := t.head.Sync(); err != nil {
+			return err
+		}
+		head, err := t.openFile(t.headID + 1)
+		if err != nil {
+			return err
+		}
+		t.head, t.headID, t.headBytes = head, t.headID+1, 0
+	}
+	if _, err := t.head.Write(blob); err != nil {
+		return err
+	}
+	t.headBytes += bLen
+	if _, err := t.index.Write((&indexEntry{filenum: t.headID, offset: t.headBytes}).marshal()); err != nil {
+		return err
+	}
+	t.writeMeter.Mark(int64(bLen + indexEntrySize))
+	t.sizeGauge.Inc(int64(bLen + indexEntrySize))
+	t.items++
+	return nil
+}
+
+// Retrieve returns the item with the given number
+func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if t.index == nil {
+		return nil, errClosed
+	}
+	if item >= t.items {
+		return nil, errOutOfBounds
+	}
+	start, err := t.readEntry(item)
+	if err != nil {
+		return nil, err
+	}
+	end, err := t.readEntry(item + 1)
+	if err != nil {
+		return nil, err
+	}
+	if start.filenum != end.filenum {
+		// The item is the first one in its file
+		start.offset = 0
+	}
+	f, ok := t.files[end.filenum]
+	if !ok {
+		return nil, fmt.Errorf("missing data file %d", end.filenum)
+	}
+	blob := make([]byte, end.offset-start.offset)
+	if _, err := f.ReadAt(blob, int64(start.offset)); err != nil {
+		return nil, err
+	}
+	t.readMeter.Mark(int64(len(blob) + 2*indexEntrySize))
+	if t.noCompression {
+		return blob, nil
+	}
+	return snappy.Decode(nil, blob)
+}
+
+// Items returns the number of the items in the table
+func (t *freezerTable) Items() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.items
+}
+
+// truncate discards the items with the numbers starting from the given one
+func (t *freezerTable) truncate(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.index == nil {
+		return errClosed
+	}
+	if t.items <= items {
+		return nil
+	}
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.logger.Warn("Truncating freezer table", "items", t.items, "limit", items)
+	if err := t.index.Truncate(int64(items+1) * indexEntrySize); err != nil {
+		return err
+	}
+	expected, err := t.readEntry(items)
+	if err != nil {
+		return err
+	}
+	for id := t.headID; id > expected.filenum; id-- {
+		if err := t.files[id].Close(); err != nil {
+			return err
+		}
+		delete(t.files, id)
+		if err := os.Remove(t.fileName(id)); err != nil {
+			return err
+		}
+	}
+	t.head, t.headID = t.files[expected.filenum], expected.filenum
+	if err := t.head.Truncate(int64(expected.offset)); err != nil {
+		return err
+	}
+	t.headBytes = expected.offset
+	t.items = items
+
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+	return nil
+}
+
+// size returns the total size of the files of the table
+func (t *freezerTable) size() (uint64, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.sizeNolock()
+}
+
+func (t *freezerTable) sizeNolock() (uint64, error) {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return 0, err
+	}
+	total := uint64(stat.Size())
+	for _, f := range t.files {
+		if stat, err = f.Stat(); err != nil {
+			return 0, err
+		}
+		total += uint64(stat.Size())
+	}
+	return total, nil
+}
+
+// Sync flushes the index and the head file to the disk
+func (t *freezerTable) Sync() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.index == nil {
+		return errClosed
+	}
+	if err := t.index.Sync(); err != nil {
+		return err
+	}
+	return t.head.Sync()
+}
+
+// Close closes the files of the table
+func (t *freezerTable) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var errs []error
+	if t.index != nil {
+		if err := t.index.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	t.index = nil
+	for id, f := range t.files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(t.files, id)
+	}
+	t.head = nil
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
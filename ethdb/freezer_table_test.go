@@ -0,0 +1,164 @@
+package ethdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+// getChunk returns a chunk of data, filled with the given byte
+func getChunk(size int, b int) []byte {
+	return bytes.Repeat([]byte{byte(b)}, size)
+}
+
+func newTestTable(t *testing.T, dir string, maxFileSize uint32, noCompression bool) *freezerTable {
+	table, err := newCustomTable(dir, "test", metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, maxFileSize, noCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func checkItems(t *testing.T, table *freezerTable, from, to int) {
+	for i := from; i < to; i++ {
+		blob, err := table.Retrieve(uint64(i))
+		if err != nil {
+			t.Fatalf("could not read item %d: %v", i, err)
+		}
+		if exp := getChunk(15, i); !bytes.Equal(blob, exp) {
+			t.Fatalf("item %d: expected %x, got %x", i, exp, blob)
+		}
+	}
+	if _, err := table.Retrieve(uint64(to)); err != errOutOfBounds {
+		t.Fatalf("expected out of bounds for item %d, got %v", to, err)
+	}
+}
+
+// The items are written into several data files and read back, also after reopening the table
+func TestFreezerTableBasics(t *testing.T) {
+	for _, noCompression := range []bool{true, false} {
+		dir, err := ioutil.TempDir(os.TempDir(), "freezer_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		table := newTestTable(t, dir, 50, noCompression)
+		for i := 0; i < 255; i++ {
+			if err := table.Append(uint64(i), getChunk(15, i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := table.Append(300, getChunk(15, 0)); err == nil {
+			t.Fatal("out of order append succeeded")
+		}
+		checkItems(t, table, 0, 255)
+		if noCompression && table.headID == 0 {
+			t.Fatal("data files are not rotated")
+		}
+		if err := table.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		table = newTestTable(t, dir, 50, noCompression)
+		checkItems(t, table, 0, 255)
+		if err := table.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// The items not fully written before a crash are dropped when the table is opened
+func TestFreezerTableRepair(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "freezer_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	table := newTestTable(t, dir, 50, true)
+	for i := 0; i < 10; i++ {
+		if err := table.Append(uint64(i), getChunk(15, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := table.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The index entry of the last item is written partially
+	idxFile := filepath.Join(dir, "test.ridx")
+	stat, err := os.Stat(idxFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(idxFile, stat.Size()-4); err != nil {
+		t.Fatal(err)
+	}
+	table = newTestTable(t, dir, 50, true)
+	checkItems(t, table, 0, 9)
+	headFile := table.fileName(table.headID)
+	if err := table.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The data of the last item is written partially
+	stat, err = os.Stat(headFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(headFile, stat.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	table = newTestTable(t, dir, 50, true)
+	checkItems(t, table, 0, 8)
+	// The table can be appended to after the repair
+	if err := table.Append(8, getChunk(15, 8)); err != nil {
+		t.Fatal(err)
+	}
+	checkItems(t, table, 0, 9)
+	if err := table.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFreezerTableTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "freezer_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	table := newTestTable(t, dir, 50, true)
+	for i := 0; i < 30; i++ {
+		if err := table.Append(uint64(i), getChunk(15, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lastFile := table.fileName(table.headID)
+	if err := table.truncate(10); err != nil {
+		t.Fatal(err)
+	}
+	checkItems(t, table, 0, 10)
+	if _, err := os.Stat(lastFile); !os.IsNotExist(err) {
+		t.Fatalf("data file %s is not removed", lastFile)
+	}
+	// The truncated items are overwritten
+	if err := table.Append(10, getChunk(15, 10)); err != nil {
+		t.Fatal(err)
+	}
+	checkItems(t, table, 0, 11)
+	if err := table.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	table = newTestTable(t, dir, 50, true)
+	checkItems(t, table, 0, 11)
+	if err := table.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
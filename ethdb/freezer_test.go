@@ -0,0 +1,116 @@
+package ethdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+// The canonical blocks are moved into the freezer, the side chains at the frozen heights are deleted
+func TestFreezeBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "freezer_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := NewMemDatabase()
+	defer db.Close()
+
+	put := func(bucket, key, value []byte) {
+		if err := db.Put(bucket, key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeBlock := func(number uint64, hash common.Hash, canonical bool) {
+		if canonical {
+			put(dbutils.HeaderPrefix, dbutils.HeaderHashKey(number), hash[:])
+		}
+		put(dbutils.HeaderNumberPrefix, hash[:], dbutils.EncodeBlockNumber(number))
+		put(dbutils.HeaderPrefix, dbutils.HeaderKey(number, hash), append([]byte("header"), hash[:]...))
+		put(dbutils.HeaderPrefix, dbutils.HeaderTDKey(number, hash), []byte{byte(number)})
+		put(dbutils.BlockBodyPrefix, dbutils.BlockBodyKey(number, hash), append([]byte("body"), hash[:]...))
+		put(dbutils.SendersPrefix, dbutils.BlockBodyKey(number, hash), hash[:])
+		if number != 1 {
+			// The receipts of the block 1 are pruned
+			put(dbutils.BlockReceiptsPrefix, dbutils.BlockReceiptsKey(number, hash), append([]byte("receipts"), hash[:]...))
+		}
+	}
+	for number := uint64(0); number < 5; number++ {
+		writeBlock(number, common.BytesToHash([]byte{byte(number)}), true)
+	}
+	side := common.HexToHash("0xff02")
+	writeBlock(2, side, false)
+
+	f, err := newFreezer(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.freezeRange(db, 0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteFrozenBlocks(db, 0, 4); err != nil {
+		t.Fatal(err)
+	}
+	if frozen, _ := f.Ancients(); frozen != 4 {
+		t.Fatalf("expected 4 frozen blocks, got %d", frozen)
+	}
+
+	for number := uint64(0); number < 4; number++ {
+		hash := common.BytesToHash([]byte{byte(number)})
+		for kind, expected := range map[string][]byte{
+			FreezerHashTable:       hash[:],
+			FreezerHeaderTable:     append([]byte("header"), hash[:]...),
+			FreezerBodiesTable:     append([]byte("body"), hash[:]...),
+			FreezerDifficultyTable: {byte(number)},
+		} {
+			if v, err := f.Ancient(kind, number); err != nil || !bytes.Equal(v, expected) {
+				t.Errorf("block %d, %s: expected %x, got %x (err %v)", number, kind, expected, v, err)
+			}
+		}
+		if v, _ := f.Ancient(FreezerReceiptTable, number); (number == 1) != (len(v) == 0) {
+			t.Errorf("block %d: unexpected receipts %x", number, v)
+		}
+
+		// The genesis stays in the database
+		has, err := db.Has(dbutils.HeaderPrefix, dbutils.HeaderKey(number, hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != (number == 0) {
+			t.Errorf("block %d: header in the database %t", number, has)
+		}
+		if has, _ := db.Has(dbutils.HeaderNumberPrefix, hash[:]); !has {
+			t.Errorf("block %d: hash to number mapping is deleted", number)
+		}
+		if has, _ := db.Has(dbutils.SendersPrefix, dbutils.BlockBodyKey(number, hash)); !has {
+			t.Errorf("block %d: senders are deleted", number)
+		}
+	}
+	for _, bucket := range [][]byte{dbutils.HeaderPrefix, dbutils.BlockBodyPrefix, dbutils.BlockReceiptsPrefix, dbutils.SendersPrefix} {
+		if has, _ := db.Has(bucket, dbutils.HeaderKey(2, side)); has {
+			t.Errorf("side block is not deleted from %s", bucket)
+		}
+	}
+	if has, _ := db.Has(dbutils.HeaderNumberPrefix, side[:]); has {
+		t.Errorf("hash to number mapping of the side block is not deleted")
+	}
+	if has, _ := db.Has(dbutils.HeaderPrefix, dbutils.HeaderKey(4, common.BytesToHash([]byte{4}))); !has {
+		t.Errorf("block 4 is deleted")
+	}
+
+	// The blocks are appended in order
+	if err := f.AppendAncient(5, nil, nil, nil, nil, nil); err != errOutOrderInsertion {
+		t.Errorf("expected out of order insertion, got %v", err)
+	}
+	if err := f.TruncateAncients(2); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := f.HasAncient(FreezerHeaderTable, 2); has {
+		t.Errorf("block 2 is not truncated")
+	}
+}
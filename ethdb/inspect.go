@@ -0,0 +1,165 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// SizeHistogram counts the sizes by powers of two, see SizeHistogramRange
+type SizeHistogram [33]uint64
+
+// SizeHistogramRange returns the sizes counted in the i-th bin of SizeHistogram, both bounds are inclusive.
+// The bin 0 counts the empty keys and values, the bin i counts the sizes in [2^(i-1), 2^i)
+func SizeHistogramRange(i int) (min, max uint32) {
+	if i == 0 {
+		return 0, 0
+	}
+	return 1 << uint(i-1), uint32(1<<uint(i) - 1)
+}
+
+// SizeBin is a non-empty bin of SizeHistogram
+type SizeBin struct {
+	Min   uint32 `json:"min"`
+	Max   uint32 `json:"max"`
+	Count uint64 `json:"count"`
+}
+
+func (h *SizeHistogram) add(size uint32) {
+	h[bits.Len32(size)]++
+}
+
+// Bins returns the non-empty bins of the histogram
+func (h SizeHistogram) Bins() []SizeBin {
+	bins := []SizeBin{}
+	for i, count := range h {
+		if count == 0 {
+			continue
+		}
+		min, max := SizeHistogramRange(i)
+		bins = append(bins, SizeBin{Min: min, Max: max, Count: count})
+	}
+	return bins
+}
+
+func (h SizeHistogram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Bins())
+}
+
+// KeyStats sums up the number and the sizes of the keys and of their values
+type KeyStats struct {
+	Keys      uint64 `json:"keys"`
+	KeySize   uint64 `json:"keySize"`
+	ValueSize uint64 `json:"valueSize"`
+}
+
+func (s *KeyStats) add(k []byte, vSize uint32) {
+	s.Keys++
+	s.KeySize += uint64(len(k))
+	s.ValueSize += uint64(vSize)
+}
+
+// BucketStats is the summary of a bucket collected by InspectDatabase.
+// KeyTypes breaks the keys of the buckets with composite keys down by their kind, see keyType
+type BucketStats struct {
+	Bucket string `json:"bucket"`
+	KeyStats
+	KeySizes   SizeHistogram        `json:"keySizes"`
+	ValueSizes SizeHistogram        `json:"valueSizes"`
+	KeyTypes   map[string]*KeyStats `json:"keyTypes,omitempty"`
+}
+
+func (s *BucketStats) add(bucket, k []byte, vSize uint32) {
+	s.KeyStats.add(k, vSize)
+	s.KeySizes.add(uint32(len(k)))
+	s.ValueSizes.add(vSize)
+	kind := keyType(bucket, k)
+	if kind == "" {
+		return
+	}
+	if s.KeyTypes == nil {
+		s.KeyTypes = make(map[string]*KeyStats)
+	}
+	typeStats, ok := s.KeyTypes[kind]
+	if !ok {
+		typeStats = &KeyStats{}
+		s.KeyTypes[kind] = typeStats
+	}
+	typeStats.add(k, vSize)
+}
+
+// keyType classifies the keys of the buckets with composite keys, it returns an empty string for the other buckets
+func keyType(bucket, k []byte) string {
+	switch {
+	case bytes.Equal(bucket, dbutils.CurrentStateBucket), bytes.Equal(bucket, dbutils.IntermediateTrieHashBucket):
+		// The storage keys (and the prefixes of the storage tries) start with the address hash and the incarnation
+		if len(k) > common.HashLength+common.IncarnationLength {
+			return "storage, " + incarnationType(k[common.HashLength:])
+		}
+		return "account"
+	case bytes.Equal(bucket, dbutils.ContractCodeBucket):
+		if len(k) == common.HashLength+common.IncarnationLength {
+			return incarnationType(k[common.HashLength:])
+		}
+	case bytes.Equal(bucket, dbutils.AccountsHistoryBucket):
+		switch {
+		case len(k) == common.HashLength+8:
+			return indexType(k)
+		case len(k) > common.HashLength:
+			// Address hash and the encoded timestamp, the full history
+			return "record"
+		}
+	case bytes.Equal(bucket, dbutils.StorageHistoryBucket):
+		switch {
+		case len(k) == 2*common.HashLength+8:
+			return indexType(k)
+		case len(k) > 2*common.HashLength+common.IncarnationLength:
+			// Composite storage key and the encoded timestamp, the full history
+			return "record, " + incarnationType(k[common.HashLength:])
+		}
+	default:
+		return ""
+	}
+	return "other"
+}
+
+func incarnationType(k []byte) string {
+	return fmt.Sprintf("incarnation %d", dbutils.DecodeIncarnation(k[:common.IncarnationLength]))
+}
+
+// indexType tells the last chunk of the history index, kept under the block number 0xffffffffffffffff, from the other ones
+func indexType(k []byte) string {
+	if bytes.Equal(k[len(k)-8:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}) {
+		return "index, last chunk"
+	}
+	return "index"
+}
+
+// InspectDatabase walks the buckets and collects the statistics of their keys and values.
+// Only the keys and the sizes of the values are read, so that it can run against the remote database of a live node
+func InspectDatabase(ctx context.Context, db KV, buckets [][]byte) ([]*BucketStats, error) {
+	stats := make([]*BucketStats, 0, len(buckets))
+	for _, bucket := range buckets {
+		start := time.Now()
+		s := &BucketStats{Bucket: string(bucket)}
+		// Every bucket is read in its own transaction, not to keep the database from reusing the freed pages for too long
+		if err := db.View(ctx, func(tx Tx) error {
+			return tx.Bucket(bucket).Cursor().NoValues().Walk(func(k []byte, vSize uint32) (bool, error) {
+				s.add(bucket, k, vSize)
+				return true, nil
+			})
+		}); err != nil {
+			return nil, fmt.Errorf("could not inspect bucket %s: %w", bucket, err)
+		}
+		log.Info("Inspected bucket", "bucket", string(bucket), "keys", s.Keys, "size", common.StorageSize(s.KeySize+s.ValueSize), "elapsed", time.Since(start))
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
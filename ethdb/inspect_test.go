@@ -0,0 +1,89 @@
+package ethdb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+func TestInspectDatabase(t *testing.T) {
+	db := NewMemDatabase()
+	defer db.Close()
+
+	addrHash := common.HexToHash("0xaa")
+	puts := []struct {
+		bucket, key, value []byte
+	}{
+		{dbutils.CurrentStateBucket, addrHash[:], []byte{1, 2, 3}},
+		{dbutils.CurrentStateBucket, common.HexToHash("0xbb").Bytes(), []byte{1}},
+		{dbutils.CurrentStateBucket, dbutils.GenerateCompositeStorageKey(addrHash, 1, common.HexToHash("0x01")), []byte{1}},
+		{dbutils.CurrentStateBucket, dbutils.GenerateCompositeStorageKey(addrHash, 2, common.HexToHash("0x01")), []byte{2}},
+		{dbutils.CurrentStateBucket, dbutils.GenerateCompositeStorageKey(addrHash, 2, common.HexToHash("0x02")), []byte{3}},
+		{dbutils.AccountsHistoryBucket, dbutils.IndexChunkKey(addrHash[:], 100), make([]byte, 16)},
+		{dbutils.AccountsHistoryBucket, dbutils.IndexChunkKey(addrHash[:], ^uint64(0)), make([]byte, 16)},
+		{dbutils.CodeBucket, common.HexToHash("0xcc").Bytes(), make([]byte, 1000)},
+	}
+	for _, p := range puts {
+		if err := db.Put(p.bucket, p.key, p.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := InspectDatabase(context.Background(), db.AbstractKV(), [][]byte{dbutils.CurrentStateBucket, dbutils.AccountsHistoryBucket, dbutils.CodeBucket, dbutils.SendersPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 4 {
+		t.Fatalf("expected 4 buckets, got %d", len(stats))
+	}
+
+	state := stats[0]
+	if expected := (KeyStats{Keys: 5, KeySize: 2*32 + 3*72, ValueSize: 7}); state.KeyStats != expected {
+		t.Errorf("state: expected %+v, got %+v", expected, state.KeyStats)
+	}
+	for kind, expected := range map[string]KeyStats{
+		"account":                {Keys: 2, KeySize: 64, ValueSize: 4},
+		"storage, incarnation 1": {Keys: 1, KeySize: 72, ValueSize: 1},
+		"storage, incarnation 2": {Keys: 2, KeySize: 144, ValueSize: 2},
+	} {
+		if got := state.KeyTypes[kind]; got == nil || *got != expected {
+			t.Errorf("state, %s: expected %+v, got %+v", kind, expected, got)
+		}
+	}
+	if len(state.KeyTypes) != 3 {
+		t.Errorf("state: unexpected key types %v", state.KeyTypes)
+	}
+	// The keys of 32 bytes are in the bin 6 (32-63), the keys of 72 bytes are in the bin 7 (64-127)
+	if state.KeySizes[6] != 2 || state.KeySizes[7] != 3 {
+		t.Errorf("state: unexpected key sizes %v", state.KeySizes.Bins())
+	}
+
+	history := stats[1]
+	for _, kind := range []string{"index", "index, last chunk"} {
+		if got := history.KeyTypes[kind]; got == nil || got.Keys != 1 {
+			t.Errorf("history, %s: expected 1 key, got %+v", kind, got)
+		}
+	}
+
+	code := stats[2]
+	if code.KeyTypes != nil {
+		t.Errorf("code: unexpected key types %v", code.KeyTypes)
+	}
+	if min, max := SizeHistogramRange(10); code.ValueSizes[10] != 1 || min != 512 || max != 1023 {
+		t.Errorf("code: unexpected value sizes %v", code.ValueSizes.Bins())
+	}
+	if stats[3].Keys != 0 {
+		t.Errorf("senders: expected no keys, got %d", stats[3].Keys)
+	}
+
+	enc, err := json.Marshal(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"bucket":"CODE","keys":1,"keySize":32,"valueSize":1000,"keySizes":[{"min":32,"max":63,"count":1}],"valueSizes":[{"min":512,"max":1023,"count":1}]}`; string(enc) != expected {
+		t.Errorf("code: expected JSON %s, got %s", expected, enc)
+	}
+}
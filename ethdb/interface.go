@@ -96,14 +96,35 @@ type Database interface {
 
 	// MemCopy creates a copy of the database in memory.
 	MemCopy() Database
-	// [TURBO-GETH] Freezer support (minimum amount that is actually used)
-	// FIXME: implement support if needed
+	// Ancients returns the number of the blocks in the freezer, see NewDatabaseWithFreezer
 	Ancients() (uint64, error)
+	// TruncateAncients discards the frozen blocks starting from the given number
 	TruncateAncients(items uint64) error
 
 	ID() uint64
 }
 
+// AncientReader wraps the reads of the old chain segments moved into the freezer.
+type AncientReader interface {
+	// HasAncient returns an indicator whether the specified data exists in the freezer.
+	HasAncient(kind string, number uint64) (bool, error)
+
+	// Ancient retrieves the data of the block from the freezer table of the kind.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// AncientSize returns the size of the freezer table of the kind.
+	AncientSize(kind string) (uint64, error)
+}
+
+// AncientWriter wraps the writes of the old chain segments into the freezer.
+type AncientWriter interface {
+	// AppendAncient appends the data of the block to the freezer, the blocks are appended in order.
+	AppendAncient(number uint64, hash, header, body, receipts, td []byte) error
+
+	// Sync flushes the freezer to the disk.
+	Sync() error
+}
+
 // MinDatabase is a minimalistic version of the Database interface.
 type MinDatabase interface {
 	Get(bucket, key []byte) ([]byte, error)
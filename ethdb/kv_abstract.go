@@ -28,7 +28,10 @@ type Bucket interface {
 
 type Cursor interface {
 	Prefix(v []byte) Cursor
-	MatchBits(uint) Cursor
+	// MatchBits limits the Prefix filter to the first n bits of the prefix, First still positions
+	// the cursor on the whole prefix. It is the cursor counterpart of the fixedbits argument of Walk,
+	// the bits beyond the prefix are not matched
+	MatchBits(n uint) Cursor
 	Prefetch(v uint) Cursor
 	NoValues() NoValuesCursor
 
@@ -51,4 +54,5 @@ const (
 	Bolt DbProvider = iota
 	Badger
 	Remote
+	Lmdb
 )
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotedbserver"
@@ -22,6 +23,7 @@ func TestManagedTx(t *testing.T) {
 		ethdb.NewBolt().InMem().MustOpen(ctx),
 		ethdb.NewBolt().InMem().MustOpen(ctx), // for remote db
 		ethdb.NewBadger().InMem().MustOpen(ctx),
+		ethdb.NewLmdb().InMem().MustOpen(ctx),
 	}
 
 	serverIn, clientOut := io.Pipe()
@@ -31,6 +33,7 @@ func TestManagedTx(t *testing.T) {
 		writeDBs[0],
 		ethdb.NewRemote().InMem(clientIn, clientOut).MustOpen(ctx),
 		writeDBs[2],
+		writeDBs[3],
 	}
 
 	serverCtx, serverCancel := context.WithCancel(ctx)
@@ -83,7 +86,90 @@ func TestManagedTx(t *testing.T) {
 		t.Run("filter "+msg, func(t *testing.T) {
 			testPrefixFilter(t, db)
 		})
+		t.Run("match bits "+msg, func(t *testing.T) {
+			testMatchBits(t, db)
+		})
 	}
+
+	t.Run("remote update", func(t *testing.T) {
+		testUpdate(t, readDBs[1])
+	})
+	t.Run("remote batch", func(t *testing.T) {
+		testRemoteBatch(t, readDBs[1])
+	})
+}
+
+func testMatchBits(t *testing.T, db ethdb.KV) {
+	require.NoError(t, db.View(context.Background(), func(tx ethdb.Tx) error {
+		b := tx.Bucket(dbutils.CurrentStateBucket)
+		for _, tc := range []struct {
+			prefix []byte
+			bits   uint
+			keys   [][]byte
+		}{
+			{[]byte{0}, 8, [][]byte{{0}, {0, 0, 1}, {0, 1}}},
+			{[]byte{0, 1}, 8, [][]byte{{0, 1}}},
+			{[]byte{4}, 5, [][]byte{{4}, {5}, {6}, {7}}},
+			{[]byte{4}, 0, [][]byte{{4}, {5}, {6}, {7}, {8}, {9}}},
+			// The bits beyond the prefix are not matched
+			{[]byte{0, 1}, 24, [][]byte{{0, 1}}},
+			{[]byte{}, 8, [][]byte{{0}, {0, 0, 1}, {0, 1}, {1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}, {9}}},
+		} {
+			var keys [][]byte
+			c := b.Cursor().Prefix(tc.prefix).MatchBits(tc.bits).Prefetch(2)
+			for k, _, err := c.First(); k != nil || err != nil; k, _, err = c.Next() {
+				require.NoError(t, err)
+				keys = append(keys, common.CopyBytes(k))
+			}
+			require.Equal(t, tc.keys, keys, "prefix %x, bits %d", tc.prefix, tc.bits)
+
+			keys = keys[:0]
+			require.NoError(t, b.Cursor().Prefix(tc.prefix).MatchBits(tc.bits).NoValues().Walk(func(k []byte, _ uint32) (bool, error) {
+				keys = append(keys, common.CopyBytes(k))
+				return true, nil
+			}))
+			require.Equal(t, tc.keys, keys, "prefix %x, bits %d", tc.prefix, tc.bits)
+		}
+
+		k, _, err := b.Cursor().Prefix([]byte{4}).MatchBits(5).Seek([]byte{8})
+		require.NoError(t, err)
+		require.Nil(t, k)
+		return nil
+	}))
+}
+
+func testUpdate(t *testing.T, db ethdb.KV) {
+	ctx := context.Background()
+	require.NoError(t, db.Update(ctx, func(tx ethdb.Tx) error {
+		b := tx.Bucket(dbutils.AccountsHistoryBucket)
+		if err := b.Put([]byte{1}, []byte{1}); err != nil {
+			return err
+		}
+		if err := b.Put([]byte{2}, []byte{2}); err != nil {
+			return err
+		}
+		return b.Delete([]byte{1})
+	}))
+	// Failed transaction is rolled back
+	require.Error(t, db.Update(ctx, func(tx ethdb.Tx) error {
+		if err := tx.Bucket(dbutils.AccountsHistoryBucket).Put([]byte{3}, []byte{3}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	}))
+
+	require.NoError(t, db.View(ctx, func(tx ethdb.Tx) error {
+		b := tx.Bucket(dbutils.AccountsHistoryBucket)
+		for _, k := range [][]byte{{1}, {3}} {
+			v, err := b.Get(k)
+			require.NoError(t, err)
+			require.Nil(t, v)
+		}
+		v, err := b.Get([]byte{2})
+		require.NoError(t, err)
+		require.Equal(t, []byte{2}, v)
+		return nil
+	}))
 }
 
 func testPrefixFilter(t *testing.T, db ethdb.KV) {
@@ -222,3 +308,24 @@ func testNoValuesIterator(t *testing.T, db ethdb.KV) {
 		assert.NoError(err)
 	}
 }
+
+func testRemoteBatch(t *testing.T, kv ethdb.KV) {
+	db := ethdb.NewRemoteBoltDatabase(kv)
+	require.NoError(t, db.Put(dbutils.StorageHistoryBucket, []byte{1}, []byte{1}))
+	require.NoError(t, db.Put(dbutils.StorageHistoryBucket, []byte{2}, []byte{2}))
+	require.NoError(t, db.Delete(dbutils.StorageHistoryBucket, []byte{2}))
+
+	batch := db.NewBatch()
+	require.NoError(t, batch.Put(dbutils.StorageHistoryBucket, []byte{3}, []byte{3}))
+	require.NoError(t, batch.Delete(dbutils.StorageHistoryBucket, []byte{1}))
+	_, err := batch.Commit()
+	require.NoError(t, err)
+
+	for _, k := range [][]byte{{1}, {2}} {
+		_, err = db.Get(dbutils.StorageHistoryBucket, k)
+		require.Equal(t, ethdb.ErrKeyNotFound, err)
+	}
+	v, err := db.Get(dbutils.StorageHistoryBucket, []byte{3})
+	require.NoError(t, err)
+	require.Equal(t, []byte{3}, v)
+}
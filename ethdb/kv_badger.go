@@ -122,6 +122,9 @@ type badgerCursor struct {
 	bucket badgerBucket
 	prefix []byte
 
+	matchBytes int  // Length of the prefix with the bucket name the keys are compared with
+	mask       byte // Mask of the last compared byte, the whole bytes are compared by badger itself
+
 	badgerOpts badger.IteratorOptions
 
 	badger *badger.Iterator
@@ -150,8 +153,11 @@ func (db *badgerDB) Update(ctx context.Context, f func(tx Tx) error) (err error)
 }
 
 func (tx *badgerTx) Bucket(name []byte) Bucket {
-	b := badgerBucket{tx: tx, nameLen: uint(len(name))}
-	b.prefix = name
+	// keys are prefixed by the bucket name and the separator, same as in BadgerDatabase
+	b := badgerBucket{tx: tx, nameLen: uint(len(name)) + 1}
+	b.prefix = make([]byte, b.nameLen)
+	copy(b.prefix, name)
+	b.prefix[len(name)] = bucketSeparator
 	return b
 }
 
@@ -175,11 +181,26 @@ func (tx *badgerTx) cleanup() {
 func (c *badgerCursor) Prefix(v []byte) Cursor {
 	c.prefix = append(c.bucket.prefix[:c.bucket.nameLen], v...)
 	c.badgerOpts.Prefix = c.prefix
+	c.matchBytes, c.mask = len(c.prefix), 0xff
 	return c
 }
 
 func (c *badgerCursor) MatchBits(n uint) Cursor {
-	panic("not implemented yet")
+	fixedbytes, mask := prefixBytesmask(c.prefix[c.bucket.nameLen:], n)
+	c.matchBytes, c.mask = int(c.bucket.nameLen)+fixedbytes, mask
+	if mask == 0xff {
+		c.badgerOpts.Prefix = c.prefix[:c.matchBytes]
+	} else {
+		c.badgerOpts.Prefix = c.prefix[:c.matchBytes-1]
+	}
+	return c
+}
+
+func (c *badgerCursor) matchKey(k []byte) bool {
+	if c.mask == 0xff {
+		return true
+	}
+	return len(k) >= c.matchBytes && k[c.matchBytes-1]&c.mask == c.prefix[c.matchBytes-1]&c.mask
 }
 
 func (c *badgerCursor) Prefetch(v uint) Cursor {
@@ -202,6 +223,10 @@ func (b badgerBucket) Get(key []byte) (val []byte, err error) {
 	var item *badger.Item
 	b.prefix = append(b.prefix[:b.nameLen], key...)
 	item, err = b.tx.badger.Get(b.prefix)
+	if err == badger.ErrKeyNotFound {
+		// Missing keys are not an error, same as in the other backends
+		return nil, nil
+	}
 	if item != nil {
 		val, err = item.ValueCopy(nil) // can improve this by using pool
 	}
@@ -234,6 +259,7 @@ func (b badgerBucket) Cursor() Cursor {
 	c := &badgerCursor{bucket: b, ctx: b.tx.ctx, badgerOpts: badger.DefaultIteratorOptions}
 	c.prefix = append(c.prefix, b.prefix[:b.nameLen]...) // set bucket
 	c.badgerOpts.Prefix = c.prefix
+	c.matchBytes, c.mask = len(c.prefix), 0xff
 	return c
 }
 
@@ -257,8 +283,8 @@ func (c *badgerCursor) initCursor() {
 func (c *badgerCursor) First() ([]byte, []byte, error) {
 	c.initCursor()
 
-	c.badger.Rewind()
-	if !c.badger.Valid() {
+	c.badger.Seek(c.prefix)
+	if !c.badger.Valid() || !c.matchKey(c.badger.Item().Key()) {
 		c.k = nil
 		return c.k, c.v, c.err
 	}
@@ -280,7 +306,7 @@ func (c *badgerCursor) Seek(seek []byte) ([]byte, []byte, error) {
 	c.initCursor()
 
 	c.badger.Seek(append(c.bucket.prefix[:c.bucket.nameLen], seek...))
-	if !c.badger.Valid() {
+	if !c.badger.Valid() || !c.matchKey(c.badger.Item().Key()) {
 		c.k = nil
 		return c.k, c.v, c.err
 	}
@@ -300,7 +326,7 @@ func (c *badgerCursor) Next() ([]byte, []byte, error) {
 	}
 
 	c.badger.Next()
-	if !c.badger.Valid() {
+	if !c.badger.Valid() || !c.matchKey(c.badger.Item().Key()) {
 		c.k = nil
 		return c.k, c.v, c.err
 	}
@@ -351,8 +377,8 @@ func (c *badgerNoValuesCursor) Walk(walker func(k []byte, vSize uint32) (bool, e
 
 func (c *badgerNoValuesCursor) First() ([]byte, uint32, error) {
 	c.initCursor()
-	c.badger.Rewind()
-	if !c.badger.Valid() {
+	c.badger.Seek(c.prefix)
+	if !c.badger.Valid() || !c.matchKey(c.badger.Item().Key()) {
 		c.k = nil
 		return c.k, 0, c.err
 	}
@@ -371,7 +397,7 @@ func (c *badgerNoValuesCursor) Seek(seek []byte) ([]byte, uint32, error) {
 	c.initCursor()
 
 	c.badger.Seek(append(c.bucket.prefix[:c.bucket.nameLen], seek...))
-	if !c.badger.Valid() {
+	if !c.badger.Valid() || !c.matchKey(c.badger.Item().Key()) {
 		c.k = nil
 		return c.k, 0, c.err
 	}
@@ -389,7 +415,7 @@ func (c *badgerNoValuesCursor) Next() ([]byte, uint32, error) {
 	}
 
 	c.badger.Next()
-	if !c.badger.Valid() {
+	if !c.badger.Valid() || !c.matchKey(c.badger.Item().Key()) {
 		c.k = nil
 		return c.k, 0, c.err
 	}
@@ -38,6 +38,9 @@ type boltCursor struct {
 	bucket boltBucket
 	prefix []byte
 
+	matchBytes int  // Number of the prefix bytes the keys are compared with, 0 - no filter
+	mask       byte // Mask of the last compared byte
+
 	bolt *bolt.Cursor
 
 	k   []byte
@@ -152,11 +155,26 @@ func (tx *boltTx) Bucket(name []byte) Bucket {
 
 func (c *boltCursor) Prefix(v []byte) Cursor {
 	c.prefix = v
+	c.matchBytes, c.mask = len(v), 0xff
 	return c
 }
 
 func (c *boltCursor) MatchBits(n uint) Cursor {
-	panic("not implemented yet")
+	c.matchBytes, c.mask = prefixBytesmask(c.prefix, n)
+	return c
+}
+
+func (c *boltCursor) matchKey(k []byte) bool {
+	if c.matchBytes == 0 {
+		return true
+	}
+	if len(k) < c.matchBytes {
+		return false
+	}
+	if !bytes.Equal(k[:c.matchBytes-1], c.prefix[:c.matchBytes-1]) {
+		return false
+	}
+	return k[c.matchBytes-1]&c.mask == c.prefix[c.matchBytes-1]&c.mask
 }
 
 func (c *boltCursor) Prefetch(v uint) Cursor {
@@ -216,7 +234,7 @@ func (c *boltCursor) First() ([]byte, []byte, error) {
 	}
 
 	c.k, c.v = c.bolt.Seek(c.prefix)
-	if !bytes.HasPrefix(c.k, c.prefix) {
+	if !c.matchKey(c.k) {
 		c.k, c.v = nil, nil
 	}
 	return c.k, c.v, nil
@@ -230,7 +248,7 @@ func (c *boltCursor) Seek(seek []byte) ([]byte, []byte, error) {
 	}
 
 	c.k, c.v = c.bolt.Seek(seek)
-	if len(c.prefix) != 0 && !bytes.HasPrefix(c.k, c.prefix) {
+	if !c.matchKey(c.k) {
 		c.k, c.v = nil, nil
 	}
 	return c.k, c.v, nil
@@ -244,7 +262,7 @@ func (c *boltCursor) Next() ([]byte, []byte, error) {
 	}
 
 	c.k, c.v = c.bolt.Next()
-	if len(c.prefix) != 0 && !bytes.HasPrefix(c.k, c.prefix) {
+	if !c.matchKey(c.k) {
 		return nil, nil, nil
 	}
 	return c.k, c.v, nil
@@ -289,7 +307,7 @@ func (c *noValuesBoltCursor) First() ([]byte, uint32, error) {
 	}
 
 	c.k, c.v = c.bolt.Seek(c.prefix)
-	if !bytes.HasPrefix(c.k, c.prefix) {
+	if !c.matchKey(c.k) {
 		c.k, c.v = nil, nil
 	}
 	return c.k, uint32(len(c.v)), nil
@@ -303,7 +321,7 @@ func (c *noValuesBoltCursor) Seek(seek []byte) ([]byte, uint32, error) {
 	}
 
 	c.k, c.v = c.bolt.Seek(seek)
-	if len(c.prefix) != 0 && !bytes.HasPrefix(c.k, c.prefix) {
+	if !c.matchKey(c.k) {
 		c.k, c.v = nil, nil
 	}
 	return c.k, uint32(len(c.v)), nil
@@ -317,7 +335,7 @@ func (c *noValuesBoltCursor) Next() ([]byte, uint32, error) {
 	}
 
 	c.k, c.v = c.bolt.Next()
-	if len(c.prefix) != 0 && !bytes.HasPrefix(c.k, c.prefix) {
+	if !c.matchKey(c.k) {
 		return nil, 0, nil
 	}
 	return c.k, uint32(len(c.v)), nil
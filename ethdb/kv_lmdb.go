@@ -0,0 +1,431 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// lmdbMapSize is the maximal size of the memory map, the file grows up to it on demand
+const lmdbMapSize = 2 << 40
+
+type lmdbOpts struct {
+	path     string
+	inMem    bool
+	readOnly bool
+}
+
+func (opts lmdbOpts) Path(path string) lmdbOpts {
+	opts.path = path
+	return opts
+}
+
+// InMem opens the database in a temporary directory, which is removed on Close,
+// lmdb has no in-memory mode
+func (opts lmdbOpts) InMem() lmdbOpts {
+	opts.inMem = true
+	return opts
+}
+
+func (opts lmdbOpts) ReadOnly() lmdbOpts {
+	opts.readOnly = true
+	return opts
+}
+
+// Open opens the environment with a named database per bucket. The change sets are stored
+// as one encoded value per block, so none of the buckets is opened with DupSort
+func (opts lmdbOpts) Open(ctx context.Context) (KV, error) {
+	if opts.inMem {
+		dir, err := ioutil.TempDir(os.TempDir(), "lmdb_db_")
+		if err != nil {
+			return nil, err
+		}
+		opts.path = dir
+	} else if err := os.MkdirAll(opts.path, 0744); err != nil {
+		return nil, err
+	}
+
+	env, err := lmdb.NewEnv()
+	if err != nil {
+		return nil, err
+	}
+	if err = env.SetMaxDBs(100); err != nil {
+		return nil, err
+	}
+	if err = env.SetMapSize(lmdbMapSize); err != nil {
+		return nil, err
+	}
+	// NoTLS lets the read transactions move between the goroutines and OS threads
+	var flags uint = lmdb.NoTLS
+	if opts.readOnly {
+		flags |= lmdb.Readonly
+	}
+	if err = env.Open(opts.path, flags, 0644); err != nil {
+		env.Close()
+		return nil, fmt.Errorf("%w, path: %s", err, opts.path)
+	}
+
+	db := &lmdbKV{
+		opts: opts,
+		env:  env,
+		log:  log.New("lmdb_db", opts.path),
+		dbi:  make(map[string]lmdb.DBI, len(dbutils.Buckets)),
+	}
+	openDBIs := func(txn *lmdb.Txn) error {
+		var dbiFlags uint
+		if !opts.readOnly {
+			dbiFlags = lmdb.Create
+		}
+		for _, name := range dbutils.Buckets {
+			dbi, createErr := txn.OpenDBI(string(name), dbiFlags)
+			if createErr != nil {
+				return createErr
+			}
+			db.dbi[string(name)] = dbi
+		}
+		return nil
+	}
+	if opts.readOnly {
+		err = env.View(openDBIs)
+	} else {
+		err = env.Update(openDBIs)
+	}
+	if err != nil {
+		env.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (opts lmdbOpts) MustOpen(ctx context.Context) KV {
+	db, err := opts.Open(ctx)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func NewLmdb() lmdbOpts {
+	return lmdbOpts{}
+}
+
+type lmdbKV struct {
+	opts lmdbOpts
+	env  *lmdb.Env
+	log  log.Logger
+	dbi  map[string]lmdb.DBI // Named databases of the buckets, not modified after Open
+}
+
+type lmdbTx struct {
+	ctx context.Context
+	db  *lmdbKV
+
+	lmdb     *lmdb.Txn
+	writable bool
+	cursors  []*lmdb.Cursor
+}
+
+type lmdbBucket struct {
+	tx *lmdbTx
+
+	dbi     lmdb.DBI
+	nameLen uint
+}
+
+type lmdbCursor struct {
+	ctx    context.Context
+	bucket lmdbBucket
+	prefix []byte
+
+	matchBytes int  // Number of the prefix bytes the keys are compared with, 0 - no filter
+	mask       byte // Mask of the last compared byte
+
+	lmdb *lmdb.Cursor
+
+	k   []byte
+	v   []byte
+	err error
+}
+
+type lmdbNoValuesCursor struct {
+	lmdbCursor
+}
+
+// Close closes lmdbKV
+// All transactions must be closed before closing the database.
+func (db *lmdbKV) Close() {
+	if err := db.env.Close(); err != nil {
+		db.log.Warn("failed to close lmdb DB", "err", err)
+	} else {
+		db.log.Info("lmdb database closed")
+	}
+	if db.opts.inMem {
+		if err := os.RemoveAll(db.opts.path); err != nil {
+			db.log.Warn("failed to remove in-mem lmdb DB", "err", err)
+		}
+	}
+}
+
+// Begin starts the transaction, a writable one locks the goroutine to the OS thread
+// until Commit or Rollback, as lmdb requires
+func (db *lmdbKV) Begin(ctx context.Context, writable bool) (Tx, error) {
+	var flags uint
+	if writable {
+		runtime.LockOSThread()
+	} else {
+		flags = lmdb.Readonly
+	}
+	txn, err := db.env.BeginTxn(nil, flags)
+	if err != nil {
+		if writable {
+			runtime.UnlockOSThread()
+		}
+		return nil, err
+	}
+	txn.RawRead = true
+	return &lmdbTx{db: db, ctx: ctx, lmdb: txn, writable: writable}, nil
+}
+
+func (db *lmdbKV) View(ctx context.Context, f func(tx Tx) error) (err error) {
+	t := &lmdbTx{db: db, ctx: ctx}
+	return db.env.View(func(txn *lmdb.Txn) error {
+		defer t.cleanup()
+		txn.RawRead = true
+		t.lmdb = txn
+		return f(t)
+	})
+}
+
+func (db *lmdbKV) Update(ctx context.Context, f func(tx Tx) error) (err error) {
+	t := &lmdbTx{db: db, ctx: ctx}
+	return db.env.Update(func(txn *lmdb.Txn) error {
+		defer t.cleanup()
+		txn.RawRead = true
+		t.lmdb = txn
+		return f(t)
+	})
+}
+
+func (tx *lmdbTx) Bucket(name []byte) Bucket {
+	dbi, ok := tx.db.dbi[string(name)]
+	if !ok {
+		panic(fmt.Sprintf("unknown bucket: %s, add it to dbutils.Buckets", name))
+	}
+	return lmdbBucket{tx: tx, dbi: dbi, nameLen: uint(len(name))}
+}
+
+func (tx *lmdbTx) Commit(ctx context.Context) error {
+	tx.cleanup()
+	if tx.writable {
+		defer runtime.UnlockOSThread()
+	}
+	return tx.lmdb.Commit()
+}
+
+func (tx *lmdbTx) Rollback() error {
+	tx.cleanup()
+	if tx.writable {
+		defer runtime.UnlockOSThread()
+	}
+	tx.lmdb.Abort()
+	return nil
+}
+
+func (tx *lmdbTx) cleanup() {
+	for _, c := range tx.cursors {
+		c.Close()
+	}
+	tx.cursors = nil
+}
+
+func (c *lmdbCursor) Prefix(v []byte) Cursor {
+	c.prefix = v
+	c.matchBytes, c.mask = len(v), 0xff
+	return c
+}
+
+func (c *lmdbCursor) MatchBits(n uint) Cursor {
+	c.matchBytes, c.mask = prefixBytesmask(c.prefix, n)
+	return c
+}
+
+func (c *lmdbCursor) matchKey(k []byte) bool {
+	if c.matchBytes == 0 {
+		return true
+	}
+	if len(k) < c.matchBytes {
+		return false
+	}
+	if !bytes.Equal(k[:c.matchBytes-1], c.prefix[:c.matchBytes-1]) {
+		return false
+	}
+	return k[c.matchBytes-1]&c.mask == c.prefix[c.matchBytes-1]&c.mask
+}
+
+func (c *lmdbCursor) Prefetch(v uint) Cursor {
+	// nothing to do
+	return c
+}
+
+func (c *lmdbCursor) NoValues() NoValuesCursor {
+	return &lmdbNoValuesCursor{lmdbCursor: *c}
+}
+
+func (b lmdbBucket) Get(key []byte) (val []byte, err error) {
+	select {
+	case <-b.tx.ctx.Done():
+		return nil, b.tx.ctx.Err()
+	default:
+	}
+
+	val, err = b.tx.lmdb.Get(b.dbi, key)
+	if lmdb.IsNotFound(err) {
+		return nil, nil
+	}
+	return val, err
+}
+
+func (b lmdbBucket) Put(key []byte, value []byte) error {
+	select {
+	case <-b.tx.ctx.Done():
+		return b.tx.ctx.Err()
+	default:
+	}
+
+	return b.tx.lmdb.Put(b.dbi, key, value, 0)
+}
+
+func (b lmdbBucket) Delete(key []byte) error {
+	select {
+	case <-b.tx.ctx.Done():
+		return b.tx.ctx.Err()
+	default:
+	}
+
+	err := b.tx.lmdb.Del(b.dbi, key, nil)
+	if lmdb.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (b lmdbBucket) Cursor() Cursor {
+	return &lmdbCursor{bucket: b, ctx: b.tx.ctx}
+}
+
+func (c *lmdbCursor) initCursor() error {
+	if c.lmdb != nil {
+		return nil
+	}
+	var err error
+	c.lmdb, err = c.bucket.tx.lmdb.OpenCursor(c.bucket.dbi)
+	if err != nil {
+		return err
+	}
+	// add to auto-cleanup on end of transactions
+	c.bucket.tx.cursors = append(c.bucket.tx.cursors, c.lmdb)
+	return nil
+}
+
+// get moves the lmdb cursor and filters the key by the prefix, the end of the bucket is not an error
+func (c *lmdbCursor) get(setkey []byte, op uint) ([]byte, []byte, error) {
+	if c.err = c.initCursor(); c.err != nil {
+		return nil, nil, c.err
+	}
+	c.k, c.v, c.err = c.lmdb.Get(setkey, nil, op)
+	if lmdb.IsNotFound(c.err) {
+		c.k, c.v, c.err = nil, nil, nil
+	}
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	if !c.matchKey(c.k) {
+		c.k, c.v = nil, nil
+	}
+	return c.k, c.v, nil
+}
+
+func (c *lmdbCursor) First() ([]byte, []byte, error) {
+	if len(c.prefix) == 0 {
+		return c.get(nil, lmdb.First)
+	}
+	return c.get(c.prefix, lmdb.SetRange)
+}
+
+func (c *lmdbCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	select {
+	case <-c.ctx.Done():
+		return nil, nil, c.ctx.Err()
+	default:
+	}
+
+	if len(seek) == 0 {
+		// lmdb does not accept the empty keys
+		return c.get(nil, lmdb.First)
+	}
+	return c.get(seek, lmdb.SetRange)
+}
+
+func (c *lmdbCursor) Next() ([]byte, []byte, error) {
+	select {
+	case <-c.ctx.Done():
+		return nil, nil, c.ctx.Err()
+	default:
+	}
+
+	return c.get(nil, lmdb.Next)
+}
+
+func (c *lmdbCursor) Walk(walker func(k, v []byte) (bool, error)) error {
+	for k, v, err := c.First(); k != nil || err != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		ok, err := walker(k, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *lmdbNoValuesCursor) Walk(walker func(k []byte, vSize uint32) (bool, error)) error {
+	for k, vSize, err := c.First(); k != nil || err != nil; k, vSize, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		ok, err := walker(k, vSize)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *lmdbNoValuesCursor) First() ([]byte, uint32, error) {
+	k, v, err := c.lmdbCursor.First()
+	return k, uint32(len(v)), err
+}
+
+func (c *lmdbNoValuesCursor) Seek(seek []byte) ([]byte, uint32, error) {
+	k, v, err := c.lmdbCursor.Seek(seek)
+	return k, uint32(len(v)), err
+}
+
+func (c *lmdbNoValuesCursor) Next() ([]byte, uint32, error) {
+	k, v, err := c.lmdbCursor.Next()
+	return k, uint32(len(v)), err
+}
@@ -2,7 +2,7 @@ package ethdb
 
 import (
 	"context"
-	"fmt"
+	"crypto/tls"
 	"io"
 
 	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
@@ -39,6 +39,10 @@ type remoteCursor struct {
 
 	remote *remote.Cursor
 
+	prefix     []byte
+	matchBytes int  // Number of the prefix bytes the keys are compared with
+	mask       byte // Mask of the last compared byte, the whole bytes are compared by the server
+
 	k   []byte
 	v   []byte
 	err error
@@ -57,6 +61,18 @@ func (opts remoteOpts) Path(path string) remoteOpts {
 	return opts
 }
 
+// TLS makes the connections to the server encrypted, see remote.NewClientTLSConfig
+func (opts remoteOpts) TLS(cfg *tls.Config) remoteOpts {
+	opts.Remote = opts.Remote.WithTLS(cfg)
+	return opts
+}
+
+// Token sets the pre-shared token the server expects
+func (opts remoteOpts) Token(token string) remoteOpts {
+	opts.Remote = opts.Remote.WithToken(token)
+	return opts
+}
+
 //
 //
 // Example text code:
@@ -126,16 +142,21 @@ func (db *remoteDB) View(ctx context.Context, f func(tx Tx) error) (err error) {
 	})
 }
 
+// Update performs read-write transaction on the remote database, the server must support protocol version remote.WriteTxVersion
 func (db *remoteDB) Update(ctx context.Context, f func(tx Tx) error) (err error) {
-	return fmt.Errorf("remote db provider doesn't support .Update method")
+	t := &remoteTx{db: db, ctx: ctx}
+	return db.remote.Update(ctx, func(tx *remote.Tx) error {
+		t.remote = tx
+		return f(t)
+	})
 }
 
 func (tx *remoteTx) Commit(ctx context.Context) error {
-	panic("remote db is read-only")
+	panic("remote db doesn't support managed transactions, use Update")
 }
 
 func (tx *remoteTx) Rollback() error {
-	panic("remote db is read-only")
+	panic("remote db doesn't support managed transactions, use Update")
 }
 
 func (tx *remoteTx) Bucket(name []byte) Bucket {
@@ -149,12 +170,41 @@ func (tx *remoteTx) cleanup() {
 }
 
 func (c *remoteCursor) Prefix(v []byte) Cursor {
+	c.prefix = v
+	c.matchBytes, c.mask = len(v), 0xff
 	c.remote = c.remote.Prefix(v)
 	return c
 }
 
+// MatchBits sends the whole matched bytes of the prefix to the server, the rest of the bits are matched here
 func (c *remoteCursor) MatchBits(n uint) Cursor {
-	panic("not implemented yet")
+	c.matchBytes, c.mask = prefixBytesmask(c.prefix, n)
+	if c.mask == 0xff {
+		c.remote = c.remote.Prefix(c.prefix[:c.matchBytes])
+	} else {
+		c.remote = c.remote.Prefix(c.prefix[:c.matchBytes-1])
+	}
+	return c
+}
+
+func (c *remoteCursor) matchKey(k []byte) bool {
+	if c.mask == 0xff {
+		return true
+	}
+	return len(k) >= c.matchBytes && k[c.matchBytes-1]&c.mask == c.prefix[c.matchBytes-1]&c.mask
+}
+
+// partialPrefix tells if the server only knows a part of the prefix, then First has to seek the whole one
+func (c *remoteCursor) partialPrefix() bool {
+	return c.matchBytes < len(c.prefix) || c.mask != 0xff
+}
+
+// filter drops the key which does not match the bits, the keys after it do not match either
+func (c *remoteCursor) filter() ([]byte, []byte, error) {
+	if c.k != nil && !c.matchKey(c.k) {
+		c.k, c.v = nil, nil
+	}
+	return c.k, c.v, c.err
 }
 
 func (c *remoteCursor) Prefetch(v uint) Cursor {
@@ -173,31 +223,35 @@ func (b remoteBucket) Get(key []byte) (val []byte, err error) {
 }
 
 func (b remoteBucket) Put(key []byte, value []byte) error {
-	panic("not supported")
+	return b.remote.Put(key, value)
 }
 
 func (b remoteBucket) Delete(key []byte) error {
-	panic("not supported")
+	return b.remote.Delete(key)
 }
 
 func (b remoteBucket) Cursor() Cursor {
-	c := &remoteCursor{bucket: b, ctx: b.tx.ctx, remote: b.remote.Cursor()}
+	c := &remoteCursor{bucket: b, ctx: b.tx.ctx, remote: b.remote.Cursor(), mask: 0xff}
 	return c
 }
 
 func (c *remoteCursor) First() ([]byte, []byte, error) {
-	c.k, c.v, c.err = c.remote.First()
-	return c.k, c.v, c.err
+	if c.partialPrefix() {
+		c.k, c.v, c.err = c.remote.Seek(c.prefix)
+	} else {
+		c.k, c.v, c.err = c.remote.First()
+	}
+	return c.filter()
 }
 
 func (c *remoteCursor) Seek(seek []byte) ([]byte, []byte, error) {
 	c.k, c.v, c.err = c.remote.Seek(seek)
-	return c.k, c.v, c.err
+	return c.filter()
 }
 
 func (c *remoteCursor) Next() ([]byte, []byte, error) {
 	c.k, c.v, c.err = c.remote.Next()
-	return c.k, c.v, c.err
+	return c.filter()
 }
 
 func (c *remoteCursor) Walk(walker func(k, v []byte) (bool, error)) error {
@@ -234,18 +288,29 @@ func (c *remoteNoValuesCursor) Walk(walker func(k []byte, vSize uint32) (bool, e
 
 func (c *remoteNoValuesCursor) First() ([]byte, uint32, error) {
 	var vSize uint32
-	c.k, vSize, c.err = c.remote.FirstKey()
-	return c.k, vSize, c.err
+	if c.partialPrefix() {
+		c.k, vSize, c.err = c.remote.SeekKey(c.prefix)
+	} else {
+		c.k, vSize, c.err = c.remote.FirstKey()
+	}
+	return c.filter(vSize)
 }
 
 func (c *remoteNoValuesCursor) Seek(seek []byte) ([]byte, uint32, error) {
 	var vSize uint32
 	c.k, vSize, c.err = c.remote.SeekKey(seek)
-	return c.k, vSize, c.err
+	return c.filter(vSize)
 }
 
 func (c *remoteNoValuesCursor) Next() ([]byte, uint32, error) {
 	var vSize uint32
 	c.k, vSize, c.err = c.remote.NextKey()
+	return c.filter(vSize)
+}
+
+func (c *remoteNoValuesCursor) filter(vSize uint32) ([]byte, uint32, error) {
+	if c.k != nil && !c.matchKey(c.k) {
+		c.k, vSize = nil, 0
+	}
 	return c.k, vSize, c.err
 }
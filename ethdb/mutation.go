@@ -119,21 +119,51 @@ func (m *mutation) GetAsOf(bucket, hBucket, key []byte, timestamp uint64) ([]byt
 	return m.db.GetAsOf(bucket, hBucket, key, timestamp)
 }
 
-// WARNING: Merged mem/DB walk is not implemented
+// Walk walks over the keys of the database merged with the pending writes, the pending writes win
 func (m *mutation) Walk(bucket, startkey []byte, fixedbits uint, walker func([]byte, []byte) (bool, error)) error {
 	m.panicOnEmptyDB()
-	return m.db.Walk(bucket, startkey, fixedbits, walker)
+	mem := m.memEntries(bucket, [][]byte{startkey}, []uint{fixedbits})
+	return mergeWalk(mem, func(w func(int, []byte, []byte) (bool, error)) error {
+		return m.db.Walk(bucket, startkey, fixedbits, func(k, v []byte) (bool, error) {
+			return w(0, k, v)
+		})
+	}, func(_ int, k, v []byte) (bool, error) {
+		return walker(k, v)
+	})
 }
 
-// WARNING: Merged mem/DB walk is not implemented
+// MultiWalk walks over the ranges of the database merged with the pending writes, the empty values are skipped
 func (m *mutation) MultiWalk(bucket []byte, startkeys [][]byte, fixedbits []uint, walker func(int, []byte, []byte) error) error {
 	m.panicOnEmptyDB()
-	return m.db.MultiWalk(bucket, startkeys, fixedbits, walker)
+	mem := m.memEntries(bucket, startkeys, fixedbits)
+	return mergeWalk(mem, func(w func(int, []byte, []byte) (bool, error)) error {
+		return m.db.MultiWalk(bucket, startkeys, fixedbits, func(rangeIdx int, k, v []byte) error {
+			_, err := w(rangeIdx, k, v)
+			return err
+		})
+	}, func(rangeIdx int, k, v []byte) (bool, error) {
+		if len(v) == 0 {
+			return true, nil
+		}
+		return true, walker(rangeIdx, k, v)
+	})
 }
 
+// WalkAsOf walks over the state as of the timestamp, taking into account the pending writes
+// to the current state and the pending change sets
 func (m *mutation) WalkAsOf(bucket, hBucket, startkey []byte, fixedbits uint, timestamp uint64, walker func([]byte, []byte) (bool, error)) error {
 	m.panicOnEmptyDB()
-	return m.db.WalkAsOf(bucket, hBucket, startkey, fixedbits, timestamp, walker)
+	mem, err := m.memEntriesAsOf(hBucket, startkey, fixedbits, timestamp)
+	if err != nil {
+		return err
+	}
+	return mergeWalk(mem, func(w func(int, []byte, []byte) (bool, error)) error {
+		return m.db.WalkAsOf(bucket, hBucket, startkey, fixedbits, timestamp, func(k, v []byte) (bool, error) {
+			return w(0, k, v)
+		})
+	}, func(_ int, k, v []byte) (bool, error) {
+		return walker(k, v)
+	})
 }
 
 func (m *mutation) RewindData(timestampSrc, timestampDst uint64) (map[string][]byte, map[string][]byte, error) {
@@ -223,15 +253,44 @@ func (m *mutation) ID() uint64 {
 	return m.db.ID()
 }
 
-// [TURBO-GETH] Freezer support (not implemented yet)
-// Ancients returns an error as we don't have a backing chain freezer.
+// Ancients returns the number of the frozen blocks of the underlying database
 func (m *mutation) Ancients() (uint64, error) {
-	return 0, errNotSupported
+	if m.db == nil {
+		return 0, errNotSupported
+	}
+	return m.db.Ancients()
 }
 
-// TruncateAncients returns an error as we don't have a backing chain freezer.
+// TruncateAncients discards the frozen blocks of the underlying database, it is not deferred until Commit
 func (m *mutation) TruncateAncients(items uint64) error {
-	return errNotSupported
+	if m.db == nil {
+		return errNotSupported
+	}
+	return m.db.TruncateAncients(items)
+}
+
+// HasAncient checks the freezer of the underlying database, the ancient data is never pending
+func (m *mutation) HasAncient(kind string, number uint64) (bool, error) {
+	if reader, ok := m.db.(AncientReader); ok {
+		return reader.HasAncient(kind, number)
+	}
+	return false, errNotSupported
+}
+
+// Ancient reads from the freezer of the underlying database
+func (m *mutation) Ancient(kind string, number uint64) ([]byte, error) {
+	if reader, ok := m.db.(AncientReader); ok {
+		return reader.Ancient(kind, number)
+	}
+	return nil, errNotSupported
+}
+
+// AncientSize returns the size of the freezer table of the underlying database
+func (m *mutation) AncientSize(kind string) (uint64, error) {
+	if reader, ok := m.db.(AncientReader); ok {
+		return reader.AncientSize(kind)
+	}
+	return 0, errNotSupported
 }
 
 func NewRWDecorator(db Database) *RWCounterDecorator {
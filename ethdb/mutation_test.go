@@ -0,0 +1,300 @@
+package ethdb
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"testing/quick"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+var mutationTestBucket = []byte("test")
+
+// randomKey returns a short key made of few distinct bytes, so that the keys often collide
+func randomKey(r *rand.Rand, maxLen int) []byte {
+	alphabet := []byte{0x00, 0x01, 0x10, 0xff}
+	k := make([]byte, 1+r.Intn(maxLen))
+	for i := range k {
+		k[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return k
+}
+
+// randomWrites applies the same random puts and deletes to all of the databases
+func randomWrites(r *rand.Rand, n int, dbs ...Database) error {
+	for i := 0; i < n; i++ {
+		k := randomKey(r, 3)
+		v := []byte{byte(r.Intn(256)), byte(i)}
+		del := r.Intn(3) == 0
+		for _, db := range dbs {
+			var err error
+			if del {
+				err = db.Delete(mutationTestBucket, k)
+			} else {
+				err = db.Put(mutationTestBucket, k, v)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func collectWalk(db Getter, startkey []byte, fixedbits uint, limit int) ([]string, error) {
+	var res []string
+	err := db.Walk(mutationTestBucket, startkey, fixedbits, func(k, v []byte) (bool, error) {
+		res = append(res, fmt.Sprintf("%x:%x", k, v))
+		return limit == 0 || len(res) < limit, nil
+	})
+	return res, err
+}
+
+func collectMultiWalk(db Getter, startkeys [][]byte, fixedbits []uint) ([]string, error) {
+	var res []string
+	err := db.MultiWalk(mutationTestBucket, startkeys, fixedbits, func(i int, k, v []byte) error {
+		res = append(res, fmt.Sprintf("%d:%x:%x", i, k, v))
+		return nil
+	})
+	return res, err
+}
+
+// The walks over a mutation see the same as the walks over a database the writes of the mutation are applied to
+func TestMutationWalk(t *testing.T) {
+	check := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		db := NewMemDatabase()
+		defer db.Close()
+		expected := NewMemDatabase()
+		defer expected.Close()
+
+		if err := randomWrites(r, r.Intn(30), db, expected); err != nil {
+			t.Fatal(err)
+		}
+		batch := db.NewBatch()
+		if r.Intn(2) == 0 {
+			// Nested mutation
+			if err := randomWrites(r, r.Intn(20), batch, expected); err != nil {
+				t.Fatal(err)
+			}
+			batch = batch.NewBatch()
+		}
+		if err := randomWrites(r, r.Intn(20), batch, expected); err != nil {
+			t.Fatal(err)
+		}
+
+		startkey := []byte{}
+		if r.Intn(4) > 0 {
+			startkey = randomKey(r, 2)
+		}
+		fixedbits := uint(r.Intn(8*len(startkey) + 1))
+		limit := r.Intn(5)
+		got, err := collectWalk(batch, startkey, fixedbits, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := collectWalk(expected, startkey, fixedbits, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Logf("Walk from %x, fixedbits %d, limit %d:\n got %v\nwant %v", startkey, fixedbits, limit, got, want)
+			return false
+		}
+
+		var startkeys [][]byte
+		var fixedbitsList []uint
+		for b := 0; b < 256; b++ {
+			if r.Intn(64) == 0 {
+				startkeys = append(startkeys, []byte{byte(b)})
+				fixedbitsList = append(fixedbitsList, 8)
+			}
+		}
+		if len(startkeys) == 0 {
+			return true
+		}
+		got, err = collectMultiWalk(batch, startkeys, fixedbitsList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err = collectMultiWalk(expected, startkeys, fixedbitsList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Logf("MultiWalk from %x:\n got %v\nwant %v", startkeys, got, want)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(check, &quick.Config{MaxCount: 200}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeAccountsHistory writes the blocks changing the accounts, the way the state writer does it:
+// the change sets, the history index and the current state
+func writeAccountsHistory(db Database, blocks []map[common.Hash][]byte, fromBlock uint64, indices map[common.Hash]dbutils.HistoryIndexBytes) error {
+	for i, changes := range blocks {
+		blockNr := fromBlock + uint64(i)
+		cs := changeset.NewAccountChangeSet()
+		for addrHash, value := range changes {
+			prev, err := db.Get(dbutils.CurrentStateBucket, addrHash[:])
+			if err != nil && err != ErrKeyNotFound {
+				return err
+			}
+			if err := cs.Add(common.CopyBytes(addrHash[:]), common.CopyBytes(prev)); err != nil {
+				return err
+			}
+			index, ok := indices[addrHash]
+			if !ok {
+				index = dbutils.NewHistoryIndex()
+			}
+			indices[addrHash] = index.Append(blockNr, len(prev) == 0)
+			if err := db.Put(dbutils.AccountsHistoryBucket, dbutils.IndexChunkKey(addrHash[:], ^uint64(0)), common.CopyBytes(indices[addrHash])); err != nil {
+				return err
+			}
+			if len(value) == 0 {
+				err = db.Delete(dbutils.CurrentStateBucket, addrHash[:])
+			} else {
+				err = db.Put(dbutils.CurrentStateBucket, common.CopyBytes(addrHash[:]), value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		enc, err := changeset.EncodeAccounts(cs)
+		if err != nil {
+			return err
+		}
+		if err := db.Put(dbutils.AccountChangeSetBucket, dbutils.EncodeTimestamp(blockNr), enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkAsOf over a mutation with the pending blocks sees the same as over a database the blocks are committed to
+func TestMutationWalkAsOf(t *testing.T) {
+	check := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		addrHashes := make([]common.Hash, 1+r.Intn(8))
+		for i := range addrHashes {
+			addrHashes[i] = common.BytesToHash(randomKey(r, 2))
+		}
+		blocks := make([]map[common.Hash][]byte, 2+r.Intn(6))
+		for i := range blocks {
+			blocks[i] = make(map[common.Hash][]byte)
+			for _, addrHash := range addrHashes {
+				if r.Intn(2) == 0 {
+					continue
+				}
+				if r.Intn(4) == 0 {
+					blocks[i][addrHash] = []byte{}
+				} else {
+					blocks[i][addrHash] = []byte{byte(i), byte(r.Intn(256))}
+				}
+			}
+		}
+		committed := 1 + r.Intn(len(blocks)-1)
+
+		db := NewMemDatabase()
+		defer db.Close()
+		expected := NewMemDatabase()
+		defer expected.Close()
+		if err := writeAccountsHistory(expected, blocks, 1, make(map[common.Hash]dbutils.HistoryIndexBytes)); err != nil {
+			t.Fatal(err)
+		}
+		indices := make(map[common.Hash]dbutils.HistoryIndexBytes)
+		if err := writeAccountsHistory(db, blocks[:committed], 1, indices); err != nil {
+			t.Fatal(err)
+		}
+		batch := db.NewBatch()
+		if err := writeAccountsHistory(batch, blocks[committed:], uint64(committed+1), indices); err != nil {
+			t.Fatal(err)
+		}
+
+		walk := func(db Getter, timestamp uint64) []string {
+			var res []string
+			if err := db.WalkAsOf(dbutils.CurrentStateBucket, dbutils.AccountsHistoryBucket, nil, 0, timestamp, func(k, v []byte) (bool, error) {
+				res = append(res, fmt.Sprintf("%x:%x", k, v))
+				return true, nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			return res
+		}
+		for timestamp := uint64(1); timestamp <= uint64(len(blocks)+1); timestamp++ {
+			got, want := walk(batch, timestamp), walk(expected, timestamp)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Logf("WalkAsOf %d, %d blocks committed:\n got %v\nwant %v", timestamp, committed, got, want)
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(check, &quick.Config{MaxCount: 100}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutationWalkAsOfStorage(t *testing.T) {
+	db := NewMemDatabase()
+	defer db.Close()
+	contractHash := common.HexToHash("0xcc")
+	keys := []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")}
+	// Block 1 sets the items 1 and 2, block 2 (pending) changes the item 1, deletes the item 2 and sets the item 3
+	values := [][][]byte{{{}, {}, {}}, {{1}, {2}, {}}, {{3}, {}, {4}}}
+	batch := db.NewBatch()
+	for blockNr := 1; blockNr < len(values); blockNr++ {
+		w := Database(db)
+		if blockNr == 2 {
+			w = batch
+		}
+		cs := changeset.NewStorageChangeSet()
+		for i, keyHash := range keys {
+			if bytes.Equal(values[blockNr-1][i], values[blockNr][i]) {
+				continue
+			}
+			storageKey := dbutils.GenerateCompositeStorageKey(contractHash, 1, keyHash)
+			if err := cs.Add(storageKey, values[blockNr-1][i]); err != nil {
+				t.Fatal(err)
+			}
+			var err error
+			if len(values[blockNr][i]) == 0 {
+				err = w.Delete(dbutils.CurrentStateBucket, storageKey)
+			} else {
+				err = w.Put(dbutils.CurrentStateBucket, storageKey, values[blockNr][i])
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		enc, err := changeset.EncodeStorage(cs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Put(dbutils.StorageChangeSetBucket, dbutils.EncodeTimestamp(uint64(blockNr)), enc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for timestamp, expected := range map[uint64][][]byte{2: values[1], 3: values[2]} {
+		storage := make(map[common.Hash][]byte)
+		if err := batch.WalkAsOf(dbutils.CurrentStateBucket, dbutils.StorageHistoryBucket, dbutils.GenerateStoragePrefix(contractHash[:], 1), 8*(common.HashLength+common.IncarnationLength), timestamp, func(k, v []byte) (bool, error) {
+			storage[common.BytesToHash(k[common.HashLength:])] = common.CopyBytes(v)
+			return true, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		for i, keyHash := range keys {
+			if !bytes.Equal(expected[i], storage[keyHash]) {
+				t.Errorf("storage item %x as of %d: expected %x, got %x", keyHash, timestamp, expected[i], storage[keyHash])
+			}
+		}
+	}
+}
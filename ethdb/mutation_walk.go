@@ -0,0 +1,177 @@
+package ethdb
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+// memEntry is a pending write of the mutation, nil value - the key is deleted
+type memEntry struct {
+	key      []byte
+	value    []byte
+	rangeIdx int
+}
+
+// inRange tells whether the key is visited by a walk from the startkey with the fixedbits,
+// that is whether it is not less than the startkey and has the same first fixedbits bits
+func inRange(k, startkey []byte, fixedbits uint) bool {
+	if bytes.Compare(k, startkey) < 0 {
+		return false
+	}
+	if fixedbits == 0 {
+		return true
+	}
+	fixedbytes, mask := Bytesmask(fixedbits)
+	if len(k) < fixedbytes {
+		return false
+	}
+	return bytes.Equal(k[:fixedbytes-1], startkey[:fixedbytes-1]) && (k[fixedbytes-1]&mask) == (startkey[fixedbytes-1]&mask)
+}
+
+func sortMemEntries(entries []memEntry) {
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+}
+
+// memEntries returns the sorted pending writes to the bucket visited by a walk over the ranges,
+// with the index of the first range each of them belongs to
+func (m *mutation) memEntries(bucket []byte, startkeys [][]byte, fixedbits []uint) []memEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	bt, ok := m.puts.mp[string(bucket)]
+	if !ok {
+		return nil
+	}
+	var entries []memEntry
+	for key, value := range bt {
+		k := []byte(key)
+		for i := range startkeys {
+			if inRange(k, startkeys[i], fixedbits[i]) {
+				entries = append(entries, memEntry{key: k, value: value, rangeIdx: i})
+				break
+			}
+		}
+	}
+	sortMemEntries(entries)
+	return entries
+}
+
+// mergeWalk walks over the keys of the database and of the pending writes in the order of the keys.
+// The pending writes win on the equal keys, the deleted keys are skipped. dbWalk walks over the database
+// with the given walker, returning false from the walker stops the walk.
+func mergeWalk(mem []memEntry, dbWalk func(walker func(int, []byte, []byte) (bool, error)) error, walker func(int, []byte, []byte) (bool, error)) error {
+	i := 0
+	stopped := false
+	// emitMem emits the pending writes before the key, all of them if the key is nil
+	emitMem := func(k []byte) (bool, error) {
+		for ; i < len(mem) && (k == nil || bytes.Compare(mem[i].key, k) < 0); i++ {
+			if mem[i].value == nil {
+				continue
+			}
+			goOn, err := walker(mem[i].rangeIdx, mem[i].key, mem[i].value)
+			if err != nil || !goOn {
+				i++
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	if err := dbWalk(func(rangeIdx int, k, v []byte) (bool, error) {
+		if goOn, err := emitMem(k); err != nil || !goOn {
+			stopped = true
+			return false, err
+		}
+		if i < len(mem) && bytes.Equal(mem[i].key, k) {
+			i++
+			if mem[i-1].value == nil {
+				return true, nil
+			}
+			rangeIdx, v = mem[i-1].rangeIdx, mem[i-1].value
+		}
+		goOn, err := walker(rangeIdx, k, v)
+		if !goOn {
+			stopped = true
+		}
+		return goOn, err
+	}); err != nil {
+		return err
+	}
+	if stopped {
+		return nil
+	}
+	_, err := emitMem(nil)
+	return err
+}
+
+// memEntriesAsOf returns the sorted pending values of the keys visited by WalkAsOf, as of the timestamp.
+// The keys of the storage are returned without the incarnation, the way WalkAsOf returns them.
+// The pending change sets are assumed to be for the blocks after the ones in the database, so
+// the values of the keys first changed at the timestamp or later are taken from the database.
+func (m *mutation) memEntriesAsOf(hBucket, startkey []byte, fixedbits uint, timestamp uint64) ([]memEntry, error) {
+	isStorage := bytes.Equal(hBucket, dbutils.StorageHistoryBucket)
+	keyLen := common.HashLength
+	if isStorage {
+		keyLen = common.HashLength + common.IncarnationLength + common.HashLength
+	}
+
+	changeSets := m.memEntries(dbutils.ChangeSetByIndexBucket(hBucket), [][]byte{nil}, []uint{0})
+	changedBefore := make(map[string]struct{})
+	asOf := make(map[string][]byte)
+	for _, cs := range changeSets {
+		if cs.value == nil {
+			continue
+		}
+		block, _ := dbutils.DecodeTimestamp(cs.key)
+		walker := func(k, v []byte) error {
+			if len(k) != keyLen || !inRange(k, startkey, fixedbits) {
+				return nil
+			}
+			if block < timestamp {
+				changedBefore[string(k)] = struct{}{}
+			} else if _, ok := asOf[string(k)]; !ok {
+				asOf[string(k)] = common.CopyBytes(v)
+			}
+			return nil
+		}
+		var err error
+		if isStorage {
+			err = changeset.StorageChangeSetBytes(cs.value).Walk(walker)
+		} else {
+			err = changeset.AccountChangeSetBytes(cs.value).Walk(walker)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []memEntry
+	for _, e := range m.memEntries(dbutils.CurrentStateBucket, [][]byte{startkey}, []uint{fixedbits}) {
+		if len(e.key) != keyLen {
+			continue
+		}
+		_, before := changedBefore[string(e.key)]
+		v, after := asOf[string(e.key)]
+		switch {
+		case before && after:
+			// Changed again at the timestamp or later, the value is in the pending change set
+		case after:
+			// The value as of the timestamp is the one before the first pending change, it is in the database
+			continue
+		default:
+			v = e.value
+		}
+		if len(v) == 0 {
+			v = nil
+		}
+		k := e.key
+		if isStorage {
+			k = append(common.CopyBytes(k[:common.HashLength]), k[common.HashLength+common.IncarnationLength:]...)
+		}
+		entries = append(entries, memEntry{key: k, value: v})
+	}
+	sortMemEntries(entries)
+	return entries, nil
+}
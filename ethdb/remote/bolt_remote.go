@@ -18,10 +18,14 @@ package remote
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/ledgerwatch/turbo-geth/ethdb/codecpool"
@@ -36,7 +40,24 @@ var (
 
 // Version is the current version of the remote db protocol. If the protocol changes in a non backwards compatible way,
 // this constant needs to be increased
-const Version uint64 = 2
+const Version uint64 = 3
+
+// MinVersion is the oldest version of the protocol the client and the server can still talk. Servers older than
+// WriteTxVersion only support read-only transactions, clients older than WriteTxVersion only know CmdVersion
+const MinVersion uint64 = 2
+
+// WriteTxVersion is the version of the protocol in which writable transactions were introduced
+const WriteTxVersion uint64 = 3
+
+// ErrWriteTxNotSupported is returned by Update if the server is too old to support writable transactions
+var ErrWriteTxNotSupported = errors.New("remote db server does not support writable transactions")
+
+// ErrHandshakeRejected is returned by all the operations once the server has rejected the version handshake,
+// for example because of a wrong or missing token. The client does not connect to the server anymore
+var ErrHandshakeRejected = errors.New("remote db server rejected the connection")
+
+// errLegacyServer is returned by the version handshake when the server is older than WriteTxVersion
+var errLegacyServer = errors.New("remote db server does not support CmdNegotiateVersion, falling back to CmdVersion")
 
 // Command is the type of command in the boltdb remote protocol
 type Command uint8
@@ -52,9 +73,12 @@ const (
 )
 
 const (
-	// CmdVersion : version
+	// CmdVersion [token]: version
 	// is sent from client to server to ask about the version of protocol the server supports
 	// it is also to be used to be sent periodically to make sure the connection stays open
+	// If the server is configured with a token, the token must follow the command, and it must
+	// be the first command on the connection. Authentication failure closes the connection
+	// Servers since WriteTxVersion reply with MinVersion, which is the only version older clients accept
 	CmdVersion Command = iota
 	// CmdBeginTx
 	// request starting a new transaction (read-only). It returns transaction's handle (uint64), or 0
@@ -98,6 +122,24 @@ const (
 	// Moves given cursor over the next given number of keys and streams back the (key, valueSize) pairs
 	// Pair with key == nil signifies the end of the stream
 	CmdCursorNextKey
+	// CmdBeginWriteTx
+	// request starting a new writable transaction. The server rolls it back and closes the connection
+	// if the transaction is not finished (by CmdCommitTx or CmdEndTx) within the server's timeout
+	CmdBeginWriteTx
+	// CmdPut (bucketHandle, key, value)
+	// puts the key and value into the given bucket. Only valid within a writable transaction
+	CmdPut
+	// CmdDelete (bucketHandle, key)
+	// deletes the key from the given bucket. Only valid within a writable transaction
+	CmdDelete
+	// CmdCommitTx ()
+	// request the end of the transaction (commit)
+	CmdCommitTx
+	// CmdNegotiateVersion (clientVersion, token): version
+	// is sent by the clients since WriteTxVersion instead of CmdVersion. The server replies with the newest version
+	// of the protocol both sides speak. The token is empty if the client does not have one. Servers older than
+	// WriteTxVersion close the connection on this command, the clients fall back to CmdVersion then
+	CmdNegotiateVersion
 )
 
 const DefaultCursorBatchSize uint = 1
@@ -153,6 +195,8 @@ type DbOpts struct {
 	RetryDialAfter time.Duration
 	PingEvery      time.Duration
 	MaxConnections uint64
+	TLS            *tls.Config // If set, connections to the server are encrypted
+	Token          string      // If set, sent to the server with every version handshake
 }
 
 var DefaultOpts = DbOpts{
@@ -168,7 +212,30 @@ func (opts DbOpts) Addr(v string) DbOpts {
 	return opts
 }
 
-func defaultDialFunc(ctx context.Context, dialAddress string) (in io.Reader, out io.Writer, closer io.Closer, err error) {
+// WithTLS makes the client connect to the server over TLS, see NewClientTLSConfig
+func (opts DbOpts) WithTLS(v *tls.Config) DbOpts {
+	opts.TLS = v
+	return opts
+}
+
+// WithToken sets the pre-shared token the server expects
+func (opts DbOpts) WithToken(v string) DbOpts {
+	opts.Token = v
+	return opts
+}
+
+func defaultDialFunc(ctx context.Context, dialAddress string, tlsConfig *tls.Config) (in io.Reader, out io.Writer, closer io.Closer, err error) {
+	if tlsConfig != nil {
+		dialer := &net.Dialer{}
+		if deadline, ok := ctx.Deadline(); ok {
+			dialer.Deadline = deadline
+		}
+		conn, err := tls.DialWithDialer(dialer, "tcp", dialAddress, tlsConfig)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("could not connect to remoteDb over TLS. addr: %s. err: %w", dialAddress, err)
+		}
+		return conn, conn, conn, nil
+	}
 	dialer := net.Dialer{}
 	conn, err := dialer.DialContext(ctx, "tcp", dialAddress)
 	if err != nil {
@@ -185,15 +252,26 @@ type DB struct {
 	doDial            chan struct{}
 	doPing            <-chan time.Time
 	cancelConnections context.CancelFunc
+	serverVersion     uint64 // Accessed atomically
+	legacyServer      uint32 // Set to 1 if the server does not know CmdNegotiateVersion, accessed atomically
+
+	rejectOnce sync.Once
+	rejected   chan struct{} // Closed when the server rejects the handshake
+	rejectErr  error         // Reason of the rejection, set before rejected is closed
 }
 
 type DialFunc func(ctx context.Context) (in io.Reader, out io.Writer, closer io.Closer, err error)
 
 // Pool of connections to server
 func (db *DB) getConnection(ctx context.Context) (io.Reader, io.Writer, io.Closer, error) {
+	if err := db.rejection(); err != nil {
+		return nil, nil, nil, err
+	}
 	select {
 	case <-ctx.Done():
 		return nil, nil, nil, ctx.Err()
+	case <-db.rejected:
+		return nil, nil, nil, db.rejectErr
 	case conn := <-db.connectionPool:
 		availableConnections.Dec(1)
 		return conn.in, conn.out, conn.closer, nil
@@ -224,11 +302,55 @@ func (db *DB) ping(ctx context.Context) (err error) {
 		db.returnConn(ctx, in, out, closer)
 	}()
 
+	return db.checkVersion(in, out)
+}
+
+// checkVersion negotiates the version of the protocol with the server over the connection (sending the token,
+// if configured) and makes sure that the server speaks a compatible version of the protocol
+func (db *DB) checkVersion(in io.Reader, out io.Writer) error {
+	if atomic.LoadUint32(&db.legacyServer) == 1 {
+		return db.checkLegacyVersion(in, out)
+	}
+	decoder := codecpool.Decoder(in)
+	defer codecpool.Return(decoder)
+	encoder := codecpool.Encoder(out)
+	defer codecpool.Return(encoder)
+	if err := encoder.Encode(CmdNegotiateVersion); err != nil {
+		return fmt.Errorf("could not encode CmdNegotiateVersion: %w", err)
+	}
+	if err := encoder.Encode(Version); err != nil {
+		return fmt.Errorf("could not encode version for CmdNegotiateVersion: %w", err)
+	}
+	if err := encoder.Encode(db.opts.Token); err != nil {
+		return fmt.Errorf("could not encode token for CmdNegotiateVersion: %w", err)
+	}
+
+	var responseCode ResponseCode
+	if err := decoder.Decode(&responseCode); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+			// Servers older than WriteTxVersion close the connection on the commands they do not know,
+			// the connection is closed by the caller and the next ones use CmdVersion
+			atomic.StoreUint32(&db.legacyServer, 1)
+			return errLegacyServer
+		}
+		return fmt.Errorf("could not decode ResponseCode of CmdNegotiateVersion: %w", err)
+	}
+
+	if responseCode != ResponseOk {
+		return fmt.Errorf("%w: %v", ErrHandshakeRejected, decodeErr(decoder, responseCode))
+	}
+	return db.decodeVersion(decoder)
+}
+
+// checkLegacyVersion sends CmdVersion over the connection to the server older than WriteTxVersion
+func (db *DB) checkLegacyVersion(in io.Reader, out io.Writer) error {
+	if db.opts.Token != "" {
+		return fmt.Errorf("%w: server is too old to authenticate the clients with the token", ErrHandshakeRejected)
+	}
 	decoder := codecpool.Decoder(in)
 	defer codecpool.Return(decoder)
 	encoder := codecpool.Encoder(out)
 	defer codecpool.Return(encoder)
-	// Check version
 	if err := encoder.Encode(CmdVersion); err != nil {
 		return fmt.Errorf("could not encode CmdVersion: %w", err)
 	}
@@ -239,20 +361,49 @@ func (db *DB) ping(ctx context.Context) (err error) {
 	}
 
 	if responseCode != ResponseOk {
-		return decodeErr(decoder, responseCode)
+		return fmt.Errorf("%w: %v", ErrHandshakeRejected, decodeErr(decoder, responseCode))
 	}
+	return db.decodeVersion(decoder)
+}
 
+// decodeVersion reads the version of the protocol replied by the server and remembers it
+func (db *DB) decodeVersion(decoder *codec.Decoder) error {
 	var v uint64
 	if err := decoder.Decode(&v); err != nil {
 		return err
 	}
-	if v != Version {
-		return fmt.Errorf("server protocol version %d, expected %d", v, Version)
+	if v < MinVersion || v > Version {
+		return fmt.Errorf("server protocol version %d, expected from %d to %d", v, MinVersion, Version)
 	}
+	atomic.StoreUint64(&db.serverVersion, v)
 
 	return nil
 }
 
+// reject makes all the waiting and the future operations fail with the error
+func (db *DB) reject(err error) {
+	db.rejectOnce.Do(func() {
+		db.rejectErr = err
+		close(db.rejected)
+	})
+}
+
+// rejection returns the error the server rejected the handshake with, nil if it has not
+func (db *DB) rejection() error {
+	select {
+	case <-db.rejected:
+		return db.rejectErr
+	default:
+		return nil
+	}
+}
+
+// ServerVersion returns the version of the protocol negotiated with the server during the last handshake,
+// or 0 if the server has not been asked yet
+func (db *DB) ServerVersion() uint64 {
+	return atomic.LoadUint64(&db.serverVersion)
+}
+
 type notifyOnClose struct {
 	internal io.Closer
 	notifyCh chan struct{}
@@ -273,7 +424,7 @@ func Open(parentCtx context.Context, opts DbOpts) (*DB, error) {
 			if opts.DialAddress == "" {
 				return nil, nil, nil, fmt.Errorf("please set opts.DialAddress or opts.DialFunc")
 			}
-			return defaultDialFunc(ctx, opts.DialAddress)
+			return defaultDialFunc(ctx, opts.DialAddress, opts.TLS)
 		}
 	}
 
@@ -281,6 +432,7 @@ func Open(parentCtx context.Context, opts DbOpts) (*DB, error) {
 		opts:           opts,
 		connectionPool: make(chan *conn, ClientMaxConnections),
 		doDial:         make(chan struct{}, ClientMaxConnections),
+		rejected:       make(chan struct{}),
 	}
 
 	for i := uint64(0); i < ClientMaxConnections; i++ {
@@ -316,6 +468,9 @@ func Open(parentCtx context.Context, opts DbOpts) (*DB, error) {
 func (db *DB) autoReconnect(ctx context.Context) {
 	select {
 	case <-db.doDial:
+		if db.rejection() != nil {
+			return
+		}
 		dialCtx, cancel := context.WithTimeout(ctx, db.opts.DialTimeout)
 		defer cancel()
 		newIn, newOut, newCloser, err := db.opts.DialFunc(dialCtx)
@@ -327,8 +482,34 @@ func (db *DB) autoReconnect(ctx context.Context) {
 		}
 
 		notifyCloser := notifyOnClose{notifyCh: db.doDial, internal: newCloser}
+		// Server does not accept any other commands before the token is checked, and the version
+		// must be known before the connection is used
+		if err = db.checkVersion(newIn, newOut); err != nil {
+			if errors.Is(err, ErrHandshakeRejected) {
+				// Redialing would not help, the connection is closed without notifying doDial
+				logger.Error("remote db server rejected the connection", "err", err)
+				db.reject(err)
+				if newCloser != nil {
+					if closeErr := newCloser.Close(); closeErr != nil {
+						logger.Error("can't close connection", "err", closeErr)
+					}
+				}
+				return
+			}
+			logger.Warn("version handshake failed", "err", err)
+			if closeErr := notifyCloser.Close(); closeErr != nil {
+				logger.Error("can't close connection", "err", closeErr)
+			}
+			if !errors.Is(err, errLegacyServer) {
+				time.Sleep(db.opts.RetryDialAfter)
+			}
+			return
+		}
 		db.returnConn(ctx, newIn, newOut, notifyCloser)
 	case <-db.doPing:
+		if db.rejection() != nil {
+			return
+		}
 		// periodically ping to close broken connections
 		pingCtx, cancel := context.WithTimeout(ctx, db.opts.PingTimeout)
 		defer cancel()
@@ -357,9 +538,10 @@ func (db *DB) Close() error {
 
 // Tx mimicks the interface of bolt.Tx
 type Tx struct {
-	ctx context.Context
-	in  io.Reader
-	out io.Writer
+	ctx      context.Context
+	in       io.Reader
+	out      io.Writer
+	writable bool
 }
 
 func (db *DB) endTx(ctx context.Context, encoder *codec.Encoder, decoder *codec.Decoder) error {
@@ -427,12 +609,103 @@ func (db *DB) View(ctx context.Context, f func(tx *Tx) error) (err error) {
 
 	endTxErr = db.endTx(ctx, encoder, decoder)
 	if endTxErr != nil {
-		logger.Warn("could not finish tx", "err", err)
+		logger.Warn("could not finish tx", "err", endTxErr)
 	}
 
 	return opErr
 }
 
+func (db *DB) commitTx(ctx context.Context, encoder *codec.Encoder, decoder *codec.Decoder) error {
+	_ = ctx
+	var responseCode ResponseCode
+
+	if err := encoder.Encode(CmdCommitTx); err != nil {
+		return fmt.Errorf("could not encode CmdCommitTx: %w", err)
+	}
+
+	if err := decoder.Decode(&responseCode); err != nil {
+		return fmt.Errorf("could not decode ResponseCode for CmdCommitTx: %w", err)
+	}
+
+	if responseCode != ResponseOk {
+		return decodeErr(decoder, responseCode)
+	}
+	return nil
+}
+
+// Update performs read-write transaction on the remote database. The transaction is committed if f returns
+// no error, and rolled back otherwise. Returns ErrWriteTxNotSupported if the server is too old. If the version of
+// the server is not known yet, it is negotiated first, the transaction is never started without it.
+// NOTE: not thread-safe
+func (db *DB) Update(ctx context.Context, f func(tx *Tx) error) (err error) {
+	if v := db.ServerVersion(); v != 0 && v < WriteTxVersion {
+		return ErrWriteTxNotSupported
+	}
+
+	var opErr error
+	var endTxErr error
+
+	var responseCode ResponseCode
+
+	in, out, closer, err := db.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil || endTxErr != nil || opErr != nil {
+			if closeErr := closer.Close(); closeErr != nil {
+				logger.Error("can't close connection", "err", closeErr)
+			}
+			return
+		}
+		db.returnConn(ctx, in, out, closer)
+	}()
+
+	if db.ServerVersion() == 0 {
+		if err = db.checkVersion(in, out); err != nil {
+			return fmt.Errorf("could not get the version of the server: %w", err)
+		}
+	}
+	if db.ServerVersion() < WriteTxVersion {
+		err = ErrWriteTxNotSupported
+		return err
+	}
+
+	decoder := codecpool.Decoder(in)
+	defer codecpool.Return(decoder)
+	encoder := codecpool.Encoder(out)
+	defer codecpool.Return(encoder)
+
+	if err = encoder.Encode(CmdBeginWriteTx); err != nil {
+		return fmt.Errorf("could not encode CmdBeginWriteTx: %w", err)
+	}
+
+	if err = decoder.Decode(&responseCode); err != nil {
+		return fmt.Errorf("could not decode response code of CmdBeginWriteTx: %w", err)
+	}
+
+	if responseCode != ResponseOk {
+		return decodeErr(decoder, responseCode)
+	}
+
+	tx := &Tx{ctx: ctx, in: in, out: out, writable: true}
+	opErr = f(tx)
+
+	if opErr != nil {
+		endTxErr = db.endTx(ctx, encoder, decoder)
+		if endTxErr != nil {
+			logger.Warn("could not roll back tx", "err", endTxErr)
+		}
+		return opErr
+	}
+
+	if endTxErr = db.commitTx(ctx, encoder, decoder); endTxErr != nil {
+		return endTxErr
+	}
+	return nil
+}
+
 // Bucket mimicks the interface of bolt.Bucket
 type Bucket struct {
 	ctx          context.Context
@@ -568,6 +841,97 @@ func (b *Bucket) Get(key []byte) ([]byte, error) {
 	return value, nil
 }
 
+// Put puts the key and value into the bucket. Only allowed in transactions started by Update
+func (b *Bucket) Put(key []byte, value []byte) error {
+	select {
+	default:
+	case <-b.ctx.Done():
+		return b.ctx.Err()
+	}
+
+	if !b.tx.writable {
+		return fmt.Errorf("put into read-only transaction")
+	}
+
+	if !b.initialized {
+		if err := b.init(); err != nil {
+			return err
+		}
+	}
+
+	decoder := codecpool.Decoder(b.in)
+	defer codecpool.Return(decoder)
+	encoder := codecpool.Encoder(b.out)
+	defer codecpool.Return(encoder)
+
+	if err := encoder.Encode(CmdPut); err != nil {
+		return fmt.Errorf("could not encode CmdPut: %w", err)
+	}
+	if err := encoder.Encode(b.bucketHandle); err != nil {
+		return fmt.Errorf("could not encode bucketHandle for CmdPut: %w", err)
+	}
+	if err := encoder.Encode(&key); err != nil {
+		return fmt.Errorf("could not encode key for CmdPut: %w", err)
+	}
+	if err := encoder.Encode(&value); err != nil {
+		return fmt.Errorf("could not encode value for CmdPut: %w", err)
+	}
+
+	var responseCode ResponseCode
+	if err := decoder.Decode(&responseCode); err != nil {
+		return fmt.Errorf("could not decode ResponseCode for CmdPut: %w", err)
+	}
+
+	if responseCode != ResponseOk {
+		return decodeErr(decoder, responseCode)
+	}
+	return nil
+}
+
+// Delete deletes the key from the bucket. Only allowed in transactions started by Update
+func (b *Bucket) Delete(key []byte) error {
+	select {
+	default:
+	case <-b.ctx.Done():
+		return b.ctx.Err()
+	}
+
+	if !b.tx.writable {
+		return fmt.Errorf("delete from read-only transaction")
+	}
+
+	if !b.initialized {
+		if err := b.init(); err != nil {
+			return err
+		}
+	}
+
+	decoder := codecpool.Decoder(b.in)
+	defer codecpool.Return(decoder)
+	encoder := codecpool.Encoder(b.out)
+	defer codecpool.Return(encoder)
+
+	if err := encoder.Encode(CmdDelete); err != nil {
+		return fmt.Errorf("could not encode CmdDelete: %w", err)
+	}
+	if err := encoder.Encode(b.bucketHandle); err != nil {
+		return fmt.Errorf("could not encode bucketHandle for CmdDelete: %w", err)
+	}
+	if err := encoder.Encode(&key); err != nil {
+		return fmt.Errorf("could not encode key for CmdDelete: %w", err)
+	}
+
+	var responseCode ResponseCode
+	if err := decoder.Decode(&responseCode); err != nil {
+		return fmt.Errorf("could not decode ResponseCode for CmdDelete: %w", err)
+	}
+
+	if responseCode != ResponseOk {
+		return decodeErr(decoder, responseCode)
+	}
+	return nil
+}
+
 // Cursor iterating over bucket keys
 func (b *Bucket) Cursor() *Cursor {
 	return &Cursor{
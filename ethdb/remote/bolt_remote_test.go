@@ -3,6 +3,7 @@ package remote
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"net"
 	"testing"
@@ -47,15 +48,24 @@ func TestReconnect(t *testing.T) {
 	assert.Equal(0, dialCallCounter)
 	assert.Equal(0, len(db.connectionPool))
 
+	// every new connection starts with the version handshake
+	handshake := func() {
+		assert.Nil(encoder.Encode(ResponseOk))
+		assert.Nil(encoder.Encode(Version))
+	}
+
 	// open 1 connection and wait for it
 	db.doDial <- struct{}{}
+	handshake()
 	db.autoReconnect(ctx)
 	<-db.connectionPool
 	assert.Equal(1, dialCallCounter)
 	assert.Equal(0, len(db.connectionPool))
+	assert.Equal(Version, db.ServerVersion())
 
 	// open 2nd connection - dialFunc will return err on 2nd call, but db must reconnect automatically
 	db.doDial <- struct{}{}
+	handshake()
 	db.autoReconnect(ctx) // dial err
 	db.autoReconnect(ctx) // dial ok
 	<-db.connectionPool
@@ -64,17 +74,115 @@ func TestReconnect(t *testing.T) {
 
 	// open conn and call ping on it
 	db.doDial <- struct{}{}
-	assert.Nil(encoder.Encode(ResponseOk))
-	assert.Nil(encoder.Encode(Version))
+	handshake()
 	db.autoReconnect(ctx) // dial err
 	db.autoReconnect(ctx) // dial ok
 	assert.Equal(5, dialCallCounter)
 	assert.Equal(1, len(db.connectionPool))
+	outBuf.Reset()
+	handshake()
 	pingCh <- time.Now()
 	db.autoReconnect(ctx)
 	var cmd Command
 	assert.Nil(decoder.Decode(&cmd))
-	assert.Equal(CmdVersion, cmd)
+	assert.Equal(CmdNegotiateVersion, cmd)
 
 	// TODO: cover case when ping receive io.EOF
 }
+
+func TestRejectedHandshake(t *testing.T) {
+	assert := assert.New(t)
+	var inBuf bytes.Buffer
+	encoder := codecpool.Encoder(&inBuf)
+	defer codecpool.Return(encoder)
+	var outBuf bytes.Buffer
+
+	dialCallCounter := 0
+	opts := DefaultOpts
+	opts.DialFunc = func(ctx context.Context) (in io.Reader, out io.Writer, closer io.Closer, err error) {
+		dialCallCounter++
+		return &inBuf, &outBuf, nil, nil
+	}
+	db := &DB{
+		opts:           opts,
+		connectionPool: make(chan *conn, ClientMaxConnections),
+		doDial:         make(chan struct{}, ClientMaxConnections),
+		rejected:       make(chan struct{}),
+	}
+
+	// The operation waiting for a connection fails as soon as the server rejects the handshake
+	errCh := make(chan error)
+	go func() {
+		_, _, _, err := db.getConnection(context.Background())
+		errCh <- err
+	}()
+	assert.Nil(encoder.Encode(ResponseErr))
+	assert.Nil(encoder.Encode("authentication failed"))
+	db.doDial <- struct{}{}
+	db.doDial <- struct{}{}
+	db.autoReconnect(context.Background())
+	assert.True(errors.Is(<-errCh, ErrHandshakeRejected))
+	assert.Equal(0, len(db.connectionPool))
+
+	// The client does not connect anymore
+	db.autoReconnect(context.Background())
+	assert.Equal(1, dialCallCounter)
+	assert.True(errors.Is(db.View(context.Background(), func(tx *Tx) error { return nil }), ErrHandshakeRejected))
+}
+
+func TestLegacyServer(t *testing.T) {
+	assert := assert.New(t)
+	var inBuf bytes.Buffer
+	encoder := codecpool.Encoder(&inBuf)
+	defer codecpool.Return(encoder)
+	var outBuf bytes.Buffer
+	decoder := codecpool.Decoder(&outBuf)
+	defer codecpool.Return(decoder)
+
+	db := &DB{opts: DefaultOpts, connectionPool: make(chan *conn, ClientMaxConnections)}
+	var cmd Command
+	var v uint64
+	var token string
+
+	// Server older than WriteTxVersion closes the connection on CmdNegotiateVersion
+	assert.Equal(errLegacyServer, db.checkVersion(&inBuf, &outBuf))
+	assert.Nil(decoder.Decode(&cmd))
+	assert.Equal(CmdNegotiateVersion, cmd)
+	assert.Nil(decoder.Decode(&v))
+	assert.Equal(Version, v)
+	assert.Nil(decoder.Decode(&token))
+	assert.Equal(uint64(0), db.ServerVersion())
+
+	// The next connections use CmdVersion
+	outBuf.Reset()
+	assert.Nil(encoder.Encode(ResponseOk))
+	assert.Nil(encoder.Encode(MinVersion))
+	assert.Nil(db.checkVersion(&inBuf, &outBuf))
+	assert.Nil(decoder.Decode(&cmd))
+	assert.Equal(CmdVersion, cmd)
+	assert.Equal(MinVersion, db.ServerVersion())
+
+	// The server does not support writable transactions
+	assert.Equal(ErrWriteTxNotSupported, db.Update(context.Background(), func(tx *Tx) error { return nil }))
+}
+
+func TestUpdateUnknownVersion(t *testing.T) {
+	assert := assert.New(t)
+	var inBuf bytes.Buffer
+	var outBuf bytes.Buffer
+	decoder := codecpool.Decoder(&outBuf)
+	defer codecpool.Return(decoder)
+
+	// The version is negotiated before the writable transaction is started
+	db := &DB{opts: DefaultOpts, connectionPool: make(chan *conn, ClientMaxConnections)}
+	db.connectionPool <- &conn{in: &inBuf, out: &outBuf, closer: notifyOnClose{notifyCh: make(chan struct{}, 1)}}
+	called := false
+	assert.Error(db.Update(context.Background(), func(tx *Tx) error {
+		called = true
+		return nil
+	}))
+	assert.False(called)
+	var cmd Command
+	assert.Nil(decoder.Decode(&cmd))
+	assert.Equal(CmdNegotiateVersion, cmd)
+}
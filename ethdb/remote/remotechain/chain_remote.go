@@ -3,6 +3,7 @@ package remotechain
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"math/big"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
 	"github.com/ledgerwatch/turbo-geth/rlp"
 )
 
@@ -64,6 +66,35 @@ func GetBlockByNumber(tx ethdb.Tx, number uint64) (*types.Block, error) {
 	return ReadBlock(tx, hash, number)
 }
 
+// GetBlockByHash reimplementation of chain.GetBlockByHash
+func GetBlockByHash(tx ethdb.Tx, hash common.Hash) (*types.Block, error) {
+	number, err := ReadHeaderNumber(tx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if number == nil {
+		return nil, nil
+	}
+	return ReadBlock(tx, hash, *number)
+}
+
+// ReadHeaderNumber reimplementation of rawdb.ReadHeaderNumber
+func ReadHeaderNumber(tx ethdb.Tx, hash common.Hash) (*uint64, error) {
+	bucket := tx.Bucket(dbutils.HeaderNumberPrefix)
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket %s not found", dbutils.HeaderNumberPrefix)
+	}
+	data, err := bucket.Get(hash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 8 {
+		return nil, nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number, nil
+}
+
 // ReadBlock reimplementation of rawdb.ReadBlock
 func ReadBlock(tx ethdb.Tx, hash common.Hash, number uint64) (*types.Block, error) {
 	header, err := ReadHeader(tx, hash, number)
@@ -133,10 +164,142 @@ func ReadBody(tx ethdb.Tx, hash common.Hash, number uint64) (*types.Body, error)
 		return nil, fmt.Errorf("invalid block body RLP: %s, %w", hash, err)
 	}
 	// Post-processing
+	senders, err := ReadSenders(tx, hash, number)
+	if err != nil {
+		return nil, err
+	}
+	if len(senders) == len(body.Transactions) {
+		body.Senders = senders
+	}
 	body.SendersToTxs()
 	return body, nil
 }
 
+// ReadSenders reimplementation of rawdb.ReadSenders
+func ReadSenders(tx ethdb.Tx, hash common.Hash, number uint64) ([]common.Address, error) {
+	bucket := tx.Bucket(dbutils.SendersPrefix)
+	if bucket == nil {
+		// Senders are only recovered by the staged sync
+		return nil, nil
+	}
+	data, err := bucket.Get(dbutils.BlockBodyKey(number, hash))
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%common.AddressLength != 0 {
+		return nil, fmt.Errorf("invalid senders length: %s, %d", hash, len(data))
+	}
+	senders := make([]common.Address, len(data)/common.AddressLength)
+	for i := range senders {
+		copy(senders[i][:], data[i*common.AddressLength:])
+	}
+	return senders, nil
+}
+
+// ReadTxLookupEntry reimplementation of rawdb.ReadTxLookupEntry
+func ReadTxLookupEntry(tx ethdb.Tx, txHash common.Hash) (*uint64, error) {
+	bucket := tx.Bucket(dbutils.TxLookupPrefix)
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket %s not found", dbutils.TxLookupPrefix)
+	}
+	data, err := bucket.Get(txHash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	number := new(big.Int).SetBytes(data).Uint64()
+	return &number, nil
+}
+
+// ReadTransaction reimplementation of rawdb.ReadTransaction
+func ReadTransaction(tx ethdb.Tx, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
+	blockNumber, err := ReadTxLookupEntry(tx, txHash)
+	if err != nil {
+		return nil, common.Hash{}, 0, 0, err
+	}
+	if blockNumber == nil {
+		return nil, common.Hash{}, 0, 0, nil
+	}
+	blockHash, err := ReadCanonicalHash(tx, *blockNumber)
+	if err != nil {
+		return nil, common.Hash{}, 0, 0, err
+	}
+	if blockHash == (common.Hash{}) {
+		return nil, common.Hash{}, 0, 0, nil
+	}
+	body, err := ReadBody(tx, blockHash, *blockNumber)
+	if err != nil {
+		return nil, common.Hash{}, 0, 0, err
+	}
+	if body == nil {
+		return nil, common.Hash{}, 0, 0, fmt.Errorf("transaction referenced missing body. Number: %d, hash: %s", *blockNumber, blockHash)
+	}
+	for txIndex, txn := range body.Transactions {
+		if txn.Hash() == txHash {
+			return txn, blockHash, *blockNumber, uint64(txIndex), nil
+		}
+	}
+	return nil, common.Hash{}, 0, 0, fmt.Errorf("transaction not found in block. Number: %d, hash: %s, txhash: %s", *blockNumber, blockHash, txHash)
+}
+
+// ReadReceipts reimplementation of rawdb.ReadReceipts
+func ReadReceipts(tx ethdb.Tx, hash common.Hash, number uint64, config *params.ChainConfig) (types.Receipts, error) {
+	bucket := tx.Bucket(dbutils.BlockReceiptsPrefix)
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket %s not found", dbutils.BlockReceiptsPrefix)
+	}
+	data, err := bucket.Get(dbutils.BlockReceiptsKey(number, hash))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	// Convert the receipts from their storage form to their internal representation
+	storageReceipts := []*types.ReceiptForStorage{}
+	if err := rlp.DecodeBytes(data, &storageReceipts); err != nil {
+		return nil, fmt.Errorf("invalid receipt array RLP: %s, %w", hash, err)
+	}
+	receipts := make(types.Receipts, len(storageReceipts))
+	for i, storageReceipt := range storageReceipts {
+		receipts[i] = (*types.Receipt)(storageReceipt)
+	}
+	// We're deriving many fields from the block body
+	body, err := ReadBody(tx, hash, number)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, fmt.Errorf("missing body but have receipt: %s", hash)
+	}
+	if err := receipts.DeriveFields(config, hash, number, body.Transactions); err != nil {
+		return nil, fmt.Errorf("failed to derive block receipts fields: %s, %w", hash, err)
+	}
+	return receipts, nil
+}
+
+// ReadChainConfig reimplementation of rawdb.ReadChainConfig
+func ReadChainConfig(tx ethdb.Tx, genesisHash common.Hash) (*params.ChainConfig, error) {
+	bucket := tx.Bucket(dbutils.ConfigPrefix)
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket %s not found", dbutils.ConfigPrefix)
+	}
+	data, err := bucket.Get(genesisHash[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var config params.ChainConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid chain config JSON: %s, %w", genesisHash, err)
+	}
+	return &config, nil
+}
+
 func ReadLastBlockNumber(tx ethdb.Tx) (uint64, error) {
 	b := tx.Bucket(dbutils.HeadHeaderKey)
 
@@ -166,3 +329,35 @@ func ReadLastBlockNumber(tx ethdb.Tx) (uint64, error) {
 
 	return binary.BigEndian.Uint64(blockNumberData), nil
 }
+
+// ReadHeadBlockHash reimplemented rawdb.ReadHeadBlockHash
+func ReadHeadBlockHash(tx ethdb.Tx) (common.Hash, error) {
+	b := tx.Bucket(dbutils.HeadBlockKey)
+	if b == nil {
+		return common.Hash{}, fmt.Errorf("bucket %s not found", dbutils.HeadBlockKey)
+	}
+	data, err := b.Get(dbutils.HeadBlockKey)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(data) == 0 {
+		return common.Hash{}, nil
+	}
+	return common.BytesToHash(data), nil
+}
+
+// ReadLowestAvailableBlock reimplemented core.ReadLowestAvailableBlock
+func ReadLowestAvailableBlock(tx ethdb.Tx) (uint64, error) {
+	b := tx.Bucket(dbutils.DatabaseInfoBucket)
+	if b == nil {
+		return 0, nil
+	}
+	data, err := b.Get(dbutils.LowestAvailableBlockKey)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 8 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
@@ -2,11 +2,14 @@ package remotedbserver
 
 import (
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -19,15 +22,36 @@ import (
 
 // Version is the current version of the remote db protocol. If the protocol changes in a non backwards compatible way,
 // this constant needs to be increased
-const Version uint64 = 2
+const Version uint64 = 3
+
+// WriteTxTimeout is the maximum duration of writable transactions opened by the clients. Writable transaction
+// blocks all other writers of the database, so when the timeout expires, the transaction is rolled back
+// and the connection is closed
+var WriteTxTimeout = 30 * time.Second
+
+// Opts are the options of the remote database server
+type Opts struct {
+	// TLS, if set, makes the listener accept only TLS connections, see remote.NewServerTLSConfig
+	TLS *tls.Config
+	// Token, if set, must be sent by the clients with the first CmdNegotiateVersion on every connection.
+	// The clients older than remote.WriteTxVersion can't send it, their CmdVersion is rejected
+	Token string
+}
 
 // Server is to be called as a go-routine, one per every client connection.
 // It runs while the connection is active and keep the entire connection's context
 // in the local variables
 // For tests, bytes.Buffer can be used for both `in` and `out`
 func Server(ctx context.Context, db ethdb.KV, in io.Reader, out io.Writer, closer io.Closer) error {
+	return ServerWithOpts(ctx, db, in, out, closer, Opts{})
+}
+
+// ServerWithOpts is Server which authenticates the clients with the token from opts
+func ServerWithOpts(ctx context.Context, db ethdb.KV, in io.Reader, out io.Writer, closer io.Closer, opts Opts) error {
+	// Set when the writable transaction times out, the connection is closed at that moment
+	var txTimedOut int32
 	defer func() {
-		if closer != nil {
+		if closer != nil && atomic.LoadInt32(&txTimedOut) == 0 {
 			if err1 := closer.Close(); err1 != nil {
 				logger.Error("Could not close connection", "err", err1)
 			}
@@ -41,12 +65,17 @@ func Server(ctx context.Context, db ethdb.KV, in io.Reader, out io.Writer, close
 
 	// Server is passive - it runs a loop what reads remote.Commands (and their arguments) and attempts to respond
 	var lastHandle uint64
-	// Read-only transactions opened by the client
+	// Transaction opened by the client
 	var tx ethdb.Tx
+	var writable bool
+	// Fires when the writable transaction takes too long
+	var txTimer *time.Timer
 
-	// We do Rollback and never Commit, because the remote transactions are always read-only, and must never change
-	// anything
+	// Transactions which have not been explicitly committed by the client are rolled back
 	defer func() {
+		if txTimer != nil {
+			txTimer.Stop()
+		}
 		if tx != nil {
 			if rollbackErr := tx.Rollback(); rollbackErr != nil {
 				logger.Error("could not roll back", "err", rollbackErr)
@@ -71,10 +100,12 @@ func Server(ctx context.Context, db ethdb.KV, in io.Reader, out io.Writer, close
 
 	var name []byte
 	var seekKey []byte
+	var token string
 
+	authenticated := opts.Token == ""
 	for {
 		// Make sure we are not blocking the resizing of the memory map
-		if tx != nil {
+		if tx != nil && !writable {
 			type Yieldable interface {
 				Yield()
 			}
@@ -88,17 +119,68 @@ func Server(ctx context.Context, db ethdb.KV, in io.Reader, out io.Writer, close
 				// Graceful termination when the end of the input is reached
 				break
 			}
+			if atomic.LoadInt32(&txTimedOut) == 1 {
+				return fmt.Errorf("writable transaction timed out after %s", WriteTxTimeout)
+			}
 			return fmt.Errorf("could not decode remote.Command: %w", err)
 		}
+		if !authenticated && c != remote.CmdVersion && c != remote.CmdNegotiateVersion {
+			err := fmt.Errorf("authentication required, send remote.CmdNegotiateVersion with the token first")
+			encodeErr(encoder, err)
+			return err
+		}
 		switch c {
 		case remote.CmdVersion:
+			if opts.Token != "" {
+				// The command carries no token, the client is told right away instead of waiting for one
+				err := fmt.Errorf("authentication required, the client is too old to send the token")
+				encodeErr(encoder, err)
+				return err
+			}
 			if err := encoder.Encode(remote.ResponseOk); err != nil {
 				return fmt.Errorf("could not encode response code to remote.CmdVersion: %w", err)
 			}
-			if err := encoder.Encode(Version); err != nil {
+			// Only the clients older than remote.WriteTxVersion send this command, and they expect exactly their version
+			if err := encoder.Encode(remote.MinVersion); err != nil {
 				return fmt.Errorf("could not encode response to remote.CmdVersion: %w", err)
 			}
+		case remote.CmdNegotiateVersion:
+			var clientVersion uint64
+			if err := decoder.Decode(&clientVersion); err != nil {
+				return fmt.Errorf("could not decode version for remote.CmdNegotiateVersion: %w", err)
+			}
+			if err := decoder.Decode(&token); err != nil {
+				return fmt.Errorf("could not decode token for remote.CmdNegotiateVersion: %w", err)
+			}
+			if opts.Token != "" {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(opts.Token)) != 1 {
+					err := fmt.Errorf("authentication failed")
+					encodeErr(encoder, err)
+					return err
+				}
+				authenticated = true
+			}
+			if clientVersion < remote.MinVersion {
+				err := fmt.Errorf("client protocol version %d, expected at least %d", clientVersion, remote.MinVersion)
+				encodeErr(encoder, err)
+				return err
+			}
+			v := Version
+			if clientVersion < v {
+				v = clientVersion
+			}
+			if err := encoder.Encode(remote.ResponseOk); err != nil {
+				return fmt.Errorf("could not encode response code to remote.CmdNegotiateVersion: %w", err)
+			}
+			if err := encoder.Encode(v); err != nil {
+				return fmt.Errorf("could not encode response to remote.CmdNegotiateVersion: %w", err)
+			}
 		case remote.CmdBeginTx:
+			if tx != nil {
+				err := fmt.Errorf("send remote.CmdBeginTx while another transaction is open")
+				encodeErr(encoder, err)
+				return err
+			}
 			var err error
 			tx, err = db.Begin(ctx, false)
 			if err != nil {
@@ -106,20 +188,43 @@ func Server(ctx context.Context, db ethdb.KV, in io.Reader, out io.Writer, close
 				encodeErr(encoder, err2)
 				return err2
 			}
+			writable = false
 
 			if err := encoder.Encode(remote.ResponseOk); err != nil {
 				return fmt.Errorf("could not encode response to remote.CmdBeginTx: %w", err)
 			}
-		case remote.CmdEndTx:
-			// Remove all the buckets
-			for bucketHandle := range buckets {
-				if cursorHandles, ok2 := cursorsByBucket[bucketHandle]; ok2 {
-					for _, cursorHandle := range cursorHandles {
-						delete(cursors, cursorHandle)
+		case remote.CmdBeginWriteTx:
+			if tx != nil {
+				err := fmt.Errorf("send remote.CmdBeginWriteTx while another transaction is open")
+				encodeErr(encoder, err)
+				return err
+			}
+			var err error
+			tx, err = db.Begin(ctx, true)
+			if err != nil {
+				err2 := fmt.Errorf("could not start transaction for remote.CmdBeginWriteTx: %w", err)
+				encodeErr(encoder, err2)
+				return err2
+			}
+			writable = true
+			txTimer = time.AfterFunc(WriteTxTimeout, func() {
+				atomic.StoreInt32(&txTimedOut, 1)
+				// Unblocks the decoder, the transaction is rolled back by the server loop
+				if closer != nil {
+					if err1 := closer.Close(); err1 != nil {
+						logger.Error("Could not close connection", "err", err1)
 					}
-					delete(cursorsByBucket, bucketHandle)
 				}
-				delete(buckets, bucketHandle)
+			})
+
+			if err := encoder.Encode(remote.ResponseOk); err != nil {
+				return fmt.Errorf("could not encode response to remote.CmdBeginWriteTx: %w", err)
+			}
+		case remote.CmdEndTx:
+			clearTx(buckets, cursors, cursorsByBucket)
+			if txTimer != nil {
+				txTimer.Stop()
+				txTimer = nil
 			}
 
 			if tx != nil {
@@ -132,6 +237,84 @@ func Server(ctx context.Context, db ethdb.KV, in io.Reader, out io.Writer, close
 			if err := encoder.Encode(remote.ResponseOk); err != nil {
 				return fmt.Errorf("could not encode response to remote.CmdEndTx: %w", err)
 			}
+		case remote.CmdCommitTx:
+			clearTx(buckets, cursors, cursorsByBucket)
+			if txTimer != nil {
+				txTimer.Stop()
+				txTimer = nil
+			}
+			if atomic.LoadInt32(&txTimedOut) == 1 {
+				return fmt.Errorf("writable transaction timed out after %s", WriteTxTimeout)
+			}
+
+			if tx == nil || !writable {
+				err := fmt.Errorf("send remote.CmdCommitTx without remote.CmdBeginWriteTx")
+				encodeErr(encoder, err)
+				return err
+			}
+			err := tx.Commit(ctx)
+			tx = nil
+			if err != nil {
+				encodeErr(encoder, fmt.Errorf("could not commit transaction: %w", err))
+				continue
+			}
+
+			if err := encoder.Encode(remote.ResponseOk); err != nil {
+				return fmt.Errorf("could not encode response to remote.CmdCommitTx: %w", err)
+			}
+		case remote.CmdPut:
+			var k, v []byte
+			if err := decoder.Decode(&bucketHandle); err != nil {
+				return fmt.Errorf("could not decode bucketHandle for remote.CmdPut: %w", err)
+			}
+			if err := decoder.Decode(&k); err != nil {
+				return fmt.Errorf("could not decode key for remote.CmdPut: %w", err)
+			}
+			if err := decoder.Decode(&v); err != nil {
+				return fmt.Errorf("could not decode value for remote.CmdPut: %w", err)
+			}
+			bucket, ok := buckets[bucketHandle]
+			if !ok {
+				encodeErr(encoder, fmt.Errorf("bucket not found for remote.CmdPut: %d", bucketHandle))
+				continue
+			}
+			if !writable {
+				encodeErr(encoder, fmt.Errorf("remote.CmdPut in read-only transaction"))
+				continue
+			}
+			if err := bucket.Put(k, v); err != nil {
+				encodeErr(encoder, fmt.Errorf("could not put for remote.CmdPut: %w", err))
+				continue
+			}
+
+			if err := encoder.Encode(remote.ResponseOk); err != nil {
+				return fmt.Errorf("could not encode response code for remote.CmdPut: %w", err)
+			}
+		case remote.CmdDelete:
+			var k []byte
+			if err := decoder.Decode(&bucketHandle); err != nil {
+				return fmt.Errorf("could not decode bucketHandle for remote.CmdDelete: %w", err)
+			}
+			if err := decoder.Decode(&k); err != nil {
+				return fmt.Errorf("could not decode key for remote.CmdDelete: %w", err)
+			}
+			bucket, ok := buckets[bucketHandle]
+			if !ok {
+				encodeErr(encoder, fmt.Errorf("bucket not found for remote.CmdDelete: %d", bucketHandle))
+				continue
+			}
+			if !writable {
+				encodeErr(encoder, fmt.Errorf("remote.CmdDelete in read-only transaction"))
+				continue
+			}
+			if err := bucket.Delete(k); err != nil {
+				encodeErr(encoder, fmt.Errorf("could not delete for remote.CmdDelete: %w", err))
+				continue
+			}
+
+			if err := encoder.Encode(remote.ResponseOk); err != nil {
+				return fmt.Errorf("could not encode response code for remote.CmdDelete: %w", err)
+			}
 		case remote.CmdBucket:
 			// Read the name of the bucket
 			if err := decoder.Decode(&name); err != nil {
@@ -454,6 +637,19 @@ func Server(ctx context.Context, db ethdb.KV, in io.Reader, out io.Writer, close
 
 const ServerMaxConnections uint64 = 2048
 
+// clearTx forgets all the buckets and cursors opened in the transaction being finished
+func clearTx(buckets map[uint64]ethdb.Bucket, cursors map[uint64]ethdb.Cursor, cursorsByBucket map[uint64][]uint64) {
+	for bucketHandle := range buckets {
+		if cursorHandles, ok2 := cursorsByBucket[bucketHandle]; ok2 {
+			for _, cursorHandle := range cursorHandles {
+				delete(cursors, cursorHandle)
+			}
+			delete(cursorsByBucket, bucketHandle)
+		}
+		delete(buckets, bucketHandle)
+	}
+}
+
 var logger = log.New("database", "remote")
 
 func encodeKeyValue(encoder *codec.Encoder, key []byte, value []byte) error {
@@ -490,7 +686,11 @@ func encodeErr(encoder *codec.Encoder, mainError error) {
 var netAddr string
 var stopNetInterface context.CancelFunc
 
-func StartDeprecated(db ethdb.KV, addr string) {
+var netOpts Opts
+
+// StartDeprecated starts the listener on the given address. Empty address and nil opts
+// mean re-using the ones from the previous call
+func StartDeprecated(db ethdb.KV, addr string, opts *Opts) {
 	if stopNetInterface != nil {
 		stopNetInterface()
 	}
@@ -500,6 +700,9 @@ func StartDeprecated(db ethdb.KV, addr string) {
 	if addr != "" {
 		netAddr = addr
 	}
+	if opts != nil {
+		netOpts = *opts
+	}
 	go func() {
 		ch := make(chan os.Signal, 1)
 		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
@@ -519,18 +722,21 @@ func StartDeprecated(db ethdb.KV, addr string) {
 		logger.Error("Could not create listener", "address", netAddr, "err", err)
 		return
 	}
+	if netOpts.TLS != nil {
+		ln = tls.NewListener(ln, netOpts.TLS)
+	}
 	stopNetInterface = func() {
 		cancel()
 		ln.Close()
 	}
 
-	logger.Info("Listening on", "address", netAddr)
-	go Listen(tcpCtx, ln, db)
+	logger.Info("Listening on", "address", netAddr, "tls", netOpts.TLS != nil, "token", netOpts.Token != "")
+	go Listen(tcpCtx, ln, db, netOpts)
 }
 
 // Listener starts listener that for each incoming connection
 // spawn a go-routine invoking Server
-func Listen(ctx context.Context, ln net.Listener, db ethdb.KV) {
+func Listen(ctx context.Context, ln net.Listener, db ethdb.KV, opts Opts) {
 	defer func() {
 		if err := ln.Close(); err != nil {
 			logger.Error("Could not close listener", "err", err)
@@ -570,7 +776,7 @@ func Listen(ctx context.Context, ln net.Listener, db ethdb.KV) {
 				<-ch
 			}()
 
-			err := Server(ctx, db, conn, conn, conn)
+			err := ServerWithOpts(ctx, db, conn, conn, conn, opts)
 			if err != nil {
 				logger.Warn("server error", "err", err)
 			}
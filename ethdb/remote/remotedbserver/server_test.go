@@ -71,7 +71,127 @@ func TestCmdVersion(t *testing.T) {
 
 	var v uint64
 	assert.Nil(decoder.Decode(&v), "Could not decode version returned by CmdVersion")
-	assert.Equal(remote.Version, v)
+	assert.Equal(remote.MinVersion, v)
+}
+
+func TestCmdNegotiateVersion(t *testing.T) {
+	assert, require, ctx, db := assert.New(t), require.New(t), context.Background(), ethdb.NewMemDatabase()
+
+	// ---------- Start of boilerplate code
+	var inBuf bytes.Buffer
+	encoder := codecpool.Encoder(&inBuf)
+	defer codecpool.Return(encoder)
+	// output buffer to receive the result of the command
+	var outBuf bytes.Buffer
+	decoder := codecpool.Decoder(&outBuf)
+	defer codecpool.Return(decoder)
+	// ---------- End of boilerplate code
+	var responseCode remote.ResponseCode
+	var v uint64
+	for _, clientVersion := range []uint64{remote.Version, remote.MinVersion, remote.Version + 1} {
+		inBuf.Reset()
+		outBuf.Reset()
+		assert.Nil(encoder.Encode(remote.CmdNegotiateVersion), "Could not encode CmdNegotiateVersion")
+		assert.Nil(encoder.Encode(clientVersion), "Could not encode version")
+		assert.Nil(encoder.Encode(""), "Could not encode token")
+		require.NoError(Server(ctx, db.AbstractKV(), &inBuf, &outBuf, closer), "Error while calling Server")
+
+		assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdNegotiateVersion")
+		assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+		assert.Nil(decoder.Decode(&v), "Could not decode version returned by CmdNegotiateVersion")
+		if clientVersion < Version {
+			assert.Equal(clientVersion, v)
+		} else {
+			assert.Equal(Version, v)
+		}
+	}
+
+	// Client too old
+	inBuf.Reset()
+	outBuf.Reset()
+	assert.Nil(encoder.Encode(remote.CmdNegotiateVersion), "Could not encode CmdNegotiateVersion")
+	assert.Nil(encoder.Encode(remote.MinVersion-1), "Could not encode version")
+	assert.Nil(encoder.Encode(""), "Could not encode token")
+	require.Error(Server(ctx, db.AbstractKV(), &inBuf, &outBuf, closer), "Old client must be rejected")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdNegotiateVersion")
+	assert.Equal(remote.ResponseErr, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(new(string)), "Could not decode the error message")
+
+	// Token
+	inBuf.Reset()
+	outBuf.Reset()
+	assert.Nil(encoder.Encode(remote.CmdNegotiateVersion), "Could not encode CmdNegotiateVersion")
+	assert.Nil(encoder.Encode(remote.Version), "Could not encode version")
+	assert.Nil(encoder.Encode("secret"), "Could not encode token")
+	assert.Nil(encoder.Encode(remote.CmdBeginTx), "Could not encode CmdBeginTx")
+	require.NoError(ServerWithOpts(ctx, db.AbstractKV(), &inBuf, &outBuf, closer, Opts{Token: "secret"}), "Error while calling Server")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdNegotiateVersion")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(&v), "Could not decode version returned by CmdNegotiateVersion")
+	assert.Equal(Version, v)
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBeginTx")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+}
+
+func TestCmdVersionToken(t *testing.T) {
+	assert, require, ctx, db := assert.New(t), require.New(t), context.Background(), ethdb.NewMemDatabase()
+	opts := Opts{Token: "secret"}
+
+	// ---------- Start of boilerplate code
+	var inBuf bytes.Buffer
+	encoder := codecpool.Encoder(&inBuf)
+	defer codecpool.Return(encoder)
+	// output buffer to receive the result of the command
+	var outBuf bytes.Buffer
+	decoder := codecpool.Decoder(&outBuf)
+	defer codecpool.Return(decoder)
+	// ---------- End of boilerplate code
+	assert.Nil(encoder.Encode(remote.CmdNegotiateVersion), "Could not encode CmdNegotiateVersion")
+	assert.Nil(encoder.Encode(remote.Version), "Could not encode version")
+	assert.Nil(encoder.Encode("secret"), "Could not encode token")
+	assert.Nil(encoder.Encode(remote.CmdBeginTx), "Could not encode CmdBeginTx")
+
+	err := ServerWithOpts(ctx, db.AbstractKV(), &inBuf, &outBuf, closer, opts)
+	require.NoError(err, "Error while calling Server")
+
+	var responseCode remote.ResponseCode
+	var v uint64
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdNegotiateVersion")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(&v), "Could not decode version returned by CmdNegotiateVersion")
+	assert.Equal(Version, v)
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBeginTx")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+
+	// Wrong token
+	inBuf.Reset()
+	outBuf.Reset()
+	assert.Nil(encoder.Encode(remote.CmdNegotiateVersion), "Could not encode CmdNegotiateVersion")
+	assert.Nil(encoder.Encode(remote.Version), "Could not encode version")
+	assert.Nil(encoder.Encode("wrong"), "Could not encode token")
+	assert.Nil(encoder.Encode(remote.CmdBeginTx), "Could not encode CmdBeginTx")
+	require.Error(ServerWithOpts(ctx, db.AbstractKV(), &inBuf, &outBuf, closer, opts), "Wrong token must be rejected")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdNegotiateVersion")
+	assert.Equal(remote.ResponseErr, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(new(string)), "Could not decode the error message")
+
+	// No token, the client is rejected without waiting for one
+	inBuf.Reset()
+	outBuf.Reset()
+	assert.Nil(encoder.Encode(remote.CmdVersion), "Could not encode CmdVersion")
+	require.Error(ServerWithOpts(ctx, db.AbstractKV(), &inBuf, &outBuf, closer, opts), "Client without token must be rejected")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdVersion")
+	assert.Equal(remote.ResponseErr, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(new(string)), "Could not decode the error message")
+
+	// No authentication at all
+	inBuf.Reset()
+	outBuf.Reset()
+	assert.Nil(encoder.Encode(remote.CmdBeginTx), "Could not encode CmdBeginTx")
+	require.Error(ServerWithOpts(ctx, db.AbstractKV(), &inBuf, &outBuf, closer, opts), "Commands before authentication must be rejected")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBeginTx")
+	assert.Equal(remote.ResponseErr, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(new(string)), "Could not decode the error message")
 }
 
 func TestCmdBeginEndError(t *testing.T) {
@@ -116,6 +236,35 @@ func TestCmdBeginEndError(t *testing.T) {
 	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
 }
 
+func TestCmdBeginTxNested(t *testing.T) {
+	assert, require, ctx, db := assert.New(t), require.New(t), context.Background(), ethdb.NewMemDatabase()
+
+	// ---------- Start of boilerplate code
+	var inBuf bytes.Buffer
+	encoder := codecpool.Encoder(&inBuf)
+	defer codecpool.Return(encoder)
+	// output buffer to receive the result of the command
+	var outBuf bytes.Buffer
+	decoder := codecpool.Decoder(&outBuf)
+	defer codecpool.Return(decoder)
+	// ---------- End of boilerplate code
+	var responseCode remote.ResponseCode
+	var errorMessage string
+	for _, second := range []remote.Command{remote.CmdBeginTx, remote.CmdBeginWriteTx} {
+		inBuf.Reset()
+		outBuf.Reset()
+		assert.Nil(encoder.Encode(remote.CmdBeginTx), "Could not encode CmdBeginTx")
+		assert.Nil(encoder.Encode(second), "Could not encode the second command")
+		require.Error(Server(ctx, db.AbstractKV(), &inBuf, &outBuf, closer), "Transaction must not be started while another one is open")
+
+		assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBeginTx")
+		assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+		assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by the second command")
+		assert.Equal(remote.ResponseErr, responseCode, "unexpected response code")
+		assert.Nil(decoder.Decode(&errorMessage), "Could not decode errorMessage returned by the second command")
+	}
+}
+
 func TestCmdBucket(t *testing.T) {
 	assert, require, ctx, db := assert.New(t), require.New(t), context.Background(), ethdb.NewMemDatabase()
 
@@ -234,6 +383,109 @@ func TestCmdGet(t *testing.T) {
 	assert.Nil(value, "Wrong value from CmdGet")
 }
 
+func TestCmdPutDeleteCommit(t *testing.T) {
+	assert, require, ctx, db := assert.New(t), require.New(t), context.Background(), ethdb.NewMemDatabase()
+
+	// ---------- Start of boilerplate code
+	// Prepare input buffer with one command CmdVersion
+	var inBuf bytes.Buffer
+	encoder := codecpool.Encoder(&inBuf)
+	defer codecpool.Return(encoder)
+	// output buffer to receive the result of the command
+	var outBuf bytes.Buffer
+	decoder := codecpool.Decoder(&outBuf)
+	defer codecpool.Return(decoder)
+	// ---------- End of boilerplate code
+	// Create a bucket and populate some values
+	var name = []byte("testbucket")
+	if err := db.KV().Update(func(tx *bolt.Tx) error {
+		b, err1 := tx.CreateBucket(name, false)
+		if err1 != nil {
+			return err1
+		}
+		return b.Put([]byte(key1), []byte(value1))
+	}); err != nil {
+		t.Errorf("Could not create and populate a bucket: %v", err)
+	}
+	assert.Nil(encoder.Encode(remote.CmdBeginWriteTx), "Could not encode CmdBeginWriteTx")
+
+	assert.Nil(encoder.Encode(remote.CmdBucket), "Could not encode CmdBucket")
+	assert.Nil(encoder.Encode(&name), "Could not encode name for CmdBucket")
+
+	var bucketHandle uint64 = 1
+	var key = []byte(key2)
+	var value = []byte(value2)
+	assert.Nil(encoder.Encode(remote.CmdPut), "Could not encode CmdPut")
+	assert.Nil(encoder.Encode(bucketHandle), "Could not encode bucketHandle for CmdPut")
+	assert.Nil(encoder.Encode(&key), "Could not encode key for CmdPut")
+	assert.Nil(encoder.Encode(&value), "Could not encode value for CmdPut")
+
+	key = []byte(key1)
+	assert.Nil(encoder.Encode(remote.CmdDelete), "Could not encode CmdDelete")
+	assert.Nil(encoder.Encode(bucketHandle), "Could not encode bucketHandle for CmdDelete")
+	assert.Nil(encoder.Encode(&key), "Could not encode key for CmdDelete")
+
+	assert.Nil(encoder.Encode(remote.CmdCommitTx), "Could not encode CmdCommitTx")
+
+	// Writes in read-only transactions are rejected
+	assert.Nil(encoder.Encode(remote.CmdBeginTx), "Could not encode CmdBeginTx")
+	assert.Nil(encoder.Encode(remote.CmdBucket), "Could not encode CmdBucket")
+	assert.Nil(encoder.Encode(&name), "Could not encode name for CmdBucket")
+	bucketHandle = 2
+	key = []byte(key3)
+	value = []byte(value3)
+	assert.Nil(encoder.Encode(remote.CmdPut), "Could not encode CmdPut")
+	assert.Nil(encoder.Encode(bucketHandle), "Could not encode bucketHandle for CmdPut")
+	assert.Nil(encoder.Encode(&key), "Could not encode key for CmdPut")
+	assert.Nil(encoder.Encode(&value), "Could not encode value for CmdPut")
+	assert.Nil(encoder.Encode(remote.CmdEndTx), "Could not encode CmdEndTx")
+
+	// By now we constructed all input requests, now we call the
+	// Server to process them all
+	err := Server(ctx, db.AbstractKV(), &inBuf, &outBuf, closer)
+	require.NoError(err, "Error while calling Server")
+
+	var responseCode remote.ResponseCode
+	// Results of CmdBeginWriteTx, CmdBucket, CmdPut, CmdDelete, CmdCommitTx
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBeginWriteTx")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBucket")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(&bucketHandle), "Could not decode response from CmdBucket")
+	assert.Equal(uint64(1), bucketHandle, "Unexpected bucketHandle")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdPut")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdDelete")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdCommitTx")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+	// Results of CmdBeginTx, CmdBucket, CmdPut, CmdEndTx
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBeginTx")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBucket")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+	assert.Nil(decoder.Decode(&bucketHandle), "Could not decode response from CmdBucket")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdPut")
+	assert.Equal(remote.ResponseErr, responseCode, "unexpected response code")
+	var errorMessage string
+	assert.Nil(decoder.Decode(&errorMessage), "Could not decode errorMessage returned by CmdPut")
+	assert.Nil(decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdEndTx")
+	assert.Equal(remote.ResponseOk, responseCode, "unexpected response code")
+
+	if err := db.KV().View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(name)
+		v1, _ := b.Get([]byte(key1))
+		assert.Nil(v1, "key1 should be deleted")
+		v2, _ := b.Get([]byte(key2))
+		assert.Equal(value2, string(v2), "key2 should be committed")
+		v3, _ := b.Get([]byte(key3))
+		assert.Nil(v3, "key3 should not be written")
+		return nil
+	}); err != nil {
+		t.Errorf("Could not read the bucket: %v", err)
+	}
+}
+
 func TestCmdSeek(t *testing.T) {
 	assert, require, ctx, db := assert.New(t), require.New(t), context.Background(), ethdb.NewMemDatabase()
 
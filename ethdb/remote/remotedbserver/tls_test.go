@@ -0,0 +1,110 @@
+package remotedbserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
+	"github.com/stretchr/testify/require"
+)
+
+// generateCert creates a certificate signed by the parent (self-signed if parent is nil)
+// and writes it, together with its key, into the dir
+func generateCert(t *testing.T, dir, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if isCA {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return cert, key
+}
+
+func TestTLSAndToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remotedb-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, caKey := generateCert(t, dir, "ca", true, nil, nil)
+	generateCert(t, dir, "server", false, ca, caKey)
+	generateCert(t, dir, "client", false, ca, caKey)
+	// Certificate not signed by the CA
+	generateCert(t, dir, "stranger", false, nil, nil)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	serverTLS, err := remote.NewServerTLSConfig(file("server.crt"), file("server.key"), file("ca.crt"))
+	require.NoError(t, err)
+
+	db := ethdb.NewMemDatabase()
+	require.NoError(t, db.Put(dbutils.CurrentStateBucket, []byte("key"), []byte("value")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	opts := Opts{TLS: serverTLS, Token: "secret"}
+	go Listen(ctx, tls.NewListener(ln, serverTLS), db.AbstractKV(), opts)
+
+	read := func(certName, token string) error {
+		clientTLS, err := remote.NewClientTLSConfig(file(certName+".crt"), file(certName+".key"), file("ca.crt"))
+		require.NoError(t, err)
+		remoteDb, err := ethdb.NewRemote().Path(ln.Addr().String()).TLS(clientTLS).Token(token).Open(ctx)
+		require.NoError(t, err)
+		defer remoteDb.Close()
+
+		viewCtx, viewCancel := context.WithTimeout(ctx, time.Second)
+		defer viewCancel()
+		return remoteDb.View(viewCtx, func(tx ethdb.Tx) error {
+			v, err := tx.Bucket(dbutils.CurrentStateBucket).Get([]byte("key"))
+			if err != nil {
+				return err
+			}
+			require.Equal(t, []byte("value"), v)
+			return nil
+		})
+	}
+
+	require.NoError(t, read("client", "secret"))
+	require.Error(t, read("client", "wrong"), "wrong token must be rejected")
+	err = read("client", "")
+	require.True(t, errors.Is(err, remote.ErrHandshakeRejected), "client without token must fail fast, got %v", err)
+	require.Error(t, read("stranger", "secret"), "client certificate not signed by the CA must be rejected")
+}
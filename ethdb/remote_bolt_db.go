@@ -20,6 +20,7 @@ package ethdb
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
@@ -31,6 +32,7 @@ import (
 type RemoteBoltDatabase struct {
 	db  KV         // BoltDB instance
 	log log.Logger // Contextual logger tracking the database path
+	id  uint64
 }
 
 // NewRemoteBoltDatabase returns a BoltDB wrapper.
@@ -40,9 +42,47 @@ func NewRemoteBoltDatabase(db KV) *RemoteBoltDatabase {
 	return &RemoteBoltDatabase{
 		db:  db,
 		log: logger,
+		id:  id(),
 	}
 }
 
+// Put inserts or updates a single entry, the server must support protocol version remote.WriteTxVersion
+func (db *RemoteBoltDatabase) Put(bucket, key []byte, value []byte) error {
+	return db.db.Update(context.Background(), func(tx Tx) error {
+		return tx.Bucket(bucket).Put(key, value)
+	})
+}
+
+// MultiPut inserts, updates or deletes (for nil values) multiple entries in one write transaction
+func (db *RemoteBoltDatabase) MultiPut(tuples ...[]byte) (uint64, error) {
+	err := db.db.Update(context.Background(), func(tx Tx) error {
+		for i := 0; i < len(tuples); i += 3 {
+			b := tx.Bucket(tuples[i])
+			if tuples[i+2] == nil {
+				if err := b.Delete(tuples[i+1]); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := b.Put(tuples[i+1], tuples[i+2]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(tuples) / 3), nil
+}
+
+// Delete removes a single entry, the server must support protocol version remote.WriteTxVersion
+func (db *RemoteBoltDatabase) Delete(bucket, key []byte) error {
+	return db.db.Update(context.Background(), func(tx Tx) error {
+		return tx.Bucket(bucket).Delete(key)
+	})
+}
+
 // Has checks if the value exists
 //
 // Deprecated: DB accessors must accept Tx object instead of open Read transaction internally
@@ -136,21 +176,18 @@ func (db *RemoteBoltDatabase) GetIndexChunk(bucket, key []byte, timestamp uint64
 
 // GetAsOf returns the value valid as of a given timestamp.
 func (db *RemoteBoltDatabase) GetAsOf(bucket, hBucket, key []byte, timestamp uint64) ([]byte, error) {
-	composite, _ := dbutils.CompositeKeySuffix(key, timestamp)
 	var dat []byte
 	err := db.db.View(context.Background(), func(tx Tx) error {
-		{
-			hK, hV, err := tx.Bucket(hBucket).Cursor().Seek(composite)
-			if err != nil {
-				return err
-			}
-
-			if hK != nil && bytes.HasPrefix(hK, key) {
-				dat = make([]byte, len(hV))
-				copy(dat, hV)
-				return nil
-			}
+		v, err := FindByHistory(tx, hBucket, key, timestamp)
+		if err == nil {
+			dat = make([]byte, len(v))
+			copy(dat, v)
+			return nil
 		}
+		if !errors.Is(err, ErrKeyNotFound) {
+			return err
+		}
+		// No changes after the timestamp, the current value is the one
 		{
 			v, err := tx.Bucket(bucket).Get(key)
 			if err != nil {
@@ -164,8 +201,6 @@ func (db *RemoteBoltDatabase) GetAsOf(bucket, hBucket, key []byte, timestamp uin
 			copy(dat, v)
 			return nil
 		}
-
-		return ErrKeyNotFound
 	})
 	return dat, err
 }
@@ -270,102 +305,9 @@ func (db *RemoteBoltDatabase) MultiWalk(bucket []byte, startkeys [][]byte, fixed
 }
 
 func (db *RemoteBoltDatabase) WalkAsOf(bucket, hBucket, startkey []byte, fixedbits uint, timestamp uint64, walker func([]byte, []byte) (bool, error)) error {
-	fixedbytes, mask := Bytesmask(fixedbits)
-	encodedTS := dbutils.EncodeTimestamp(timestamp)
-	l := len(startkey)
-	sl := l + len(encodedTS)
-	keyBuffer := make([]byte, l+len(EndSuffix))
-	err := db.db.View(context.Background(), func(tx Tx) error {
-		var err error
-
-		b := tx.Bucket(bucket)
-		if b == nil {
-			return nil
-		}
-		hB := tx.Bucket(hBucket)
-		if hB == nil {
-			return nil
-		}
-		c := b.Cursor()
-		hC := hB.Cursor()
-		k, v, err := c.Seek(startkey)
-		if err != nil {
-			return err
-		}
-
-		hK, hV, err := hC.Seek(startkey)
-		if err != nil {
-			return err
-		}
-
-		goOn := true
-		for goOn {
-			if k != nil && fixedbits > 0 && !bytes.Equal(k[:fixedbytes-1], startkey[:fixedbytes-1]) {
-				k = nil
-			}
-			if k != nil && fixedbits > 0 && (k[fixedbytes-1]&mask) != (startkey[fixedbytes-1]&mask) {
-				k = nil
-			}
-			if hK != nil && fixedbits > 0 && !bytes.Equal(hK[:fixedbytes-1], startkey[:fixedbytes-1]) {
-				hK = nil
-			}
-			if hK != nil && fixedbits > 0 && (hK[fixedbytes-1]&mask) != (startkey[fixedbytes-1]&mask) {
-				hK = nil
-			}
-
-			// historical key points to an old block
-			if hK != nil && bytes.Compare(hK[l:], encodedTS) < 0 {
-				copy(keyBuffer, hK[:l])
-				copy(keyBuffer[l:], encodedTS)
-				// update historical key/value to the desired block
-				//hK, hV, err = hC.SeekTo(keyBuffer[:sl])
-				hK, hV, err = hC.Seek(keyBuffer[:sl])
-				if err != nil {
-					return err
-				}
-
-				continue
-			}
-
-			var cmp int
-			if k == nil {
-				if hK == nil {
-					break
-				} else {
-					cmp = 1
-				}
-			} else if hK == nil {
-				cmp = -1
-			} else {
-				cmp = bytes.Compare(k, hK[:l])
-			}
-			if cmp < 0 {
-				goOn, err = walker(k, v)
-			} else {
-				goOn, err = walker(hK[:l], hV)
-			}
-			if goOn {
-				if cmp <= 0 {
-					k, v, err = c.Next()
-					if err != nil {
-						return err
-					}
-				}
-				if cmp >= 0 {
-					copy(keyBuffer, hK[:l])
-					copy(keyBuffer[l:], EndSuffix)
-					//hK, hV, err = hC.SeekTo(keyBuffer)
-					hK, hV, err = hC.Seek(keyBuffer)
-					if err != nil {
-						return err
-					}
-				}
-			}
-		}
-
-		return err
+	return db.db.View(context.Background(), func(tx Tx) error {
+		return walkAsOf(tx, bucket, hBucket, startkey, fixedbits, timestamp, walker)
 	})
-	return err
 }
 
 func (db *RemoteBoltDatabase) MultiWalkAsOf(bucket, hBucket []byte, startkeys [][]byte, fixedbits []uint, timestamp uint64, walker func(int, []byte, []byte) error) error {
@@ -537,6 +479,46 @@ func (db *RemoteBoltDatabase) RewindData(timestampSrc, timestampDst uint64) (map
 	return RewindData(db, timestampSrc, timestampDst)
 }
 
+func (db *RemoteBoltDatabase) NewBatch() DbWithPendingMutations {
+	m := &mutation{
+		db:   db,
+		puts: newPuts(),
+	}
+	return m
+}
+
+// IdealBatchSize defines the size of the data batches should ideally add in one write.
+func (db *RemoteBoltDatabase) IdealBatchSize() int {
+	return 100 * 1024
+}
+
+// DiskSize returns 0, the size of the remote database is not known
+func (db *RemoteBoltDatabase) DiskSize() int64 {
+	return 0
+}
+
+func (db *RemoteBoltDatabase) Keys() ([][]byte, error) {
+	return nil, errNotSupported
+}
+
+func (db *RemoteBoltDatabase) MemCopy() Database {
+	panic("remote db doesn't support MemCopy")
+}
+
+// Ancients returns an error as the freezer is not served by the remote database
+func (db *RemoteBoltDatabase) Ancients() (uint64, error) {
+	return 0, errNotSupported
+}
+
+// TruncateAncients returns an error as the freezer is not served by the remote database
+func (db *RemoteBoltDatabase) TruncateAncients(items uint64) error {
+	return errNotSupported
+}
+
+func (db *RemoteBoltDatabase) ID() uint64 {
+	return db.id
+}
+
 func (db *RemoteBoltDatabase) Close() {
 	db.db.Close()
 }
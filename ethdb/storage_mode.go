@@ -0,0 +1,113 @@
+package ethdb
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+// StorageMode is the set of optional data the node writes to the database, it is fixed
+// when the database is created and kept in the StorageMode* keys of DatabaseInfoBucket
+type StorageMode struct {
+	History   bool
+	Receipts  bool
+	TxIndex   bool
+	Preimages bool
+}
+
+var DefaultStorageMode = StorageMode{History: true, Receipts: false, TxIndex: true, Preimages: true}
+
+func (m StorageMode) ToString() string {
+	modeString := ""
+	if m.History {
+		modeString += "h"
+	}
+	if m.Preimages {
+		modeString += "p"
+	}
+	if m.Receipts {
+		modeString += "r"
+	}
+	if m.TxIndex {
+		modeString += "t"
+	}
+	return modeString
+}
+
+func StorageModeFromString(flags string) (StorageMode, error) {
+	mode := StorageMode{}
+	for _, flag := range flags {
+		switch flag {
+		case 'h':
+			mode.History = true
+		case 'r':
+			mode.Receipts = true
+		case 't':
+			mode.TxIndex = true
+		case 'p':
+			mode.Preimages = true
+		default:
+			return mode, fmt.Errorf("unexpected flag found: %c", flag)
+		}
+	}
+
+	return mode, nil
+}
+
+// GetStorageModeFromDB reads the storage mode the database was created with
+func GetStorageModeFromDB(db Getter) (StorageMode, error) {
+	var sm StorageMode
+	for _, mode := range []struct {
+		key   []byte
+		value *bool
+	}{
+		{dbutils.StorageModeHistory, &sm.History},
+		{dbutils.StorageModePreImages, &sm.Preimages},
+		{dbutils.StorageModeReceipts, &sm.Receipts},
+		{dbutils.StorageModeTxIndex, &sm.TxIndex},
+	} {
+		v, err := db.Get(dbutils.DatabaseInfoBucket, mode.key)
+		if err != nil && err != ErrKeyNotFound {
+			return StorageMode{}, err
+		}
+		*mode.value = len(v) > 0
+	}
+	return sm, nil
+}
+
+// SetStorageModeIfNotExist writes the storage mode to a new database, the modes
+// already written are kept
+func SetStorageModeIfNotExist(db Database, sm StorageMode) error {
+	for _, mode := range []struct {
+		key   []byte
+		value bool
+	}{
+		{dbutils.StorageModeHistory, sm.History},
+		{dbutils.StorageModePreImages, sm.Preimages},
+		{dbutils.StorageModeReceipts, sm.Receipts},
+		{dbutils.StorageModeTxIndex, sm.TxIndex},
+	} {
+		if err := setModeOnEmpty(db, mode.key, mode.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setModeOnEmpty(db Database, key []byte, currentValue bool) error {
+	_, err := db.Get(dbutils.DatabaseInfoBucket, key)
+	if err != nil && err != ErrKeyNotFound {
+		return err
+	}
+	if err == ErrKeyNotFound {
+		val := []byte{}
+		if currentValue {
+			val = []byte{1}
+		}
+		if err = db.Put(dbutils.DatabaseInfoBucket, key, val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
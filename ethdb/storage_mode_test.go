@@ -1,16 +1,15 @@
-package eth
+package ethdb
 
 import (
 	"reflect"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
-	"github.com/ledgerwatch/turbo-geth/ethdb"
 )
 
 func TestSetStorageModeIfNotExist(t *testing.T) {
-	db := ethdb.NewMemDatabase()
-	sm, err := getStorageModeFromDB(db)
+	db := NewMemDatabase()
+	sm, err := GetStorageModeFromDB(db)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -19,7 +18,7 @@ func TestSetStorageModeIfNotExist(t *testing.T) {
 		t.Fatal()
 	}
 
-	err = setStorageModeIfNotExist(db, StorageMode{
+	err = SetStorageModeIfNotExist(db, StorageMode{
 		true,
 		true,
 		true,
@@ -29,7 +28,7 @@ func TestSetStorageModeIfNotExist(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	sm, err = getStorageModeFromDB(db)
+	sm, err = GetStorageModeFromDB(db)
 	if err != nil {
 		t.Fatal(err)
 	}
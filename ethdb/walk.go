@@ -17,6 +17,7 @@
 package ethdb
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 
@@ -24,6 +25,7 @@ import (
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
 )
 
 var EndSuffix = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
@@ -161,3 +163,317 @@ func GetHistoricalAccountIncarnation(db Getter, addrHash common.Hash, timestamp
 	}
 	return
 }
+
+// FindByHistory looks the key up in the history index and returns its value from the change set of the first
+// block after timestamp. ErrKeyNotFound means that the key has not changed since, and the current value is valid
+func FindByHistory(tx Tx, hBucket []byte, key []byte, timestamp uint64) ([]byte, error) {
+	var keyF []byte
+	if bytes.Equal(dbutils.StorageHistoryBucket, hBucket) {
+		keyF = make([]byte, len(key)-common.IncarnationLength)
+		copy(keyF, key[:common.HashLength])
+		copy(keyF[common.HashLength:], key[common.HashLength+common.IncarnationLength:])
+	} else {
+		keyF = common.CopyBytes(key)
+	}
+
+	k, v, err := tx.Bucket(hBucket).Cursor().Seek(dbutils.IndexChunkKey(key, timestamp))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(k, keyF) {
+		return nil, ErrKeyNotFound
+	}
+	index := dbutils.WrapHistoryIndex(v)
+
+	changeSetBlock, set, ok := index.Search(timestamp)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	// set == true if this change was from empty record (non-existent account) to non-empty
+	// In such case, we do not need to examine changeSet and return empty data
+	if set {
+		return []byte{}, nil
+	}
+	changeSetData, err := tx.Bucket(dbutils.ChangeSetByIndexBucket(hBucket)).Get(dbutils.EncodeTimestamp(changeSetBlock))
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	switch {
+	case bytes.Equal(dbutils.AccountsHistoryBucket, hBucket):
+		data, err = changeset.AccountChangeSetBytes(changeSetData).FindLast(key)
+	case bytes.Equal(dbutils.StorageHistoryBucket, hBucket):
+		data, err = changeset.StorageChangeSetBytes(changeSetData).FindWithoutIncarnation(key[:common.HashLength], key[common.HashLength+common.IncarnationLength:])
+	}
+	if err != nil {
+		return nil, ErrKeyNotFound
+	}
+
+	//restore codehash
+	if bytes.Equal(dbutils.AccountsHistoryBucket, hBucket) {
+		var acc accounts.Account
+		if err := acc.DecodeForStorage(data); err != nil {
+			return nil, err
+		}
+		if acc.Incarnation > 0 && acc.IsEmptyCodeHash() {
+			codeHash, err := tx.Bucket(dbutils.ContractCodeBucket).Get(dbutils.GenerateStoragePrefix(key, acc.Incarnation))
+			if err != nil {
+				return nil, err
+			}
+			if len(codeHash) > 0 {
+				acc.CodeHash = common.BytesToHash(codeHash)
+			}
+			data = make([]byte, acc.EncodingLengthForStorage())
+			acc.EncodeForStorage(data)
+		}
+	}
+	return data, nil
+}
+
+// walkAsOf implements WalkAsOf of the databases on top of the KV, it merges the current state with the
+// thin history of the accounts or of the storage
+func walkAsOf(tx Tx, bucket, hBucket, startkey []byte, fixedbits uint, timestamp uint64, walker func(k []byte, v []byte) (bool, error)) error {
+	if bytes.Equal(bucket, dbutils.CurrentStateBucket) && bytes.Equal(hBucket, dbutils.AccountsHistoryBucket) {
+		return walkAsOfThinAccounts(tx, startkey, fixedbits, timestamp, walker)
+	} else if bytes.Equal(bucket, dbutils.CurrentStateBucket) && bytes.Equal(hBucket, dbutils.StorageHistoryBucket) {
+		return walkAsOfThinStorage(tx, startkey, fixedbits, timestamp, func(k1, k2, v []byte) (bool, error) {
+			return walker(append(common.CopyBytes(k1), k2...), v)
+		})
+	}
+	panic("Not implemented for arbitrary buckets")
+}
+
+func walkAsOfThinAccounts(tx Tx, startkey []byte, fixedbits uint, timestamp uint64, walker func(k []byte, v []byte) (bool, error)) error {
+	csB := tx.Bucket(dbutils.AccountChangeSetBucket)
+	//for state
+	mainCursor := tx.Bucket(dbutils.CurrentStateBucket).Cursor().Prefix(startkey).MatchBits(fixedbits)
+	//for historic data
+	historyCursor := newKVSplitCursor(
+		tx.Bucket(dbutils.AccountsHistoryBucket),
+		startkey,
+		fixedbits,
+		common.HashLength,   /* part1end */
+		common.HashLength,   /* part2start */
+		common.HashLength+8, /* part3start */
+	)
+	nextAccount := func(k, v []byte, err error) ([]byte, []byte, error) {
+		for err == nil && k != nil && len(k) > common.HashLength {
+			k, v, err = mainCursor.Next()
+		}
+		return k, v, err
+	}
+	k, v, err := nextAccount(mainCursor.First())
+	if err != nil {
+		return err
+	}
+	hK, tsEnc, _, hV, err := historyCursor.First()
+	for err == nil && hK != nil && binary.BigEndian.Uint64(tsEnc) < timestamp {
+		hK, tsEnc, _, hV, err = historyCursor.Next()
+	}
+	if err != nil {
+		return err
+	}
+	goOn := true
+	for goOn {
+		var cmp int
+		if k == nil {
+			if hK == nil {
+				break
+			} else {
+				cmp = 1
+			}
+		} else if hK == nil {
+			cmp = -1
+		} else {
+			cmp = bytes.Compare(k, hK)
+		}
+		if cmp < 0 {
+			goOn, err = walker(k, v)
+		} else {
+			index := dbutils.WrapHistoryIndex(hV)
+			if changeSetBlock, set, ok := index.Search(timestamp); ok {
+				// set == true if this change was from empty record (non-existent account) to non-empty
+				// In such case, we do not need to examine changeSet and simply skip the record
+				if !set {
+					// Extract value from the changeSet
+					changeSetData, err1 := csB.Get(dbutils.EncodeTimestamp(changeSetBlock))
+					if err1 != nil {
+						return err1
+					}
+					if changeSetData == nil {
+						return fmt.Errorf("could not find ChangeSet record for index entry %d (query timestamp %d)", changeSetBlock, timestamp)
+					}
+					data, err1 := changeset.AccountChangeSetBytes(changeSetData).FindLast(hK)
+					if err1 != nil {
+						return fmt.Errorf("could not find key %x in the ChangeSet record for index entry %d (query timestamp %d)",
+							hK,
+							changeSetBlock,
+							timestamp,
+						)
+					}
+					if len(data) > 0 { // Skip accounts did not exist
+						goOn, err = walker(hK, data)
+					}
+				}
+			} else if cmp == 0 {
+				goOn, err = walker(k, v)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if goOn {
+			if cmp <= 0 {
+				if k, v, err = nextAccount(mainCursor.Next()); err != nil {
+					return err
+				}
+			}
+			if cmp >= 0 {
+				hK0 := common.CopyBytes(hK) // the key of the cursor is only valid until Next
+				for hK != nil && (bytes.Equal(hK0, hK) || binary.BigEndian.Uint64(tsEnc) < timestamp) {
+					if hK, tsEnc, _, hV, err = historyCursor.Next(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func walkAsOfThinStorage(tx Tx, startkey []byte, fixedbits uint, timestamp uint64, walker func(k1, k2, v []byte) (bool, error)) error {
+	csB := tx.Bucket(dbutils.StorageChangeSetBucket)
+	startkeyNoInc := make([]byte, len(startkey)-common.IncarnationLength)
+	copy(startkeyNoInc, startkey[:common.HashLength])
+	copy(startkeyNoInc[common.HashLength:], startkey[common.HashLength+common.IncarnationLength:])
+	//for storage
+	mainCursor := newKVSplitCursor(
+		tx.Bucket(dbutils.CurrentStateBucket),
+		startkey,
+		fixedbits,
+		common.HashLength, /* part1end */
+		common.HashLength+common.IncarnationLength,                   /* part2start */
+		common.HashLength+common.IncarnationLength+common.HashLength, /* part3start */
+	)
+	//for historic data
+	historyCursor := newKVSplitCursor(
+		tx.Bucket(dbutils.StorageHistoryBucket),
+		startkeyNoInc,
+		fixedbits-8*common.IncarnationLength,
+		common.HashLength,   /* part1end */
+		common.HashLength,   /* part2start */
+		common.HashLength*2, /* part3start */
+	)
+	addrHash, keyHash, _, v, err := mainCursor.First()
+	if err != nil {
+		return err
+	}
+	hAddrHash, hKeyHash, tsEnc, hV, err := historyCursor.First()
+	for err == nil && hKeyHash != nil && binary.BigEndian.Uint64(tsEnc) < timestamp {
+		hAddrHash, hKeyHash, tsEnc, hV, err = historyCursor.Next()
+	}
+	if err != nil {
+		return err
+	}
+	goOn := true
+	for goOn {
+		var cmp int
+		if keyHash == nil {
+			if hKeyHash == nil {
+				break
+			} else {
+				cmp = 1
+			}
+		} else if hKeyHash == nil {
+			cmp = -1
+		} else {
+			cmp = bytes.Compare(keyHash, hKeyHash)
+		}
+		if cmp < 0 {
+			goOn, err = walker(addrHash, keyHash, v)
+		} else {
+			index := dbutils.WrapHistoryIndex(hV)
+			if changeSetBlock, set, ok := index.Search(timestamp); ok {
+				// set == true if this change was from empty record (non-existent storage item) to non-empty
+				// In such case, we do not need to examine changeSet and simply skip the record
+				if !set {
+					// Extract value from the changeSet
+					changeSetData, err1 := csB.Get(dbutils.EncodeTimestamp(changeSetBlock))
+					if err1 != nil {
+						return err1
+					}
+					if changeSetData == nil {
+						return fmt.Errorf("could not find ChangeSet record for index entry %d (query timestamp %d)", changeSetBlock, timestamp)
+					}
+					data, err1 := changeset.StorageChangeSetBytes(changeSetData).FindWithoutIncarnation(hAddrHash, hKeyHash)
+					if err1 != nil {
+						return fmt.Errorf("could not find key %x%x in the ChangeSet record for index entry %d (query timestamp %d): %v",
+							hAddrHash, hKeyHash,
+							changeSetBlock,
+							timestamp,
+							err1,
+						)
+					}
+					if len(data) > 0 { // Skip deleted entries
+						goOn, err = walker(hAddrHash, hKeyHash, data)
+					}
+				}
+			} else if cmp == 0 {
+				goOn, err = walker(addrHash, keyHash, v)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if goOn {
+			if cmp <= 0 {
+				if addrHash, keyHash, _, v, err = mainCursor.Next(); err != nil {
+					return err
+				}
+			}
+			if cmp >= 0 {
+				hKeyHash0 := common.CopyBytes(hKeyHash)
+				for hKeyHash != nil && (bytes.Equal(hKeyHash0, hKeyHash) || binary.BigEndian.Uint64(tsEnc) < timestamp) {
+					if hAddrHash, hKeyHash, tsEnc, hV, err = historyCursor.Next(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// kvSplitCursor splits the keys into three parts, it is used to ignore the incarnations in the middle
+// of the composite storage keys without reconstructing the keys. The keys are matched by the cursor itself
+type kvSplitCursor struct {
+	c          Cursor
+	part1end   int // Position in the key where the first part ends
+	part2start int // Position in the key where the second part starts
+	part3start int // Position in the key where the third part starts
+}
+
+func newKVSplitCursor(b Bucket, startkey []byte, matchBits uint, part1end, part2start, part3start int) *kvSplitCursor {
+	return &kvSplitCursor{
+		c:          b.Cursor().Prefix(startkey).MatchBits(matchBits),
+		part1end:   part1end,
+		part2start: part2start,
+		part3start: part3start,
+	}
+}
+
+func (sc *kvSplitCursor) split(k, v []byte, err error) (key1, key2, key3, val []byte, _ error) {
+	if err != nil || k == nil {
+		return nil, nil, nil, nil, err
+	}
+	return k[:sc.part1end], k[sc.part2start:sc.part3start], k[sc.part3start:], v, nil
+}
+
+func (sc *kvSplitCursor) First() (key1, key2, key3, val []byte, err error) {
+	return sc.split(sc.c.First())
+}
+
+func (sc *kvSplitCursor) Next() (key1, key2, key3, val []byte, err error) {
+	return sc.split(sc.c.Next())
+}
@@ -550,56 +550,46 @@ type StorageResult struct {
 }
 
 // GetProof returns the Merkle-proof for a given account and optionally some storage keys.
-func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*AccountResult, error) {
-	/*
-		state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
-		if state == nil || err != nil {
-			return nil, err
-		}
-
-		storageTrie := state.StorageTrie(address)
-		storageHash := types.EmptyRootHash
-		codeHash := state.GetCodeHash(address)
-		storageProof := make([]StorageResult, len(storageKeys))
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash) (*AccountResult, error) {
+	state, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
 
-		// if we have a storageTrie, (which means the account exists), we can update the storagehash
-		if storageTrie != nil {
-			storageHash = storageTrie.Hash()
-		} else {
-			// no storageTrie means the account does not exist, so the codeHash is the hash of an empty bytearray.
-			codeHash = crypto.Keccak256Hash(nil)
-		}
+	keys := make([]common.Hash, len(storageKeys))
+	for i, key := range storageKeys {
+		keys[i] = common.HexToHash(key)
+	}
+	proof, err := state.GetProofs(address, keys)
+	if err != nil {
+		return nil, err
+	}
+	// The parts of the trie off the paths to the keys come from the intermediate hashes
+	if len(proof.Account) > 0 && crypto.Keccak256Hash(proof.Account[0]) != header.Root {
+		return nil, fmt.Errorf("proof does not match the state root %x of block %d", header.Root, header.Number.Uint64())
+	}
 
-		// create the proof for the storageKeys
-		for i, key := range storageKeys {
-			if storageTrie != nil {
-				proof, storageError := state.GetStorageProof(address, common.HexToHash(key))
-				if storageError != nil {
-					return nil, storageError
-				}
-				storageProof[i] = StorageResult{key, (*hexutil.Big)(state.GetState(address, common.HexToHash(key)).Big()), common.ToHexArray(proof)}
-			} else {
-				storageProof[i] = StorageResult{key, &hexutil.Big{}, []string{}}
-			}
-		}
+	codeHash := state.GetCodeHash(address)
+	if !state.Exist(address) {
+		// the account does not exist, so the codeHash is the hash of an empty bytearray.
+		codeHash = crypto.Keccak256Hash(nil)
+	}
 
-		// create the accountProof
-		accountProof, proofErr := state.GetProof(address)
-		if proofErr != nil {
-			return nil, proofErr
-		}
+	// create the proof for the storageKeys
+	storageProof := make([]StorageResult, len(storageKeys))
+	for i, key := range storageKeys {
+		storageProof[i] = StorageResult{key, (*hexutil.Big)(state.GetState(address, keys[i]).Big()), common.ToHexArray(proof.Storage[i])}
+	}
 
-		return &AccountResult{
-			Address:      address,
-			AccountProof: common.ToHexArray(accountProof),
-			Balance:      (*hexutil.Big)(state.GetBalance(address)),
-			CodeHash:     codeHash,
-			Nonce:        hexutil.Uint64(state.GetNonce(address)),
-			StorageHash:  storageHash,
-			StorageProof: storageProof,
-		}, state.Error()
-	*/
-	return nil, nil
+	return &AccountResult{
+		Address:      address,
+		AccountProof: common.ToHexArray(proof.Account),
+		Balance:      (*hexutil.Big)(state.GetBalance(address)),
+		CodeHash:     codeHash,
+		Nonce:        hexutil.Uint64(state.GetNonce(address)),
+		StorageHash:  proof.StorageHash,
+		StorageProof: storageProof,
+	}, state.Error()
 }
 
 // GetHeaderByNumber returns the requested canonical block header.
@@ -1103,9 +1093,9 @@ type RPCTransaction struct {
 	S                *hexutil.Big    `json:"s"`
 }
 
-// newRPCTransaction returns a transaction that will serialize to the RPC
+// NewRPCTransaction returns a transaction that will serialize to the RPC
 // representation, with the given location metadata set (if available).
-func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64) *RPCTransaction {
+func NewRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64) *RPCTransaction {
 	var signer types.Signer = types.FrontierSigner{}
 	if tx.Protected() {
 		signer = types.NewEIP155Signer(tx.ChainId())
@@ -1136,7 +1126,7 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 
 // newRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
 func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
-	return newRPCTransaction(tx, common.Hash{}, 0, 0)
+	return NewRPCTransaction(tx, common.Hash{}, 0, 0)
 }
 
 // newRPCTransactionFromBlockIndex returns a transaction that will serialize to the RPC representation.
@@ -1145,7 +1135,7 @@ func newRPCTransactionFromBlockIndex(b *types.Block, index uint64) *RPCTransacti
 	if index >= uint64(len(txs)) {
 		return nil
 	}
-	return newRPCTransaction(txs[index], b.Hash(), b.NumberU64(), index)
+	return NewRPCTransaction(txs[index], b.Hash(), b.NumberU64(), index)
 }
 
 // newRPCRawTransactionFromBlockIndex returns the bytes of a transaction given a block and a transaction index.
@@ -1256,7 +1246,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, has
 		return nil, err
 	}
 	if tx != nil {
-		return newRPCTransaction(tx, blockHash, blockNumber, index), nil
+		return NewRPCTransaction(tx, blockHash, blockNumber, index), nil
 	}
 	// No finalized transaction, try to retrieve it from the pool
 	if tx := s.b.GetPoolTransaction(hash); tx != nil {
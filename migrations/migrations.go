@@ -1,14 +1,34 @@
 package migrations
 
 import (
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 )
 
+// Migration is a one-off change of the data in the database. Name is the ID of the migration,
+// the migrations are applied in the order of the list and the name of the last applied one
+// is kept in DatabaseInfoBucket, so the names must be unique and never change.
 type Migration struct {
 	Name string
-	Up   func(db ethdb.Database, history, receipts, txIndex, preImages, thinHistory bool) error
+	// Up applies the migration, progress is the last checkpoint saved by the migration or nil.
+	// A long migration saves the checkpoints in the same batch as the migrated data, then
+	// it resumes from the last checkpoint when the node is restarted in the middle of it
+	Up func(db ethdb.Database, sm ethdb.StorageMode, progress []byte, checkpoint Checkpoint) error
+}
+
+// Checkpoint writes the progress of the migration to the putter, which is usually the batch
+// with the migrated data
+type Checkpoint func(putter ethdb.Putter, progress []byte) error
+
+// Status is the state of a migration in the database
+type Status struct {
+	Name     string
+	Applied  bool
+	Progress []byte // Last checkpoint of the migration being applied
 }
 
 func NewMigrator() *Migrator {
@@ -21,39 +41,133 @@ type Migrator struct {
 	Migrations []Migration
 }
 
-func (m *Migrator) Apply(db ethdb.Database, history, receipts, txIndex, preImages, thinHistory bool) error {
-	if len(m.Migrations) == 0 {
-		return nil
+// Apply applies the migrations after the last applied one
+func (m *Migrator) Apply(db ethdb.Database, sm ethdb.StorageMode) error {
+	pending, err := m.pending(db)
+	if err != nil {
+		return err
+	}
+	for _, v := range pending {
+		if err := apply(db, v, sm); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	lastApplied, err := db.Get(dbutils.DatabaseInfoBucket, dbutils.LastAppliedMigration)
-	if err != nil && err != ethdb.ErrKeyNotFound {
-		return err
+// DryRun applies the migrations after the last applied one to a batch, which is rolled back,
+// and returns their names. The migrations must not write to the database past the given one
+func (m *Migrator) DryRun(db ethdb.Database, sm ethdb.StorageMode) ([]string, error) {
+	pending, err := m.pending(db)
+	if err != nil {
+		return nil, err
 	}
+	batch := db.NewBatch()
+	defer batch.Rollback()
 
-	i := len(m.Migrations) - 1
-	for ; i >= 0; i-- {
-		if m.Migrations[i].Name == string(lastApplied) {
-			break
+	names := make([]string, 0, len(pending))
+	for _, v := range pending {
+		if err := apply(batch, v, sm); err != nil {
+			return nil, err
 		}
+		names = append(names, v.Name)
 	}
+	return names, nil
+}
 
-	m.Migrations = m.Migrations[i+1:]
+// Status returns the state of all migrations
+func (m *Migrator) Status(db ethdb.Getter) ([]Status, error) {
+	lastApplied, err := m.lastApplied(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(m.Migrations))
+	for i, v := range m.Migrations {
+		statuses[i] = Status{Name: v.Name, Applied: i <= lastApplied}
+		if statuses[i].Progress, err = readProgress(db, v.Name); err != nil {
+			return nil, err
+		}
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) pending(db ethdb.Getter) ([]Migration, error) {
+	lastApplied, err := m.lastApplied(db)
+	if err != nil {
+		return nil, err
+	}
+	return m.Migrations[lastApplied+1:], nil
+}
+
+// lastApplied returns the index of the last applied migration, -1 if none is applied
+func (m *Migrator) lastApplied(db ethdb.Getter) (int, error) {
+	names := make(map[string]struct{}, len(m.Migrations))
 	for _, v := range m.Migrations {
-		log.Warn("Apply migration", "name", v.Name)
-		err := v.Up(db, history, receipts, txIndex, preImages, thinHistory)
-		if err != nil {
-			return err
+		if _, ok := names[v.Name]; ok {
+			return 0, fmt.Errorf("duplicate migration name: %s", v.Name)
 		}
-		err = db.Put(dbutils.DatabaseInfoBucket, dbutils.LastAppliedMigration, []byte(v.Name))
-		if err != nil {
-			return err
+		names[v.Name] = struct{}{}
+	}
+
+	lastApplied, err := db.Get(dbutils.DatabaseInfoBucket, dbutils.LastAppliedMigration)
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		return 0, err
+	}
+	if len(lastApplied) == 0 {
+		return -1, nil
+	}
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		if m.Migrations[i].Name == string(lastApplied) {
+			return i, nil
 		}
-		log.Warn("Applied migration", "name", v.Name)
 	}
-	return nil
+	return 0, fmt.Errorf("unknown last applied migration: %s", lastApplied)
 }
 
-var migrations = []Migration{
+func apply(db ethdb.Database, v Migration, sm ethdb.StorageMode) error {
+	progressKey := append(common.CopyBytes(dbutils.MigrationProgressPrefix), v.Name...)
+	progress, err := readProgress(db, v.Name)
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		log.Warn("Resume migration", "name", v.Name, "progress", fmt.Sprintf("%x", progress))
+	} else {
+		log.Warn("Apply migration", "name", v.Name)
+	}
+
+	checkpoint := func(putter ethdb.Putter, progress []byte) error {
+		return putter.Put(dbutils.DatabaseInfoBucket, progressKey, progress)
+	}
+	if err := v.Up(db, sm, progress, checkpoint); err != nil {
+		return fmt.Errorf("migration %s: %w", v.Name, err)
+	}
 
+	// The migration is marked as applied and its progress is removed at once
+	batch := db.NewBatch()
+	if err := batch.Delete(dbutils.DatabaseInfoBucket, progressKey); err != nil {
+		return err
+	}
+	if err := batch.Put(dbutils.DatabaseInfoBucket, dbutils.LastAppliedMigration, []byte(v.Name)); err != nil {
+		return err
+	}
+	if _, err := batch.Commit(); err != nil {
+		return err
+	}
+	log.Warn("Applied migration", "name", v.Name)
+	return nil
 }
+
+func readProgress(db ethdb.Getter, name string) ([]byte, error) {
+	progressKey := append(common.CopyBytes(dbutils.MigrationProgressPrefix), name...)
+	progress, err := db.Get(dbutils.DatabaseInfoBucket, progressKey)
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		return nil, err
+	}
+	if len(progress) == 0 {
+		return nil, nil
+	}
+	return progress, nil
+}
+
+var migrations = []Migration{}
@@ -1,9 +1,11 @@
 package migrations
 
 import (
+	"errors"
+	"testing"
+
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
-	"testing"
 )
 
 func TestApplyWithInit(t *testing.T) {
@@ -11,13 +13,13 @@ func TestApplyWithInit(t *testing.T) {
 	migrations = []Migration{
 		{
 			"one",
-			func(db ethdb.Database, history, receipts, txIndex, preImages, thinHistory bool) error {
+			func(db ethdb.Database, sm ethdb.StorageMode, progress []byte, checkpoint Checkpoint) error {
 				return nil
 			},
 		},
 		{
 			"two",
-			func(db ethdb.Database, history, receipts, txIndex, preImages, thinHistory bool) error {
+			func(db ethdb.Database, sm ethdb.StorageMode, progress []byte, checkpoint Checkpoint) error {
 				return nil
 			},
 		},
@@ -25,7 +27,7 @@ func TestApplyWithInit(t *testing.T) {
 
 	migrator := NewMigrator()
 	migrator.Migrations = migrations
-	err := migrator.Apply(db, false, false, false, false, false)
+	err := migrator.Apply(db, ethdb.StorageMode{})
 	if err != nil {
 		t.Fatal()
 	}
@@ -43,14 +45,14 @@ func TestApplyWithoutInit(t *testing.T) {
 	migrations = []Migration{
 		{
 			"one",
-			func(db ethdb.Database, history, receipts, txIndex, preImages, thinHistory bool) error {
+			func(db ethdb.Database, sm ethdb.StorageMode, progress []byte, checkpoint Checkpoint) error {
 				t.Fatal("shouldn't been executed")
 				return nil
 			},
 		},
 		{
 			"two",
-			func(db ethdb.Database, history, receipts, txIndex, preImages, thinHistory bool) error {
+			func(db ethdb.Database, sm ethdb.StorageMode, progress []byte, checkpoint Checkpoint) error {
 				return nil
 			},
 		},
@@ -62,7 +64,7 @@ func TestApplyWithoutInit(t *testing.T) {
 
 	migrator := NewMigrator()
 	migrator.Migrations = migrations
-	err = migrator.Apply(db, false, false, false, false, false)
+	err = migrator.Apply(db, ethdb.StorageMode{})
 	if err != nil {
 		t.Fatal()
 	}
@@ -74,3 +76,96 @@ func TestApplyWithoutInit(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestApplyResumesFromCheckpoint(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	errInterrupted := errors.New("interrupted")
+	interrupt := true
+	var resumedFrom []byte
+	migrator := NewMigrator()
+	migrator.Migrations = []Migration{
+		{
+			"one",
+			func(db ethdb.Database, sm ethdb.StorageMode, progress []byte, checkpoint Checkpoint) error {
+				if !sm.History {
+					t.Fatal("storage mode is not passed to the migration")
+				}
+				resumedFrom = progress
+				batch := db.NewBatch()
+				if err := batch.Put(dbutils.DatabaseInfoBucket, []byte("migrated"), []byte{1}); err != nil {
+					return err
+				}
+				if err := checkpoint(batch, []byte{1}); err != nil {
+					return err
+				}
+				if _, err := batch.Commit(); err != nil {
+					return err
+				}
+				if interrupt {
+					return errInterrupted
+				}
+				return nil
+			},
+		},
+	}
+
+	if err := migrator.Apply(db, ethdb.StorageMode{History: true}); !errors.Is(err, errInterrupted) {
+		t.Fatalf("expected the interrupted migration, got %v", err)
+	}
+	statuses, err := migrator.Status(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].Applied || string(statuses[0].Progress) != string([]byte{1}) {
+		t.Fatalf("unexpected status of the interrupted migration: %+v", statuses[0])
+	}
+
+	interrupt = false
+	if err := migrator.Apply(db, ethdb.StorageMode{History: true}); err != nil {
+		t.Fatal(err)
+	}
+	if string(resumedFrom) != string([]byte{1}) {
+		t.Fatalf("migration is not resumed from the checkpoint, progress %x", resumedFrom)
+	}
+	statuses, err = migrator.Status(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Applied || statuses[0].Progress != nil {
+		t.Fatalf("unexpected status of the applied migration: %+v", statuses[0])
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	migrator := NewMigrator()
+	migrator.Migrations = []Migration{
+		{
+			"one",
+			func(db ethdb.Database, sm ethdb.StorageMode, progress []byte, checkpoint Checkpoint) error {
+				if err := checkpoint(db, []byte{1}); err != nil {
+					return err
+				}
+				return db.Put(dbutils.DatabaseInfoBucket, []byte("migrated"), []byte{1})
+			},
+		},
+	}
+
+	names, err := migrator.DryRun(db, ethdb.StorageMode{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "one" {
+		t.Fatalf("unexpected migrations: %v", names)
+	}
+	if _, err := db.Get(dbutils.DatabaseInfoBucket, []byte("migrated")); err != ethdb.ErrKeyNotFound {
+		t.Fatalf("dry run has written to the database, err %v", err)
+	}
+	statuses, err := migrator.Status(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].Applied || statuses[0].Progress != nil {
+		t.Fatalf("dry run has changed the status: %+v", statuses[0])
+	}
+}
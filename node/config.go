@@ -195,6 +195,14 @@ type Config struct {
 	// empty string means not to start the listener
 	RemoteDbListenAddress string
 
+	// Certificate and key of the remote database listener, empty strings mean plaintext connections
+	RemoteDbTLSCert string
+	RemoteDbTLSKey  string
+	// CA certificate the remote database clients must be signed by, empty string means not to verify clients
+	RemoteDbTLSCACert string
+	// Pre-shared token the remote database clients must present, empty string means no authentication
+	RemoteDbToken string
+
 	staticNodesWarning     bool
 	trustedNodesWarning    bool
 	oldGethResourceWarning bool
@@ -660,6 +660,25 @@ func (n *Node) OpenDatabase(name string) (ethdb.Database, error) {
 	return boltDb, nil
 }
 
+// OpenDatabaseWithFreezer opens the database like OpenDatabase and, if the freezer
+// directory is given, moves the old chain segments from the database into the freezer.
+// A relative freezer directory is resolved in the instance directory.
+func (n *Node) OpenDatabaseWithFreezer(name string, freezer string) (ethdb.Database, error) {
+	db, err := n.OpenDatabase(name)
+	if err != nil || freezer == "" || n.config.DataDir == "" {
+		return db, err
+	}
+	if !filepath.IsAbs(freezer) {
+		freezer = n.config.ResolvePath(freezer)
+	}
+	frdb, err := ethdb.NewDatabaseWithFreezer(db, freezer, "eth/db/"+name+"/")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return frdb, nil
+}
+
 // ResolvePath returns the absolute path of a resource in the instance directory.
 func (n *Node) ResolvePath(x string) string {
 	return n.config.ResolvePath(x)
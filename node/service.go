@@ -17,6 +17,7 @@
 package node
 
 import (
+	"path/filepath"
 	"reflect"
 
 	"github.com/ledgerwatch/turbo-geth/accounts"
@@ -37,10 +38,23 @@ type ServiceContext struct {
 	AccountManager *accounts.Manager // Account manager created by the node.
 }
 
-// OpenDatabaseWithFreezer
-// FIXME: implement the functionality
+// OpenDatabaseWithFreezer opens the database like OpenDatabase and, if the freezer directory is
+// given, moves the old chain segments from the database into the freezer. A relative freezer
+// directory is resolved in the data directory. The ephemeral databases have no freezer.
 func (ctx *ServiceContext) OpenDatabaseWithFreezer(name string, freezer string) (ethdb.Database, error) {
-	return ctx.OpenDatabase(name)
+	db, err := ctx.OpenDatabase(name)
+	if err != nil || freezer == "" || ctx.Config.DataDir == "" {
+		return db, err
+	}
+	if !filepath.IsAbs(freezer) {
+		freezer = ctx.Config.ResolvePath(freezer)
+	}
+	frdb, err := ethdb.NewDatabaseWithFreezer(db, freezer, "eth/db/"+name+"/")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return frdb, nil
 }
 
 // OpenDatabase opens an existing database with the given name (or creates one
@@ -63,21 +77,6 @@ func (ctx *ServiceContext) OpenDatabase(name string) (ethdb.Database, error) {
 	}
 
 	return boltDb, nil
-	/*
-		if err != nil {
-			return nil, err
-		}
-		root := ctx.config.ResolvePath(name)
-
-			FIXME: restore and move to OpenDatabaseWithFreezer
-			switch {
-			case freezer == "":
-				freezer = filepath.Join(root, "ancient")
-			case !filepath.IsAbs(freezer):
-				freezer = ctx.config.ResolvePath(freezer)
-			}
-		return ethdb.NewBoltDatabase(root)
-	*/
 }
 
 // ResolvePath resolves a user path into the data directory if that was relative
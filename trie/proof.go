@@ -0,0 +1,92 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// Prove returns the Merkle proof of the key (EIP-1186): the RLP encodings of the nodes on the path
+// to the key, starting from the root. The nodes shorter than 32 bytes are embedded into their parents,
+// so they are not included. If the key is not in the trie, the proof of its absence is returned.
+// The nodes on the path must be resolved.
+func (t *Trie) Prove(key []byte) ([][]byte, error) {
+	hex := keybytesToHex(key)
+	if t.binary {
+		hex = keyHexToBin(hex)
+	}
+	return t.prove(t.root, hex)
+}
+
+// ProveStorage returns the Merkle proof of the storage key in the storage trie of the account,
+// the proof is empty if the account does not exist or has no storage
+func (t *Trie) ProveStorage(addrHash []byte, key []byte) ([][]byte, error) {
+	hex := keybytesToHex(addrHash)
+	if t.binary {
+		hex = keyHexToBin(hex)
+	}
+	accNode, gotValue := t.getAccount(t.root, hex, 0)
+	if !gotValue {
+		return nil, fmt.Errorf("account %x is not resolved", addrHash)
+	}
+	if accNode == nil {
+		return [][]byte{}, nil
+	}
+	hex = keybytesToHex(key)
+	if t.binary {
+		hex = keyHexToBin(hex)
+	}
+	return t.prove(accNode.storage, hex)
+}
+
+func (t *Trie) prove(root node, hex []byte) ([][]byte, error) {
+	h := t.newHasherFunc()
+	defer returnHasherToPool(h)
+
+	proof := [][]byte{}
+	nd := root
+	pos := 0
+	for nd != nil && pos < len(hex) {
+		switch n := nd.(type) {
+		case hashNode:
+			return nil, fmt.Errorf("node %x on the path to %x is not resolved", []byte(n), hex)
+		case valueNode, *accountNode:
+			return proof, nil
+		}
+
+		enc, err := h.hashChildren(nd, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(proof) == 0 || len(enc) >= common.HashLength {
+			proof = append(proof, common.CopyBytes(enc))
+		}
+
+		switch n := nd.(type) {
+		case *shortNode:
+			if !bytes.HasPrefix(hex[pos:], n.Key) {
+				return proof, nil
+			}
+			pos += len(n.Key)
+			nd = n.Val
+		case *duoNode:
+			i1, i2 := n.childrenIdx()
+			switch hex[pos] {
+			case i1:
+				nd = n.child1
+			case i2:
+				nd = n.child2
+			default:
+				nd = nil
+			}
+			pos++
+		case *fullNode:
+			nd = n.Children[hex[pos]]
+			pos++
+		default:
+			return nil, fmt.Errorf("unexpected node on the path to %x: %T", hex, nd)
+		}
+	}
+	return proof, nil
+}
@@ -0,0 +1,187 @@
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/require"
+)
+
+// checkProof checks that the proof nodes are linked by their hashes from the root,
+// and the last node holds the value
+func checkProof(t *testing.T, root common.Hash, proof [][]byte, value []byte) {
+	require.NotEmpty(t, proof)
+	require.Equal(t, root, crypto.Keccak256Hash(proof[0]), "root of the proof")
+	for i := 1; i < len(proof); i++ {
+		require.True(t, bytes.Contains(proof[i-1], crypto.Keccak256(proof[i])), "node %d is not referenced by its parent", i)
+	}
+	if value != nil {
+		require.True(t, bytes.Contains(proof[len(proof)-1], value), "value is not in the last node")
+	}
+}
+
+func TestProve(t *testing.T) {
+	tr := New(common.Hash{})
+	keys := []string{"doe", "dog", "dogglesworth", "horse", "shaman"}
+	for _, k := range keys {
+		tr.Update(crypto.Keccak256([]byte(k)), []byte(k+" is a value long enough not to be embedded"))
+	}
+	root := tr.Hash()
+
+	for _, k := range keys {
+		proof, err := tr.Prove(crypto.Keccak256([]byte(k)))
+		require.NoError(t, err)
+		checkProof(t, root, proof, []byte(k+" is a value long enough not to be embedded"))
+	}
+
+	// The proof of absence ends at the node where the path diverges
+	proof, err := tr.Prove(crypto.Keccak256([]byte("cat")))
+	require.NoError(t, err)
+	checkProof(t, root, proof, nil)
+
+	// The unresolved nodes can't be proved
+	_, err = New(root).Prove(crypto.Keccak256([]byte("dog")))
+	require.Error(t, err)
+}
+
+func TestProveStorage(t *testing.T) {
+	addrHash := common.HexToHash("1100000000000000000000000000000000000000000000000000000000000000")
+	acc := accounts.NewAccount()
+	acc.Initialised = true
+	acc.Incarnation = 1
+	acc.CodeHash = crypto.Keccak256Hash([]byte("code"))
+	tr := New(common.Hash{})
+	tr.UpdateAccount(addrHash[:], &acc)
+	keys := []common.Hash{crypto.Keccak256Hash([]byte{1}), crypto.Keccak256Hash([]byte{2})}
+	for i, k := range keys {
+		tr.Update(append(addrHash[:], k[:]...), bytes.Repeat([]byte{byte(i + 1)}, 32))
+	}
+	tr.Hash()
+
+	resolved, ok := tr.GetAccount(addrHash[:])
+	require.True(t, ok)
+	for i, k := range keys {
+		proof, err := tr.ProveStorage(addrHash[:], k[:])
+		require.NoError(t, err)
+		checkProof(t, resolved.Root, proof, bytes.Repeat([]byte{byte(i + 1)}, 32))
+	}
+
+	proof, err := tr.ProveStorage(common.HexToHash("12").Bytes(), keys[0][:])
+	require.NoError(t, err)
+	require.Empty(t, proof, "no proof for the storage of a missing account")
+}
+
+// The historical trie is resolved from the current state rewound by the change sets,
+// the intermediate hashes on the paths to the modified keys are not used
+func TestResolveHistoricalAndProve(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	newAccount := func(balance int64) *accounts.Account {
+		acc := accounts.NewAccount()
+		acc.Initialised = true
+		acc.Balance.SetInt64(balance)
+		return &acc
+	}
+	encode := func(acc *accounts.Account) []byte {
+		value := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(value)
+		return value
+	}
+	a := common.HexToHash("1100000000000000000000000000000000000000000000000000000000000000")
+	b := common.HexToHash("1200000000000000000000000000000000000000000000000000000000000000")
+	c := common.HexToHash("2100000000000000000000000000000000000000000000000000000000000000")
+	d := common.HexToHash("2200000000000000000000000000000000000000000000000000000000000000")
+	e := common.HexToHash("2300000000000000000000000000000000000000000000000000000000000000")
+	f := common.HexToHash("2400000000000000000000000000000000000000000000000000000000000000")
+	newContract := func(balance int64) *accounts.Account {
+		acc := newAccount(balance)
+		acc.Incarnation = 1
+		acc.CodeHash = common.HexToHash("c0de")
+		return acc
+	}
+
+	// As of block 1: a=1, b=5, c=3, e=7, contract f=6. Block 2: a=2, c is deleted, d=4 is created, f=8
+	historical := New(common.Hash{})
+	for k, acc := range map[common.Hash]*accounts.Account{a: newAccount(1), b: newAccount(5), c: newAccount(3), e: newAccount(7), f: newContract(6)} {
+		historical.UpdateAccount(k[:], acc)
+	}
+	current := New(common.Hash{})
+	for k, acc := range map[common.Hash]*accounts.Account{a: newAccount(2), b: newAccount(5), d: newAccount(4), e: newAccount(7), f: newContract(8)} {
+		current.UpdateAccount(k[:], acc)
+		require.NoError(t, db.Put(dbutils.CurrentStateBucket, common.CopyBytes(k[:]), encode(acc)))
+	}
+	historicalRoot, currentRoot := historical.Hash(), current.Hash()
+	current.WalkBranchChildren(func(hex []byte, hash common.Hash, _ uint64) {
+		if len(hex) == 0 || len(hex)%2 == 1 || len(hex) >= 2*common.HashLength {
+			return
+		}
+		var key []byte
+		CompressNibbles(hex, &key)
+		require.NoError(t, db.Put(dbutils.IntermediateTrieHashBucket, common.CopyBytes(key), common.CopyBytes(hash[:])))
+	})
+
+	cs := changeset.NewAccountChangeSet()
+	require.NoError(t, cs.Add(a[:], encode(newAccount(1))))
+	require.NoError(t, cs.Add(c[:], encode(newAccount(3))))
+	require.NoError(t, cs.Add(d[:], []byte{}))
+	// The code hashes of the contracts are not kept in the change sets
+	contract := newContract(6)
+	contract.CodeHash = EmptyCodeHash
+	require.NoError(t, cs.Add(f[:], encode(contract)))
+	require.NoError(t, db.Put(dbutils.ContractCodeBucket, dbutils.GenerateStoragePrefix(f[:], 1), common.HexToHash("c0de").Bytes()))
+	v, err := changeset.EncodeAccounts(cs)
+	require.NoError(t, err)
+	require.NoError(t, db.Put(dbutils.AccountChangeSetBucket, dbutils.EncodeTimestamp(2), v))
+
+	tr := New(currentRoot)
+	r := NewResolver(0, 2)
+	r.AddRequest(tr.NewResolveRequest(nil, []byte{}, 0, currentRoot[:]))
+	require.NoError(t, r.ResolveWithDb(db, 2, false))
+
+	tr = New(historicalRoot)
+	r = NewResolver(0, 1)
+	r.SetHistorical(true)
+	var hex []byte
+	DecompressNibbles(a[:], &hex)
+	r.AddRequest(tr.NewResolveRequest(nil, hex, 0, historicalRoot[:]))
+	require.NoError(t, r.ResolveWithDb(db, 1, false))
+
+	proof, err := tr.Prove(a[:])
+	require.NoError(t, err)
+	expected, err := historical.Prove(a[:])
+	require.NoError(t, err)
+	require.Equal(t, expected, proof)
+	checkProof(t, historicalRoot, proof, nil)
+
+	tr = New(historicalRoot)
+	r = NewResolver(0, 1)
+	r.SetHistorical(true)
+	hex = nil
+	DecompressNibbles(f[:], &hex)
+	r.AddRequest(tr.NewResolveRequest(nil, hex, 0, historicalRoot[:]))
+	require.NoError(t, r.ResolveWithDb(db, 1, false))
+	proof, err = tr.Prove(f[:])
+	require.NoError(t, err)
+	expected, err = historical.Prove(f[:])
+	require.NoError(t, err)
+	require.Equal(t, expected, proof)
+
+	// The overlay collected once gives the same proofs in the following resolves
+	overlay, err := NewStateOverlay(db, 1)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		tr = New(historicalRoot)
+		r = NewResolver(0, 1)
+		r.SetOverlay(overlay)
+		r.AddRequest(tr.NewResolveRequest(nil, hex, 0, historicalRoot[:]))
+		require.NoError(t, r.ResolveWithDb(db, 1, false))
+		proof, err = tr.Prove(f[:])
+		require.NoError(t, err)
+		require.Equal(t, expected, proof)
+	}
+}
@@ -19,7 +19,9 @@ type ResolveFunc func(*Resolver) error
 // See also ResolveRequest in trie.go
 type Resolver struct {
 	historical       bool
-	collectWitnesses bool // if true, stores witnesses for all the subtries that are being resolved
+	overlay          *StateOverlay // State as of the block for the historical resolve, collected by the resolve if nil
+	collectWitnesses bool          // if true, stores witnesses for all the subtries that are being resolved
+	ignoreIH         bool          // if true, IntermediateTrieHashBucket is not used, all the hashes are computed from the state
 	blockNr          uint64
 	topLevels        int // How many top levels of the trie to keep (not roll into hashes)
 	requests         []*ResolveRequest
@@ -45,6 +47,8 @@ func (tr *Resolver) Reset(topLevels int, blockNr uint64) {
 	tr.witnesses = nil
 	tr.collectWitnesses = false
 	tr.historical = false
+	tr.overlay = nil
+	tr.ignoreIH = false
 }
 
 func (tr *Resolver) CollectWitnesses(c bool) {
@@ -62,6 +66,19 @@ func (tr *Resolver) SetHistorical(h bool) {
 	tr.historical = h
 }
 
+// SetOverlay makes the resolve historical and lays the given state over the current one, instead of
+// collecting it from the history
+func (tr *Resolver) SetOverlay(o *StateOverlay) {
+	tr.historical = true
+	tr.overlay = o
+}
+
+// IgnoreIntermediateHashes makes the resolver compute the hashes of all the subtries from the state,
+// for when the entries of IntermediateTrieHashBucket can't be trusted (e.g. while they are being regenerated)
+func (tr *Resolver) IgnoreIntermediateHashes(ignore bool) {
+	tr.ignoreIH = ignore
+}
+
 // AddCodeRequest add a request for code resolution
 func (tr *Resolver) AddCodeRequest(req *ResolveRequestForCode) {
 	tr.codeRequests = append(tr.codeRequests, req)
@@ -171,6 +188,8 @@ func (tr *Resolver) ResolveStateful(db ethdb.Database, blockNr uint64, trace boo
 
 	sort.Stable(tr)
 	resolver := NewResolverStateful(tr.topLevels, tr.requests, hf)
+	resolver.ignoreIH = tr.ignoreIH
+	resolver.overlay = tr.overlay
 	if err := resolver.RebuildTrie(db, blockNr, tr.historical, trace); err != nil {
 		return err
 	}
@@ -194,7 +213,8 @@ func hookSubtrie(currentReq *ResolveRequest, hbRoot node, hbHash common.Hash) er
 		if err != nil {
 			return err
 		}
-		currentReq.NodeRLP = h
+		// The hasher's buffer is reused once it is returned to the pool
+		currentReq.NodeRLP = common.CopyBytes(h)
 	}
 
 	var hookKey []byte
@@ -60,6 +60,10 @@ type ResolverStateful struct {
 
 	seenAccount        bool
 	accAddrHashWithInc []byte // valid only if `seenAccount` is true
+
+	overlay  *StateOverlay // State modified after the block, when resolving the historical trie
+	stale    *ResolveSet   // Paths to the keys of the overlay
+	ignoreIH bool          // IntermediateTrieHashBucket is not used
 }
 
 func NewResolverStateful(topLevels int, requests []*ResolveRequest, hookFunction hookFunction) *ResolverStateful {
@@ -102,6 +106,8 @@ func (tr *ResolverStateful) Reset(topLevels int, requests []*ResolveRequest, hoo
 	tr.groupsStorage = tr.groupsStorage[:0]
 	tr.wasIHStorage = false
 	tr.seenAccount = false
+	tr.overlay = nil
+	tr.stale = nil
 }
 
 func (tr *ResolverStateful) PopRoots() []node {
@@ -376,13 +382,23 @@ func (tr *ResolverStateful) RebuildTrie(db ethdb.Database, blockNr uint64, histo
 		return fmt.Errorf("only Bolt supported yet, given: %T", db)
 	}
 
-	var err error
 	if historical {
-		panic("historical data is not implemented")
+		// The current state is rewound to the block on the fly, the intermediate hashes of the subtries
+		// which have not been modified since the block are still valid
+		if tr.overlay == nil {
+			overlay, err := NewStateOverlay(db, blockNr)
+			if err != nil {
+				return err
+			}
+			tr.overlay = overlay
+		}
+		tr.stale = tr.overlay.staleSet()
 	} else {
-		err = tr.MultiWalk2(boltDB, startkeys, fixedbits, tr.WalkerAccount, tr.WalkerStorage, true)
+		tr.overlay = nil
+		tr.stale = nil
 	}
 
+	err := tr.MultiWalk2(boltDB, startkeys, fixedbits, tr.WalkerAccount, tr.WalkerStorage, true)
 	if err != nil {
 		return err
 	}
@@ -688,10 +704,13 @@ func (tr *ResolverStateful) MultiWalk2(db *bolt.DB, startkeys [][]byte, fixedbit
 	err := db.View(func(tx *bolt.Tx) error {
 		ihBucket := tx.Bucket(dbutils.IntermediateTrieHashBucket)
 		var ih *bolt.Cursor
-		if ihBucket != nil {
+		if ihBucket != nil && !tr.ignoreIH {
 			ih = ihBucket.Cursor()
 		}
-		c := tx.Bucket(dbutils.CurrentStateBucket).Cursor()
+		var c stateCursor = tx.Bucket(dbutils.CurrentStateBucket).Cursor()
+		if tr.overlay != nil {
+			c = tr.overlay.cursor(c)
+		}
 
 		var k, v []byte
 		for k, v = c.Seek(startkey); k != nil; k, v = c.Next() {
@@ -753,7 +772,9 @@ func (tr *ResolverStateful) MultiWalk2(db *bolt.DB, startkeys [][]byte, fixedbit
 								break
 							}
 						}
-						ihK, ihV = ih.SeekTo(startkey)
+						if ih != nil {
+							ihK, ihV = ih.SeekTo(startkey)
+						}
 						if tr.trace {
 							fmt.Printf("c.SeekTo(%x) = %x\n", startkey, k)
 							//fmt.Printf("[wasIH = %t], ih.SeekTo(%x) = %x\n", isIH, startkey, ihK)
@@ -823,16 +844,17 @@ func (tr *ResolverStateful) MultiWalk2(db *bolt.DB, startkeys [][]byte, fixedbit
 				continue
 			}
 
+			ihHex := minKeyAsNibbles.B
 			if len(ihK) > common.HashLength {
-				canUseIntermediateHash = tr.rss[rangeIdx].HashOnly(append(minKeyAsNibbles.B[:common.HashLength*2], minKeyAsNibbles.B[common.HashLength*2+16:]...))
-				if tr.trace {
-					fmt.Printf("tr.rss[%d].HashOnly(%x)=%t\n", rangeIdx, minKeyAsNibbles.B[:], canUseIntermediateHash)
-				}
-			} else {
-				canUseIntermediateHash = tr.rss[rangeIdx].HashOnly(minKeyAsNibbles.B[:])
-				if tr.trace {
-					fmt.Printf("tr.rss[%d].HashOnly(%x)=%t\n", rangeIdx, minKeyAsNibbles.B[:], canUseIntermediateHash)
-				}
+				ihHex = append(minKeyAsNibbles.B[:common.HashLength*2], minKeyAsNibbles.B[common.HashLength*2+16:]...)
+			}
+			canUseIntermediateHash = tr.rss[rangeIdx].HashOnly(ihHex)
+			if tr.trace {
+				fmt.Printf("tr.rss[%d].HashOnly(%x)=%t\n", rangeIdx, ihHex, canUseIntermediateHash)
+			}
+			if canUseIntermediateHash && tr.overlay != nil {
+				// Storage of the account is not seen if the account is skipped, as it did not exist at the block
+				canUseIntermediateHash = tr.stale.HashOnly(ihHex) && (len(ihK) <= common.HashLength || tr.seenAccount)
 			}
 
 			if !canUseIntermediateHash { // can't use ih as is, need go to children
@@ -0,0 +1,192 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// stateCursor is the part of bolt.Cursor used by MultiWalk2 to iterate over CurrentStateBucket
+type stateCursor interface {
+	Seek(seek []byte) ([]byte, []byte)
+	SeekTo(seek []byte) ([]byte, []byte)
+	Next() ([]byte, []byte)
+}
+
+// StateOverlay holds the keys modified after the block the trie is resolved for, with their values
+// as of the block (as returned by RewindData), to be laid over the current state. It is not modified
+// by the resolvers, so it can be shared by them until the current state changes
+type StateOverlay struct {
+	keys            [][]byte // Sorted keys of CurrentStateBucket
+	values          [][]byte // Values as of the block, empty - the key did not exist
+	deletedAccounts map[string]struct{}
+	stale           *ResolveSet // Paths to the modified keys, the intermediate hashes on them can't be used
+}
+
+// NewStateOverlay collects the keys modified after the block from the history
+func NewStateOverlay(db ethdb.Database, blockNr uint64) (*StateOverlay, error) {
+	accountMap, storageMap, err := db.RewindData(math.MaxUint64, blockNr)
+	if err != nil {
+		return nil, fmt.Errorf("collecting keys modified after block %d: %w", blockNr, err)
+	}
+	if err = restoreCodeHashes(db, accountMap); err != nil {
+		return nil, err
+	}
+	return newStateOverlay(accountMap, storageMap), nil
+}
+
+func newStateOverlay(accountMap, storageMap map[string][]byte) *StateOverlay {
+	o := &StateOverlay{
+		keys:            make([][]byte, 0, len(accountMap)+len(storageMap)),
+		deletedAccounts: make(map[string]struct{}),
+		stale:           NewResolveSet(0),
+	}
+	for key, value := range accountMap {
+		o.keys = append(o.keys, []byte(key))
+		if len(value) == 0 {
+			o.deletedAccounts[key] = struct{}{}
+		}
+		var hex []byte
+		DecompressNibbles([]byte(key), &hex)
+		o.stale.AddHex(hex)
+	}
+	for key := range storageMap {
+		o.keys = append(o.keys, []byte(key))
+		// The incarnation is not a part of the path in the trie
+		var hex, storageHex []byte
+		DecompressNibbles([]byte(key)[:common.HashLength], &hex)
+		DecompressNibbles([]byte(key)[common.HashLength+common.IncarnationLength:], &storageHex)
+		o.stale.AddHex(append(hex, storageHex...))
+	}
+	sort.Slice(o.keys, func(i, j int) bool { return bytes.Compare(o.keys[i], o.keys[j]) < 0 })
+	o.stale.ensureInited()
+	o.values = make([][]byte, len(o.keys))
+	for i, key := range o.keys {
+		if len(key) > common.HashLength {
+			o.values[i] = storageMap[string(key)]
+		} else {
+			o.values[i] = accountMap[string(key)]
+		}
+	}
+	return o
+}
+
+// restoreCodeHashes sets the code hashes of the contracts rewound by RewindData, the change sets do not keep them
+func restoreCodeHashes(db ethdb.Getter, accountMap map[string][]byte) error {
+	for key, value := range accountMap {
+		if len(value) == 0 {
+			continue
+		}
+		var acc accounts.Account
+		if err := acc.DecodeForStorage(value); err != nil {
+			return err
+		}
+		if acc.Incarnation == 0 || !acc.IsEmptyCodeHash() {
+			continue
+		}
+		codeHash, err := db.Get(dbutils.ContractCodeBucket, dbutils.GenerateStoragePrefix([]byte(key), acc.Incarnation))
+		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return err
+		}
+		if len(codeHash) == 0 {
+			continue
+		}
+		acc.CodeHash = common.BytesToHash(codeHash)
+		value = make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(value)
+		accountMap[key] = value
+	}
+	return nil
+}
+
+// staleSet returns the copy of the paths to the modified keys for one resolve, as ResolveSet
+// keeps its position between the lookups
+func (o *StateOverlay) staleSet() *ResolveSet {
+	stale := *o.stale
+	return &stale
+}
+
+func (o *StateOverlay) cursor(c stateCursor) *overlayCursor {
+	return &overlayCursor{c: c, o: o}
+}
+
+// overlayCursor merges the cursor over the current state with the overlay, the overlay wins
+// on the equal keys. The deleted keys and the storage of the deleted accounts are skipped.
+type overlayCursor struct {
+	c stateCursor
+	o *StateOverlay
+	i int // Position in the overlay
+
+	k, v               []byte // Position of c
+	advanceC, advanceO bool   // Which of the sources the current key is taken from
+}
+
+func (oc *overlayCursor) Seek(seek []byte) ([]byte, []byte) {
+	oc.k, oc.v = oc.c.Seek(seek)
+	oc.i = sort.Search(len(oc.o.keys), func(i int) bool { return bytes.Compare(oc.o.keys[i], seek) >= 0 })
+	return oc.current()
+}
+
+func (oc *overlayCursor) SeekTo(seek []byte) ([]byte, []byte) {
+	oc.k, oc.v = oc.c.SeekTo(seek)
+	oc.i = sort.Search(len(oc.o.keys), func(i int) bool { return bytes.Compare(oc.o.keys[i], seek) >= 0 })
+	return oc.current()
+}
+
+func (oc *overlayCursor) Next() ([]byte, []byte) {
+	oc.advance()
+	return oc.current()
+}
+
+func (oc *overlayCursor) advance() {
+	if oc.advanceC {
+		oc.k, oc.v = oc.c.Next()
+	}
+	if oc.advanceO {
+		oc.i++
+	}
+}
+
+func (oc *overlayCursor) current() ([]byte, []byte) {
+	for {
+		var k, v []byte
+		oc.advanceC, oc.advanceO = false, false
+		hasOverlay := oc.i < len(oc.o.keys)
+		switch {
+		case oc.k == nil && !hasOverlay:
+			return nil, nil
+		case !hasOverlay:
+			oc.advanceC = true
+		case oc.k == nil:
+			oc.advanceO = true
+		default:
+			cmp := bytes.Compare(oc.k, oc.o.keys[oc.i])
+			oc.advanceC = cmp <= 0
+			oc.advanceO = cmp >= 0
+		}
+		if oc.advanceO {
+			k, v = oc.o.keys[oc.i], oc.o.values[oc.i]
+		} else {
+			k, v = oc.k, oc.v
+		}
+
+		if len(v) == 0 {
+			oc.advance()
+			continue
+		}
+		if len(k) > common.HashLength {
+			if _, ok := oc.o.deletedAccounts[string(k[:common.HashLength])]; ok {
+				oc.advance()
+				continue
+			}
+		}
+		return k, v
+	}
+}
@@ -1233,6 +1233,108 @@ func (t *Trie) EvictNode(hex []byte) {
 	}
 }
 
+// WalkBranchChildren calls the walker for each child of the loaded branch nodes (duoNode and fullNode)
+// which is itself a loaded branch node, deeper children first. The walker receives the prefix (in HEX encoding,
+// without terminator) at which the child resides, the hash of the child, and the incarnation of the contract
+// if the child belongs to a storage trie. Other children are skipped, because their position changes when
+// their siblings get deleted, and so do children embedded into their parents (i.e. with RLP shorter than 32 bytes).
+// The trie needs to be hashed (see Hash) before calling this function.
+func (t *Trie) WalkBranchChildren(walker func(hex []byte, hash common.Hash, incarnation uint64)) {
+	t.walkBranchChildren(t.root, []byte{}, 0, walker)
+}
+
+func (t *Trie) walkBranchChildren(n node, hex []byte, incarnation uint64, walker func([]byte, common.Hash, uint64)) {
+	switch n := n.(type) {
+	case *shortNode:
+		if _, ok := n.Val.(valueNode); ok {
+			return
+		}
+		h := n.Key
+		// Remove terminator
+		if h[len(h)-1] == 16 {
+			h = h[:len(h)-1]
+		}
+		t.walkBranchChildren(n.Val, concat(hex, h...), incarnation, walker)
+	case *duoNode:
+		i1, i2 := n.childrenIdx()
+		t.walkBranchChild(n.child1, concat(hex, i1), incarnation, walker)
+		t.walkBranchChild(n.child2, concat(hex, i2), incarnation, walker)
+	case *fullNode:
+		for i, child := range n.Children[:16] {
+			if child != nil {
+				t.walkBranchChild(child, concat(hex, byte(i)), incarnation, walker)
+			}
+		}
+	case *accountNode:
+		if n.storage != nil {
+			t.walkBranchChildren(n.storage, hex, n.Incarnation, walker)
+		}
+	}
+}
+
+func (t *Trie) walkBranchChild(child node, hex []byte, incarnation uint64, walker func([]byte, common.Hash, uint64)) {
+	t.walkBranchChildren(child, hex, incarnation, walker)
+	switch child.(type) {
+	case *duoNode, *fullNode:
+	default:
+		return
+	}
+	if ref := child.reference(); len(ref) == common.HashLength {
+		walker(hex, common.BytesToHash(ref), incarnation)
+	}
+}
+
+// WalkLoadedLeaves calls onAccount for every account and onStorage for every storage item loaded into the trie,
+// in the order of their keys. Subtries represented by hash nodes are skipped.
+// The code of the account is passed to onAccount if it is loaded, nil otherwise.
+func (t *Trie) WalkLoadedLeaves(
+	onAccount func(addrHash []byte, acc *accounts.Account, code []byte) error,
+	onStorage func(addrHash []byte, keyHash []byte, value []byte) error,
+) error {
+	return t.walkLoadedLeaves(t.root, []byte{}, onAccount, onStorage)
+}
+
+func (t *Trie) walkLoadedLeaves(
+	n node, hex []byte,
+	onAccount func([]byte, *accounts.Account, []byte) error,
+	onStorage func([]byte, []byte, []byte) error,
+) error {
+	switch n := n.(type) {
+	case *shortNode:
+		h := n.Key
+		// Remove terminator
+		if h[len(h)-1] == 16 {
+			h = h[:len(h)-1]
+		}
+		return t.walkLoadedLeaves(n.Val, concat(hex, h...), onAccount, onStorage)
+	case *duoNode:
+		i1, i2 := n.childrenIdx()
+		if err := t.walkLoadedLeaves(n.child1, concat(hex, i1), onAccount, onStorage); err != nil {
+			return err
+		}
+		return t.walkLoadedLeaves(n.child2, concat(hex, i2), onAccount, onStorage)
+	case *fullNode:
+		for i, child := range n.Children[:16] {
+			if child != nil {
+				if err := t.walkLoadedLeaves(child, concat(hex, byte(i)), onAccount, onStorage); err != nil {
+					return err
+				}
+			}
+		}
+	case *accountNode:
+		if err := onAccount(hexToKeybytes(hex), &n.Account, n.code); err != nil {
+			return err
+		}
+		if n.storage != nil {
+			return t.walkLoadedLeaves(n.storage, hex, onAccount, onStorage)
+		}
+	case valueNode:
+		key := hexToKeybytes(hex)
+		return onStorage(key[:common.HashLength], key[common.HashLength:], n)
+	}
+	return nil
+}
+
 func (t *Trie) TrieSize() int {
 	return calcSubtreeSize(t.root)
 }
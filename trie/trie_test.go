@@ -893,3 +893,72 @@ func TestCodeNodeUpdateAccountNoChangeCodeHash(t *testing.T) {
 	assert.Equal(t, codeValue1, value, "the value should NOT reset after account's non codehash had changed")
 	assert.True(t, gotValue, "should indicate that the code is still in the cache")
 }
+
+func TestWalkLoadedLeaves(t *testing.T) {
+	type storageItem struct {
+		addrHash, keyHash, value []byte
+	}
+	code := []byte{0x60, 0x00, 0x60, 0x00, 0xfd}
+	addrHash1 := crypto.Keccak256([]byte{1})
+	addrHash2 := crypto.Keccak256([]byte{2})
+	keyHash1 := crypto.Keccak256([]byte{3})
+	keyHash2 := crypto.Keccak256([]byte{4})
+
+	acc1 := accounts.NewAccount()
+	acc1.Balance.SetUint64(1000)
+	acc2 := accounts.NewAccount()
+	acc2.Nonce = 1
+	acc2.CodeHash = crypto.Keccak256Hash(code)
+
+	tr := New(common.Hash{})
+	tr.UpdateAccount(addrHash1, &acc1)
+	tr.UpdateAccount(addrHash2, &acc2)
+	assert.NoError(t, tr.UpdateAccountCode(addrHash2, codeNode(code)))
+	tr.Update(append(common.CopyBytes(addrHash2), keyHash1...), []byte{0x2a})
+	tr.Update(append(common.CopyBytes(addrHash2), keyHash2...), []byte{0x01, 0xc9})
+	root := tr.Hash()
+
+	walk := func(tr *Trie) (map[string]accounts.Account, map[string][]byte, []storageItem) {
+		accs := make(map[string]accounts.Account)
+		codes := make(map[string][]byte)
+		var storage []storageItem
+		assert.NoError(t, tr.WalkLoadedLeaves(
+			func(addrHash []byte, acc *accounts.Account, code []byte) error {
+				accs[string(addrHash)] = *acc
+				codes[string(addrHash)] = code
+				return nil
+			},
+			func(addrHash []byte, keyHash []byte, value []byte) error {
+				storage = append(storage, storageItem{addrHash, keyHash, value})
+				return nil
+			},
+		))
+		return accs, codes, storage
+	}
+
+	expectedStorage := []storageItem{{addrHash2, keyHash1, []byte{0x2a}}, {addrHash2, keyHash2, []byte{0x01, 0xc9}}}
+	if bytes.Compare(keyHash1, keyHash2) > 0 {
+		expectedStorage[0], expectedStorage[1] = expectedStorage[1], expectedStorage[0]
+	}
+
+	// The leaves survive the witness round trip
+	witness, err := tr.ExtractWitness(1, false, nil)
+	assert.NoError(t, err)
+	tr1, err := BuildTrieFromWitness(witness, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, root, tr1.Hash())
+
+	for _, tr := range []*Trie{tr, tr1} {
+		accs, codes, storage := walk(tr)
+		assert.Equal(t, 2, len(accs))
+		acc1 := accs[string(addrHash1)]
+		assert.Equal(t, uint64(1000), acc1.Balance.Uint64())
+		assert.Equal(t, EmptyRoot, accs[string(addrHash1)].Root)
+		assert.Nil(t, codes[string(addrHash1)])
+		assert.Equal(t, uint64(1), accs[string(addrHash2)].Nonce)
+		assert.Equal(t, acc2.CodeHash, accs[string(addrHash2)].CodeHash)
+		assert.NotEqual(t, EmptyRoot, accs[string(addrHash2)].Root)
+		assert.Equal(t, code, codes[string(addrHash2)])
+		assert.Equal(t, expectedStorage, storage)
+	}
+}
@@ -10,6 +10,11 @@ func (t *Trie) ExtractWitness(blockNr uint64, trace bool, rs *ResolveSet) (*Witn
 	return extractWitnessFromRootNode(t.root, blockNr, trace, h)
 }
 
+// ExtractWitnessHashOnly is ExtractWitness which hashes the subtries chosen by hashOnly instead of a resolve set
+func (t *Trie) ExtractWitnessHashOnly(blockNr uint64, trace bool, hashOnly HashOnly) (*Witness, error) {
+	return extractWitnessFromRootNode(t.root, blockNr, trace, hashOnly)
+}
+
 func (t *Trie) ExtractWitnessForPrefix(prefix []byte, blockNr uint64, trace bool, rs *ResolveSet) (*Witness, error) {
 	foundNode, _, found, _ := t.getNode(prefix, false)
 	if !found {